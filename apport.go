@@ -0,0 +1,144 @@
+package csi
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/vosst/csi/crash"
+)
+
+// defaultPath is the PATH that apport considers uninteresting.
+const defaultPath = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin:/usr/games:/usr/local/games"
+
+// safeEnvironmentVariables lists all environment variables that are reported
+// verbatim in the ProcEnviron field. All other variables are dropped to avoid
+// leaking private information.
+var safeEnvironmentVariables = map[string]struct{}{
+	"SHELL":             struct{}{},
+	"TERM":              struct{}{},
+	"LANGUAGE":          struct{}{},
+	"LANG":              struct{}{},
+	"LC_CTYPE":          struct{}{},
+	"LC_COLLATE":        struct{}{},
+	"LC_TIME":           struct{}{},
+	"LC_NUMERIC":        struct{}{},
+	"LC_MONETARY":       struct{}{},
+	"LC_MESSAGES":       struct{}{},
+	"LC_PAPER":          struct{}{},
+	"LC_NAME":           struct{}{},
+	"LC_ADDRESS":        struct{}{},
+	"LC_TELEPHONE":      struct{}{},
+	"LC_MEASUREMENT":    struct{}{},
+	"LC_IDENTIFICATION": struct{}{},
+	"LOCPATH":           struct{}{},
+}
+
+// presentEnvironmentVariables lists all environment variables whose presence,
+// but not their value, is reported in the ProcEnviron field.
+var presentEnvironmentVariables = []string{"LD_LIBRARY_PATH", "LD_PRELOAD", "XDG_RUNTIME_DIR"}
+
+// apportEnviron renders env in the format of apport's ProcEnviron field,
+// only including variables known to be safe.
+func apportEnviron(env map[string]string) string {
+	lines := []string{}
+
+	for k, v := range env {
+		if _, present := safeEnvironmentVariables[k]; present {
+			lines = append(lines, fmt.Sprintf("%s=%s", k, v))
+		}
+	}
+
+	if path, present := env["PATH"]; present {
+		switch {
+		case path == defaultPath:
+			lines = append(lines, fmt.Sprintf("PATH=%s", path))
+		case strings.Contains(path, "/home") || strings.Contains(path, "/tmp"):
+			lines = append(lines, "PATH=(custom, user)")
+		default:
+			lines = append(lines, "PATH=(custom, no user)")
+		}
+	}
+
+	for _, k := range presentEnvironmentVariables {
+		if _, present := env[k]; present {
+			lines = append(lines, fmt.Sprintf("%s=<set>", k))
+		}
+	}
+
+	sort.Strings(lines)
+	return strings.Join(lines, "\n")
+}
+
+// apportCmdline renders cmdline in the format of apport's ProcCmdline field,
+// escaping backslashes and spaces within arguments like apport does, such
+// that arguments remain distinguishable.
+func apportCmdline(cmdline []string) string {
+	args := make([]string, len(cmdline))
+	for i, arg := range cmdline {
+		args[i] = strings.Replace(strings.Replace(arg, `\`, `\\`, -1), " ", `\ `, -1)
+	}
+
+	return strings.Join(args, " ")
+}
+
+// ApportReport maps the crash report to the standard fields of an apport
+// crash report, such that it can be handled by crash.ReportPersister
+// implementations and apport's tooling.
+//
+// Fields are only set if the corresponding information is available,
+// including the signatures used for detecting duplicates.
+func (self CrashReport) ApportReport() crash.Report {
+	report := crash.Report{"ProblemType": []string{"Crash"}}
+
+	set := func(key, value string) {
+		if len(value) > 0 {
+			report[key] = []string{value}
+		}
+	}
+
+	if self.Signal != 0 {
+		set("Signal", fmt.Sprint(int(self.Signal)))
+	}
+
+	if !self.When.IsZero() {
+		set("Date", self.When.Format(time.ANSIC))
+	}
+
+	if sr := self.System; sr != nil {
+		set("Architecture", string(sr.Architecture))
+		set("DistroRelease", strings.TrimSpace(sr.OS.Name+" "+sr.OS.Release))
+		set("Uname", strings.TrimSpace(strings.Join([]string{sr.OS.Kernel.Name, sr.OS.Kernel.Release, sr.OS.Kernel.Machine}, " ")))
+	}
+
+	if pr := self.Process; pr != nil {
+		set("ExecutablePath", string(pr.Exe))
+		set("ProcCmdline", apportCmdline(pr.Cmdline))
+		set("ProcCwd", string(pr.Cwd))
+		set("ProcEnviron", apportEnviron(pr.Env))
+
+		maps := make([]string, len(pr.Maps))
+		for i, mr := range pr.Maps {
+			maps[i] = mr.String()
+		}
+		set("ProcMaps", strings.Join(maps, "\n"))
+
+		if len(pr.Status.Name) > 0 {
+			set("ProcStatus", pr.Status.String())
+		}
+
+		if pr.Bundle != nil {
+			set("Package", strings.TrimSpace(pr.Bundle.Name()+" "+pr.Bundle.Version()))
+			set("PackageArchitecture", pr.Bundle.Arch())
+		}
+	}
+
+	if len(self.Stacktrace) > 0 {
+		set("Stacktrace", self.Stacktrace.String())
+		set("StacktraceTop", self.Stacktrace.Top())
+	}
+
+	report.AddSignatures()
+	return report
+}
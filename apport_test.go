@@ -0,0 +1,127 @@
+package csi
+
+import (
+	"bytes"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vosst/csi/crash"
+	"github.com/vosst/csi/pkg"
+	"github.com/vosst/csi/pkg/debian"
+	"github.com/vosst/csi/proc/pid"
+	"github.com/vosst/csi/stacktrace"
+)
+
+const testMaps = `00400000-00754000 r-xp 00000000 08:02 404368                             /usr/bin/python3.4
+011c0000-01492000 rw-p 00000000 00:00 0                                  [heap]
+7f8ac75f3000-7f8ac7673000 rw-p 00000000 00:00 0
+7f8ac7673000-7f8ac7694000 r-xp 00000000 fd:01 661266                     /lib/x86_64-linux-gnu/liblzma.so.5.0.0
+`
+
+func testCrashReport() CrashReport {
+	maps, _ := pid.NewMapsFromReader(strings.NewReader(testMaps))
+
+	sr := SystemReport{HostName: "test", Architecture: pkg.ArchAmd64}
+	sr.OS.Name = "Ubuntu"
+	sr.OS.Release = "14.04"
+	sr.OS.Kernel.Name = "Linux"
+	sr.OS.Kernel.Release = "3.13.0-63-generic"
+	sr.OS.Kernel.Machine = "x86_64"
+
+	pr := ProcessReport{
+		Bundle:  debian.Package{"Package": []string{"python3.4"}, "Version": []string{"3.4.0-2ubuntu1.1"}, "Architecture": []string{"amd64"}},
+		Cmdline: pid.Cmdline{"/usr/bin/python3", "/usr/share/apport/apportcheckresume"},
+		Cwd:     pid.Cwd("/"),
+		Env:     pid.Environ{"TERM": "linux", "PATH": "/home/user/bin:/usr/bin", "HOME": "/home/user", "SECRET": "42"},
+		Exe:     pid.Exe("/usr/bin/python3.4"),
+		Maps:    maps,
+	}
+
+	st := stacktrace.Stacktrace{
+		{PC: 0x7f8ac7675000, Function: "lzma_code", Module: "/lib/x86_64-linux-gnu/liblzma.so.5.0.0"},
+		{PC: 0x4a1b2c, Function: "main", File: "../Modules/main.c", Line: 42, Module: "/usr/bin/python3.4"},
+	}
+
+	return CrashReport{syscall.SIGSEGV, 0, time.Date(2015, time.September, 4, 7, 59, 46, 0, time.UTC), &sr, &pr, st}
+}
+
+func TestApportReportFillsStandardFields(t *testing.T) {
+	report := testCrashReport().ApportReport()
+
+	assert.Equal(t, []string{"Crash"}, report["ProblemType"])
+	assert.Equal(t, []string{"11"}, report["Signal"])
+	assert.Equal(t, []string{"Fri Sep  4 07:59:46 2015"}, report["Date"])
+	assert.Equal(t, []string{"amd64"}, report["Architecture"])
+	assert.Equal(t, []string{"Ubuntu 14.04"}, report["DistroRelease"])
+	assert.Equal(t, []string{"Linux 3.13.0-63-generic x86_64"}, report["Uname"])
+	assert.Equal(t, []string{"/usr/bin/python3.4"}, report["ExecutablePath"])
+	assert.Equal(t, []string{"/usr/bin/python3 /usr/share/apport/apportcheckresume"}, report["ProcCmdline"])
+	assert.Equal(t, []string{"/"}, report["ProcCwd"])
+	assert.Equal(t, []string{"python3.4 3.4.0-2ubuntu1.1"}, report["Package"])
+	assert.Equal(t, []string{"amd64"}, report["PackageArchitecture"])
+}
+
+func TestApportReportOnlyIncludesSafeEnvironmentVariables(t *testing.T) {
+	report := testCrashReport().ApportReport()
+	assert.Equal(t, []string{"PATH=(custom, user)\nTERM=linux"}, report["ProcEnviron"])
+}
+
+func TestApportReportOnlyReportsPresenceOfLibraryPathsAndUserPaths(t *testing.T) {
+	cr := testCrashReport()
+	cr.Process.Env = pid.Environ{"LD_PRELOAD": "/home/user/hook.so", "LD_LIBRARY_PATH": "/opt/lib", "PATH": "/tmp/bin:/usr/bin"}
+
+	report := cr.ApportReport()
+	assert.Equal(t, []string{"LD_LIBRARY_PATH=<set>\nLD_PRELOAD=<set>\nPATH=(custom, user)"}, report["ProcEnviron"])
+
+	cr.Process.Env = pid.Environ{"PATH": "/opt/bin:/usr/bin"}
+	report = cr.ApportReport()
+	assert.Equal(t, []string{"PATH=(custom, no user)"}, report["ProcEnviron"])
+}
+
+func TestApportReportEscapesSpacesAndBackslashesInArguments(t *testing.T) {
+	cr := testCrashReport()
+	cr.Process.Cmdline = pid.Cmdline{"/usr/bin/vim", "my notes.txt", `C:\dir`, "plain"}
+
+	report := cr.ApportReport()
+	assert.Equal(t, []string{`/usr/bin/vim my\ notes.txt C:\\dir plain`}, report["ProcCmdline"])
+}
+
+func TestApportReportRendersMapsInProcFormat(t *testing.T) {
+	report := testCrashReport().ApportReport()
+	assert.Equal(t, []string{strings.TrimSuffix(testMaps, "\n")}, report["ProcMaps"])
+}
+
+func TestApportReportIncludesStacktrace(t *testing.T) {
+	report := testCrashReport().ApportReport()
+	assert.Equal(t, []string{
+		"#0  0x00007f8ac7675000 in lzma_code () from /lib/x86_64-linux-gnu/liblzma.so.5.0.0\n" +
+			"#1  0x00000000004a1b2c in main () at ../Modules/main.c:42"}, report["Stacktrace"])
+	assert.Equal(t, []string{
+		"lzma_code () from /lib/x86_64-linux-gnu/liblzma.so.5.0.0\n" +
+			"main () at ../Modules/main.c:42"}, report["StacktraceTop"])
+}
+
+func TestApportReportIncludesSignatures(t *testing.T) {
+	report := testCrashReport().ApportReport()
+	assert.Equal(t, []string{"/usr/bin/python3.4:11:lzma_code:main"}, report["DuplicateSignature"])
+	assert.Equal(t, []string{"/usr/bin/python3.4:11:x86_64:/lib/x86_64-linux-gnu/liblzma.so.5.0.0+2000:/usr/bin/python3.4+a1b2c"}, report["StacktraceAddressSignature"])
+}
+
+func TestApportReportSkipsMissingInformation(t *testing.T) {
+	report := CrashReport{}.ApportReport()
+	assert.Equal(t, crash.Report{"ProblemType": []string{"Crash"}}, report)
+}
+
+func TestApportReportCanBeWrittenAndParsed(t *testing.T) {
+	report := testCrashReport().ApportReport()
+
+	var buf bytes.Buffer
+	assert.Nil(t, crash.WriteReport(&buf, report))
+
+	parsed, err := crash.ParseReport(&buf)
+	assert.Nil(t, err)
+	assert.Equal(t, report, parsed)
+}
@@ -1,10 +1,13 @@
 package command
 
 import (
+	"context"
 	"fmt"
 	"github.com/codegangsta/cli"
 	"github.com/golang/snappy"
 	"github.com/vosst/csi"
+	"github.com/vosst/csi/core"
+	"github.com/vosst/csi/stacktrace"
 	"golang.org/x/crypto/ssh/terminal"
 	"gopkg.in/yaml.v2"
 	"io"
@@ -30,17 +33,21 @@ var (
 	// Messages are sent to this writer
 	dumpOutputWriter = newDumpOutputWriter()
 
-	dumpFlagVerbose  = cli.BoolFlag{"verbose", "enables verbose output to syslog for debugging purposes", ""}
-	dumpFlagCompress = cli.BoolFlag{"compress", "compress the core dump with snappy", ""}
-	dumpFlagCrashDir = cli.StringFlag{"crash-dir", "/var/crash", "destination directory for crash reports", ""}
-	dumpFlagPid      = cli.IntFlag{"pid", -1, "pid of the crashed process", ""}
-	dumpFlagUid      = cli.IntFlag{"uid", -1, "real UID of dumped process", ""}
-	dumpFlagGid      = cli.IntFlag{"gid", -1, "real GID of dumped process", ""}
-	dumpFlagSig      = cli.IntFlag{"sig", -1, "number of signal causing dump", ""}
-	dumpFlagTime     = cli.IntFlag{"time", 0, "time of dump in seconds since epoch", ""}
-	dumpFlagHost     = cli.StringFlag{"host", "", "hostname (same as nodename returned by uname)", ""}
-	dumpFlagExe      = cli.StringFlag{"exe", "", "executable filename (without path prefix)", ""}
-	dumpFlagSize     = cli.StringFlag{"size", "", "core file size soft resource limit", ""}
+	dumpFlagVerbose    = cli.BoolFlag{"verbose", "enables verbose output to syslog for debugging purposes", ""}
+	dumpFlagCompress   = cli.BoolFlag{"compress", "compress the core dump with snappy", ""}
+	dumpFlagCrashDir   = cli.StringFlag{"crash-dir", "/var/crash", "destination directory for crash reports", ""}
+	dumpFlagPid        = cli.IntFlag{"pid", -1, "pid of the crashed process", ""}
+	dumpFlagTid        = cli.IntFlag{"tid", -1, "id of the thread that received the signal", ""}
+	dumpFlagUid        = cli.IntFlag{"uid", -1, "real UID of dumped process", ""}
+	dumpFlagGid        = cli.IntFlag{"gid", -1, "real GID of dumped process", ""}
+	dumpFlagSig        = cli.IntFlag{"sig", -1, "number of signal causing dump", ""}
+	dumpFlagTime       = cli.IntFlag{"time", 0, "time of dump in seconds since epoch", ""}
+	dumpFlagHost       = cli.StringFlag{"host", "", "hostname (same as nodename returned by uname)", ""}
+	dumpFlagExe        = cli.StringFlag{"exe", "", "executable filename (without path prefix)", ""}
+	dumpFlagSize       = cli.StringFlag{"size", "", "core file size soft resource limit", ""}
+	dumpFlagDebugDir   = cli.StringFlag{"debug-dir", stacktrace.DefaultDebugDir, "directory containing separate debug files for symbolizing stack traces", ""}
+	dumpFlagCollectors = cli.StringFlag{"collectors", csi.DefaultCollectorConfigFile, "file enabling and disabling collectors and declaring additional ones", ""}
+	dumpFlagTimeout    = cli.IntFlag{"timeout", 10, "seconds to spend on gathering crash meta data at most, unbounded if not positive", ""}
 )
 
 func actionDump(c *cli.Context) {
@@ -56,34 +63,40 @@ func actionDump(c *cli.Context) {
 	oldMask := syscall.Umask(0000)
 	defer syscall.Umask(oldMask)
 
-	cd = filepath.Join(cd, exe, when.Format(time.RFC3339), fmt.Sprint(pid))
+	cd = csi.CrashStore{cd}.Path(exe, when, pid)
 	if err := os.MkdirAll(cd, 0755); err != nil {
 		fmt.Fprintf(dumpOutputWriter, "Failed to create crash directory %s [%s]\n", cd, err)
 	}
 
+	// The crashed process is kept around by the kernel until we consumed the
+	// core dump, we thus bound the time spent on gathering meta data.
+	ctx := context.Background()
+	if timeout := c.Int(dumpFlagTimeout.Name); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+		defer cancel()
+	}
+
+	if err := csi.DefaultRegistry.Load(c.String(dumpFlagCollectors.Name)); err != nil {
+		fmt.Fprintf(dumpOutputWriter, "Failed to configure collectors [%s]\n", err)
+	}
+
 	ci := csi.CrashInspector{}
-	if cr, err := ci.Inspect(pid, syscall.Signal(sig)); err != nil {
-		fmt.Fprintf(dumpOutputWriter, "Failed to gather crash meta data [%s]\n", err)
-	} else {
-		if b, err := yaml.Marshal(cr); err != nil {
-			fmt.Fprintf(dumpOutputWriter, "Failed to write crash meta data [%s]\n", err)
-		} else {
-			ry := filepath.Join(cd, "report.yaml")
-			if f, err := os.Create(ry); err != nil {
-				fmt.Fprintf(dumpOutputWriter, "Failed to dump crash report to %s [%s]\n", ry, err)
-			} else {
-				defer f.Close()
-				fmt.Fprintf(f, "%s", b)
-			}
-		}
+	cr, err := ci.InspectContext(ctx, pid, c.Int(dumpFlagTid.Name), syscall.Signal(sig))
+	if err != nil && verbose {
+		fmt.Fprintf(dumpOutputWriter, "Failed to gather parts of crash meta data [%s]\n", err)
+	}
+
+	if c.Int(dumpFlagTime.Name) > 0 {
+		cr.When = when
 	}
 
-	// And we finally dump the actual core file
+	// We dump the actual core file before writing the report, such that
+	// we are able to unwind the stack of the faulting thread.
 	df := filepath.Join(cd, "core")
 	if f, err := os.Create(df); err != nil {
 		fmt.Fprintf(dumpOutputWriter, "Failed to dump core to %s [%s]", df, err)
 	} else {
-		defer f.Close()
 		// TODO(tvoss): Investigate into syscall.Sendfile and figure out a way
 		// to avoid copying of data to userspace.
 		var dest io.Writer = f
@@ -94,10 +107,38 @@ func actionDump(c *cli.Context) {
 		start := time.Now()
 		n, _ := io.Copy(dest, os.Stdin)
 		elapsed := time.Since(start)
+		f.Close()
 
 		if verbose {
 			fmt.Fprintf(dumpOutputWriter, "Wrote %d bytes of core dump to %s in %f seconds", n, df, elapsed.Seconds())
 		}
+
+		if cr != nil {
+			if cf, err := core.Open(df); err != nil {
+				fmt.Fprintf(dumpOutputWriter, "Failed to open core %s [%s]\n", df, err)
+			} else {
+				if err := cr.Unwind(cf, c.String(dumpFlagDebugDir.Name)); err != nil {
+					fmt.Fprintf(dumpOutputWriter, "%s\n", err)
+				}
+				cf.Close()
+			}
+		}
+	}
+
+	if cr == nil {
+		return
+	}
+
+	if b, err := yaml.Marshal(cr); err != nil {
+		fmt.Fprintf(dumpOutputWriter, "Failed to write crash meta data [%s]\n", err)
+	} else {
+		ry := filepath.Join(cd, "report.yaml")
+		if f, err := os.Create(ry); err != nil {
+			fmt.Fprintf(dumpOutputWriter, "Failed to dump crash report to %s [%s]\n", ry, err)
+		} else {
+			defer f.Close()
+			fmt.Fprintf(f, "%s", b)
+		}
 	}
 }
 
@@ -106,5 +147,5 @@ var Dump = cli.Command{
 	Usage:       "dumps information about a crashed process",
 	Description: `Usually used as the default core dump handler. Install in your system with 'csi install' (requires elevated privileges).`,
 	Action:      actionDump,
-	Flags:       []cli.Flag{dumpFlagVerbose, dumpFlagCrashDir, dumpFlagPid, dumpFlagUid, dumpFlagGid, dumpFlagSig, dumpFlagTime, dumpFlagHost, dumpFlagExe, dumpFlagSize},
+	Flags:       []cli.Flag{dumpFlagVerbose, dumpFlagCompress, dumpFlagCrashDir, dumpFlagPid, dumpFlagTid, dumpFlagUid, dumpFlagGid, dumpFlagSig, dumpFlagTime, dumpFlagHost, dumpFlagExe, dumpFlagSize, dumpFlagDebugDir, dumpFlagTimeout, dumpFlagCollectors},
 }
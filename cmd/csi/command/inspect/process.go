@@ -5,24 +5,62 @@ import (
 	"github.com/codegangsta/cli"
 	"github.com/vosst/csi"
 	"github.com/vosst/csi/pkg/debian"
+	"github.com/vosst/csi/proc"
+	"github.com/vosst/csi/proc/pid"
+	"github.com/vosst/csi/proc/snapshot"
 	"gopkg.in/yaml.v2"
+	"io/ioutil"
 	"os"
 	"strconv"
 )
 
 var (
-	processFlagPid = cli.StringFlag{"pid", "", "specify the pid of the process that should be inspected", ""}
+	processFlagPid        = cli.StringFlag{"pid", "", "specify the pid of the process that should be inspected", ""}
+	processFlagProc       = cli.StringFlag{"proc", proc.Dir, "specify the root of the proc fs to read from, either a directory or a snapshot archive", ""}
+	processFlagSnapshot   = cli.StringFlag{"snapshot", "", "write a snapshot of the process to the given archive, one of .tar, .tar.gz, .tgz, .tar.zst or .tar.sz", ""}
+	processFlagCollectors = cli.StringFlag{"collectors", csi.DefaultCollectorConfigFile, "file enabling and disabling collectors and declaring additional ones", ""}
 )
 
 func actionProcess(context *cli.Context) {
-	pid := os.Getpid()
+	id := os.Getpid()
 
 	if p := context.String(processFlagPid.Name); len(p) > 0 {
-		pid, _ = strconv.Atoi(p)
+		id, _ = strconv.Atoi(p)
 	}
 
-	pi := csi.ProcessInspector{debian.NewSystem()}
-	processInfo, _ := pi.Inspect(pid)
+	fs := pid.FS(context.String(processFlagProc.Name))
+
+	// Snapshots are extracted to a temporary directory serving as root of the proc fs.
+	if fi, err := os.Stat(string(fs)); err == nil && fi.Mode().IsRegular() {
+		dir, err := ioutil.TempDir("", "csi-snapshot")
+		if err != nil {
+			fmt.Fprintf(context.App.Writer, "Failed to create temporary directory [%s]\n", err)
+			return
+		}
+
+		defer os.RemoveAll(dir)
+
+		if fs, err = snapshot.Open(string(fs), dir); err != nil {
+			fmt.Fprintf(context.App.Writer, "Failed to extract snapshot [%s]\n", err)
+			return
+		}
+	}
+
+	pi := csi.ProcessInspector{debian.NewSystem(), fs, csi.DefaultWorkers, nil}
+
+	if fn := context.String(processFlagSnapshot.Name); len(fn) > 0 {
+		if err := pi.Snapshot(fn, id); err != nil {
+			fmt.Fprintf(context.App.Writer, "Failed to write snapshot [%s]\n", err)
+			return
+		}
+	}
+
+	if err := csi.DefaultRegistry.Load(context.String(processFlagCollectors.Name)); err != nil {
+		fmt.Fprintf(context.App.Writer, "Failed to configure collectors [%s]\n", err)
+		return
+	}
+
+	processInfo, _ := pi.Inspect(id)
 
 	if b, err := yaml.Marshal(processInfo); err != nil {
 		fmt.Fprintf(context.App.Writer, "Failed to query process information")
@@ -35,6 +73,6 @@ func actionProcess(context *cli.Context) {
 var Process = cli.Command{
 	Name:   "process",
 	Usage:  "collects process-specific information",
-	Flags:  []cli.Flag{processFlagPid},
+	Flags:  []cli.Flag{processFlagPid, processFlagProc, processFlagSnapshot, processFlagCollectors},
 	Action: actionProcess,
 }
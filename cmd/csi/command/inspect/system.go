@@ -7,10 +7,21 @@ import (
 	"github.com/codegangsta/cli"
 	"github.com/vosst/csi"
 	"github.com/vosst/csi/pkg/debian"
+	"github.com/vosst/csi/proc"
+)
+
+var (
+	systemFlagProc       = cli.StringFlag{"proc", proc.Dir, "specify the root of the proc fs to read from, e.g., an extracted snapshot", ""}
+	systemFlagCollectors = cli.StringFlag{"collectors", csi.DefaultCollectorConfigFile, "file enabling and disabling collectors and declaring additional ones", ""}
 )
 
 func actionSystem(context *cli.Context) {
-	si := csi.SystemInspector{debian.NewSystem()}
+	if err := csi.DefaultRegistry.Load(context.String(systemFlagCollectors.Name)); err != nil {
+		fmt.Fprintf(context.App.Writer, "Failed to configure collectors [%s]\n", err)
+		return
+	}
+
+	si := csi.SystemInspector{debian.NewSystem(), proc.FS(context.String(systemFlagProc.Name)), csi.DefaultWorkers, nil}
 	sysInfo, _ := si.Inspect()
 
 	if b, err := json.MarshalIndent(sysInfo, "", "  "); err != nil {
@@ -25,5 +36,6 @@ func actionSystem(context *cli.Context) {
 var System = cli.Command{
 	Name:   "system",
 	Usage:  "collects system/OS-specific information",
+	Flags:  []cli.Flag{systemFlagProc, systemFlagCollectors},
 	Action: actionSystem,
 }
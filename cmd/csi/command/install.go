@@ -0,0 +1,64 @@
+package command
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/codegangsta/cli"
+	"github.com/vosst/csi/coredump"
+)
+
+var (
+	installFlagCrashDir   = cli.StringFlag{"crash-dir", coredump.DefaultCrashDir, "destination directory for crash reports", ""}
+	installFlagCompress   = cli.BoolFlag{"compress", "compress core dumps with snappy", ""}
+	installFlagPipeLimit  = cli.IntFlag{"pipe-limit", coredump.DefaultPipeLimit, "number of crashing processes handled in parallel", ""}
+	installFlagPersist    = cli.BoolFlag{"persist", "write a sysctl.d drop-in to keep the handler installed across reboots", ""}
+	installFlagSysDir     = cli.StringFlag{"sys-dir", coredump.DefaultSysDir, "root of the sysctl tree", ""}
+	installFlagSysctlDir  = cli.StringFlag{"sysctl-dir", coredump.DefaultSysctlDir, "directory for sysctl drop-in files", ""}
+	installFlagBackupFile = cli.StringFlag{"backup-file", coredump.DefaultBackupFile, "file preserving the previous core pattern", ""}
+)
+
+// newInstaller assembles a coredump.Installer from the command line flags in c.
+func newInstaller(c *cli.Context) coredump.Installer {
+	return coredump.Installer{
+		SysDir:     c.String(installFlagSysDir.Name),
+		SysctlDir:  c.String(installFlagSysctlDir.Name),
+		BackupFile: c.String(installFlagBackupFile.Name),
+	}
+}
+
+func actionInstall(c *cli.Context) {
+	exe, err := os.Executable()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to determine path to csi executable [%s]\n", err)
+		return
+	}
+
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to resolve path to csi executable [%s]\n", err)
+		return
+	}
+
+	handler := coredump.Handler{
+		Executable: exe,
+		CrashDir:   c.String(installFlagCrashDir.Name),
+		Compress:   c.Bool(installFlagCompress.Name),
+	}
+
+	if err := newInstaller(c).Install(handler, c.Int(installFlagPipeLimit.Name), c.Bool(installFlagPersist.Name)); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to install csi as core dump handler [%s]\n", err)
+		return
+	}
+
+	fmt.Fprintf(c.App.Writer, "Installed %s as core dump handler\n", exe)
+}
+
+// Command install registers csi as the kernel's core dump handler.
+var Install = cli.Command{
+	Name:        "install",
+	Usage:       "installs csi as the system's core dump handler",
+	Description: `Writes a pipe handler invoking 'csi dump' to /proc/sys/kernel/core_pattern, preserving the previous pattern for 'csi uninstall' (requires elevated privileges).`,
+	Action:      actionInstall,
+	Flags:       []cli.Flag{installFlagCrashDir, installFlagCompress, installFlagPipeLimit, installFlagPersist, installFlagSysDir, installFlagSysctlDir, installFlagBackupFile},
+}
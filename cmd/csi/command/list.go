@@ -3,6 +3,7 @@ package command
 import (
 	"fmt"
 	"github.com/codegangsta/cli"
+	"github.com/vosst/csi"
 	"github.com/vosst/csi/crash"
 	"io"
 	"os"
@@ -10,46 +11,102 @@ import (
 
 const bullet = "\u2022"
 
-var listFlagCrashDir = cli.StringFlag{"crash-dir", "/var/crash", "directory containing crash files", ""}
+var (
+	listFlagCrashDir       = cli.StringFlag{"crash-dir", "/var/crash", "directory containing crash files", ""}
+	listFlagSignatureIndex = cli.StringFlag{"signature-index", crash.DefaultSignatureIndexFile, "file recording signatures of uploaded crashes", ""}
+)
+
+// listingGroup bundles all reports sharing a signature.
+type listingGroup struct {
+	signature string       // Signature shared by all reports, empty if unknown
+	names     []string     // Names of all reports in the group
+	report    crash.Report // The first report of the group
+}
 
-// ListingVisitor provides listing of available crash reports.
+// ListingVisitor provides listing of available crash reports, grouping
+// repeated crashes by their signature.
 type ListingVisitor struct {
-	Out io.Writer // Destination for output.
+	Out   io.Writer             // Destination for output.
+	Index *crash.SignatureIndex // Index of signatures of uploaded crashes, may be nil.
+
+	groups      []*listingGroup
+	bySignature map[string]*listingGroup
 }
 
-func (self ListingVisitor) NewReport(name string, report crash.Report) {
-	problemType := "unknown"
-	if pt := report["Problemtype"]; pt != nil && len(pt) > 0 {
-		problemType = pt[0]
-	}
+// NewListingVisitor returns a ListingVisitor printing to out.
+func NewListingVisitor(out io.Writer, index *crash.SignatureIndex) *ListingVisitor {
+	return &ListingVisitor{Out: out, Index: index, bySignature: map[string]*listingGroup{}}
+}
 
-	executablePath := "unknown executable"
-	if ep := report["Executablepath"]; ep != nil && len(ep) > 0 {
-		executablePath = ep[0]
+func (self *ListingVisitor) NewReport(name string, report crash.Report) {
+	sig, ok := report.Signature()
+	if g, present := self.bySignature[sig]; ok && present {
+		g.names = append(g.names, name)
+		return
 	}
 
-	annotation := "no further details"
-	if a := report["Annotation"]; a != nil && len(a) > 0 {
-		annotation = a[0]
+	g := &listingGroup{sig, []string{name}, report}
+	self.groups = append(self.groups, g)
+	if ok {
+		self.bySignature[sig] = g
 	}
-
-	fmt.Fprintf(self.Out, "  %s %s[%s]: %s - %s \n", bullet, name, problemType, executablePath, annotation)
-
 }
 
-func (self ListingVisitor) NewError(err error) {
+func (self *ListingVisitor) NewError(err error) {
 	// We silently skip errors.
 }
 
+// Flush prints all reports seen so far, listing repeated crashes below their first occurrence.
+func (self *ListingVisitor) Flush() {
+	for _, g := range self.groups {
+		problemType := "unknown"
+		if pt := g.report["ProblemType"]; pt != nil && len(pt) > 0 {
+			problemType = pt[0]
+		}
+
+		executablePath := "unknown executable"
+		if ep := g.report["ExecutablePath"]; ep != nil && len(ep) > 0 {
+			executablePath = ep[0]
+		}
+
+		annotation := "no further details"
+		if a := g.report["Annotation"]; a != nil && len(a) > 0 {
+			annotation = a[0]
+		}
+
+		details := ""
+		if len(g.names) > 1 {
+			details += fmt.Sprintf(" (%d occurrences)", len(g.names))
+		}
+		if self.Index != nil && len(g.signature) > 0 && self.Index.Uploaded(g.signature) {
+			details += " (uploaded)"
+		}
+
+		fmt.Fprintf(self.Out, "  %s %s[%s]: %s - %s%s\n", bullet, g.names[0], problemType, executablePath, annotation, details)
+		for _, name := range g.names[1:] {
+			fmt.Fprintf(self.Out, "      %s\n", name)
+		}
+	}
+
+	self.groups = nil
+	self.bySignature = map[string]*listingGroup{}
+}
+
 func actionList(c *cli.Context) {
 	crashDir := c.String(listFlagCrashDir.Name)
+
+	// The index is optional, we are still able to group crashes without it.
+	index, _ := crash.LoadSignatureIndex(c.String(listFlagSignatureIndex.Name))
+
 	fmt.Fprintf(os.Stdout, "Listing crash reports in %s:\n", crashDir)
-	crash.ForEachReportInDir(crashDir, ListingVisitor{os.Stdout})
+	lv := NewListingVisitor(os.Stdout, index)
+	csi.CrashStore{crashDir}.ForEachReport(lv)
+	lv.Flush()
 }
 
 var List = cli.Command{
 	Name:   "list",
 	Usage:  "lists all crash reports on the system",
-	Flags:  []cli.Flag{listFlagCrashDir},
+	Flags:  []cli.Flag{listFlagCrashDir, listFlagSignatureIndex},
 	Action: actionList,
 }
@@ -0,0 +1,26 @@
+package command
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/codegangsta/cli"
+)
+
+func actionUninstall(c *cli.Context) {
+	if err := newInstaller(c).Uninstall(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to uninstall csi as core dump handler [%s]\n", err)
+		return
+	}
+
+	fmt.Fprintf(c.App.Writer, "Restored previous core dump handler\n")
+}
+
+// Command uninstall restores the core dump handler that was active before 'csi install'.
+var Uninstall = cli.Command{
+	Name:        "uninstall",
+	Usage:       "restores the system's previous core dump handler",
+	Description: `Restores the core pattern preserved by 'csi install' and removes the sysctl.d drop-in (requires elevated privileges).`,
+	Action:      actionUninstall,
+	Flags:       []cli.Flag{installFlagSysDir, installFlagSysctlDir, installFlagBackupFile},
+}
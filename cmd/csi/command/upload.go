@@ -3,40 +3,101 @@ package command
 import (
 	"fmt"
 	"github.com/codegangsta/cli"
+	"github.com/vosst/csi"
 	"github.com/vosst/csi/crash"
 	"github.com/vosst/csi/machine"
 	"io"
 	"net/http"
 	"net/url"
 	"os"
-	"path/filepath"
+	"time"
 )
 
 var (
 	uploadFlagDest     = cli.StringFlag{"dest", "https://daisy.ubuntu.com", "the upload destination", ""}
 	uploadFlagCrashDir = cli.StringFlag{"crash-dir", "/var/crash", "directory containing crash files", ""}
 	uploadFlagCleanup  = cli.BoolFlag{"cleanup", "deletes crash reports after successful upload", ""}
+	uploadFlagIndex    = cli.StringFlag{"signature-index", crash.DefaultSignatureIndexFile, "file recording signatures of uploaded crashes", ""}
+	uploadFlagTimeout  = cli.DurationFlag{"timeout", time.Minute, "timeout for submitting individual crash reports to the upload destination", ""}
+	uploadFlagCoreTime = cli.DurationFlag{"core-timeout", time.Hour, "timeout for uploading individual core dumps to the upload destination", ""}
+	uploadFlagCompress = cli.StringFlag{"compress-core", string(crash.CoreCompressionGzip), "compression applied to uploaded core dumps, one of gzip, snappy or none", ""}
+	uploadFlagMaxCore  = cli.IntFlag{"max-core-size", 0, "maximum size of uploaded core dumps in MiB, 0 for no limit", ""}
+	uploadFlagProgress = cli.BoolFlag{"progress", "reports the progress of core dump uploads", ""}
 )
 
+// progressInterval is the number of bytes between two progress reports.
+const progressInterval = 64 * 1024 * 1024
+
+// printProgress returns a function reporting the progress of core uploads to out.
+func printProgress(out io.Writer) func(int64) {
+	reported := int64(0)
+	return func(sent int64) {
+		if sent < reported {
+			reported = 0
+		}
+
+		if sent-reported >= progressInterval {
+			reported = sent
+			fmt.Fprintf(out, "    Sent %d MiB of core dump\n", sent/(1024*1024))
+		}
+	}
+}
+
 type UploadingVisitor struct {
-	CrashDir  string                // The directory containing crashes
-	Out       io.Writer             // Destination for output
-	Persister crash.ReportPersister // Persister provides persistence of crash reports.
-	Cleanup   bool                  // If true, successfully uploaded crash reports are deleted.
+	Store   csi.CrashStore        // The store containing crashes
+	Out     io.Writer             // Destination for output
+	Queue   *csi.UploadQueue      // Uploads crashes, tracking their upload status
+	Cleanup bool                  // If true, successfully uploaded crash reports are deleted.
+	Index   *crash.SignatureIndex // Records signatures of uploaded crashes, may be nil.
 }
 
 func (self UploadingVisitor) NewReport(name string, report crash.Report) {
-	err := self.Persister.Persist(report)
+	sig, hasSig := report.Signature()
+	hasSig = hasSig && self.Index != nil
 
-	if err != nil {
-		fmt.Fprintf(self.Out, "  %s %s: Failed to upload crash report - %s\n", bullet, name, err)
+	// Only crashes that we have not tried to upload before are checked for duplicates.
+	if status, err := self.Store.LoadUploadStatus(name); err == nil && len(status.State) == 0 && hasSig {
+		self.Index.Add(sig, crash.ReportId(name, report))
+
+		// The server already knows about the crash, no need to upload it again.
+		if self.Index.Uploaded(sig) {
+			fmt.Fprintf(self.Out, "  %s %s: Skipped, duplicate of an uploaded crash\n", bullet, name)
+			if self.Cleanup {
+				self.Store.Remove(name)
+			}
+			return
+		}
+	}
+
+	status, err := self.Queue.Upload(name, report)
+
+	switch e := err.(type) {
+	case nil:
+	case csi.ErrorUploadDeferred:
+		fmt.Fprintf(self.Out, "  %s %s: Waiting for retry until %s\n", bullet, name, e.Until.Format(time.RFC3339))
+		return
+	default:
+		if status.State == csi.UploadFailed {
+			fmt.Fprintf(self.Out, "  %s %s: Failed to upload crash report, giving up - %s\n", bullet, name, err)
+		} else {
+			fmt.Fprintf(self.Out, "  %s %s: Failed to upload crash report, retrying after %s - %s\n", bullet, name, status.NextAttempt.Format(time.RFC3339), err)
+		}
+		return
+	}
+
+	if status.State != csi.UploadUploaded {
+		fmt.Fprintf(self.Out, "  %s %s: Upload failed before, giving up - %s\n", bullet, name, status.LastError)
 		return
 	}
 
-	fmt.Fprintf(self.Out, "  %s %s: Successfully uploaded\n", bullet, name)
+	fmt.Fprintf(self.Out, "  %s %s: Successfully uploaded (OOPS ID %s)\n", bullet, name, status.OopsId)
+
+	if hasSig {
+		self.Index.MarkUploaded(sig, time.Now())
+	}
 
 	if self.Cleanup {
-		os.Remove(filepath.Join(self.CrashDir, name))
+		self.Store.Remove(name)
 	}
 }
 
@@ -57,10 +118,41 @@ func actionUpload(c *cli.Context) {
 		return
 	}
 
-	crashDir := c.String(uploadFlagCrashDir.Name)
-	persister := crash.HttpReportPersister{*u, mi, &http.Client{}}
+	compression, err := crash.ParseCoreCompression(c.String(uploadFlagCompress.Name))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return
+	}
+
+	var progress func(int64)
+	if c.Bool(uploadFlagProgress.Name) {
+		progress = printProgress(os.Stdout)
+	}
+
+	store := csi.CrashStore{c.String(uploadFlagCrashDir.Name)}
+	persister := crash.HttpReportPersister{
+		*u,
+		mi,
+		&http.Client{Timeout: c.Duration(uploadFlagTimeout.Name)},
+		compression,
+		int64(c.Int(uploadFlagMaxCore.Name)) * 1024 * 1024,
+		progress,
+		c.Duration(uploadFlagCoreTime.Name),
+	}
 
-	crash.ForEachReportInDir(crashDir, UploadingVisitor{crashDir, os.Stdout, persister, c.Bool(uploadFlagCleanup.Name)})
+	index, err := crash.LoadSignatureIndex(c.String(uploadFlagIndex.Name))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s, uploading all crashes\n", err)
+		index = nil
+	}
+
+	store.ForEachReport(UploadingVisitor{store, os.Stdout, csi.NewUploadQueue(store, persister), c.Bool(uploadFlagCleanup.Name), index})
+
+	if index != nil {
+		if err := index.Save(); err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+		}
+	}
 }
 
 // Command upload uploads crash reports to the server infrastructure
@@ -68,5 +160,5 @@ var Upload = cli.Command{
 	Name:   "upload",
 	Usage:  "uploads crash reports to the server infrastructure",
 	Action: actionUpload,
-	Flags:  []cli.Flag{uploadFlagDest, uploadFlagCrashDir, uploadFlagCleanup},
+	Flags:  []cli.Flag{uploadFlagDest, uploadFlagCrashDir, uploadFlagCleanup, uploadFlagIndex, uploadFlagTimeout, uploadFlagCoreTime, uploadFlagCompress, uploadFlagMaxCore, uploadFlagProgress},
 }
@@ -20,7 +20,9 @@ func main() {
 		command.Dump,
 		command.Id,
 		command.Inspect,
+		command.Install,
 		command.List,
+		command.Uninstall,
 		command.Upload,
 	}
 
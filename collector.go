@@ -0,0 +1,285 @@
+package csi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+
+	"github.com/vosst/csi/pkg"
+	"github.com/vosst/csi/proc/pid"
+)
+
+// Scope distinguishes collectors gathering information about individual
+// processes from collectors gathering information about the overall system.
+type Scope string
+
+const (
+	ScopeProcess Scope = "process" // The collector contributes to ProcessReport
+	ScopeSystem  Scope = "system"  // The collector contributes to SystemReport
+)
+
+// Target describes what collectors gather information about.
+type Target struct {
+	Pid             int        // Id of the inspected process, 0 for collectors of ScopeSystem
+	Proc            pid.FS     // The proc fs to read information from
+	PackagingSystem pkg.System // Queries into the underlying packaging system
+}
+
+// A Collector gathers an individual part of a report. Collectors run
+// concurrently to each other and must not rely on the results of others.
+type Collector interface {
+	// Name uniquely identifies the collector, its result is reported under this name.
+	Name() string
+	// Scope determines whether the collector contributes to process or system reports.
+	Scope() Scope
+	// Collect gathers information about target. Collectors should give up
+	// once ctx is done, their results are discarded in that case anyway.
+	// Partial results returned together with an error are reported, too.
+	//
+	// Returns an error if gathering the information fails.
+	Collect(ctx context.Context, target Target) (interface{}, error)
+}
+
+// CollectorState summarizes the outcome of an individual collector.
+type CollectorState string
+
+const (
+	CollectorOk        CollectorState = "ok"        // The collector gathered its information
+	CollectorDisabled  CollectorState = "disabled"  // The collector is disabled by configuration
+	CollectorMissing   CollectorState = "missing"   // The information is not available, e.g., on older kernels (ENOENT)
+	CollectorDenied    CollectorState = "denied"    // Accessing the information is not permitted (EACCES, EPERM)
+	CollectorExited    CollectorState = "exited"    // The process exited while being inspected (ESRCH)
+	CollectorTimedOut  CollectorState = "timed-out" // The collector did not finish before the deadline (ETIMEDOUT)
+	CollectorCancelled CollectorState = "cancelled" // The inspection was cancelled before the collector finished (ECANCELED)
+	CollectorFailed    CollectorState = "failed"    // Gathering the information failed for any other reason
+)
+
+// DefaultWorkers is the number of collectors run concurrently by inspectors not specifying otherwise.
+const DefaultWorkers = 4
+
+// CollectorStatus records the outcome of an individual collector in a report.
+type CollectorStatus struct {
+	State CollectorState // Outcome of the collector
+	Error string         `yaml:",omitempty" json:",omitempty"` // Reason the collector failed, empty on success
+}
+
+// ErrorCollector is returned if an individual collector fails.
+type ErrorCollector struct {
+	Collector string        // Name of the failed collector
+	Errno     syscall.Errno // System error causing the failure, 0 if unknown
+	Err       error         // The original error
+}
+
+// Error pretty prints an ErrorCollector instance.
+func (self ErrorCollector) Error() string {
+	return fmt.Sprintf("Collector %s failed [%s]", self.Collector, self.Err)
+}
+
+// State maps the cause of the failure to a CollectorState.
+func (self ErrorCollector) State() CollectorState {
+	switch self.Errno {
+	case syscall.ENOENT:
+		return CollectorMissing
+	case syscall.EACCES, syscall.EPERM:
+		return CollectorDenied
+	case syscall.ESRCH:
+		return CollectorExited
+	case syscall.ETIMEDOUT:
+		return CollectorTimedOut
+	case syscall.ECANCELED:
+		return CollectorCancelled
+	}
+
+	return CollectorFailed
+}
+
+// Status returns the CollectorStatus describing the failure.
+func (self ErrorCollector) Status() CollectorStatus {
+	return CollectorStatus{self.State(), self.Err.Error()}
+}
+
+// ErrorCollectors lists all collectors that failed while assembling a report.
+type ErrorCollectors []ErrorCollector
+
+// Error pretty prints an ErrorCollectors instance.
+func (self ErrorCollectors) Error() string {
+	s := []string{}
+	for _, err := range self {
+		s = append(s, err.Error())
+	}
+
+	return fmt.Sprintf("%d collectors failed [%s]", len(self), strings.Join(s, "; "))
+}
+
+// collectorJob runs an individual collector as part of assembling a report.
+type collectorJob struct {
+	Name string // Name of the collector
+	// Collect gathers the information, returning a function storing it in the
+	// report. Collect must not access the report itself, as it might still be
+	// running when the report is handed out.
+	Collect func(ctx context.Context) (apply func(), err error)
+	// Failed determines the cause of a failure, nil if the cause cannot be determined.
+	Failed func(err error) ErrorCollector
+}
+
+// runCollectors runs collectors on at most workers goroutines until all of
+// them finished or ctx is done. Results of collectors finishing in time are
+// applied in order, even if they fail, such that partial information is kept.
+// Collectors still running when ctx is done are marked as timed out or
+// cancelled, and their results are discarded. Collectors blocked in calls that
+// cannot be interrupted, e.g., statfs(2) on a hung NFS mount, are abandoned
+// rather than cancelled and finish in the background. The outcome of every
+// collector is recorded in statuses.
+//
+// Returns the failed collectors.
+func runCollectors(ctx context.Context, workers int, collectors []collectorJob, statuses map[string]CollectorStatus) ErrorCollectors {
+	type result struct {
+		apply func()
+		err   error
+	}
+
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+
+	jobs := make(chan int)
+	// Buffered, such that workers finishing after ctx is done never block.
+	finished := make(chan int, len(collectors))
+	results := make([]*result, len(collectors))
+
+	go func() {
+		defer close(jobs)
+		for i := range collectors {
+			if ctx.Err() != nil {
+				return
+			}
+
+			select {
+			case jobs <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for w := 0; w < workers; w++ {
+		go func() {
+			for i := range jobs {
+				apply, err := collectors[i].Collect(ctx)
+				results[i] = &result{apply, err}
+				finished <- i
+			}
+		}()
+	}
+
+	done := make([]bool, len(collectors))
+wait:
+	for n := 0; n < len(collectors); n++ {
+		select {
+		case i := <-finished:
+			done[i] = true
+		case <-ctx.Done():
+			break wait
+		}
+	}
+
+	// Collectors might have finished while ctx was done, select picks either at random.
+drain:
+	for {
+		select {
+		case i := <-finished:
+			done[i] = true
+		default:
+			break drain
+		}
+	}
+
+	errs := ErrorCollectors{}
+	for i, c := range collectors {
+		if !done[i] {
+			ec := ErrorCollector{c.Name, syscall.ECANCELED, ctx.Err()}
+			if ctx.Err() == context.DeadlineExceeded {
+				ec.Errno = syscall.ETIMEDOUT
+			}
+
+			statuses[c.Name] = ec.Status()
+			errs = append(errs, ec)
+			continue
+		}
+
+		r := results[i]
+		if r.apply != nil {
+			r.apply()
+		}
+
+		if r.err == nil {
+			statuses[c.Name] = CollectorStatus{State: CollectorOk}
+			continue
+		}
+
+		ec := ErrorCollector{c.Name, errnoOf(r.err), r.err}
+		if c.Failed != nil {
+			ec = c.Failed(r.err)
+		}
+
+		statuses[c.Name] = ec.Status()
+		errs = append(errs, ec)
+	}
+
+	return errs
+}
+
+// newErrorCollector wraps err, the failure of collector, determining its cause.
+// The proc fs reports most failures of its readers with errors that have lost
+// their errno, we thus probe the process directory dir and its entry fn, if
+// given, for the cause.
+func newErrorCollector(collector string, err error, dir string, fn string) ErrorCollector {
+	ec := ErrorCollector{collector, errnoOf(err), err}
+
+	if _, err := os.Lstat(dir); os.IsNotExist(err) {
+		ec.Errno = syscall.ESRCH
+	} else if ec.Errno == 0 && len(fn) > 0 {
+		ec.Errno = errnoOf(probe(fn))
+	}
+
+	return ec
+}
+
+// probe accesses fn like a reader would, without interpreting its contents.
+func probe(fn string) error {
+	fi, err := os.Lstat(fn)
+	if err != nil {
+		return err
+	}
+
+	if fi.Mode()&os.ModeSymlink != 0 {
+		_, err = os.Readlink(fn)
+		return err
+	}
+
+	f, err := os.Open(fn)
+	if err == nil {
+		f.Close()
+	}
+
+	return err
+}
+
+// errnoOf returns the syscall.Errno wrapped by err, 0 if there is none. Collectors
+// giving up once their context is done are mapped to ETIMEDOUT and ECANCELED.
+func errnoOf(err error) syscall.Errno {
+	var errno syscall.Errno
+	switch {
+	case errors.As(err, &errno):
+		return errno
+	case errors.Is(err, context.DeadlineExceeded):
+		return syscall.ETIMEDOUT
+	case errors.Is(err, context.Canceled):
+		return syscall.ECANCELED
+	}
+
+	return 0
+}
@@ -0,0 +1,152 @@
+package csi
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vosst/csi/log"
+	"github.com/vosst/csi/proc/pid"
+)
+
+func TestRunCollectorsBoundsConcurrencyAndAppliesInOrder(t *testing.T) {
+	var mutex sync.Mutex
+	running, peak := 0, 0
+	applied := []string{}
+
+	collectors := []collectorJob{}
+	for _, name := range []string{"a", "b", "c", "d", "e", "f"} {
+		name := name
+		collectors = append(collectors, collectorJob{name, func(ctx context.Context) (func(), error) {
+			mutex.Lock()
+			if running++; running > peak {
+				peak = running
+			}
+			mutex.Unlock()
+
+			time.Sleep(10 * time.Millisecond)
+
+			mutex.Lock()
+			running--
+			mutex.Unlock()
+
+			if name == "c" {
+				return func() { applied = append(applied, name) }, errors.New("partial")
+			}
+
+			return func() { applied = append(applied, name) }, nil
+		}, nil})
+	}
+
+	statuses := map[string]CollectorStatus{}
+	errs := runCollectors(context.Background(), 2, collectors, statuses)
+
+	assert.True(t, peak <= 2)
+	assert.Equal(t, []string{"a", "b", "c", "d", "e", "f"}, applied)
+	assert.Equal(t, 1, len(errs))
+	assert.Equal(t, CollectorStatus{CollectorFailed, "partial"}, statuses["c"])
+	assert.Equal(t, CollectorOk, statuses["f"].State)
+}
+
+func TestRunCollectorsMarksOverrunningCollectorsAsTimedOut(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	collectors := []collectorJob{
+		{"fast", func(ctx context.Context) (func(), error) {
+			return nil, nil
+		}, nil},
+		{"slow", func(ctx context.Context) (func(), error) {
+			<-release
+			return func() { t.Error("Results of timed out collectors must not be applied") }, nil
+		}, nil},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	statuses := map[string]CollectorStatus{}
+	errs := runCollectors(ctx, 2, collectors, statuses)
+
+	assert.True(t, time.Since(start) < time.Second)
+	assert.Equal(t, CollectorOk, statuses["fast"].State)
+	assert.Equal(t, CollectorTimedOut, statuses["slow"].State)
+	assert.Equal(t, 1, len(errs))
+	assert.Equal(t, syscall.ETIMEDOUT, errs[0].Errno)
+}
+
+func TestRunCollectorsKeepsResultsOfCollectorsFinishedBeforeDeadline(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	for n := 0; n < 100; n++ {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		// With a single worker, all fast collectors have finished before trigger cancels ctx.
+		collectors := []collectorJob{}
+		for _, name := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+			collectors = append(collectors, collectorJob{name, func(ctx context.Context) (func(), error) {
+				return nil, nil
+			}, nil})
+		}
+
+		collectors = append(collectors, collectorJob{"trigger", func(ctx context.Context) (func(), error) {
+			cancel()
+			<-release
+			return nil, nil
+		}, nil})
+
+		statuses := map[string]CollectorStatus{}
+		runCollectors(ctx, 1, collectors, statuses)
+		cancel()
+
+		for _, c := range collectors[:len(collectors)-1] {
+			assert.Equal(t, CollectorOk, statuses[c.Name].State, c.Name)
+		}
+		assert.Equal(t, CollectorCancelled, statuses["trigger"].State)
+	}
+}
+
+func TestProcessInspectorHonorsDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+
+	pi := ProcessInspector{&fakeSystem{}, pid.FS("proc/test_data"), 0, nil}
+	pr, err := pi.InspectContext(ctx, 1042)
+	assert.NotNil(t, pr)
+	assert.NotNil(t, err)
+
+	for name, status := range pr.Collectors {
+		assert.Equal(t, CollectorTimedOut, status.State, name)
+	}
+}
+
+func TestLongRunningCollectorsGiveUpOnceContextIsDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	mounts, err := parseMounts(ctx, strings.NewReader("/dev/sda1 / ext4 rw 0 0\n"))
+	assert.Equal(t, context.Canceled, err)
+	assert.Empty(t, mounts)
+
+	fd, err := pid.FS("proc/test_data").NewFdContext(ctx, 1042)
+	assert.Equal(t, context.Canceled, err)
+	for _, entry := range fd {
+		assert.Empty(t, entry.Peers)
+	}
+
+	_, err = log.NewSyslogCollector().Collect(ctx)
+	assert.NotNil(t, err)
+
+	_, err = log.NewDmesgCollector().Collect(ctx)
+	assert.Equal(t, context.Canceled, err)
+
+	assert.Equal(t, CollectorCancelled, ErrorCollector{"mounts", errnoOf(context.Canceled), context.Canceled}.State())
+	assert.Equal(t, CollectorTimedOut, ErrorCollector{"mounts", errnoOf(context.DeadlineExceeded), context.DeadlineExceeded}.State())
+}
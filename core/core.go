@@ -0,0 +1,351 @@
+// Package core parses ELF core files as written by the kernel when dumping a crashed process.
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/golang/snappy"
+	"github.com/vosst/csi/proc/pid"
+)
+
+// snappyMagic marks the beginning of a snappy-framed stream.
+var snappyMagic = []byte("\xff\x06\x00\x00sNaPpY")
+
+// Decompress returns a reader yielding the uncompressed contents of reader,
+// transparently decompressing snappy-framed streams as written by 'csi dump --compress'.
+func Decompress(reader io.Reader) io.Reader {
+	br := bufio.NewReader(reader)
+	if magic, err := br.Peek(len(snappyMagic)); err == nil && bytes.Equal(magic, snappyMagic) {
+		return snappy.NewReader(br)
+	}
+
+	return br
+}
+
+// Segment describes a PT_LOAD segment, i.e., a memory region of the dumped process.
+type Segment struct {
+	Vaddr  uint64       // Virtual address of the region
+	Memsz  uint64       // Size of the region in memory
+	Filesz uint64       // Number of bytes of the region contained in the core file
+	Offset uint64       // Offset of the region's contents in the core file
+	Flags  elf.ProgFlag // Access permissions of the region
+}
+
+// Core models an ELF core file.
+type Core struct {
+	Class       elf.Class         // Class of the core file, 32- or 64-bit
+	ByteOrder   binary.ByteOrder  // Byte order of the core file
+	Machine     elf.Machine       // Machine the dumped process executed on
+	Threads     []Thread          // All threads of the dumped process
+	ProcessInfo *ProcessInfo      // Information about the dumped process, nil if missing
+	SigInfo     *SigInfo          // Signal that caused the dump, nil if missing
+	Auxv        map[uint64]uint64 // Auxiliary vector of the dumped process
+	Files       []MappedFile      // Files mapped into the address space of the dumped process
+	Segments    []Segment         // Memory regions of the dumped process
+
+	reader io.ReaderAt  // Provides access to segment contents
+	close  func() error // Releases resources backing reader, may be nil
+}
+
+// NewCore parses the ELF core file available from reader.
+//
+// Returns an error if reader does not provide an ELF core file or if parsing a note fails.
+func NewCore(reader io.ReaderAt) (*Core, error) {
+	f, err := elf.NewFile(reader)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to parse ELF file [%s]", err))
+	}
+
+	if f.Type != elf.ET_CORE {
+		return nil, errors.New(fmt.Sprintf("Not a core file, type is %s", f.Type))
+	}
+
+	core := Core{
+		Class:     f.Class,
+		ByteOrder: f.ByteOrder,
+		Machine:   f.Machine,
+		Auxv:      map[uint64]uint64{},
+		reader:    reader,
+	}
+
+	for _, prog := range f.Progs {
+		switch prog.Type {
+		case elf.PT_LOAD:
+			core.Segments = append(core.Segments, Segment{prog.Vaddr, prog.Memsz, prog.Filesz, prog.Off, prog.Flags})
+		case elf.PT_NOTE:
+			b, err := ioutil.ReadAll(prog.Open())
+			if err != nil {
+				return nil, errors.New(fmt.Sprintf("Failed to read notes [%s]", err))
+			}
+
+			if err := core.parseNotes(b); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &core, nil
+}
+
+// align4 rounds n up to the next multiple of 4.
+func align4(n int) int {
+	return (n + 3) &^ 3
+}
+
+// parseNotes decodes all notes contained in b.
+func (self *Core) parseNotes(b []byte) error {
+	for len(b) >= 12 {
+		namesz := int(self.ByteOrder.Uint32(b[0:]))
+		descsz := int(self.ByteOrder.Uint32(b[4:]))
+		typ := self.ByteOrder.Uint32(b[8:])
+
+		desc := 12 + align4(namesz)
+		if namesz < 0 || descsz < 0 || len(b) < desc+descsz {
+			return errors.New("Failed to parse notes, note exceeds segment")
+		}
+
+		d := decoder{self.Class, self.ByteOrder, b[desc : desc+descsz]}
+		name := strings.TrimRight(string(b[12:12+namesz]), "\x00")
+
+		// Only notes written by the kernel's core dump code are of interest.
+		if name == "CORE" || name == "LINUX" {
+			if err := self.parseNote(typ, d); err != nil {
+				return err
+			}
+		}
+
+		if len(b) < desc+align4(descsz) {
+			break
+		}
+		b = b[desc+align4(descsz):]
+	}
+
+	return nil
+}
+
+// parseNote decodes an individual note of type typ.
+func (self *Core) parseNote(typ uint32, d decoder) error {
+	switch typ {
+	case NT_PRSTATUS:
+		thread, err := d.parsePrStatus(self.Machine)
+		if err != nil {
+			return err
+		}
+		self.Threads = append(self.Threads, thread)
+	case NT_PRPSINFO:
+		pi, err := d.parsePrPsInfo()
+		if err != nil {
+			return err
+		}
+		self.ProcessInfo = &pi
+	case NT_SIGINFO:
+		si, err := d.parseSigInfo()
+		if err != nil {
+			return err
+		}
+		self.SigInfo = &si
+	case NT_AUXV:
+		self.Auxv = d.parseAuxv()
+	case NT_FILE:
+		files, err := d.parseFile()
+		if err != nil {
+			return err
+		}
+		self.Files = files
+	}
+
+	return nil
+}
+
+// Open parses the core file fn. Snappy-compressed cores are decompressed to a
+// temporary file first, which is removed on Close.
+//
+// Returns an error if opening, decompressing or parsing the core file fails.
+func Open(fn string) (*Core, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+
+	magic := make([]byte, len(snappyMagic))
+	if _, err := io.ReadFull(f, magic); err != nil || !bytes.Equal(magic, snappyMagic) {
+		core, err := NewCore(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+
+		core.close = f.Close
+		return core, nil
+	}
+
+	defer f.Close()
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	tmp, err := ioutil.TempFile("", "csi-core")
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to create temporary file for decompressing %s [%s]", fn, err))
+	}
+
+	cleanup := func() error {
+		tmp.Close()
+		return os.Remove(tmp.Name())
+	}
+
+	if _, err := io.Copy(tmp, snappy.NewReader(f)); err != nil {
+		cleanup()
+		return nil, errors.New(fmt.Sprintf("Failed to decompress %s [%s]", fn, err))
+	}
+
+	core, err := NewCore(tmp)
+	if err != nil {
+		cleanup()
+		return nil, err
+	}
+
+	core.close = cleanup
+	return core, nil
+}
+
+// Close releases all resources associated with the core.
+func (self *Core) Close() error {
+	if self.close != nil {
+		return self.close()
+	}
+
+	return nil
+}
+
+// ReadMemory reads len(p) bytes of the dumped process's memory at addr into p.
+// Parts of a segment that were not dumped, e.g., read-only file mappings,
+// read as zeros.
+//
+// Returns an error if addr is not covered by any segment.
+func (self *Core) ReadMemory(p []byte, addr uint64) (int, error) {
+	for _, seg := range self.Segments {
+		if addr < seg.Vaddr || addr >= seg.Vaddr+seg.Memsz {
+			continue
+		}
+
+		off := addr - seg.Vaddr
+		n := uint64(len(p))
+		if off+n > seg.Memsz {
+			n = seg.Memsz - off
+		}
+
+		m := uint64(0)
+		if off < seg.Filesz {
+			m = n
+			if off+m > seg.Filesz {
+				m = seg.Filesz - off
+			}
+
+			if _, err := self.reader.ReadAt(p[:m], int64(seg.Offset+off)); err != nil {
+				return 0, err
+			}
+		}
+
+		for i := m; i < n; i++ {
+			p[i] = 0
+		}
+
+		if n < uint64(len(p)) {
+			return int(n), io.ErrUnexpectedEOF
+		}
+
+		return int(n), nil
+	}
+
+	return 0, errors.New(fmt.Sprintf("Address %#x is not mapped", addr))
+}
+
+// ReadWord reads a word of the dumped process's native size and byte order at addr.
+func (self *Core) ReadWord(addr uint64) (uint64, error) {
+	if self.Class == elf.ELFCLASS64 {
+		b := make([]byte, 8)
+		if _, err := self.ReadMemory(b, addr); err != nil {
+			return 0, err
+		}
+		return self.ByteOrder.Uint64(b), nil
+	}
+
+	b := make([]byte, 4)
+	if _, err := self.ReadMemory(b, addr); err != nil {
+		return 0, err
+	}
+	return uint64(self.ByteOrder.Uint32(b)), nil
+}
+
+// FaultingThread returns the thread that received the fatal signal, falling
+// back to the first thread if no thread reports a current signal. Returns nil
+// if the core does not contain any threads.
+func (self *Core) FaultingThread() *Thread {
+	for i := range self.Threads {
+		if self.Threads[i].Signal != 0 {
+			return &self.Threads[i]
+		}
+	}
+
+	if len(self.Threads) > 0 {
+		return &self.Threads[0]
+	}
+
+	return nil
+}
+
+// CheckMaps cross-checks the mapped files recorded in the core against maps,
+// as captured when inspecting the process.
+//
+// Returns an error listing all file mappings that are missing in maps.
+func (self *Core) CheckMaps(maps pid.Maps) error {
+	known := map[string]struct{}{}
+	for _, mr := range maps {
+		known[fmt.Sprintf("%x %s", uint64(mr.Address.Begin), mr.Path)] = struct{}{}
+	}
+
+	missing := []string{}
+	for _, f := range self.Files {
+		if _, present := known[fmt.Sprintf("%x %s", f.Start, f.Path)]; !present {
+			missing = append(missing, fmt.Sprintf("%x-%x %s", f.Start, f.End, f.Path))
+		}
+	}
+
+	if len(missing) > 0 {
+		return errors.New(fmt.Sprintf("Mapped files missing in maps: %s", strings.Join(missing, ", ")))
+	}
+
+	return nil
+}
+
+// CheckAuxv cross-checks the auxiliary vector recorded in the core against auxv,
+// as captured when inspecting the process.
+//
+// Returns an error listing all entries that differ.
+func (self *Core) CheckAuxv(auxv pid.Auxv) error {
+	mismatches := []string{}
+	for k, v := range self.Auxv {
+		if w, present := auxv[k]; !present || v != w {
+			mismatches = append(mismatches, fmt.Sprintf("%d: %#x != %#x", k, v, w))
+		}
+	}
+
+	if len(mismatches) > 0 {
+		sort.Strings(mismatches)
+		return errors.New(fmt.Sprintf("Auxiliary vectors differ: %s", strings.Join(mismatches, ", ")))
+	}
+
+	return nil
+}
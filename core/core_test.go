@@ -0,0 +1,240 @@
+package core
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/stretchr/testify/assert"
+	"github.com/vosst/csi/proc/pid"
+)
+
+var le = binary.LittleEndian
+
+// note encodes an individual ELF note owned by name.
+func note(name string, typ uint32, desc []byte) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, le, []uint32{uint32(len(name) + 1), uint32(len(desc)), typ})
+	buf.WriteString(name)
+	buf.Write(make([]byte, align4(len(name)+1)-len(name)))
+	buf.Write(desc)
+	buf.Write(make([]byte, align4(len(desc))-len(desc)))
+	return buf.Bytes()
+}
+
+// prStatus encodes an x86_64 elf_prstatus for thread tid with signal sig and the given registers.
+func prStatus(tid int32, sig int16, regs map[string]uint64) []byte {
+	b := make([]byte, 336)
+	le.PutUint16(b[12:], uint16(sig))
+	le.PutUint64(b[16:], 1<<10)
+	le.PutUint32(b[32:], uint32(tid))
+	le.PutUint32(b[36:], 1)
+	le.PutUint64(b[48:], 2)
+	le.PutUint64(b[56:], 500000)
+
+	for i, name := range registerNames[elf.EM_X86_64] {
+		le.PutUint64(b[112+8*i:], regs[name])
+	}
+
+	return b
+}
+
+func prPsInfo() []byte {
+	b := make([]byte, 136)
+	b[1] = 'R'
+	le.PutUint32(b[16:], 1000)
+	le.PutUint32(b[20:], 1001)
+	le.PutUint32(b[24:], 42)
+	copy(b[40:], "crashy")
+	copy(b[56:], "crashy --flag")
+	return b
+}
+
+func sigInfo() []byte {
+	b := make([]byte, 128)
+	le.PutUint32(b[0:], 11)
+	le.PutUint32(b[8:], 1)
+	le.PutUint64(b[16:], 0xdeadbeef)
+	return b
+}
+
+func auxv() []byte {
+	b := make([]byte, 48)
+	le.PutUint64(b[0:], 6)
+	le.PutUint64(b[8:], 4096)
+	le.PutUint64(b[16:], 9)
+	le.PutUint64(b[24:], 0x400000)
+	return b
+}
+
+func fileNote() []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, le, []uint64{2, 4096, 0x400000, 0x401000, 0, 0x7f0000000000, 0x7f0000002000, 1})
+	buf.WriteString("/usr/bin/crashy\x00/lib/libc.so.6\x00")
+	return buf.Bytes()
+}
+
+const (
+	testStackBegin = 0x7ffd0000
+	testStackSize  = 0x2000
+	testStackDump  = 0x1000
+)
+
+// testCore assembles a minimal x86_64 core file with two threads and a single, partially dumped segment.
+func testCore() []byte {
+	var notes bytes.Buffer
+	notes.Write(note("CORE", NT_PRSTATUS, prStatus(42, 11, map[string]uint64{"rip": 0x400123, "rsp": testStackBegin + 8, "rbp": testStackBegin + 16})))
+	notes.Write(note("CORE", NT_PRPSINFO, prPsInfo()))
+	notes.Write(note("CORE", NT_SIGINFO, sigInfo()))
+	notes.Write(note("CORE", NT_AUXV, auxv()))
+	notes.Write(note("CORE", NT_FILE, fileNote()))
+	notes.Write(note("LINUX", 0x202, []byte{1, 2, 3}))
+	notes.Write(note("CORE", NT_PRSTATUS, prStatus(43, 0, nil)))
+
+	stack := make([]byte, testStackDump)
+	le.PutUint64(stack[8:], 0xcafe)
+
+	notesOff := uint64(64 + 2*56)
+	loadOff := notesOff + uint64(notes.Len())
+
+	var buf bytes.Buffer
+	buf.Write([]byte{0x7f, 'E', 'L', 'F', byte(elf.ELFCLASS64), byte(elf.ELFDATA2LSB), byte(elf.EV_CURRENT), 0, 0, 0, 0, 0, 0, 0, 0, 0})
+	binary.Write(&buf, le, uint16(elf.ET_CORE))
+	binary.Write(&buf, le, uint16(elf.EM_X86_64))
+	binary.Write(&buf, le, uint32(elf.EV_CURRENT))
+	binary.Write(&buf, le, []uint64{0, 64, 0})
+	binary.Write(&buf, le, uint32(0))
+	binary.Write(&buf, le, []uint16{64, 56, 2, 64, 0, 0})
+
+	binary.Write(&buf, le, elf.Prog64{Type: uint32(elf.PT_NOTE), Off: notesOff, Filesz: uint64(notes.Len()), Align: 4})
+	binary.Write(&buf, le, elf.Prog64{Type: uint32(elf.PT_LOAD), Flags: uint32(elf.PF_R | elf.PF_W), Off: loadOff, Vaddr: testStackBegin, Filesz: testStackDump, Memsz: testStackSize, Align: 4096})
+
+	buf.Write(notes.Bytes())
+	buf.Write(stack)
+
+	return buf.Bytes()
+}
+
+func TestNewCoreParsesThreads(t *testing.T) {
+	core, err := NewCore(bytes.NewReader(testCore()))
+	assert.Nil(t, err)
+
+	assert.Equal(t, elf.EM_X86_64, core.Machine)
+	assert.Equal(t, 2, len(core.Threads))
+
+	thread := core.FaultingThread()
+	assert.Equal(t, 42, thread.Pid)
+	assert.Equal(t, 1, thread.Ppid)
+	assert.Equal(t, 11, thread.Signal)
+	assert.Equal(t, uint64(1<<10), thread.SigPending)
+	assert.Equal(t, 2*time.Second+500*time.Millisecond, thread.UserTime)
+	assert.Equal(t, 27, len(thread.Registers.Values))
+
+	pc, _ := thread.Registers.PC()
+	sp, _ := thread.Registers.SP()
+	fp, _ := thread.Registers.FP()
+	assert.Equal(t, uint64(0x400123), pc)
+	assert.Equal(t, uint64(testStackBegin+8), sp)
+	assert.Equal(t, uint64(testStackBegin+16), fp)
+	assert.Equal(t, uint64(0x400123), thread.Registers.Map()["rip"])
+}
+
+func TestNewCoreParsesProcessAndSignalInfo(t *testing.T) {
+	core, err := NewCore(bytes.NewReader(testCore()))
+	assert.Nil(t, err)
+
+	assert.Equal(t, &ProcessInfo{Sname: 'R', Uid: 1000, Gid: 1001, Pid: 42, Fname: "crashy", Args: "crashy --flag"}, core.ProcessInfo)
+	assert.Equal(t, int32(11), core.SigInfo.Signo)
+	assert.Equal(t, int32(1), core.SigInfo.Code)
+	assert.Equal(t, uint64(0xdeadbeef), core.SigInfo.Addr)
+}
+
+func TestNewCoreParsesAuxvAndMappedFiles(t *testing.T) {
+	core, err := NewCore(bytes.NewReader(testCore()))
+	assert.Nil(t, err)
+
+	assert.Equal(t, map[uint64]uint64{6: 4096, 9: 0x400000}, core.Auxv)
+	assert.Equal(t, []MappedFile{
+		{0x400000, 0x401000, 0, "/usr/bin/crashy"},
+		{0x7f0000000000, 0x7f0000002000, 4096, "/lib/libc.so.6"},
+	}, core.Files)
+}
+
+func TestParseFileRejectsCorruptCounts(t *testing.T) {
+	for _, count := range []uint64{4, 1 << 62, 1<<64 - 1} {
+		b := fileNote()
+		le.PutUint64(b, count)
+
+		_, err := decoder{elf.ELFCLASS64, le, b}.parseFile()
+		assert.IsType(t, ErrorMalformedNote{}, err, count)
+	}
+
+	_, err := decoder{elf.ELFCLASS64, le, fileNote()[:8]}.parseFile()
+	assert.IsType(t, ErrorMalformedNote{}, err)
+}
+
+func TestReadMemoryReadsDumpedAndZeroFillsMissingContents(t *testing.T) {
+	core, err := NewCore(bytes.NewReader(testCore()))
+	assert.Nil(t, err)
+
+	w, err := core.ReadWord(testStackBegin + 8)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0xcafe), w)
+
+	w, err = core.ReadWord(testStackBegin + testStackDump + 8)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0), w)
+
+	_, err = core.ReadWord(0x1000)
+	assert.NotNil(t, err)
+}
+
+func TestNewCoreRejectsNonCoreFiles(t *testing.T) {
+	b := testCore()
+	le.PutUint16(b[16:], uint16(elf.ET_EXEC))
+	_, err := NewCore(bytes.NewReader(b))
+	assert.NotNil(t, err)
+
+	_, err = NewCore(strings.NewReader("not an elf file"))
+	assert.NotNil(t, err)
+}
+
+func TestOpenHandlesSnappyCompressedCores(t *testing.T) {
+	f, err := ioutil.TempFile("", "csi-core-test")
+	assert.Nil(t, err)
+	defer os.Remove(f.Name())
+
+	w := snappy.NewWriter(f)
+	w.Write(testCore())
+	w.Close()
+	f.Close()
+
+	core, err := Open(f.Name())
+	assert.Nil(t, err)
+	defer core.Close()
+
+	assert.Equal(t, 42, core.FaultingThread().Pid)
+	w2, err := core.ReadWord(testStackBegin + 8)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0xcafe), w2)
+}
+
+func TestCheckMapsAndAuxvReportMismatches(t *testing.T) {
+	core, err := NewCore(bytes.NewReader(testCore()))
+	assert.Nil(t, err)
+
+	maps, _ := pid.NewMapsFromReader(strings.NewReader(
+		"00400000-00401000 r-xp 00000000 08:02 1 /usr/bin/crashy\n" +
+			"7f0000000000-7f0000002000 r-xp 00001000 08:02 2 /lib/libc.so.6\n"))
+	assert.Nil(t, core.CheckMaps(maps))
+	assert.NotNil(t, core.CheckMaps(maps[:1]))
+
+	assert.Nil(t, core.CheckAuxv(pid.Auxv{6: 4096, 9: 0x400000}))
+	assert.NotNil(t, core.CheckAuxv(pid.Auxv{6: 4096}))
+}
@@ -0,0 +1,289 @@
+package core
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Note types found in core dumps, taken from ${KERNELSRC}/include/uapi/linux/elf.h
+const (
+	NT_PRSTATUS = 1          // Status of an individual thread, including its registers
+	NT_FPREGSET = 2          // Floating point registers of an individual thread
+	NT_PRPSINFO = 3          // Information about the process
+	NT_AUXV     = 6          // Contents of the auxiliary vector
+	NT_SIGINFO  = 0x53494749 // Information about the signal causing the dump
+	NT_FILE     = 0x46494c45 // Table of mapped files
+)
+
+// Thread describes an individual thread of the dumped process, as captured in an NT_PRSTATUS note.
+type Thread struct {
+	Pid        int           // Id of the thread
+	Ppid       int           // Id of the parent process
+	Pgrp       int           // Process group id
+	Sid        int           // Session id
+	Signal     int           // Current signal of the thread, non-zero for the thread that received the fatal signal
+	SigPending uint64        // Bitmap of pending signals
+	SigHeld    uint64        // Bitmap of blocked signals
+	UserTime   time.Duration // Time spent in user mode
+	SystemTime time.Duration // Time spent in kernel mode
+	Registers  Registers     // General purpose registers
+}
+
+// ProcessInfo describes the dumped process, as captured in an NT_PRPSINFO note.
+type ProcessInfo struct {
+	State  byte   // Numeric process state
+	Sname  byte   // Process state as character, see pid.State
+	Zombie bool   // True if the process is a zombie
+	Nice   int8   // Nice value
+	Flags  uint64 // Kernel flags of the process, see pid.Flags
+	Uid    uint32 // User id
+	Gid    uint32 // Group id
+	Pid    int    // Process id
+	Ppid   int    // Id of the parent process
+	Pgrp   int    // Process group id
+	Sid    int    // Session id
+	Fname  string // Filename of the executable
+	Args   string // Initial part of the argument list
+}
+
+// SigInfo describes the signal that caused the dump, as captured in an NT_SIGINFO note.
+//
+// Depending on the signal, either Addr or Pid and Uid carry meaningful values.
+type SigInfo struct {
+	Signo int32  // Signal number
+	Errno int32  // Errno value
+	Code  int32  // Signal code
+	Addr  uint64 // Faulting address for SIGSEGV, SIGBUS, SIGILL, SIGFPE and SIGTRAP
+	Pid   int32  // Id of the sending process for signals sent with kill
+	Uid   uint32 // Real user id of the sending process for signals sent with kill
+}
+
+// MappedFile describes a file mapped into the address space of the dumped process,
+// as captured in an NT_FILE note.
+type MappedFile struct {
+	Start  uint64 // Start address of the mapping
+	End    uint64 // End address of the mapping
+	Offset uint64 // Offset into the file in bytes
+	Path   string // Path of the mapped file
+}
+
+// ErrorMalformedNote indicates a note that is too short for its type.
+type ErrorMalformedNote struct {
+	Type uint32 // Type of the offending note
+	Size int    // Size of the offending note's descriptor
+}
+
+// Error pretty prints the given ErrorMalformedNote instance.
+func (self ErrorMalformedNote) Error() string {
+	return fmt.Sprintf("Malformed note of type %#x with %d bytes", self.Type, self.Size)
+}
+
+// decoder reads fixed-size values from a note descriptor, given the class
+// and byte order of the core file.
+type decoder struct {
+	class elf.Class
+	order binary.ByteOrder
+	b     []byte
+}
+
+func (self decoder) wordSize() int {
+	if self.class == elf.ELFCLASS64 {
+		return 8
+	}
+
+	return 4
+}
+
+func (self decoder) u16(off int) uint16 {
+	return self.order.Uint16(self.b[off:])
+}
+
+func (self decoder) u32(off int) uint32 {
+	return self.order.Uint32(self.b[off:])
+}
+
+func (self decoder) i32(off int) int {
+	return int(int32(self.u32(off)))
+}
+
+func (self decoder) word(off int) uint64 {
+	if self.class == elf.ELFCLASS64 {
+		return self.order.Uint64(self.b[off:])
+	}
+
+	return uint64(self.u32(off))
+}
+
+func (self decoder) timeval(off int) time.Duration {
+	sec := self.word(off)
+	usec := self.word(off + self.wordSize())
+	return time.Duration(sec)*time.Second + time.Duration(usec)*time.Microsecond
+}
+
+func (self decoder) str(off, n int) string {
+	b := self.b[off : off+n]
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+
+	return string(b)
+}
+
+// parsePrStatus decodes an elf_prstatus structure.
+func (self decoder) parsePrStatus(machine elf.Machine) (Thread, error) {
+	ws := self.wordSize()
+
+	// Offsets in struct elf_prstatus, see ${KERNELSRC}/include/linux/elfcore.h
+	sigpend := 16
+	pids := sigpend + 2*ws
+	times := pids + 16
+	regs := times + 8*ws
+	fpvalid := 8
+	if ws == 4 {
+		fpvalid = 4
+	}
+
+	if len(self.b) < regs+fpvalid {
+		return Thread{}, ErrorMalformedNote{NT_PRSTATUS, len(self.b)}
+	}
+
+	thread := Thread{
+		Signal:     int(int16(self.u16(12))),
+		SigPending: self.word(sigpend),
+		SigHeld:    self.word(sigpend + ws),
+		Pid:        self.i32(pids),
+		Ppid:       self.i32(pids + 4),
+		Pgrp:       self.i32(pids + 8),
+		Sid:        self.i32(pids + 12),
+		UserTime:   self.timeval(times),
+		SystemTime: self.timeval(times + 2*ws),
+	}
+
+	thread.Registers.Machine = machine
+	for off := regs; off+ws <= len(self.b)-fpvalid; off += ws {
+		thread.Registers.Values = append(thread.Registers.Values, self.word(off))
+	}
+
+	return thread, nil
+}
+
+// parsePrPsInfo decodes an elf_prpsinfo structure.
+func (self decoder) parsePrPsInfo() (ProcessInfo, error) {
+	ws := self.wordSize()
+
+	// On 32-bit architectures, uid and gid are 16-bit values.
+	ids := 8 + ws
+	idSize := 4
+	if ws == 4 {
+		ids = 8
+		idSize = 2
+	}
+	pids := ids + 2*idSize
+	fname := pids + 16
+
+	if len(self.b) < fname+16+80 {
+		return ProcessInfo{}, ErrorMalformedNote{NT_PRPSINFO, len(self.b)}
+	}
+
+	pi := ProcessInfo{
+		State:  self.b[0],
+		Sname:  self.b[1],
+		Zombie: self.b[2] != 0,
+		Nice:   int8(self.b[3]),
+		Flags:  self.word(ws),
+		Pid:    self.i32(pids),
+		Ppid:   self.i32(pids + 4),
+		Pgrp:   self.i32(pids + 8),
+		Sid:    self.i32(pids + 12),
+		Fname:  self.str(fname, 16),
+		Args:   self.str(fname+16, 80),
+	}
+
+	if idSize == 2 {
+		pi.Uid, pi.Gid = uint32(self.u16(ids)), uint32(self.u16(ids+2))
+	} else {
+		pi.Uid, pi.Gid = self.u32(ids), self.u32(ids+4)
+	}
+
+	return pi, nil
+}
+
+// parseSigInfo decodes a siginfo_t structure.
+func (self decoder) parseSigInfo() (SigInfo, error) {
+	fields := 12
+	if self.wordSize() == 8 {
+		fields = 16
+	}
+
+	if len(self.b) < fields+self.wordSize() {
+		return SigInfo{}, ErrorMalformedNote{NT_SIGINFO, len(self.b)}
+	}
+
+	return SigInfo{
+		Signo: int32(self.u32(0)),
+		Errno: int32(self.u32(4)),
+		Code:  int32(self.u32(8)),
+		Addr:  self.word(fields),
+		Pid:   int32(self.u32(fields)),
+		Uid:   self.u32(fields + 4),
+	}, nil
+}
+
+// parseAuxv decodes the auxiliary vector, a sequence of (type, value) pairs terminated by AT_NULL.
+func (self decoder) parseAuxv() map[uint64]uint64 {
+	ws := self.wordSize()
+	auxv := map[uint64]uint64{}
+
+	for off := 0; off+2*ws <= len(self.b); off += 2 * ws {
+		k := self.word(off)
+		if k == 0 {
+			break
+		}
+
+		auxv[k] = self.word(off + ws)
+	}
+
+	return auxv
+}
+
+// parseFile decodes the table of mapped files. Please see fill_files_note in
+// ${KERNELSRC}/fs/binfmt_elf.c for a description of the layout.
+func (self decoder) parseFile() ([]MappedFile, error) {
+	ws := self.wordSize()
+
+	if len(self.b) < 2*ws {
+		return nil, ErrorMalformedNote{NT_FILE, len(self.b)}
+	}
+
+	// The count is taken from the core, reject counts exceeding the size of
+	// the note before computing offsets that might overflow.
+	if self.word(0) > uint64((len(self.b)-2*ws)/(3*ws)) {
+		return nil, ErrorMalformedNote{NT_FILE, len(self.b)}
+	}
+
+	count := int(self.word(0))
+	pageSize := self.word(ws)
+	names := 2*ws + count*3*ws
+
+	paths := bytes.Split(self.b[names:], []byte{0})
+	if len(paths) < count {
+		return nil, errors.New(fmt.Sprintf("Expected %d file names in NT_FILE note, found %d", count, len(paths)))
+	}
+
+	files := make([]MappedFile, count)
+	for i := range files {
+		off := 2*ws + i*3*ws
+		files[i] = MappedFile{
+			Start:  self.word(off),
+			End:    self.word(off + ws),
+			Offset: self.word(off+2*ws) * pageSize,
+			Path:   string(paths[i]),
+		}
+	}
+
+	return files, nil
+}
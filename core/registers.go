@@ -0,0 +1,100 @@
+package core
+
+import (
+	"debug/elf"
+	"fmt"
+)
+
+// registerNames maps machines to the names of the registers in their general
+// purpose register set, in the order of the kernel's user_regs_struct.
+var registerNames = map[elf.Machine][]string{
+	elf.EM_X86_64: []string{
+		"r15", "r14", "r13", "r12", "rbp", "rbx", "r11", "r10", "r9", "r8",
+		"rax", "rcx", "rdx", "rsi", "rdi", "orig_rax", "rip", "cs", "eflags",
+		"rsp", "ss", "fs_base", "gs_base", "ds", "es", "fs", "gs",
+	},
+	elf.EM_386: []string{
+		"ebx", "ecx", "edx", "esi", "edi", "ebp", "eax", "xds", "xes", "xfs",
+		"xgs", "orig_eax", "eip", "xcs", "eflags", "esp", "xss",
+	},
+	elf.EM_AARCH64: []string{
+		"x0", "x1", "x2", "x3", "x4", "x5", "x6", "x7", "x8", "x9", "x10",
+		"x11", "x12", "x13", "x14", "x15", "x16", "x17", "x18", "x19", "x20",
+		"x21", "x22", "x23", "x24", "x25", "x26", "x27", "x28", "x29", "x30",
+		"sp", "pc", "pstate",
+	},
+	elf.EM_ARM: []string{
+		"r0", "r1", "r2", "r3", "r4", "r5", "r6", "r7", "r8", "r9", "r10",
+		"fp", "ip", "sp", "lr", "pc", "cpsr", "orig_r0",
+	},
+}
+
+// specialRegisters maps machines to the names of their program counter,
+// stack pointer and frame pointer registers.
+var specialRegisters = map[elf.Machine][3]string{
+	elf.EM_X86_64:  {"rip", "rsp", "rbp"},
+	elf.EM_386:     {"eip", "esp", "ebp"},
+	elf.EM_AARCH64: {"pc", "sp", "x29"},
+	elf.EM_ARM:     {"pc", "sp", "fp"},
+}
+
+// Registers describes the general purpose register set of a thread.
+type Registers struct {
+	Machine elf.Machine // The machine the registers belong to.
+	Values  []uint64    // Register values in the order of the kernel's user_regs_struct.
+}
+
+// Name returns the name of the i-th register, falling back to its index for unknown machines.
+func (self Registers) Name(i int) string {
+	if names, present := registerNames[self.Machine]; present && i < len(names) {
+		return names[i]
+	}
+
+	return fmt.Sprintf("r%d", i)
+}
+
+// Get returns the value of the register called name.
+//
+// Returns false if the register is unknown.
+func (self Registers) Get(name string) (uint64, bool) {
+	for i, v := range self.Values {
+		if self.Name(i) == name {
+			return v, true
+		}
+	}
+
+	return 0, false
+}
+
+func (self Registers) special(i int) (uint64, bool) {
+	if names, present := specialRegisters[self.Machine]; present {
+		return self.Get(names[i])
+	}
+
+	return 0, false
+}
+
+// PC returns the program counter.
+func (self Registers) PC() (uint64, bool) {
+	return self.special(0)
+}
+
+// SP returns the stack pointer.
+func (self Registers) SP() (uint64, bool) {
+	return self.special(1)
+}
+
+// FP returns the frame pointer.
+func (self Registers) FP() (uint64, bool) {
+	return self.special(2)
+}
+
+// Map returns all registers keyed by name.
+func (self Registers) Map() map[string]uint64 {
+	m := make(map[string]uint64, len(self.Values))
+	for i, v := range self.Values {
+		m[self.Name(i)] = v
+	}
+
+	return m
+}
@@ -0,0 +1,67 @@
+package coredump
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MaxPatternLength is the maximum length of a core pattern accepted by the kernel,
+// taken from ${KERNELSRC}/include/linux/binfmts.h (CORENAME_MAX_SIZE minus the
+// terminating NUL).
+const MaxPatternLength = 127
+
+// DefaultCrashDir is the crash directory assumed by 'csi dump' if none is given.
+const DefaultCrashDir = "/var/crash"
+
+// ErrorPatternTooLong indicates that a core pattern exceeds MaxPatternLength.
+type ErrorPatternTooLong struct {
+	Pattern string // The offending pattern.
+}
+
+// Error pretty prints the given ErrorPatternTooLong instance.
+func (self ErrorPatternTooLong) Error() string {
+	return fmt.Sprintf("Core pattern %s exceeds %d characters", self.Pattern, MaxPatternLength)
+}
+
+// Handler describes an invocation of 'csi dump' as pipe handler for core dumps.
+type Handler struct {
+	Executable string // Absolute path to the csi executable.
+	CrashDir   string // Destination directory for crash reports, omitted if empty or DefaultCrashDir.
+	Compress   bool   // Compress core dumps with snappy.
+}
+
+// Pattern assembles the core pattern invoking the handler, handing the
+// crash-specific information provided by the kernel to 'csi dump'.
+// Please see man core for the individual specifiers.
+//
+// Returns an error if the resulting pattern exceeds MaxPatternLength.
+func (self Handler) Pattern() (string, error) {
+	args := []string{
+		"|" + self.Executable,
+		"dump",
+		"--pid=%p",
+		"--tid=%i",
+		"--uid=%u",
+		"--gid=%g",
+		"--sig=%s",
+		"--time=%t",
+		"--host=%h",
+		"--exe=%e",
+		"--size=%c",
+	}
+
+	if len(self.CrashDir) > 0 && self.CrashDir != DefaultCrashDir {
+		args = append(args, "--crash-dir="+self.CrashDir)
+	}
+
+	if self.Compress {
+		args = append(args, "--compress")
+	}
+
+	pattern := strings.Join(args, " ")
+	if len(pattern) > MaxPatternLength {
+		return "", ErrorPatternTooLong{pattern}
+	}
+
+	return pattern, nil
+}
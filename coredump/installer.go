@@ -0,0 +1,225 @@
+package coredump
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	DefaultSysDir     = "/proc/sys"                        // Default mount point of the sysctl tree.
+	DefaultSysctlDir  = "/etc/sysctl.d"                    // Default directory for sysctl drop-in files.
+	DefaultBackupFile = "/var/lib/csi/core_pattern.backup" // Default location for preserving previous settings.
+	DefaultPipeLimit  = 10                                 // Default number of crashing processes handled in parallel.
+
+	// SysctlDropIn is the name of the drop-in file persisting the settings across reboots.
+	SysctlDropIn = "60-csi-core-pattern.conf"
+
+	keyCorePattern   = "kernel.core_pattern"
+	keyCorePipeLimit = "kernel.core_pipe_limit"
+)
+
+// ErrNotInstalled is returned by Installer.Uninstall if no previous settings have been preserved.
+var ErrNotInstalled = errors.New("csi is not installed as core dump handler")
+
+// Settings bundles the kernel parameters controlling core dump handling.
+// Please see man core for further details.
+type Settings struct {
+	CorePattern   string // Template for naming core dumps or pipe handler invocation.
+	CorePipeLimit int    // Number of crashing processes that may be piped to the handler in parallel, 0 for unlimited.
+}
+
+// NewSettingsFromReader parses settings in sysctl.conf format from reader,
+// silently skipping over comments and unknown keys.
+//
+// Returns an error if reading fails or if a known key has an invalid value.
+func NewSettingsFromReader(reader io.Reader) (Settings, error) {
+	settings := Settings{}
+
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		tokens := strings.SplitN(line, "=", 2)
+		if len(tokens) != 2 {
+			continue
+		}
+
+		switch strings.TrimSpace(tokens[0]) {
+		case keyCorePattern:
+			settings.CorePattern = strings.TrimSpace(tokens[1])
+		case keyCorePipeLimit:
+			limit, err := strconv.Atoi(strings.TrimSpace(tokens[1]))
+			if err != nil {
+				return settings, errors.New(fmt.Sprintf("Failed to parse %s [%s]", keyCorePipeLimit, err))
+			}
+			settings.CorePipeLimit = limit
+		}
+	}
+
+	return settings, scanner.Err()
+}
+
+// WriteTo writes settings in sysctl.conf format to writer.
+func (self Settings) WriteTo(writer io.Writer) (int64, error) {
+	n, err := fmt.Fprintf(writer, "%s = %s\n%s = %d\n", keyCorePattern, self.CorePattern, keyCorePipeLimit, self.CorePipeLimit)
+	return int64(n), err
+}
+
+// Installer registers 'csi dump' as the kernel's core dump handler.
+type Installer struct {
+	SysDir     string // Root of the sysctl tree, usually /proc/sys.
+	SysctlDir  string // Directory receiving the sysctl drop-in file for persistent installations.
+	BackupFile string // File preserving the settings in place before installation.
+}
+
+// NewInstaller returns an Installer operating on the system's default locations.
+func NewInstaller() Installer {
+	return Installer{DefaultSysDir, DefaultSysctlDir, DefaultBackupFile}
+}
+
+func (self Installer) corePatternFile() string {
+	return filepath.Join(self.SysDir, "kernel", "core_pattern")
+}
+
+func (self Installer) corePipeLimitFile() string {
+	return filepath.Join(self.SysDir, "kernel", "core_pipe_limit")
+}
+
+func (self Installer) dropInFile() string {
+	return filepath.Join(self.SysctlDir, SysctlDropIn)
+}
+
+// Current reads the settings currently active in the kernel.
+//
+// Returns an error if reading the settings from the sysctl tree fails.
+func (self Installer) Current() (Settings, error) {
+	settings := Settings{}
+
+	b, err := ioutil.ReadFile(self.corePatternFile())
+	if err != nil {
+		return settings, errors.New(fmt.Sprintf("Failed to read core pattern [%s]", err))
+	}
+	settings.CorePattern = strings.TrimRight(string(b), "\n")
+
+	b, err = ioutil.ReadFile(self.corePipeLimitFile())
+	if err != nil {
+		return settings, errors.New(fmt.Sprintf("Failed to read core pipe limit [%s]", err))
+	}
+
+	if settings.CorePipeLimit, err = strconv.Atoi(strings.TrimSpace(string(b))); err != nil {
+		return settings, errors.New(fmt.Sprintf("Failed to parse core pipe limit [%s]", err))
+	}
+
+	return settings, nil
+}
+
+// apply activates settings in the kernel.
+func (self Installer) apply(settings Settings) error {
+	if err := ioutil.WriteFile(self.corePatternFile(), []byte(settings.CorePattern+"\n"), 0644); err != nil {
+		return errors.New(fmt.Sprintf("Failed to write core pattern [%s]", err))
+	}
+
+	if err := ioutil.WriteFile(self.corePipeLimitFile(), []byte(fmt.Sprintf("%d\n", settings.CorePipeLimit)), 0644); err != nil {
+		return errors.New(fmt.Sprintf("Failed to write core pipe limit [%s]", err))
+	}
+
+	return nil
+}
+
+// writeSettings stores settings in sysctl.conf format to the file fn, creating parent directories as needed.
+func writeSettings(fn string, settings Settings) error {
+	if err := os.MkdirAll(filepath.Dir(fn), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.Create(fn)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	_, err = settings.WriteTo(f)
+	return err
+}
+
+// Install registers handler as the kernel's core dump handler, allowing for
+// pipeLimit crashing processes to be handled in parallel. The previous settings
+// are preserved in BackupFile, unless a backup already exists from an earlier
+// installation. If persist is true, a sysctl drop-in file is written to SysctlDir
+// such that the settings survive a reboot.
+//
+// Returns an error if assembling the core pattern, preserving the previous
+// settings or applying the new settings fails.
+func (self Installer) Install(handler Handler, pipeLimit int, persist bool) error {
+	pattern, err := handler.Pattern()
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(self.BackupFile); os.IsNotExist(err) {
+		current, err := self.Current()
+		if err != nil {
+			return err
+		}
+
+		if err := writeSettings(self.BackupFile, current); err != nil {
+			return errors.New(fmt.Sprintf("Failed to back up current settings to %s [%s]", self.BackupFile, err))
+		}
+	}
+
+	settings := Settings{pattern, pipeLimit}
+
+	if err := self.apply(settings); err != nil {
+		return err
+	}
+
+	if persist {
+		if err := writeSettings(self.dropInFile(), settings); err != nil {
+			return errors.New(fmt.Sprintf("Failed to write sysctl drop-in %s [%s]", self.dropInFile(), err))
+		}
+	}
+
+	return nil
+}
+
+// Uninstall restores the settings preserved by Install and removes the
+// backup as well as the sysctl drop-in file.
+//
+// Returns ErrNotInstalled if no backup exists, or an error if restoring the
+// previous settings fails.
+func (self Installer) Uninstall() error {
+	f, err := os.Open(self.BackupFile)
+	if os.IsNotExist(err) {
+		return ErrNotInstalled
+	} else if err != nil {
+		return errors.New(fmt.Sprintf("Failed to open backup %s [%s]", self.BackupFile, err))
+	}
+
+	defer f.Close()
+
+	settings, err := NewSettingsFromReader(f)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Failed to read backup %s [%s]", self.BackupFile, err))
+	}
+
+	if err := self.apply(settings); err != nil {
+		return err
+	}
+
+	if err := os.Remove(self.dropInFile()); err != nil && !os.IsNotExist(err) {
+		return errors.New(fmt.Sprintf("Failed to remove sysctl drop-in %s [%s]", self.dropInFile(), err))
+	}
+
+	return os.Remove(self.BackupFile)
+}
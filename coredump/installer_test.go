@@ -0,0 +1,129 @@
+package coredump
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const apportPattern = "|/usr/share/apport/apport %p %s %c %d %P"
+
+// newTestInstaller sets up a fake sysctl tree in a temporary directory.
+func newTestInstaller(t *testing.T) (Installer, func()) {
+	dir, err := ioutil.TempDir("", "csi-coredump")
+	assert.Nil(t, err)
+
+	os.MkdirAll(filepath.Join(dir, "sys", "kernel"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "sys", "kernel", "core_pattern"), []byte(apportPattern+"\n"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "sys", "kernel", "core_pipe_limit"), []byte("0\n"), 0644)
+
+	installer := Installer{filepath.Join(dir, "sys"), filepath.Join(dir, "sysctl.d"), filepath.Join(dir, "lib", "backup")}
+	return installer, func() { os.RemoveAll(dir) }
+}
+
+var testHandler = Handler{Executable: "/usr/bin/csi"}
+
+func TestHandlerPatternPassesAllSpecifiers(t *testing.T) {
+	pattern, err := testHandler.Pattern()
+	assert.Nil(t, err)
+	assert.Equal(t, "|/usr/bin/csi dump --pid=%p --tid=%i --uid=%u --gid=%g --sig=%s --time=%t --host=%h --exe=%e --size=%c", pattern)
+}
+
+func TestHandlerPatternOnlyIncludesNonDefaultCrashDir(t *testing.T) {
+	pattern, _ := Handler{"/usr/bin/csi", DefaultCrashDir, true}.Pattern()
+	assert.True(t, strings.HasSuffix(pattern, "--size=%c --compress"))
+
+	pattern, _ = Handler{"/usr/bin/csi", "/srv/crash", false}.Pattern()
+	assert.True(t, strings.HasSuffix(pattern, "--size=%c --crash-dir=/srv/crash"))
+}
+
+func TestHandlerPatternRejectsTooLongPatterns(t *testing.T) {
+	_, err := Handler{"/usr/bin/csi", "/a/very/long/path/to/a/directory/for/crashes", true}.Pattern()
+	assert.IsType(t, ErrorPatternTooLong{}, err)
+}
+
+func TestInstallWritesPatternAndPipeLimitAndPreservesPreviousSettings(t *testing.T) {
+	installer, cleanup := newTestInstaller(t)
+	defer cleanup()
+
+	assert.Nil(t, installer.Install(testHandler, DefaultPipeLimit, false))
+
+	settings, err := installer.Current()
+	assert.Nil(t, err)
+	pattern, _ := testHandler.Pattern()
+	assert.Equal(t, Settings{pattern, DefaultPipeLimit}, settings)
+
+	f, err := os.Open(installer.BackupFile)
+	assert.Nil(t, err)
+	defer f.Close()
+
+	backup, err := NewSettingsFromReader(f)
+	assert.Nil(t, err)
+	assert.Equal(t, Settings{apportPattern, 0}, backup)
+
+	_, err = os.Stat(filepath.Join(installer.SysctlDir, SysctlDropIn))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestInstallTwiceKeepsOriginalBackup(t *testing.T) {
+	installer, cleanup := newTestInstaller(t)
+	defer cleanup()
+
+	assert.Nil(t, installer.Install(testHandler, DefaultPipeLimit, false))
+	assert.Nil(t, installer.Install(Handler{"/usr/bin/csi", "", true}, DefaultPipeLimit, false))
+	assert.Nil(t, installer.Uninstall())
+
+	settings, err := installer.Current()
+	assert.Nil(t, err)
+	assert.Equal(t, Settings{apportPattern, 0}, settings)
+}
+
+func TestInstallWithPersistenceWritesSysctlDropIn(t *testing.T) {
+	installer, cleanup := newTestInstaller(t)
+	defer cleanup()
+
+	assert.Nil(t, installer.Install(testHandler, 4, true))
+
+	f, err := os.Open(filepath.Join(installer.SysctlDir, SysctlDropIn))
+	assert.Nil(t, err)
+	defer f.Close()
+
+	settings, err := NewSettingsFromReader(f)
+	assert.Nil(t, err)
+	pattern, _ := testHandler.Pattern()
+	assert.Equal(t, Settings{pattern, 4}, settings)
+}
+
+func TestUninstallRestoresPreviousSettingsAndRemovesFiles(t *testing.T) {
+	installer, cleanup := newTestInstaller(t)
+	defer cleanup()
+
+	assert.Nil(t, installer.Install(testHandler, DefaultPipeLimit, true))
+	assert.Nil(t, installer.Uninstall())
+
+	settings, err := installer.Current()
+	assert.Nil(t, err)
+	assert.Equal(t, Settings{apportPattern, 0}, settings)
+
+	_, err = os.Stat(filepath.Join(installer.SysctlDir, SysctlDropIn))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(installer.BackupFile)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestUninstallFailsIfNotInstalled(t *testing.T) {
+	installer, cleanup := newTestInstaller(t)
+	defer cleanup()
+
+	assert.Equal(t, ErrNotInstalled, installer.Uninstall())
+}
+
+func TestNewSettingsFromReaderSkipsCommentsAndUnknownKeys(t *testing.T) {
+	settings, err := NewSettingsFromReader(strings.NewReader("# comment\nkernel.core_pattern = core\nvm.swappiness = 10\nkernel.core_pipe_limit=2\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, Settings{"core", 2}, settings)
+}
@@ -0,0 +1,36 @@
+package crash
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Backoff computes exponentially growing delays between retries of failed uploads.
+type Backoff struct {
+	Initial time.Duration // Delay after the first failed attempt
+	Max     time.Duration // Upper bound for delays
+	Factor  float64       // Growth factor of delays between consecutive attempts
+	Jitter  float64       // Fraction of the delay that is randomized, in [0, 1]
+}
+
+// DefaultBackoff starts retrying after a minute and backs off to at most a day.
+var DefaultBackoff = Backoff{time.Minute, 24 * time.Hour, 2, 0.2}
+
+// Delay returns the delay before retrying after attempts failed attempts,
+// randomizing it with rnd to avoid many clients retrying in lockstep.
+func (self Backoff) Delay(attempts int, rnd *rand.Rand) time.Duration {
+	d := float64(self.Initial)
+	for i := 1; i < attempts && d < float64(self.Max); i++ {
+		d *= self.Factor
+	}
+
+	if d > float64(self.Max) {
+		d = float64(self.Max)
+	}
+
+	if self.Jitter > 0 && rnd != nil {
+		d += d * self.Jitter * (2*rnd.Float64() - 1)
+	}
+
+	return time.Duration(d)
+}
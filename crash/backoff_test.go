@@ -0,0 +1,29 @@
+package crash
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackoffGrowsExponentiallyUpToMax(t *testing.T) {
+	b := Backoff{time.Second, time.Minute, 2, 0}
+
+	assert.Equal(t, time.Second, b.Delay(1, nil))
+	assert.Equal(t, 2*time.Second, b.Delay(2, nil))
+	assert.Equal(t, 8*time.Second, b.Delay(4, nil))
+	assert.Equal(t, time.Minute, b.Delay(10, nil))
+	assert.Equal(t, time.Minute, b.Delay(1000, nil))
+}
+
+func TestBackoffJitterStaysWithinBounds(t *testing.T) {
+	b := Backoff{time.Second, time.Minute, 2, 0.5}
+	rnd := rand.New(rand.NewSource(42))
+
+	for i := 0; i < 100; i++ {
+		d := b.Delay(3, rnd)
+		assert.True(t, d >= 2*time.Second && d <= 6*time.Second, "delay %s out of bounds", d)
+	}
+}
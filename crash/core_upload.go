@@ -0,0 +1,124 @@
+package crash
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/golang/snappy"
+)
+
+// CoreCompression enumerates the encodings applied to core dumps while uploading them.
+type CoreCompression string
+
+const (
+	CoreCompressionNone   CoreCompression = ""       // Cores are uploaded as is
+	CoreCompressionGzip   CoreCompression = "gzip"   // Cores are compressed with gzip, as expected by the Ubuntu error tracker
+	CoreCompressionSnappy CoreCompression = "snappy" // Cores are compressed with snappy, as written by 'csi dump --compress'
+)
+
+// ParseCoreCompression returns the CoreCompression named by s, accepting "none" for CoreCompressionNone.
+//
+// Returns an error if s does not name a known compression.
+func ParseCoreCompression(s string) (CoreCompression, error) {
+	switch c := CoreCompression(s); c {
+	case CoreCompressionNone, CoreCompressionGzip, CoreCompressionSnappy:
+		return c, nil
+	case "none":
+		return CoreCompressionNone, nil
+	}
+
+	return CoreCompressionNone, errors.New(fmt.Sprintf("Unknown core compression %s", s))
+}
+
+// ErrorCoreTooLarge indicates that a core dump exceeds the size accepted for uploads.
+type ErrorCoreTooLarge struct {
+	Limit int64 // Maximum size of core dumps in bytes
+}
+
+// Error pretty prints the given ErrorCoreTooLarge instance.
+func (self ErrorCoreTooLarge) Error() string {
+	return fmt.Sprintf("Core dump exceeds the maximum size of %d bytes", self.Limit)
+}
+
+// coreReader counts the bytes read from a core dump, enforcing a size limit
+// and reporting the progress to a callback.
+type coreReader struct {
+	Reader   io.Reader        // The uncompressed core dump
+	Limit    int64            // Maximum number of bytes to read, 0 for no limit
+	Progress func(sent int64) // Called with the number of bytes read so far, may be nil
+	read     int64
+}
+
+func (self *coreReader) Read(p []byte) (int, error) {
+	n, err := self.Reader.Read(p)
+	self.read += int64(n)
+
+	if self.Limit > 0 && self.read > self.Limit {
+		return 0, ErrorCoreTooLarge{self.Limit}
+	}
+
+	if n > 0 && self.Progress != nil {
+		self.Progress(self.read)
+	}
+
+	return n, err
+}
+
+// compressCore copies reader to writer, compressing the stream with compression.
+func compressCore(writer io.Writer, reader io.Reader, compression CoreCompression) error {
+	var wc io.WriteCloser
+
+	switch compression {
+	case CoreCompressionNone:
+		_, err := io.Copy(writer, reader)
+		return err
+	case CoreCompressionGzip:
+		wc = gzip.NewWriter(writer)
+	case CoreCompressionSnappy:
+		wc = snappy.NewWriter(writer)
+	default:
+		return errors.New(fmt.Sprintf("Unknown core compression %s", compression))
+	}
+
+	if _, err := io.Copy(wc, reader); err != nil {
+		return err
+	}
+
+	return wc.Close()
+}
+
+// coreBody streams a core dump to an HTTP request, compressing it on the fly.
+// Memory consumption is bounded by the buffers of the compressor, independent of the size of the core.
+type coreBody struct {
+	*io.PipeReader
+	done chan error
+}
+
+// newCoreBody starts streaming reader, compressed with compression. Streaming fails
+// with ErrorCoreTooLarge if reader yields more than limit bytes, unless limit is 0.
+func newCoreBody(reader io.Reader, compression CoreCompression, limit int64, progress func(int64)) coreBody {
+	pr, pw := io.Pipe()
+	body := coreBody{pr, make(chan error, 1)}
+
+	go func() {
+		err := compressCore(pw, &coreReader{Reader: reader, Limit: limit, Progress: progress}, compression)
+		pw.CloseWithError(err)
+		body.done <- err
+	}()
+
+	return body
+}
+
+// Wait stops streaming and returns the error that interrupted it, if any.
+// Errors caused by the consumer closing the body early are not reported.
+func (self coreBody) Wait() error {
+	self.PipeReader.Close()
+
+	if err := <-self.done; err != nil && err != io.ErrClosedPipe {
+		return err
+	}
+
+	return nil
+}
@@ -62,14 +62,18 @@ func ForEachReportInDir(dir string, visitor ReportVisitor) {
 			continue
 		}
 
-		defer f.Close()
-		report, err := ParseReport(NewLineReader{f})
+		// Binary values, e.g., core dumps, are referenced rather than read, and
+		// read from f by Report.Binary if required.
+		report, err := ParseReport(f)
 
 		if err != nil {
+			f.Close()
 			visitor.NewError(ErrorFailedToParseCrashReport{entry.Name(), err})
 			continue
 		}
 
 		visitor.NewReport(entry.Name(), report)
+		report.Close()
+		f.Close()
 	}
 }
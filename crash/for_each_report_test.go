@@ -46,16 +46,13 @@ func TestForEachReportInDirReportsParsingError(t *testing.T) {
 	os.RemoveAll(testDir)
 	os.MkdirAll(testDir, os.ModeDir|os.ModePerm)
 
-	d, _ := os.Create(filepath.Join(testDir, "not_parseable"))
+	d, _ := os.Create(filepath.Join(testDir, "not_parseable.crash"))
 	fmt.Fprintf(d, "This is malformed, totally, absolutely.....")
 	d.Close()
 
 	erv := ErrorRecordingVisitor{}
 	ForEachReportInDir(testDir, &erv)
-	// Apparently, the parser does not return an error but instead
-	// just returns an empty map. With that, we cannot easily assert on the
-	// error here. Still leaving it in for documenting the case.
-	// assert.IsType(t, ErrorFailedToParseCrashReport{}, erv.Err)
+	assert.IsType(t, ErrorFailedToParseCrashReport{}, erv.Err)
 }
 
 func TestForEachReportInDirInvokesVisitorForReports(t *testing.T) {
@@ -5,11 +5,14 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
-	"log"
+	"net"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/vosst/csi/machine"
 	"labix.org/v2/mgo/bson"
@@ -54,7 +57,6 @@ var AcceptableFields = map[string]struct{}{
 	"Disassembly":                struct{}{},
 	"StacktraceTop":              struct{}{},
 	"AssertionMessage":           struct{}{},
-	"CoreDump":                   struct{}{},
 	"VmCore":                     struct{}{},
 	"Tags":                       struct{}{},
 	"OopsText":                   struct{}{},
@@ -74,13 +76,18 @@ var UnacceptableFields = map[string]struct{}{
 	"CrashCounter":       struct{}{}, // We maintain our own count.
 	"_MarkForUpload":     struct{}{}, // Redundant since the crash was uploaded.
 	"Title":              struct{}{},
+	"CoreDump":           struct{}{}, // Uploaded separately, only if requested by the crash database.
 }
 
 // HttpReporterPersister persists incoming crash reports to launchpad.
 type HttpReportPersister struct {
-	SubmitURL  url.URL            // URL for sending the crash report to
-	Identifier machine.Identifier // Identifier helps in generating a globally unique device id
-	Client     *http.Client       // HTTP client instance for reaching out to the crash db service
+	SubmitURL   url.URL            // URL for sending the crash report to
+	Identifier  machine.Identifier // Identifier helps in generating a globally unique device id
+	Client      *http.Client       // HTTP client instance for reaching out to the crash db service
+	Compression CoreCompression    // Compression applied to core dumps while uploading them
+	MaxCoreSize int64              // Maximum size of uncompressed core dumps in bytes, 0 for no limit
+	Progress    func(sent int64)   // Called with the number of core dump bytes sent so far, may be nil
+	CoreTimeout time.Duration      // Time limit for uploading a core dump, replacing the timeout of Client if positive
 }
 
 // filterField returns true if the given (key, value) pair should be filtered out.
@@ -101,12 +108,13 @@ func (self HttpReportPersister) filterField(k string, v []string) bool {
 }
 
 // marshalToBSON walks the given report, filtering out all invalid fields
-// and encodes the resulting filtered map to BSON.
+// and encodes the resulting filtered map to BSON. Binary fields are never
+// submitted, cores are uploaded separately with UploadCore.
 func (self HttpReportPersister) marshalToBSON(report Report) ([]byte, error) {
 	filtered := make(map[string]string)
 
 	for k, v := range report {
-		if !self.filterField(k, v) && len(v) > 0 {
+		if !self.filterField(k, v) && !report.IsBinary(k) && len(v) > 0 {
 			filtered[k] = v[0]
 		}
 	}
@@ -114,12 +122,84 @@ func (self HttpReportPersister) marshalToBSON(report Report) ([]byte, error) {
 	return bson.Marshal(filtered)
 }
 
-func (self HttpReportPersister) uploadCore(report Report, oopsId string) error {
-	core, contains := report["CoreDump"]
-	if !contains || len(core) == 0 {
-		return errors.New("Missing field CoreDump in report")
+// SubmitResult describes the response of the crash database to a submitted report.
+type SubmitResult struct {
+	OopsId        string // Id assigned to the report by the crash database, empty if none
+	CoreRequested bool   // True if the crash database asks for the core dump
+}
+
+// ReportUploader abstracts the two-stage upload protocol of the crash database:
+// reports are submitted first, and cores are only uploaded on request.
+type ReportUploader interface {
+	// Submit sends report to the crash database.
+	Submit(report Report) (SubmitResult, error)
+	// UploadCore sends the core dump of report, read from core, identified by oopsId.
+	UploadCore(report Report, core io.Reader, oopsId string) error
+}
+
+// ErrorHttpStatus indicates an unexpected HTTP status code returned by the crash database.
+type ErrorHttpStatus struct {
+	Code       int           // The status code returned by the server
+	RetryAfter time.Duration // Delay requested by the server with a Retry-After header, 0 if none
+}
+
+// Error pretty prints the given ErrorHttpStatus instance.
+func (self ErrorHttpStatus) Error() string {
+	return fmt.Sprintf("Received status code %d, indicating an issue with our upload", self.Code)
+}
+
+// Temporary returns true if the request might succeed when retried later,
+// i.e., for server-side errors, timeouts and rate limiting.
+func (self ErrorHttpStatus) Temporary() bool {
+	return self.Code >= 500 || self.Code == http.StatusRequestTimeout || self.Code == http.StatusTooManyRequests
+}
+
+// parseRetryAfter interprets the value of a Retry-After header, either given
+// in seconds or as an HTTP date. Returns 0 if value is empty or invalid.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if secs, err := strconv.Atoi(value); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+
+	if t, err := http.ParseTime(value); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+
+	return 0
+}
+
+// checkResponse returns an ErrorHttpStatus if resp does not indicate success.
+func checkResponse(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	return ErrorHttpStatus{resp.StatusCode, parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())}
+}
+
+// IsTemporary returns true if err indicates a failure that might go away when
+// retrying later, i.e., network issues and temporary server-side issues.
+func IsTemporary(err error) bool {
+	switch e := err.(type) {
+	case ErrorHttpStatus:
+		return e.Temporary()
+	case *url.Error:
+		return true
+	case net.Error:
+		return true
 	}
 
+	return false
+}
+
+// UploadCore streams core, the core dump of report, to the crash database,
+// referring to the report submitted before as oopsId. The core is compressed
+// on the fly and sent with chunked transfer encoding, such that it never has
+// to be held in memory.
+//
+// Returns ErrorCoreTooLarge if core exceeds MaxCoreSize, or an error if report
+// lacks its architecture or if the upload fails.
+func (self HttpReportPersister) UploadCore(report Report, core io.Reader, oopsId string) error {
 	arch, contains := report["Architecture"]
 	if !contains || len(arch) == 0 {
 		return errors.New("Missing field Architecture in report")
@@ -131,52 +211,105 @@ func (self HttpReportPersister) uploadCore(report Report, oopsId string) error {
 		return err
 	}
 
-	coreURL := fmt.Sprintf("%s/%s/submit-core/%s/%s", self.SubmitURL, oopsId, arch, hex.EncodeToString(id))
-	req, err := http.NewRequest("POST", coreURL, strings.NewReader(core[0]))
+	body := newCoreBody(core, self.Compression, self.MaxCoreSize, self.Progress)
+
+	coreURL := fmt.Sprintf("%s/%s/submit-core/%s/%s", self.SubmitURL.String(), oopsId, arch[0], hex.EncodeToString(id))
+	req, err := http.NewRequest("POST", coreURL, body)
+	if err != nil {
+		body.Wait()
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.TransferEncoding = []string{"chunked"}
+
+	// Cores take much longer to upload than reports, hence their own timeout.
+	client := *self.Client
+	if self.CoreTimeout > 0 {
+		client.Timeout = self.CoreTimeout
+	}
+
+	resp, err := client.Do(req)
+
+	// Failures to read the core take precedence over the
+	// resulting, seemingly temporary, transport errors.
+	if berr := body.Wait(); berr != nil {
+		if err == nil {
+			resp.Body.Close()
+		}
+		return berr
+	}
+
 	if err != nil {
 		return err
 	}
 
-	// TODO(vosst): add handling of response here.
-	_, err = self.Client.Do(req)
-	return err
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	return checkResponse(resp)
 }
 
-func (self HttpReportPersister) handleUploadResponse(report Report, response string) error {
-	if len(response) == 0 {
-		return nil
+// parseSubmitResponse interprets the body of the crash database's response to a submitted report,
+// "<oops id> <command>" where command is either CORE or OOPSID.
+func parseSubmitResponse(response string) (SubmitResult, error) {
+	if len(strings.TrimSpace(response)) == 0 {
+		return SubmitResult{}, nil
 	}
 
 	var oopsId, command string
 	if _, err := fmt.Sscanf(response, "%s %s", &oopsId, &command); err != nil {
-		return errors.New("Failed to parse response body")
+		return SubmitResult{}, errors.New("Failed to parse response body")
+	}
+
+	return SubmitResult{oopsId, command == "CORE"}, nil
+}
+
+// Submit sends report to the crash database, filtering out unacceptable fields.
+//
+// Returns the response of the crash database or an error if the upload fails.
+func (self HttpReportPersister) Submit(report Report) (SubmitResult, error) {
+	bson, err := self.marshalToBSON(report)
+	if err != nil {
+		return SubmitResult{}, errors.New(fmt.Sprintf("Failed to encode report [%s]", err))
+	}
+
+	resp, err := self.Client.Post(self.SubmitURL.String(), "application/octet-stream", bytes.NewReader(bson))
+	if err != nil {
+		return SubmitResult{}, err
+	}
+
+	defer resp.Body.Close()
+
+	if err := checkResponse(resp); err != nil {
+		return SubmitResult{}, err
 	}
 
-	switch command {
-	case "CORE":
-		return self.uploadCore(report, oopsId)
-	case "OOPSID":
-		log.Printf("Server reported OOPS ID: %s", oopsId)
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return SubmitResult{}, err
 	}
 
-	return nil
+	return parseSubmitResponse(string(body))
 }
 
+// Persist submits report and uploads its core dump, decoded from the field
+// CoreDump, if requested by the crash database.
 func (self HttpReportPersister) Persist(report Report) error {
-	bson, _ := self.marshalToBSON(report)
+	result, err := self.Submit(report)
+	if err != nil {
+		return err
+	}
+
+	if !result.CoreRequested {
+		return nil
+	}
 
-	if resp, err := self.Client.Post(self.SubmitURL.String(), "application/octet-stream", bytes.NewReader(bson)); err != nil {
-		fmt.Print(err)
+	core, err := report.Binary("CoreDump")
+	if err != nil {
 		return err
-	} else if resp.StatusCode == http.StatusOK {
-		// We received a response and try to interpret it further
-		defer resp.Body.Close()
-		if body, err := ioutil.ReadAll(resp.Body); err != nil {
-			return err
-		} else {
-			return self.handleUploadResponse(report, string(body))
-		}
-	} else {
-		return errors.New(fmt.Sprintf("Received status code %d, indicating an issue with our upload", resp.StatusCode))
 	}
+
+	defer core.Close()
+	return self.UploadCore(report, core, result.OopsId)
 }
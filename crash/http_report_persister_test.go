@@ -1,46 +1,233 @@
 package crash
 
 import (
+	"bytes"
+	"compress/gzip"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/golang/snappy"
 	"github.com/stretchr/testify/assert"
 	"github.com/vosst/csi/machine"
 	"labix.org/v2/mgo/bson"
 )
 
-func TestHttpCrashReportPersisterSendsValidBSON(t *testing.T) {
-	go func() {
-		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			defer r.Body.Close()
+// newTestPersister returns a persister submitting to server.
+func newTestPersister(server *httptest.Server) HttpReportPersister {
+	mi := &machine.MockIdentifier{}
+	mi.On("Identify").Return([]byte{42, 42, 42}, nil)
 
-			bytes, _ := ioutil.ReadAll(r.Body)
+	u, _ := url.Parse(server.URL)
+	return HttpReportPersister{*u, mi, server.Client(), CoreCompressionNone, 0, nil, 0}
+}
 
-			report := make(map[string]interface{})
-			if err := bson.Unmarshal(bytes, report); err != nil {
-				http.Error(w, err.Error(), http.StatusBadRequest)
-			}
-		}))
+func testReport(t *testing.T) Report {
+	f, _ := os.Open("test_data/test.crash")
+	defer f.Close()
 
-		server.Close()
-	}()
+	report, err := ParseReport(NewLineReader{f})
+	assert.Nil(t, err)
+	return report
+}
 
-	mi := &machine.MockIdentifier{}
-	mi.On("Identify").Return([]byte{42, 42, 42}, nil)
+func TestHttpCrashReportPersisterSendsValidBSON(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
 
-	u, _ := url.Parse("http://localhost:9090")
+		bytes, _ := ioutil.ReadAll(r.Body)
 
-	persister := HttpReportPersister{*u, mi, &http.Client{}}
+		report := make(map[string]interface{})
+		if err := bson.Unmarshal(bytes, report); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
 
-	f, _ := os.Open("test_data/test.crash")
+	persister := newTestPersister(server)
+	assert.Nil(t, persister.Persist(testReport(t)))
+}
 
-	report, err := ParseReport(NewLineReader{f})
+func TestHttpCrashReportPersisterReportsOopsId(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		w.Write([]byte("1234-abcd OOPSID"))
+	}))
+	defer server.Close()
+
+	result, err := newTestPersister(server).Submit(testReport(t))
 	assert.Nil(t, err)
+	assert.Equal(t, SubmitResult{"1234-abcd", false}, result)
+}
+
+func TestHttpCrashReportPersisterUploadsCoreOnRequest(t *testing.T) {
+	corePath := ""
+	coreBody := ""
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		if r.URL.Path == "/" {
+			w.Write([]byte("1234-abcd CORE"))
+			return
+		}
+
+		corePath, coreBody = r.URL.Path, string(b)
+	}))
+	defer server.Close()
+
+	report := testReport(t)
+	assert.Nil(t, report.SetBinary("CoreDump", strings.NewReader("core")))
+	report["Architecture"] = []string{"amd64"}
+
+	assert.Nil(t, newTestPersister(server).Persist(report))
+	assert.Equal(t, "/1234-abcd/submit-core/amd64/2a2a2a", corePath)
+	assert.Equal(t, "core", coreBody)
+}
+
+func TestHttpCrashReportPersisterSubmitsReportsWithoutBinaryFields(t *testing.T) {
+	var submitted map[string]interface{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		submitted = map[string]interface{}{}
+		bson.Unmarshal(b, submitted)
+		w.Write([]byte("1234-abcd OOPSID"))
+	}))
+	defer server.Close()
+
+	report := testReport(t)
+	assert.Nil(t, report.SetBinary("CoreDump", strings.NewReader("core")))
+	assert.Nil(t, report.SetBinary("Attachment", strings.NewReader("attachment")))
 
-	err = persister.Persist(report)
+	_, err := newTestPersister(server).Submit(report)
 	assert.Nil(t, err)
+	assert.Equal(t, "KernelOops", submitted["ProblemType"])
+	assert.NotContains(t, submitted, "CoreDump")
+	assert.NotContains(t, submitted, "Attachment")
+}
+
+func TestHttpCrashReportPersisterStreamsCompressedCores(t *testing.T) {
+	var received []byte
+	var transferEncoding []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, _ = ioutil.ReadAll(r.Body)
+		transferEncoding = r.TransferEncoding
+	}))
+	defer server.Close()
+
+	core := bytes.Repeat([]byte("core dump contents "), 100000)
+
+	for _, compression := range []CoreCompression{CoreCompressionGzip, CoreCompressionSnappy} {
+		var sent int64
+		persister := newTestPersister(server)
+		persister.Compression = compression
+		persister.Progress = func(n int64) { sent = n }
+
+		report := Report{"Architecture": []string{"amd64"}}
+		assert.Nil(t, persister.UploadCore(report, bytes.NewReader(core), "1234-abcd"))
+		assert.Equal(t, []string{"chunked"}, transferEncoding)
+		assert.Equal(t, int64(len(core)), sent)
+		assert.True(t, len(received) < len(core))
+
+		var r io.Reader
+		if compression == CoreCompressionGzip {
+			r, _ = gzip.NewReader(bytes.NewReader(received))
+		} else {
+			r = snappy.NewReader(bytes.NewReader(received))
+		}
+
+		decoded, err := ioutil.ReadAll(r)
+		assert.Nil(t, err)
+		assert.Equal(t, core, decoded)
+	}
+}
+
+func TestHttpCrashReportPersisterRejectsOversizedCores(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	persister := newTestPersister(server)
+	persister.MaxCoreSize = 1024
+
+	report := Report{"Architecture": []string{"amd64"}}
+	err := persister.UploadCore(report, bytes.NewReader(make([]byte, 4096)), "1234-abcd")
+	assert.Equal(t, ErrorCoreTooLarge{1024}, err)
+	assert.False(t, IsTemporary(err))
+
+	assert.Nil(t, persister.UploadCore(report, bytes.NewReader(make([]byte, 1024)), "1234-abcd"))
+}
+
+func TestHttpCrashReportPersisterReportsFailedCoreUploads(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	report := Report{"Architecture": []string{"amd64"}}
+	err := newTestPersister(server).UploadCore(report, strings.NewReader("core"), "1234-abcd")
+	assert.Equal(t, ErrorHttpStatus{http.StatusServiceUnavailable, 0}, err)
+}
+
+func TestParseCoreCompression(t *testing.T) {
+	for s, expected := range map[string]CoreCompression{"": CoreCompressionNone, "none": CoreCompressionNone, "gzip": CoreCompressionGzip, "snappy": CoreCompressionSnappy} {
+		c, err := ParseCoreCompression(s)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, c)
+	}
+
+	_, err := ParseCoreCompression("xz")
+	assert.NotNil(t, err)
+}
+
+func TestHttpCrashReportPersisterDistinguishesServerAndClientErrors(t *testing.T) {
+	status := http.StatusServiceUnavailable
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		w.Header().Set("Retry-After", "120")
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	persister := newTestPersister(server)
+
+	_, err := persister.Submit(testReport(t))
+	assert.Equal(t, ErrorHttpStatus{http.StatusServiceUnavailable, 2 * time.Minute}, err)
+	assert.True(t, IsTemporary(err))
+
+	status = http.StatusBadRequest
+	_, err = persister.Submit(testReport(t))
+	assert.NotNil(t, err)
+	assert.False(t, IsTemporary(err))
+
+	status = http.StatusTooManyRequests
+	_, err = persister.Submit(testReport(t))
+	assert.True(t, IsTemporary(err))
+}
+
+func TestHttpCrashReportPersisterTreatsNetworkErrorsAsTemporary(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	persister := newTestPersister(server)
+	server.Close()
+
+	_, err := persister.Submit(testReport(t))
+	assert.NotNil(t, err)
+	assert.True(t, IsTemporary(err))
+}
+
+func TestParseRetryAfterAcceptsSecondsAndDates(t *testing.T) {
+	now := time.Date(2015, time.September, 4, 7, 59, 46, 0, time.UTC)
+
+	assert.Equal(t, 30*time.Second, parseRetryAfter("30", now))
+	assert.Equal(t, time.Hour, parseRetryAfter(now.Add(time.Hour).Format(http.TimeFormat), now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("", now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("soon", now))
 }
@@ -2,22 +2,471 @@ package crash
 
 import (
 	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/base64"
+	"errors"
+	"fmt"
 	"io"
-	"net/textproto"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
 )
 
-// Report models an apport crash report.
-type Report textproto.MIMEHeader
+// binaryMarker is the value apport writes after the key of a base64-encoded field.
+const binaryMarker = "base64"
 
-// ParseReport parses information from reader.
+// binaryBlockSize is the number of uncompressed bytes apport encodes per chunk.
+const binaryBlockSize = 1024 * 1024
+
+// Report models an apport crash report, mapping field names to values.
+//
+// Field names are kept verbatim, multi-line values keep their line breaks.
+// Binary fields are kept in their encoded form, a line "base64" followed by
+// one line per base64-encoded chunk. Binary fields whose contents are kept in
+// a file only hold the line "base64", the file is tracked outside of the map.
+// Use Binary to access the decoded contents.
+type Report map[string][]string
+
+// keyRegExp matches valid field names as accepted by apport.
+var keyRegExp = regexp.MustCompile(`^[a-zA-Z0-9._-]+$`)
+
+// ErrorMalformedReport indicates a syntax error in a crash report.
+type ErrorMalformedReport struct {
+	Line   int    // Line number of the offending line, starting at 1.
+	Reason string // Human-readable description of the issue.
+}
+
+// Error pretty prints the given ErrorMalformedReport instance.
+func (self ErrorMalformedReport) Error() string {
+	return fmt.Sprintf("Malformed report in line %d [%s]", self.Line, self.Reason)
+}
+
+// ParseReport parses a report in apport's format from reader.
+//
+// Every field starts with a line "Key: value". Subsequent lines starting with
+// a single space continue the value of the previous field. Binary fields start
+// with "Key: base64" and carry one base64-encoded, compressed chunk per
+// continuation line. Empty lines are skipped.
+//
+// If reader is an *os.File, the chunks of binary fields are not held in
+// memory but referenced by their location in the file, and decoded from the
+// file by Binary. The file has to stay open until the report is closed.
+//
+// Returns an error if reading from reader fails or if the input is malformed.
 func ParseReport(reader io.Reader) (Report, error) {
-	tr := textproto.NewReader(bufio.NewReader(reader))
+	report := Report{}
+	br := bufio.NewReader(reader)
+
+	// ref is the template for references to binary values, valid if ref.File is not nil.
+	ref := binaryRef{Kind: refEncoded}
+	if f, ok := reader.(*os.File); ok {
+		if offset, err := f.Seek(0, os.SEEK_CUR); err == nil {
+			ref.File, ref.Offset = f, offset
+		}
+	}
+
+	key := ""
+	value := []string{}
+	pos := int64(0)        // Number of bytes consumed from reader.
+	binary := int64(-1)    // Position of the chunks of the current field, if referenced.
+	binaryEnd := int64(-1) // Position after the last chunk of the current field.
+
+	flush := func() {
+		if len(key) == 0 {
+			return
+		}
+
+		if binary >= 0 {
+			r := ref
+			r.Offset, r.Length = ref.Offset+binary, binaryEnd-binary
+			report.setRef(key, r)
+		} else {
+			report[key] = []string{strings.Join(value, "\n")}
+		}
+	}
+
+	for n := 1; ; n++ {
+		// Chunks of referenced binary values are skipped without holding them in memory.
+		skip := false
+		if binary >= 0 {
+			b, _ := br.Peek(1)
+			skip = len(b) == 1 && b[0] == ' '
+		}
+
+		line, size, err := readLine(br, !skip)
+		pos += int64(size)
+
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+
+		if skip {
+			binaryEnd = pos
+		} else if len(line) == 0 && err == io.EOF {
+			break
+		} else if line = strings.TrimSuffix(line, "\n"); len(line) == 0 {
+			// Tolerate empty lines, e.g., trailing newlines added by NewLineReader.
+		} else if strings.HasPrefix(line, " ") {
+			if len(key) == 0 {
+				return nil, ErrorMalformedReport{n, "continuation line without preceding field"}
+			}
+			value = append(value, line[1:])
+		} else {
+			flush()
+
+			tokens := strings.SplitN(line, ":", 2)
+			if len(tokens) != 2 {
+				return nil, ErrorMalformedReport{n, "missing separator ':'"}
+			}
+
+			if !keyRegExp.MatchString(tokens[0]) {
+				return nil, ErrorMalformedReport{n, fmt.Sprintf("invalid field name %q", tokens[0])}
+			}
+
+			if _, present := report[tokens[0]]; present {
+				return nil, ErrorMalformedReport{n, fmt.Sprintf("duplicate field %s", tokens[0])}
+			}
+
+			key = tokens[0]
+			value = []string{}
+			binary, binaryEnd = -1, -1
+
+			if v := strings.TrimSpace(tokens[1]); len(v) > 0 {
+				value = append(value, v)
+			}
+
+			if ref.File != nil && len(value) == 1 && value[0] == binaryMarker {
+				binary, binaryEnd = pos, pos
+			}
+		}
+
+		if err == io.EOF {
+			break
+		}
+	}
+
+	flush()
+
+	return report, nil
+}
 
-	hdr, err := tr.ReadMIMEHeader()
+// readLine reads the next line from br, including its line break. If keep is
+// false, the line is consumed without holding it in memory and an empty
+// string is returned. Returns the number of bytes consumed.
+func readLine(br *bufio.Reader, keep bool) (string, int, error) {
+	var line []byte
+	n := 0
+
+	for {
+		b, err := br.ReadSlice('\n')
+		n += len(b)
+		if keep {
+			line = append(line, b...)
+		}
+
+		if err != bufio.ErrBufferFull {
+			return string(line), n, err
+		}
+	}
+}
+
+// IsBinary returns true if the value stored for key is a base64-encoded blob.
+func (self Report) IsBinary(key string) bool {
+	v, present := self[key]
+	if !present || len(v) == 0 {
+		return false
+	}
+
+	return v[0] == binaryMarker || strings.HasPrefix(v[0], binaryMarker+"\n")
+}
+
+// Kinds of contents referenced by a binaryRef.
+const (
+	refRaw     = "raw"     // Uncompressed contents
+	refEncoded = "encoded" // Encoded chunks in apport's format, one per line, each indented with a single space
+)
+
+// binaryRef references the contents of a binary value in a file, such that
+// large values, e.g., core dumps, are never held in memory.
+type binaryRef struct {
+	Kind   string   // Kind of the referenced contents
+	File   *os.File // File keeping the contents, read by offset
+	Offset int64    // Offset of the contents in the file
+	Length int64    // Length of the contents, up to the end of the file if negative
+}
+
+// open returns a reader for the referenced contents, reading from the file
+// without changing its offset. Closing the reader leaves the file open.
+//
+// Returns an error if querying the size of the file fails.
+func (self binaryRef) open() (io.ReadCloser, error) {
+	length := self.Length
+	if length < 0 {
+		fi, err := self.File.Stat()
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Failed to stat %s [%s]", self.File.Name(), err))
+		}
+		length = fi.Size() - self.Offset
+	}
+
+	return ioutil.NopCloser(io.NewSectionReader(self.File, self.Offset, length)), nil
+}
+
+// binaryRefs keeps the references of binary values kept in a file, indexed
+// by the value stored in the report. References are only ever added by
+// ParseReport and SetBinary, never derived from the contents of a report.
+var binaryRefs = struct {
+	sync.Mutex
+	refs map[*string]binaryRef
+}{refs: map[*string]binaryRef{}}
+
+// setRef stores a binary value for key whose contents are referenced by ref.
+func (self Report) setRef(key string, ref binaryRef) {
+	self.dropRef(key)
+
+	value := []string{binaryMarker}
+	self[key] = value
+
+	binaryRefs.Lock()
+	binaryRefs.refs[&value[0]] = ref
+	binaryRefs.Unlock()
+}
+
+// dropRef releases the reference stored for key, if any.
+func (self Report) dropRef(key string) {
+	if v := self[key]; len(v) > 0 {
+		binaryRefs.Lock()
+		delete(binaryRefs.refs, &v[0])
+		binaryRefs.Unlock()
+	}
+}
+
+// ref returns the reference stored for key, false if key does not refer to a
+// binary value kept in a file.
+func (self Report) ref(key string) (binaryRef, bool) {
+	v := self[key]
+	if len(v) == 0 {
+		return binaryRef{}, false
+	}
+
+	binaryRefs.Lock()
+	defer binaryRefs.Unlock()
+
+	ref, ok := binaryRefs.refs[&v[0]]
+	return ref, ok
+}
+
+// Close releases the references to files kept by self. Files handed to
+// ParseReport or SetBinary are not closed, they remain owned by the caller.
+// Binary values kept in a file cannot be accessed after Close.
+func (self Report) Close() error {
+	for key := range self {
+		self.dropRef(key)
+	}
+
+	return nil
+}
+
+// Binary returns a reader that lazily decodes the binary value stored for key.
+// Chunks are base64-decoded one at a time and the resulting stream is
+// decompressed with gzip, or zlib for reports written by older apport versions.
+// Values kept in a file are read from the file. The caller has to close the
+// returned reader.
+//
+// Returns an error if key is not present or does not refer to a binary value,
+// or if accessing the file keeping the value fails.
+func (self Report) Binary(key string) (io.ReadCloser, error) {
+	if !self.IsBinary(key) {
+		return nil, errors.New(fmt.Sprintf("Field %s is missing or not binary", key))
+	}
+
+	if ref, ok := self.ref(key); ok {
+		r, err := ref.open()
+		if err != nil || ref.Kind == refRaw {
+			return r, err
+		}
+
+		return ioutil.NopCloser(&binaryReader{chunks: lineChunks(r)}), nil
+	}
+
+	chunks := strings.Split(self[key][0], "\n")[1:]
+	return ioutil.NopCloser(&binaryReader{chunks: sliceChunks(chunks)}), nil
+}
+
+// SetBinary stores the contents of reader as binary value for key. The
+// contents of an *os.File are not read but referenced by the file and its
+// current offset, and only compressed and encoded by WriteReport. The file has
+// to stay open until the report is closed. All other readers
+// are read immediately, compressing their contents with gzip and splitting
+// the compressed stream into base64-encoded chunks.
+//
+// Returns an error if reading from reader or compressing fails.
+func (self Report) SetBinary(key string, reader io.Reader) error {
+	if f, ok := reader.(*os.File); ok {
+		if offset, err := f.Seek(0, os.SEEK_CUR); err == nil {
+			self.setRef(key, binaryRef{refRaw, f, offset, -1})
+			return nil
+		}
+	}
+
+	chunks := []string{binaryMarker}
+	err := encodeBinary(reader, func(chunk []byte) error {
+		chunks = append(chunks, string(chunk))
+		return nil
+	})
 
 	if err != nil {
-		return nil, err
+		return errors.New(fmt.Sprintf("Failed to compress binary value for %s [%s]", key, err))
+	}
+
+	self.dropRef(key)
+	self[key] = []string{strings.Join(chunks, "\n")}
+	return nil
+}
+
+// encodeBinary compresses the contents of reader with gzip, one block of
+// binaryBlockSize bytes at a time, and hands the base64-encoded compressed
+// output of every block to chunk.
+//
+// Returns an error if reading, compressing or chunk fails.
+func encodeBinary(reader io.Reader, chunk func(encoded []byte) error) error {
+	var buf bytes.Buffer
+	var encoded []byte
+	gw := gzip.NewWriter(&buf)
+
+	flush := func() error {
+		if buf.Len() == 0 {
+			return nil
+		}
+
+		if n := base64.StdEncoding.EncodedLen(buf.Len()); cap(encoded) < n {
+			encoded = make([]byte, n)
+		} else {
+			encoded = encoded[:n]
+		}
+
+		base64.StdEncoding.Encode(encoded, buf.Bytes())
+		buf.Reset()
+		return chunk(encoded)
+	}
+
+	for {
+		n, err := io.CopyN(gw, reader, binaryBlockSize)
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		if err := flush(); err != nil {
+			return err
+		}
+
+		if n < binaryBlockSize {
+			break
+		}
+	}
+
+	if err := gw.Close(); err != nil {
+		return err
+	}
+
+	return flush()
+}
+
+// sliceChunks returns a function handing out chunks one at a time, io.EOF once all have been consumed.
+func sliceChunks(chunks []string) func() (string, error) {
+	return func() (string, error) {
+		if len(chunks) == 0 {
+			return "", io.EOF
+		}
+
+		chunk := chunks[0]
+		chunks = chunks[1:]
+		return chunk, nil
+	}
+}
+
+// lineChunks returns a function handing out the chunks read from reader, one
+// per line, each indented with a single space, io.EOF once all have been consumed.
+func lineChunks(reader io.Reader) func() (string, error) {
+	br := bufio.NewReader(reader)
+
+	return func() (string, error) {
+		for {
+			line, _, err := readLine(br, true)
+			if chunk := strings.TrimSpace(line); len(chunk) > 0 {
+				return chunk, nil
+			}
+
+			if err != nil {
+				return "", err
+			}
+		}
+	}
+}
+
+// chunkReader base64-decodes chunks one at a time.
+type chunkReader struct {
+	next func() (string, error) // Returns the next chunk, io.EOF if there is none.
+	buf  []byte                 // Decoded, unread bytes of the current chunk.
+}
+
+// Read decodes the next chunk into p, once all bytes of the current chunk have been consumed.
+func (self *chunkReader) Read(p []byte) (int, error) {
+	for len(self.buf) == 0 {
+		chunk, err := self.next()
+		if err != nil {
+			return 0, err
+		}
+
+		b, err := base64.StdEncoding.DecodeString(chunk)
+		if err != nil {
+			return 0, errors.New(fmt.Sprintf("Failed to decode base64 chunk [%s]", err))
+		}
+
+		self.buf = b
+	}
+
+	n := copy(p, self.buf)
+	self.buf = self.buf[n:]
+	return n, nil
+}
+
+// gzipMagic marks the beginning of a gzip stream.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// binaryReader decompresses the decoded chunks, creating the decompressor on first read.
+type binaryReader struct {
+	chunks func() (string, error) // Returns the next encoded chunk, io.EOF if there is none.
+	next   io.Reader              // Decompressing reader, nil until first read.
+}
+
+// Read reads decompressed bytes into p.
+func (self *binaryReader) Read(p []byte) (int, error) {
+	if self.next == nil {
+		br := bufio.NewReader(&chunkReader{next: self.chunks})
+
+		magic, err := br.Peek(len(gzipMagic))
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+
+		if bytes.Equal(magic, gzipMagic) {
+			self.next, err = gzip.NewReader(br)
+		} else {
+			self.next, err = zlib.NewReader(br)
+		}
+
+		if err != nil {
+			return 0, err
+		}
 	}
 
-	return Report(hdr), nil
+	return self.next.Read(p)
 }
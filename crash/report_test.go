@@ -0,0 +1,153 @@
+package crash
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseReportKeepsCaseOfKeys(t *testing.T) {
+	f, _ := os.Open("test_data/test.crash")
+	defer f.Close()
+
+	report, err := ParseReport(f)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"KernelOops"}, report["ProblemType"])
+	assert.Equal(t, []string{"/usr/share/apport/apportcheckresume"}, report["ExecutablePath"])
+	assert.Nil(t, report["Problemtype"])
+}
+
+func TestParseReportKeepsLineBreaksInMultiLineValues(t *testing.T) {
+	f, _ := os.Open("test_data/test.crash")
+	defer f.Close()
+
+	report, err := ParseReport(f)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"TERM=linux\nPATH=(custom, no user)"}, report["ProcEnviron"])
+	assert.True(t, strings.HasPrefix(report["ProcMaps"][0], "00400000-00754000 r-xp 00000000 08:02 404368"))
+	assert.Equal(t, 113, len(strings.Split(report["ProcMaps"][0], "\n")))
+	assert.Equal(t, []string{""}, report["UserGroups"])
+}
+
+func TestParseReportReportsErrorForMalformedInput(t *testing.T) {
+	inputs := []string{
+		"This is malformed, totally, absolutely.....",
+		" Continuation: without field",
+		"Invalid Key: value",
+		"Key: value\nKey: value",
+	}
+
+	for _, input := range inputs {
+		_, err := ParseReport(strings.NewReader(input))
+		assert.IsType(t, ErrorMalformedReport{}, err, input)
+	}
+}
+
+func TestParseReportAcceptsEmptyInput(t *testing.T) {
+	report, err := ParseReport(strings.NewReader(""))
+	assert.Nil(t, err)
+	assert.Empty(t, report)
+}
+
+// encodeChunks base64-encodes b in chunks of size n, one per line.
+func encodeChunks(b []byte, n int) string {
+	lines := []string{}
+	for ; len(b) > n; b = b[n:] {
+		lines = append(lines, " "+base64.StdEncoding.EncodeToString(b[:n]))
+	}
+	lines = append(lines, " "+base64.StdEncoding.EncodeToString(b))
+	return strings.Join(lines, "\n")
+}
+
+func TestParseReportDecodesGzipCompressedBinaryFields(t *testing.T) {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	gw.Write([]byte("core dump contents"))
+	gw.Close()
+
+	input := "ProblemType: Crash\nCoreDump: base64\n" + encodeChunks(buf.Bytes(), 7) + "\nSignal: 11\n"
+	report, err := ParseReport(strings.NewReader(input))
+	assert.Nil(t, err)
+	assert.True(t, report.IsBinary("CoreDump"))
+	assert.False(t, report.IsBinary("Signal"))
+	assert.Equal(t, []string{"11"}, report["Signal"])
+
+	r, err := report.Binary("CoreDump")
+	assert.Nil(t, err)
+	b, err := ioutil.ReadAll(r)
+	assert.Nil(t, err)
+	assert.Equal(t, "core dump contents", string(b))
+}
+
+func TestParseReportDecodesZlibCompressedBinaryFields(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	zw.Write([]byte("legacy core dump contents"))
+	zw.Close()
+
+	report, err := ParseReport(strings.NewReader("CoreDump: base64\n" + encodeChunks(buf.Bytes(), 5)))
+	assert.Nil(t, err)
+
+	r, err := report.Binary("CoreDump")
+	assert.Nil(t, err)
+	b, err := ioutil.ReadAll(r)
+	assert.Nil(t, err)
+	assert.Equal(t, "legacy core dump contents", string(b))
+}
+
+func TestBinaryReportsErrorForInvalidBase64(t *testing.T) {
+	report, err := ParseReport(strings.NewReader("CoreDump: base64\n !!!\n"))
+	assert.Nil(t, err)
+
+	r, err := report.Binary("CoreDump")
+	assert.Nil(t, err)
+	_, err = io.Copy(ioutil.Discard, r)
+	assert.NotNil(t, err)
+}
+
+func TestBinaryReportsErrorForTextFields(t *testing.T) {
+	report := Report{"Signal": []string{"11"}}
+	_, err := report.Binary("Signal")
+	assert.NotNil(t, err)
+	_, err = report.Binary("CoreDump")
+	assert.NotNil(t, err)
+}
+
+func TestParseReportDoesNotFollowReferencesInReportContents(t *testing.T) {
+	secret, err := ioutil.TempFile("", "csi-report-test")
+	assert.Nil(t, err)
+	defer os.Remove(secret.Name())
+	defer secret.Close()
+	secret.Write([]byte("secret"))
+
+	input := fmt.Sprintf("CoreDump: base64\n base64\n @raw:0:-1:%s\n", secret.Name())
+
+	f, err := ioutil.TempFile("", "csi-report-test")
+	assert.Nil(t, err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+	f.Write([]byte(input))
+	f.Seek(0, os.SEEK_SET)
+
+	for _, reader := range []io.Reader{strings.NewReader(input), f} {
+		report, err := ParseReport(reader)
+		assert.Nil(t, err)
+		assert.True(t, report.IsBinary("CoreDump"))
+
+		r, err := report.Binary("CoreDump")
+		if err == nil {
+			b, _ := ioutil.ReadAll(r)
+			r.Close()
+			assert.NotContains(t, string(b), "secret")
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package crash
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// firstKey is always written first, mirroring apport.
+const firstKey = "ProblemType"
+
+// ErrorInvalidFieldName indicates a field name that cannot be represented in apport's format.
+type ErrorInvalidFieldName struct {
+	Name string // The offending field name.
+}
+
+// Error pretty prints the given ErrorInvalidFieldName instance.
+func (self ErrorInvalidFieldName) Error() string {
+	return fmt.Sprintf("Invalid field name %q", self.Name)
+}
+
+// sortedKeys returns the keys of report in the order apport writes them,
+// ProblemType first, followed by all remaining keys in lexical order.
+func sortedKeys(report Report) []string {
+	keys := []string{}
+	for k := range report {
+		if k != firstKey {
+			keys = append(keys, k)
+		}
+	}
+
+	sort.Strings(keys)
+
+	if _, present := report[firstKey]; present {
+		keys = append([]string{firstKey}, keys...)
+	}
+
+	return keys
+}
+
+// WriteReport serializes report to writer in apport's format, such that the
+// output can be read back by ParseReport and by apport's tooling.
+//
+// Single-line values are written as "Key: value". Multi-line values start with
+// "Key:" and continue on subsequent lines, each indented with a single space.
+// Binary values are written as "Key: base64", followed by one indented line
+// per chunk. Like apport, binary values are written after all other fields,
+// such that readers can stop early. Binary values kept in a file are read,
+// and compressed and encoded if necessary, while writing.
+//
+// Returns an error if report contains an invalid field name or if writing fails.
+func WriteReport(writer io.Writer, report Report) error {
+	bw := bufio.NewWriter(writer)
+
+	binaries := []string{}
+	for _, k := range sortedKeys(report) {
+		if !keyRegExp.MatchString(k) {
+			return ErrorInvalidFieldName{k}
+		}
+
+		if report.IsBinary(k) {
+			binaries = append(binaries, k)
+			continue
+		}
+
+		v := ""
+		if len(report[k]) > 0 {
+			v = report[k][0]
+		}
+
+		if !strings.Contains(v, "\n") {
+			fmt.Fprintf(bw, "%s: %s\n", k, v)
+		} else {
+			fmt.Fprintf(bw, "%s:\n %s\n", k, strings.Replace(v, "\n", "\n ", -1))
+		}
+	}
+
+	for _, k := range binaries {
+		fmt.Fprintf(bw, "%s: %s\n", k, binaryMarker)
+
+		if err := writeBinary(bw, report, k); err != nil {
+			return err
+		}
+	}
+
+	return bw.Flush()
+}
+
+// writeBinary writes the chunks of the binary value stored for key to bw, one indented line per chunk.
+//
+// Returns an error if reading the value from its file or encoding it fails.
+func writeBinary(bw *bufio.Writer, report Report, key string) error {
+	chunk := func(encoded []byte) error {
+		bw.WriteByte(' ')
+		bw.Write(encoded)
+		_, err := bw.WriteString("\n")
+		return err
+	}
+
+	ref, ok := report.ref(key)
+	if !ok {
+		for _, c := range strings.Split(report[key][0], "\n")[1:] {
+			if err := chunk([]byte(c)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	r, err := ref.open()
+	if err != nil {
+		return err
+	}
+
+	defer r.Close()
+
+	if ref.Kind == refEncoded {
+		next := lineChunks(r)
+		for c, err := next(); err != io.EOF; c, err = next() {
+			if err != nil {
+				return errors.New(fmt.Sprintf("Failed to read binary value for %s [%s]", key, err))
+			}
+			if err := chunk([]byte(c)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := encodeBinary(r, chunk); err != nil {
+		return errors.New(fmt.Sprintf("Failed to encode binary value for %s [%s]", key, err))
+	}
+
+	return nil
+}
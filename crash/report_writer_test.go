@@ -0,0 +1,190 @@
+package crash
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteReportRoundTripsTestData(t *testing.T) {
+	b, err := ioutil.ReadFile("test_data/test.crash")
+	assert.Nil(t, err)
+
+	report, err := ParseReport(bytes.NewReader(b))
+	assert.Nil(t, err)
+
+	var buf bytes.Buffer
+	assert.Nil(t, WriteReport(&buf, report))
+	assert.Equal(t, string(b), buf.String())
+}
+
+func TestWriteReportWritesProblemTypeFirstAndSortsRemainingKeys(t *testing.T) {
+	report := Report{
+		"Signal":       []string{"11"},
+		"Architecture": []string{"amd64"},
+		"ProblemType":  []string{"Crash"},
+	}
+
+	var buf bytes.Buffer
+	assert.Nil(t, WriteReport(&buf, report))
+	assert.Equal(t, "ProblemType: Crash\nArchitecture: amd64\nSignal: 11\n", buf.String())
+}
+
+func TestWriteReportIndentsMultiLineValues(t *testing.T) {
+	report := Report{"ProcEnviron": []string{"TERM=linux\n\nPATH=(custom, no user)"}}
+
+	var buf bytes.Buffer
+	assert.Nil(t, WriteReport(&buf, report))
+	assert.Equal(t, "ProcEnviron:\n TERM=linux\n \n PATH=(custom, no user)\n", buf.String())
+}
+
+func TestWriteReportRejectsInvalidFieldNames(t *testing.T) {
+	var buf bytes.Buffer
+	assert.IsType(t, ErrorInvalidFieldName{}, WriteReport(&buf, Report{"Not valid": []string{"42"}}))
+}
+
+func TestWriteReportRoundTripsBinaryValues(t *testing.T) {
+	core := make([]byte, 3*binaryBlockSize+42)
+	rand.New(rand.NewSource(42)).Read(core)
+
+	report := Report{"ProblemType": []string{"Crash"}}
+	assert.Nil(t, report.SetBinary("CoreDump", bytes.NewReader(core)))
+	assert.True(t, report.IsBinary("CoreDump"))
+	assert.True(t, len(strings.Split(report["CoreDump"][0], "\n")) > 4)
+
+	var buf bytes.Buffer
+	assert.Nil(t, WriteReport(&buf, report))
+	assert.True(t, strings.HasPrefix(buf.String(), "ProblemType: Crash\nCoreDump: base64\n H4sI"))
+
+	parsed, err := ParseReport(&buf)
+	assert.Nil(t, err)
+
+	r, err := parsed.Binary("CoreDump")
+	assert.Nil(t, err)
+	b, err := ioutil.ReadAll(r)
+	assert.Nil(t, err)
+	assert.Equal(t, core, b)
+}
+
+func TestWriteReportWritesBinaryValuesLast(t *testing.T) {
+	report := Report{"ProblemType": []string{"Crash"}, "Signal": []string{"11"}}
+	assert.Nil(t, report.SetBinary("Attachment", strings.NewReader("attached")))
+
+	var buf bytes.Buffer
+	assert.Nil(t, WriteReport(&buf, report))
+	assert.True(t, strings.HasPrefix(buf.String(), "ProblemType: Crash\nSignal: 11\nAttachment: base64\n H4sI"))
+}
+
+func TestSetBinaryReferencesFilesUntilWritten(t *testing.T) {
+	core := make([]byte, 2*binaryBlockSize+42)
+	rand.New(rand.NewSource(42)).Read(core)
+
+	f, err := ioutil.TempFile("", "csi-report-writer-test")
+	assert.Nil(t, err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	f.Write([]byte("header"))
+	f.Write(core)
+	f.Seek(int64(len("header")), os.SEEK_SET)
+
+	report := Report{"ProblemType": []string{"Crash"}}
+	assert.Nil(t, report.SetBinary("CoreDump", f))
+	assert.True(t, report.IsBinary("CoreDump"))
+	assert.True(t, len(report["CoreDump"][0]) < 1024)
+
+	r, err := report.Binary("CoreDump")
+	assert.Nil(t, err)
+	b, err := ioutil.ReadAll(r)
+	r.Close()
+	assert.Nil(t, err)
+	assert.Equal(t, core, b)
+
+	var buf bytes.Buffer
+	assert.Nil(t, WriteReport(&buf, report))
+
+	parsed, err := ParseReport(&buf)
+	assert.Nil(t, err)
+
+	r, err = parsed.Binary("CoreDump")
+	assert.Nil(t, err)
+	b, err = ioutil.ReadAll(r)
+	assert.Nil(t, err)
+	assert.Equal(t, core, b)
+}
+
+func TestParseReportReferencesBinaryValuesOfFiles(t *testing.T) {
+	core := make([]byte, 2*binaryBlockSize+42)
+	rand.New(rand.NewSource(42)).Read(core)
+
+	report := Report{"ProblemType": []string{"Crash"}, "Signal": []string{"11"}}
+	assert.Nil(t, report.SetBinary("CoreDump", bytes.NewReader(core)))
+
+	f, err := ioutil.TempFile("", "csi-report-writer-test")
+	assert.Nil(t, err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	assert.Nil(t, WriteReport(f, report))
+	f.Seek(0, os.SEEK_SET)
+
+	parsed, err := ParseReport(f)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"11"}, parsed["Signal"])
+	assert.True(t, parsed.IsBinary("CoreDump"))
+	assert.True(t, len(parsed["CoreDump"][0]) < 1024)
+
+	r, err := parsed.Binary("CoreDump")
+	assert.Nil(t, err)
+	b, err := ioutil.ReadAll(r)
+	r.Close()
+	assert.Nil(t, err)
+	assert.Equal(t, core, b)
+
+	var buf bytes.Buffer
+	assert.Nil(t, WriteReport(&buf, parsed))
+
+	reparsed, err := ParseReport(&buf)
+	assert.Nil(t, err)
+
+	r, err = reparsed.Binary("CoreDump")
+	assert.Nil(t, err)
+	b, err = ioutil.ReadAll(r)
+	assert.Nil(t, err)
+	assert.Equal(t, core, b)
+}
+
+func TestSetBinaryReadsFromTheFileNotItsPath(t *testing.T) {
+	f, err := ioutil.TempFile("", "csi-report-writer-test")
+	assert.Nil(t, err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	f.Write([]byte("core"))
+	f.Seek(0, os.SEEK_SET)
+
+	report := Report{"ProblemType": []string{"Crash"}}
+	assert.Nil(t, report.SetBinary("CoreDump", f))
+	defer report.Close()
+
+	// Replace the file referenced by name.
+	assert.Nil(t, os.Remove(f.Name()))
+	assert.Nil(t, ioutil.WriteFile(f.Name(), []byte("replaced"), 0600))
+
+	var buf bytes.Buffer
+	assert.Nil(t, WriteReport(&buf, report))
+
+	parsed, err := ParseReport(&buf)
+	assert.Nil(t, err)
+
+	r, err := parsed.Binary("CoreDump")
+	assert.Nil(t, err)
+	b, err := ioutil.ReadAll(r)
+	assert.Nil(t, err)
+	assert.Equal(t, "core", string(b))
+}
@@ -0,0 +1,146 @@
+package crash
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/vosst/csi/proc/pid"
+)
+
+// maxUnresolvedFrames is the fraction of frames that may be outside of any
+// mapped file for StacktraceAddressSignature to still be computed.
+const maxUnresolvedFrames = 0.1
+
+// topFrameRegExp extracts the function name from a line of the StacktraceTop field.
+var topFrameRegExp = regexp.MustCompile(`^(?:([\w:~.]+).*|(<signal handler called>)\s*)$`)
+
+// field returns the first value of key, or an empty string if key is missing.
+func (self Report) field(key string) string {
+	if v := self[key]; len(v) > 0 {
+		return v[0]
+	}
+
+	return ""
+}
+
+// DuplicateSignature computes the signature apport uses for finding duplicates
+// of a crash: the executable path, the signal and the functions of the
+// topmost frames, separated by ':'.
+//
+// Returns false if the report is not a crash report or if any of the topmost
+// frames could not be symbolized.
+func (self Report) DuplicateSignature() (string, bool) {
+	exe, sig, top := self.field("ExecutablePath"), self.field("Signal"), self.field("StacktraceTop")
+	if self.field("ProblemType") != "Crash" || len(exe) == 0 || len(sig) == 0 || len(top) == 0 {
+		return "", false
+	}
+
+	parts := []string{exe, sig}
+	for _, line := range strings.Split(top, "\n") {
+		m := topFrameRegExp.FindStringSubmatch(line)
+		if m == nil {
+			return "", false
+		}
+
+		parts = append(parts, m[1]+m[2])
+	}
+
+	return strings.Join(parts, ":"), true
+}
+
+// StacktraceAddressSignature computes the signature apport uses for finding
+// duplicates of unsymbolized crashes: the executable path, the signal, the
+// machine and the addresses of all frames, given as offset into the mapped
+// file containing them, separated by ':'.
+//
+// Returns false if the report lacks the required fields or if too many
+// frames are outside of any mapped file.
+func (self Report) StacktraceAddressSignature() (string, bool) {
+	exe, sig, st := self.field("ExecutablePath"), self.field("Signal"), self.field("Stacktrace")
+	uname := strings.Fields(self.field("Uname"))
+	if len(exe) == 0 || len(sig) == 0 || len(st) == 0 || len(uname) == 0 {
+		return "", false
+	}
+
+	// Values lack the trailing line break that the maps parser relies on.
+	maps, err := pid.NewMapsFromReader(strings.NewReader(self.field("ProcMaps") + "\n"))
+	if err != nil {
+		return "", false
+	}
+
+	frames, failed := []string{}, 0
+	for _, line := range strings.Split(st, "\n") {
+		tokens := strings.Fields(line)
+		if len(tokens) < 2 || !strings.HasPrefix(tokens[0], "#") || !strings.HasPrefix(tokens[1], "0x") {
+			continue
+		}
+
+		addr, err := strconv.ParseUint(tokens[1][2:], 16, 64)
+		if err != nil {
+			continue
+		}
+
+		if offset, ok := addressToOffset(maps, addr); ok {
+			frames = append(frames, offset)
+		} else {
+			failed++
+		}
+	}
+
+	if len(frames) == 0 || float64(failed) > maxUnresolvedFrames*float64(len(frames)+failed) {
+		return "", false
+	}
+
+	return strings.Join(append([]string{exe, sig, uname[len(uname)-1]}, frames...), ":"), true
+}
+
+// addressToOffset renders addr as path+offset, relative to the mapping containing addr.
+func addressToOffset(maps pid.Maps, addr uint64) (string, bool) {
+	for _, mr := range maps {
+		if !strings.HasPrefix(mr.Path, "/") {
+			continue
+		}
+
+		if uint64(mr.Address.Begin) <= addr && addr < uint64(mr.Address.End) {
+			return fmt.Sprintf("%s+%x", mr.Path, addr-uint64(mr.Address.Begin)), true
+		}
+	}
+
+	return "", false
+}
+
+// AddSignatures sets the DuplicateSignature and StacktraceAddressSignature
+// fields if they are missing and can be computed.
+func (self Report) AddSignatures() {
+	if _, present := self["DuplicateSignature"]; !present {
+		if sig, ok := self.DuplicateSignature(); ok {
+			self["DuplicateSignature"] = []string{sig}
+		}
+	}
+
+	if _, present := self["StacktraceAddressSignature"]; !present {
+		if sig, ok := self.StacktraceAddressSignature(); ok {
+			self["StacktraceAddressSignature"] = []string{sig}
+		}
+	}
+}
+
+// Signature returns the signature identifying duplicates of the report,
+// preferring DuplicateSignature over StacktraceAddressSignature.
+//
+// Returns false if neither signature is available.
+func (self Report) Signature() (string, bool) {
+	for _, key := range []string{"DuplicateSignature", "StacktraceAddressSignature"} {
+		if sig := self.field(key); len(sig) > 0 {
+			return sig, true
+		}
+	}
+
+	if sig, ok := self.DuplicateSignature(); ok {
+		return sig, true
+	}
+
+	return self.StacktraceAddressSignature()
+}
@@ -0,0 +1,127 @@
+package crash
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// DefaultSignatureIndexFile is the default location of the signature index.
+const DefaultSignatureIndexFile = "/var/lib/csi/signatures.yaml"
+
+// SignatureEntry describes all crashes sharing a signature.
+type SignatureEntry struct {
+	Occurrences int       // Number of crashes with the signature that have been handled
+	Uploaded    time.Time // Time of the first successful upload, zero if never uploaded
+	Reports     []string  `yaml:",omitempty"` // Ids of the crashes counted in Occurrences
+}
+
+// SignatureIndex records crash signatures across runs, enabling us to skip
+// uploads of crashes that the server already knows about.
+type SignatureIndex struct {
+	Path    string                     // File the index is persisted to
+	Entries map[string]*SignatureEntry // Entries keyed by signature
+}
+
+// LoadSignatureIndex reads the index persisted in path. A missing file yields an empty index.
+//
+// Returns an error if reading or decoding path fails.
+func LoadSignatureIndex(path string) (*SignatureIndex, error) {
+	index := SignatureIndex{path, map[string]*SignatureEntry{}}
+
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &index, nil
+	} else if err != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to read signature index %s [%s]", path, err))
+	}
+
+	if err := yaml.Unmarshal(b, &index.Entries); err != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to decode signature index %s [%s]", path, err))
+	}
+
+	if index.Entries == nil {
+		index.Entries = map[string]*SignatureEntry{}
+	}
+
+	return &index, nil
+}
+
+// entry returns the entry for signature, creating it if necessary.
+func (self *SignatureIndex) entry(signature string) *SignatureEntry {
+	e, present := self.Entries[signature]
+	if !present {
+		e = &SignatureEntry{}
+		self.Entries[signature] = e
+	}
+
+	return e
+}
+
+// Add records the crash identified by report with signature. Every crash is
+// counted once, no matter how often it is added.
+//
+// Returns false if the crash has been recorded before.
+func (self *SignatureIndex) Add(signature string, report string) bool {
+	e := self.entry(signature)
+	for _, r := range e.Reports {
+		if r == report {
+			return false
+		}
+	}
+
+	e.Reports = append(e.Reports, report)
+	e.Occurrences++
+	return true
+}
+
+// ReportId identifies the crash report named name in a crash directory. As
+// apport reuses names for subsequent crashes of an executable, the id
+// includes the date of the crash if available.
+func ReportId(name string, report Report) string {
+	if date := report["Date"]; len(date) > 0 && len(date[0]) > 0 {
+		return name + "@" + date[0]
+	}
+
+	return name
+}
+
+// MarkUploaded records that a crash with signature has been uploaded at when.
+// The time of the first upload is kept.
+func (self *SignatureIndex) MarkUploaded(signature string, when time.Time) {
+	if e := self.entry(signature); e.Uploaded.IsZero() {
+		e.Uploaded = when
+	}
+}
+
+// Uploaded returns true if a crash with signature has been uploaded before.
+func (self *SignatureIndex) Uploaded(signature string) bool {
+	e, present := self.Entries[signature]
+	return present && !e.Uploaded.IsZero()
+}
+
+// Save persists the index to Path, replacing the previous contents atomically.
+//
+// Returns an error if encoding or writing the index fails.
+func (self *SignatureIndex) Save() error {
+	b, err := yaml.Marshal(self.Entries)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Failed to encode signature index [%s]", err))
+	}
+
+	if err := os.MkdirAll(filepath.Dir(self.Path), 0755); err != nil {
+		return errors.New(fmt.Sprintf("Failed to create directory for signature index %s [%s]", self.Path, err))
+	}
+
+	tmp := self.Path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return errors.New(fmt.Sprintf("Failed to write signature index %s [%s]", tmp, err))
+	}
+
+	return os.Rename(tmp, self.Path)
+}
@@ -0,0 +1,76 @@
+package crash
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignatureIndexStartsEmptyIfFileIsMissing(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "csi-signature-index")
+	defer os.RemoveAll(dir)
+
+	index, err := LoadSignatureIndex(filepath.Join(dir, "signatures.yaml"))
+	assert.Nil(t, err)
+	assert.Empty(t, index.Entries)
+	assert.False(t, index.Uploaded("sig"))
+}
+
+func TestSignatureIndexPersistsUploads(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "csi-signature-index")
+	defer os.RemoveAll(dir)
+
+	fn := filepath.Join(dir, "nested", "signatures.yaml")
+	index, _ := LoadSignatureIndex(fn)
+
+	first := time.Date(2015, time.September, 4, 7, 59, 46, 0, time.UTC)
+	assert.True(t, index.Add("sig", "a.crash"))
+	assert.True(t, index.Add("sig", "b.crash"))
+	index.MarkUploaded("sig", first)
+	index.MarkUploaded("sig", first.Add(time.Hour))
+	index.Add("other", "c.crash")
+	assert.Nil(t, index.Save())
+
+	loaded, err := LoadSignatureIndex(fn)
+	assert.Nil(t, err)
+	assert.True(t, loaded.Uploaded("sig"))
+	assert.False(t, loaded.Uploaded("other"))
+	assert.Equal(t, 2, loaded.Entries["sig"].Occurrences)
+	assert.True(t, first.Equal(loaded.Entries["sig"].Uploaded))
+}
+
+func TestLoadSignatureIndexRejectsMalformedFiles(t *testing.T) {
+	f, _ := ioutil.TempFile("", "csi-signature-index")
+	defer os.Remove(f.Name())
+	f.WriteString("- not a map")
+	f.Close()
+
+	_, err := LoadSignatureIndex(f.Name())
+	assert.NotNil(t, err)
+}
+
+func TestSignatureIndexCountsEveryReportOnce(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "csi-signature-index")
+	defer os.RemoveAll(dir)
+
+	fn := filepath.Join(dir, "signatures.yaml")
+	index, _ := LoadSignatureIndex(fn)
+
+	first := ReportId("a.crash", Report{"Date": []string{"Fri Sep  4 07:59:46 2015"}})
+	second := ReportId("a.crash", Report{"Date": []string{"Sat Sep  5 07:59:46 2015"}})
+	assert.NotEqual(t, first, second)
+
+	assert.True(t, index.Add("sig", first))
+	assert.False(t, index.Add("sig", first))
+	assert.Nil(t, index.Save())
+
+	// Walking the same reports in another run does not inflate the count.
+	index, _ = LoadSignatureIndex(fn)
+	assert.False(t, index.Add("sig", first))
+	assert.True(t, index.Add("sig", second))
+	assert.Equal(t, 2, index.Entries["sig"].Occurrences)
+}
@@ -0,0 +1,83 @@
+package crash
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testSignatureReport() Report {
+	return Report{
+		"ProblemType":    []string{"Crash"},
+		"ExecutablePath": []string{"/usr/bin/crashy"},
+		"Signal":         []string{"11"},
+		"Uname":          []string{"Linux 3.13.0-63-generic x86_64"},
+		"ProcMaps": []string{
+			"00400000-00401000 r-xp 00000000 08:02 1 /usr/bin/crashy\n" +
+				"00602000-00623000 rw-p 00000000 00:00 0 [heap]\n" +
+				"7f0000000000-7f0000002000 r-xp 00000000 08:02 2 /lib/libc.so.6"},
+		"Stacktrace": []string{
+			"#0  0x00007f0000001234 in raise () from /lib/libc.so.6\n" +
+				"#1  0x0000000000400567 in main () at main.c:42"},
+		"StacktraceTop": []string{"raise () from /lib/libc.so.6\nmain () at main.c:42"},
+	}
+}
+
+func TestDuplicateSignatureCombinesExecutableSignalAndFunctions(t *testing.T) {
+	sig, ok := testSignatureReport().DuplicateSignature()
+	assert.True(t, ok)
+	assert.Equal(t, "/usr/bin/crashy:11:raise:main", sig)
+}
+
+func TestDuplicateSignatureRequiresSymbolizedFrames(t *testing.T) {
+	report := testSignatureReport()
+	report["StacktraceTop"] = []string{"raise () from /lib/libc.so.6\n?? ()"}
+
+	_, ok := report.DuplicateSignature()
+	assert.False(t, ok)
+
+	report = testSignatureReport()
+	report["ProblemType"] = []string{"KernelOops"}
+
+	_, ok = report.DuplicateSignature()
+	assert.False(t, ok)
+}
+
+func TestStacktraceAddressSignatureUsesOffsetsIntoMappedFiles(t *testing.T) {
+	sig, ok := testSignatureReport().StacktraceAddressSignature()
+	assert.True(t, ok)
+	assert.Equal(t, "/usr/bin/crashy:11:x86_64:/lib/libc.so.6+1234:/usr/bin/crashy+567", sig)
+}
+
+func TestStacktraceAddressSignatureRejectsUnresolvedFrames(t *testing.T) {
+	report := testSignatureReport()
+	report["Stacktrace"] = []string{report["Stacktrace"][0] + "\n#2  0x0000000000602010 in ?? ()"}
+
+	_, ok := report.StacktraceAddressSignature()
+	assert.False(t, ok)
+}
+
+func TestAddSignaturesKeepsExistingFields(t *testing.T) {
+	report := testSignatureReport()
+	report["DuplicateSignature"] = []string{"existing"}
+	report.AddSignatures()
+
+	assert.Equal(t, []string{"existing"}, report["DuplicateSignature"])
+	assert.Equal(t, []string{"/usr/bin/crashy:11:x86_64:/lib/libc.so.6+1234:/usr/bin/crashy+567"}, report["StacktraceAddressSignature"])
+
+	sig, ok := report.Signature()
+	assert.True(t, ok)
+	assert.Equal(t, "existing", sig)
+}
+
+func TestSignatureFallsBackToAddressSignature(t *testing.T) {
+	report := testSignatureReport()
+	delete(report, "StacktraceTop")
+
+	sig, ok := report.Signature()
+	assert.True(t, ok)
+	assert.Equal(t, "/usr/bin/crashy:11:x86_64:/lib/libc.so.6+1234:/usr/bin/crashy+567", sig)
+
+	_, ok = Report{}.Signature()
+	assert.False(t, ok)
+}
@@ -1,39 +1,150 @@
 package csi
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"github.com/vosst/csi/core"
 	"github.com/vosst/csi/pkg/debian"
+	"github.com/vosst/csi/proc"
+	"github.com/vosst/csi/proc/pid"
+	"github.com/vosst/csi/stacktrace"
 	"os"
+	"syscall"
+	"time"
 )
 
 // Crash report bundles all meta-data about a crashed process.
 type CrashReport struct {
-	Signal  os.Signal      // Signal that caused the crash
-	System  *SystemReport  // Information about the overall system
-	Process *ProcessReport // Information about the crashed process
+	Signal     syscall.Signal        // Signal that caused the crash
+	Thread     int                   // Id of the thread that received the signal, 0 if unknown
+	When       time.Time             // Time of the crash
+	System     *SystemReport         // Information about the overall system
+	Process    *ProcessReport        // Information about the crashed process
+	Stacktrace stacktrace.Stacktrace // Symbolized stack of the faulting thread
 }
 
 // CrashInspector gathers information about a crash.
 type CrashInspector struct {
+	Proc       pid.FS    // The proc fs to read information about the crashed process from
+	Workers    int       // Maximum number of collectors running concurrently per inspector, DefaultWorkers if not positive
+	Collectors *Registry // Collectors to run, DefaultRegistry if nil
 }
 
-// Inspect gathers information for a crashed process identfied by pid, recording the signal that caused the crash.
+// Inspect gathers information for a crashed process, see InspectContext.
+func (self CrashInspector) Inspect(pid int, tid int, signal syscall.Signal) (*CrashReport, error) {
+	return self.InspectContext(context.Background(), pid, tid, signal)
+}
+
+// InspectContext gathers information for a crashed process identfied by pid, recording the signal that caused the crash
+// and the thread tid that received it. tid is ignored if it is not positive. System and process information is gathered
+// concurrently until done or until ctx is done, whatever happens first. A report is returned in any case, with failed
+// collectors recorded in the system and process reports.
 //
-// Returns an error if either gathering system info or process-specific info fails.
-func (self CrashInspector) Inspect(pid int, signal os.Signal) (*CrashReport, error) {
-	si := SystemInspector{debian.NewSystem()}
-	sr, err := si.Inspect()
-	if err != nil {
-		return nil, errors.New(fmt.Sprintf("Failed to gather system information [%s]\n", err))
+// Returns ErrorCollectors listing the failed collectors of both the system and the process inspection if any collector fails.
+func (self CrashInspector) InspectContext(ctx context.Context, pid int, tid int, signal syscall.Signal) (*CrashReport, error) {
+	var sr SystemReport
+	var serr error
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		si := SystemInspector{debian.NewSystem(), proc.FS(self.Proc), self.Workers, self.Collectors}
+		sr, serr = si.InspectContext(ctx)
+	}()
+
+	pi := ProcessInspector{debian.NewSystem(), self.Proc, self.Workers, self.Collectors}
+	pr, perr := pi.InspectContext(ctx, pid)
+
+	<-done
+
+	if tid < 0 {
+		tid = 0
+	}
+
+	errs := ErrorCollectors{}
+	for _, err := range []error{serr, perr} {
+		if ec, ok := err.(ErrorCollectors); ok {
+			errs = append(errs, ec...)
+		}
+	}
+
+	cr := &CrashReport{signal, tid, time.Now(), &sr, pr, nil}
+	if len(errs) > 0 {
+		return cr, errs
+	}
+
+	return cr, nil
+}
+
+// Unwind unwinds and symbolizes the stack of the faulting thread in c, resolving
+// addresses with the binaries mapped into the crashed process and their separate
+// debug files in debugDir. The mapped memory regions of the process report are
+// preferred over the file mappings recorded in c.
+//
+// The faulting thread is identified by Thread if known, and by the signal
+// recorded in c otherwise. Thread is updated accordingly.
+//
+// For processes executing in a different mount namespace, mapped files and
+// debugDir are resolved in the root of the process, which has to be alive.
+//
+// Returns an error if c does not contain any threads, if the files mapped into
+// the process cannot be resolved or if unwinding is not supported for the
+// machine the process executed on.
+func (self *CrashReport) Unwind(c *core.Core, debugDir string) error {
+	return self.unwind(pid.DefaultFS, c, debugDir)
+}
+
+// unwind is like Unwind but resolves the root of the process in the proc fs fs.
+func (self *CrashReport) unwind(fs pid.FS, c *core.Core, debugDir string) error {
+	thread := c.FaultingThread()
+	for i := range c.Threads {
+		if self.Thread > 0 && c.Threads[i].Pid == self.Thread {
+			thread = &c.Threads[i]
+		}
+	}
+
+	if thread == nil {
+		return errors.New("Failed to unwind stack, core does not contain any threads")
 	}
 
-	pi := ProcessInspector{debian.NewSystem()}
-	pr, err := pi.Inspect(pid)
+	self.Thread = thread.Pid
+
+	maps := pid.Maps{}
+	if self.Process != nil {
+		maps = self.Process.Maps
+	}
+
+	if len(maps) == 0 {
+		for _, f := range c.Files {
+			mr := pid.MemoryRegion{Offset: int64(f.Offset), Path: f.Path}
+			mr.Address.Begin, mr.Address.End = int64(f.Start), int64(f.End)
+			maps = append(maps, mr)
+		}
+	}
+
+	// Paths of mapped files are only meaningful in the mount namespace of the process.
+	root := ""
+	if self.Process != nil {
+		for _, t := range self.Process.ForeignNamespaces {
+			if t == pid.NamespaceMount {
+				root = fs.RootDir(self.Process.Stat.Pid)
+			}
+		}
+	}
+
+	if len(root) > 0 {
+		if _, err := os.Stat(root); err != nil {
+			return errors.New(fmt.Sprintf("Failed to unwind stack, cannot resolve mapped files in the mount namespace of the process [%s]", err))
+		}
+	}
 
+	u := stacktrace.Unwinder{Machine: c.Machine, Memory: c, Modules: stacktrace.NewModulesInRoot(maps, debugDir, root)}
+	st, err := u.Unwind(thread.Registers)
 	if err != nil {
-		return nil, errors.New(fmt.Sprintf("Failed to gather process information [%s]\n", err))
+		return errors.New(fmt.Sprintf("Failed to unwind stack [%s]", err))
 	}
 
-	return &CrashReport{signal, &sr, pr}, nil
+	self.Stacktrace = st
+	return nil
 }
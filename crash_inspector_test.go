@@ -0,0 +1,25 @@
+package csi
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vosst/csi/core"
+	"github.com/vosst/csi/proc/pid"
+)
+
+func TestUnwindReportsFilesThatCannotBeResolvedInTheMountNamespace(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "csi-crash-inspector-test")
+	defer os.RemoveAll(dir)
+
+	pr := &ProcessReport{ForeignNamespaces: []string{pid.NamespaceMount}}
+	pr.Stat.Pid = 42
+
+	cr := CrashReport{Process: pr}
+	err := cr.unwind(pid.FS(dir), &core.Core{Threads: []core.Thread{{Pid: 42}}}, "")
+	assert.NotNil(t, err)
+	assert.True(t, strings.Contains(err.Error(), "mount namespace"))
+}
@@ -0,0 +1,240 @@
+package csi
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/vosst/csi/core"
+	"github.com/vosst/csi/crash"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	crashReportFile = "report.yaml" // Name of the file containing the CrashReport of a csi crash.
+	coreFile        = "core"        // Name of the file containing the core dump of a csi crash.
+	apportSuffix    = ".crash"      // Suffix of apport crash report files.
+	apportCoreField = "CoreDump"    // Field containing the core dump in an apport crash report.
+
+	uploadStatusFile   = "upload.yaml"  // Name of the file containing the UploadStatus of a csi crash.
+	uploadStatusSuffix = ".upload.yaml" // Suffix of the file containing the UploadStatus of an apport crash.
+)
+
+// CrashStore provides access to all crashes in a crash directory. It handles
+// both apport's flat layout with one <name>.crash file per crash and the nested
+// layout written by 'csi dump', <exe>/<RFC3339 time>/<pid>/{report.yaml,core}.
+//
+// Crashes are identified by their name relative to Dir, either the file name
+// of an apport crash report or the relative path of a csi crash directory.
+type CrashStore struct {
+	Dir string // The crash directory.
+}
+
+// Path returns the directory for the crash of the process identified by pid,
+// executing exe, that happened at when.
+func (self CrashStore) Path(exe string, when time.Time, pid int) string {
+	return filepath.Join(self.Dir, exe, when.Format(time.RFC3339), fmt.Sprint(pid))
+}
+
+// isApport returns true if name refers to an apport crash report.
+func isApport(name string) bool {
+	return strings.HasSuffix(name, apportSuffix)
+}
+
+// signingVisitor adds missing signatures to reports before handing them to ReportVisitor.
+type signingVisitor struct {
+	crash.ReportVisitor
+}
+
+func (self signingVisitor) NewReport(name string, report crash.Report) {
+	report.AddSignatures()
+	self.ReportVisitor.NewReport(name, report)
+}
+
+// ForEachReport iterates over all crashes in the store, reporting them to
+// visitor as crash.Report. csi crashes are converted with CrashReport.ApportReport.
+// Signatures are added to all reports if they can be computed.
+func (self CrashStore) ForEachReport(visitor crash.ReportVisitor) {
+	crash.ForEachReportInDir(self.Dir, signingVisitor{visitor})
+
+	filepath.Walk(self.Dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			// ForEachReportInDir already reported an issue with Dir.
+			if path != self.Dir {
+				visitor.NewError(crash.ErrorFailedToReadCrashDir{path, err})
+			}
+			return nil
+		}
+
+		if info.IsDir() || info.Name() != crashReportFile {
+			return nil
+		}
+
+		name, _ := filepath.Rel(self.Dir, filepath.Dir(path))
+
+		cr, err := self.LoadCrashReport(name)
+		if err != nil {
+			visitor.NewError(crash.ErrorFailedToParseCrashReport{name, err})
+			return nil
+		}
+
+		visitor.NewReport(name, cr.ApportReport())
+		return nil
+	})
+}
+
+// LoadCrashReport decodes the CrashReport of the csi crash identified by name.
+//
+// Returns an error if name refers to an apport crash report or if reading or decoding fails.
+func (self CrashStore) LoadCrashReport(name string) (*CrashReport, error) {
+	if isApport(name) {
+		return nil, errors.New(fmt.Sprintf("%s is an apport crash report", name))
+	}
+
+	fn := filepath.Join(self.Dir, name, crashReportFile)
+
+	b, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to read %s [%s]", fn, err))
+	}
+
+	cr := CrashReport{}
+	if err := yaml.Unmarshal(b, &cr); err != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to decode %s [%s]", fn, err))
+	}
+
+	return &cr, nil
+}
+
+// readCloser combines a decoding reader with the file it reads from.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// apportCore decodes the core dump of an apport crash report from the report's file.
+type apportCore struct {
+	io.ReadCloser
+	report crash.Report // The report referencing the core dump
+	file   *os.File     // The file keeping the report
+}
+
+// Close closes the decoding reader, the report and its file.
+func (self apportCore) Close() error {
+	self.ReadCloser.Close()
+	self.report.Close()
+	return self.file.Close()
+}
+
+// OpenCore opens the core dump of the crash identified by name. For csi crashes,
+// snappy-compressed cores are transparently decompressed. For apport crash
+// reports, the CoreDump field is decoded.
+//
+// Returns an error if the crash has no core dump or if opening it fails.
+func (self CrashStore) OpenCore(name string) (io.ReadCloser, error) {
+	if isApport(name) {
+		f, err := os.Open(filepath.Join(self.Dir, name))
+		if err != nil {
+			return nil, err
+		}
+
+		report, err := crash.ParseReport(f)
+		if err != nil {
+			f.Close()
+			return nil, crash.ErrorFailedToParseCrashReport{name, err}
+		}
+
+		r, err := report.Binary(apportCoreField)
+		if err != nil {
+			report.Close()
+			f.Close()
+			return nil, err
+		}
+
+		return apportCore{r, report, f}, nil
+	}
+
+	fn := filepath.Join(self.Dir, name, coreFile)
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to open core %s [%s]", fn, err))
+	}
+
+	return readCloser{core.Decompress(f), f}, nil
+}
+
+// uploadStatusPath returns the file recording the upload status of the crash identified by name.
+func (self CrashStore) uploadStatusPath(name string) string {
+	if isApport(name) {
+		return filepath.Join(self.Dir, strings.TrimSuffix(name, apportSuffix)+uploadStatusSuffix)
+	}
+
+	return filepath.Join(self.Dir, name, uploadStatusFile)
+}
+
+// LoadUploadStatus reads the upload status of the crash identified by name.
+// Crashes without a recorded status yield a zero UploadStatus.
+//
+// Returns an error if reading or decoding the status fails.
+func (self CrashStore) LoadUploadStatus(name string) (UploadStatus, error) {
+	status := UploadStatus{}
+	fn := self.uploadStatusPath(name)
+
+	b, err := ioutil.ReadFile(fn)
+	if os.IsNotExist(err) {
+		return status, nil
+	} else if err != nil {
+		return status, errors.New(fmt.Sprintf("Failed to read upload status %s [%s]", fn, err))
+	}
+
+	if err := yaml.Unmarshal(b, &status); err != nil {
+		return status, errors.New(fmt.Sprintf("Failed to decode upload status %s [%s]", fn, err))
+	}
+
+	return status, nil
+}
+
+// SaveUploadStatus records status for the crash identified by name, replacing
+// the previous status atomically.
+//
+// Returns an error if encoding or writing the status fails.
+func (self CrashStore) SaveUploadStatus(name string, status UploadStatus) error {
+	b, err := yaml.Marshal(status)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Failed to encode upload status [%s]", err))
+	}
+
+	fn := self.uploadStatusPath(name)
+	if err := ioutil.WriteFile(fn+".tmp", b, 0644); err != nil {
+		return errors.New(fmt.Sprintf("Failed to write upload status %s [%s]", fn, err))
+	}
+
+	return os.Rename(fn+".tmp", fn)
+}
+
+// Remove deletes the crash identified by name from the store, including its
+// upload status. For csi crashes, parent directories left empty are pruned, too.
+func (self CrashStore) Remove(name string) error {
+	if isApport(name) {
+		os.Remove(self.uploadStatusPath(name))
+		return os.Remove(filepath.Join(self.Dir, name))
+	}
+
+	if err := os.RemoveAll(filepath.Join(self.Dir, name)); err != nil {
+		return err
+	}
+
+	for dir := filepath.Dir(name); dir != "." && dir != string(filepath.Separator); dir = filepath.Dir(dir) {
+		// Remove fails for non-empty directories, which is exactly what we want.
+		if os.Remove(filepath.Join(self.Dir, dir)) != nil {
+			break
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,129 @@
+package csi
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/snappy"
+	"github.com/stretchr/testify/assert"
+	"github.com/vosst/csi/crash"
+	"gopkg.in/yaml.v2"
+)
+
+type recordingVisitor struct {
+	Reports map[string]crash.Report
+	Errors  []error
+}
+
+func (self *recordingVisitor) NewReport(name string, report crash.Report) {
+	self.Reports[name] = report
+}
+
+func (self *recordingVisitor) NewError(err error) {
+	self.Errors = append(self.Errors, err)
+}
+
+// newTestStore populates a temporary crash directory with an apport crash report
+// and a csi crash with a snappy-compressed core.
+func newTestStore(t *testing.T) (CrashStore, string, func()) {
+	dir, err := ioutil.TempDir("", "csi-crash-store")
+	assert.Nil(t, err)
+
+	b, err := ioutil.ReadFile("crash/test_data/test.crash")
+	assert.Nil(t, err)
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "test.crash"), b, 0644))
+
+	cr := testCrashReport()
+	store := CrashStore{dir}
+	cd := store.Path("python3.4", cr.When, 42)
+	assert.Nil(t, os.MkdirAll(cd, 0755))
+
+	b, err = yaml.Marshal(cr)
+	assert.Nil(t, err)
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(cd, crashReportFile), b, 0644))
+
+	f, err := os.Create(filepath.Join(cd, coreFile))
+	assert.Nil(t, err)
+	w := snappy.NewWriter(f)
+	w.Write([]byte("core dump contents"))
+	w.Close()
+	f.Close()
+
+	name, _ := filepath.Rel(dir, cd)
+	return store, name, func() { os.RemoveAll(dir) }
+}
+
+func TestCrashStoreVisitsApportAndCsiCrashes(t *testing.T) {
+	store, name, cleanup := newTestStore(t)
+	defer cleanup()
+
+	rv := recordingVisitor{Reports: map[string]crash.Report{}}
+	store.ForEachReport(&rv)
+
+	assert.Empty(t, rv.Errors)
+	assert.Equal(t, 2, len(rv.Reports))
+	assert.Equal(t, []string{"KernelOops"}, rv.Reports["test.crash"]["ProblemType"])
+	assert.Equal(t, []string{"/usr/bin/python3.4"}, rv.Reports[name]["ExecutablePath"])
+	assert.Equal(t, []string{"11"}, rv.Reports[name]["Signal"])
+}
+
+func TestCrashStoreLoadsCrashReport(t *testing.T) {
+	store, name, cleanup := newTestStore(t)
+	defer cleanup()
+
+	cr, err := store.LoadCrashReport(name)
+	assert.Nil(t, err)
+
+	expected := testCrashReport()
+	assert.Equal(t, expected.Signal, cr.Signal)
+	assert.True(t, expected.When.Equal(cr.When))
+	assert.Equal(t, expected.System.OS.Kernel, cr.System.OS.Kernel)
+	assert.Equal(t, expected.Process.Bundle, cr.Process.Bundle)
+	assert.Equal(t, expected.Process.Maps, cr.Process.Maps)
+	assert.Equal(t, expected.ApportReport(), cr.ApportReport())
+
+	_, err = store.LoadCrashReport("test.crash")
+	assert.NotNil(t, err)
+}
+
+func TestCrashStoreDecompressesSnappyCores(t *testing.T) {
+	store, name, cleanup := newTestStore(t)
+	defer cleanup()
+
+	r, err := store.OpenCore(name)
+	assert.Nil(t, err)
+	defer r.Close()
+
+	b, err := ioutil.ReadAll(r)
+	assert.Nil(t, err)
+	assert.Equal(t, "core dump contents", string(b))
+}
+
+func TestCrashStoreReadsUncompressedCores(t *testing.T) {
+	store, name, cleanup := newTestStore(t)
+	defer cleanup()
+
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(store.Dir, name, coreFile), []byte("\x7fELF"), 0644))
+
+	r, err := store.OpenCore(name)
+	assert.Nil(t, err)
+	defer r.Close()
+
+	b, err := ioutil.ReadAll(r)
+	assert.Nil(t, err)
+	assert.Equal(t, "\x7fELF", string(b))
+}
+
+func TestCrashStoreRemovesCrashesAndPrunesEmptyDirectories(t *testing.T) {
+	store, name, cleanup := newTestStore(t)
+	defer cleanup()
+
+	assert.Nil(t, store.Remove(name))
+	assert.Nil(t, store.Remove("test.crash"))
+
+	entries, err := ioutil.ReadDir(store.Dir)
+	assert.Nil(t, err)
+	assert.Empty(t, entries)
+}
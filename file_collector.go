@@ -0,0 +1,184 @@
+package csi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"syscall"
+)
+
+// DefaultFileLimit is the maximum number of bytes gathered from the end of a
+// file if a FileCollectorConfig does not declare a limit.
+const DefaultFileLimit = 1024 * 1024
+
+// maxSymlinks is the maximum number of symbolic links followed when resolving a path.
+const maxSymlinks = 40
+
+// FileCollectorConfig declares a collector gathering the contents of a file.
+type FileCollectorConfig struct {
+	Name  string // Name of the collector
+	Scope Scope  // Scope of the collector, paths of process collectors are resolved in the root of the inspected process
+	Path  string // Path of the file
+	Limit int64  // Maximum number of bytes gathered from the end of the file, DefaultFileLimit if not positive
+}
+
+// fileCollector gathers the contents of a file, as declared by a FileCollectorConfig.
+type fileCollector struct {
+	config FileCollectorConfig
+}
+
+// NewFileCollector returns a Collector gathering the contents of the file
+// declared in config, e.g., the log file of an application.
+func NewFileCollector(config FileCollectorConfig) Collector {
+	if len(config.Scope) == 0 {
+		config.Scope = ScopeSystem
+	}
+
+	return fileCollector{config}
+}
+
+func (self fileCollector) Name() string {
+	return self.config.Name
+}
+
+func (self fileCollector) Scope() Scope {
+	return self.config.Scope
+}
+
+// Collect returns the trailing self.config.Limit bytes of the file as a string.
+// Paths of process collectors, including the targets of symbolic links, are
+// resolved in the root of the process, such that they never refer to files
+// outside of it.
+//
+// Returns an error if opening or reading the file fails, or if the file is
+// not a regular file.
+func (self fileCollector) Collect(ctx context.Context, target Target) (interface{}, error) {
+	root, fn := "/", self.config.Path
+	if self.config.Scope == ScopeProcess {
+		root = target.Proc.RootDir(target.Pid)
+	}
+
+	f, err := openInRoot(root, fn)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to open %s [%s]", fn, err))
+	}
+
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to stat %s [%s]", fn, err))
+	}
+
+	if !fi.Mode().IsRegular() {
+		return nil, errors.New(fmt.Sprintf("Failed to read %s [not a regular file]", fn))
+	}
+
+	limit := self.config.Limit
+	if limit <= 0 {
+		limit = DefaultFileLimit
+	}
+
+	if fi.Size() > limit {
+		if _, err := f.Seek(-limit, os.SEEK_END); err != nil {
+			return nil, errors.New(fmt.Sprintf("Failed to seek in %s [%s]", fn, err))
+		}
+	}
+
+	b, err := ioutil.ReadAll(io.LimitReader(f, limit))
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to read %s [%s]", fn, err))
+	}
+
+	return string(b), nil
+}
+
+// openInRoot opens fn for reading, resolving it in the directory root as if
+// root was the root directory. Every component is opened without following
+// symbolic links, links are read and resolved in root instead. The file is
+// opened non-blocking, such that opening a FIFO does not wait for a writer.
+//
+// Returns an error if resolving or opening fn fails.
+func openInRoot(root string, fn string) (*os.File, error) {
+	rootFd, err := syscall.Open(root, syscall.O_RDONLY|syscall.O_DIRECTORY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, &os.PathError{"open", root, err}
+	}
+
+	// dirs holds the directories resolved so far, starting with root.
+	dirs := []int{rootFd}
+	defer func() {
+		for _, fd := range dirs {
+			syscall.Close(fd)
+		}
+	}()
+
+	components := strings.Split(fn, "/")
+	links := 0
+
+	for len(components) > 0 {
+		name := components[0]
+		components = components[1:]
+
+		switch name {
+		case "", ".":
+			continue
+		case "..":
+			if len(dirs) > 1 {
+				syscall.Close(dirs[len(dirs)-1])
+				dirs = dirs[:len(dirs)-1]
+			}
+			continue
+		}
+
+		dir := dirs[len(dirs)-1]
+		flags := syscall.O_RDONLY | syscall.O_NOFOLLOW | syscall.O_CLOEXEC
+		if len(components) > 0 {
+			flags |= syscall.O_DIRECTORY
+		} else {
+			flags |= syscall.O_NONBLOCK
+		}
+
+		fd, err := syscall.Openat(dir, name, flags, 0)
+		if err == syscall.ELOOP || err == syscall.ENOTDIR {
+			// The component might be a symbolic link, refused by O_NOFOLLOW.
+			target, lerr := os.Readlink(fmt.Sprintf("/proc/self/fd/%d/%s", dir, name))
+			if lerr != nil {
+				return nil, &os.PathError{"open", fn, err}
+			}
+
+			if links++; links > maxSymlinks {
+				return nil, &os.PathError{"open", fn, syscall.ELOOP}
+			}
+
+			if path.IsAbs(target) {
+				for _, fd := range dirs[1:] {
+					syscall.Close(fd)
+				}
+				dirs = dirs[:1]
+			}
+
+			components = append(strings.Split(target, "/"), components...)
+			continue
+		}
+
+		if err != nil {
+			return nil, &os.PathError{"open", fn, err}
+		}
+
+		if len(components) > 0 {
+			dirs = append(dirs, fd)
+			continue
+		}
+
+		return os.NewFile(uintptr(fd), fn), nil
+	}
+
+	// fn resolves to a directory.
+	return nil, &os.PathError{"open", fn, syscall.EISDIR}
+}
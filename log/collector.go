@@ -1,19 +1,26 @@
 package log
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
-	"io/ioutil"
+	"io"
+	"os"
 
 	"github.com/vosst/csi/dmesg"
 )
 
+// syslogChunkSize is the number of bytes read from the syslog at once, in between checking for cancellation.
+const syslogChunkSize = 1024 * 1024
+
 // A Collector handles gathering of all contents of a log facility.
 type Collector interface {
-	// Collect gathers a blob of bytes representing the contents of a specific log facility.
+	// Collect gathers a blob of bytes representing the contents of a specific log facility,
+	// giving up once ctx is done.
 	//
-	// Returns an error if snapshotting the underlying log facility fails.
-	Collect() ([]byte, error)
+	// Returns an error if snapshotting the underlying log facility fails or ctx is done.
+	Collect(ctx context.Context) ([]byte, error)
 }
 
 // A DmesgCollector gathers the contents of the kernel log buffer.
@@ -25,10 +32,15 @@ func NewDmesgCollector() DmesgCollector {
 	return DmesgCollector{}
 }
 
-// Collect returns the contents of the kernel log buffer.
+// Collect returns the contents of the kernel log buffer. Reading the buffer
+// takes a single syscall that cannot be cancelled, ctx is only checked before.
 //
 // Returns an error if querying the kernel log buffer fails due to a lag of permissions.
-func (d DmesgCollector) Collect() ([]byte, error) {
+func (d DmesgCollector) Collect(ctx context.Context) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	blob, err := dmesg.ReadAll()
 	if err != nil {
 		return nil, errors.New(fmt.Sprintf("Failed to collect contents of the kernel log buffer [%s]", err))
@@ -47,11 +59,27 @@ func NewSyslogCollector() SyslogCollector {
 	return SyslogCollector{"/var/log/syslog"}
 }
 
-func (s SyslogCollector) Collect() ([]byte, error) {
-	blob, err := ioutil.ReadFile(s.fn)
+// Collect returns the contents of the syslog, read in chunks until ctx is done.
+//
+// Returns an error if reading the syslog fails or ctx is done.
+func (s SyslogCollector) Collect(ctx context.Context) ([]byte, error) {
+	f, err := os.Open(s.fn)
 	if err != nil {
 		return nil, errors.New(fmt.Sprintf("Failed to collect syslog from %s [%s]", s.fn, err))
 	}
 
-	return blob, nil
+	defer f.Close()
+
+	blob := bytes.Buffer{}
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		if _, err := io.CopyN(&blob, f, syslogChunkSize); err == io.EOF {
+			return blob.Bytes(), nil
+		} else if err != nil {
+			return nil, errors.New(fmt.Sprintf("Failed to collect syslog from %s [%s]", s.fn, err))
+		}
+	}
 }
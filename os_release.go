@@ -0,0 +1,172 @@
+package csi
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// OSReleaseFiles lists the locations of os-release, in order of precedence. Please see man os-release.
+var OSReleaseFiles = []string{"/etc/os-release", "/usr/lib/os-release"}
+
+// OSRelease identifies the operating system, as described in os-release. Fields
+// missing from os-release are left empty.
+type OSRelease struct {
+	Id              string   // Lower-case identifier of the OS, e.g., debian (ID)
+	IdLike          []string `yaml:",omitempty"` // Identifiers of closely related OSes, e.g., [rhel, fedora] (ID_LIKE)
+	VersionId       string   // Version of the OS, e.g., 12 (VERSION_ID)
+	VersionCodename string   // Lower-case code name of the release, e.g., bookworm (VERSION_CODENAME)
+	PrettyName      string   // Name of the OS suitable for presentation (PRETTY_NAME)
+	Variant         string   // Variant or edition of the OS, e.g., Server Edition (VARIANT)
+	BuildId         string   // Identifier of the system image the OS was installed from (BUILD_ID)
+}
+
+// NewOSReleaseFromVars assembles an OSRelease from the variables of os-release.
+func NewOSReleaseFromVars(vars map[string]string) OSRelease {
+	return OSRelease{
+		Id:              vars["ID"],
+		IdLike:          strings.Fields(vars["ID_LIKE"]),
+		VersionId:       vars["VERSION_ID"],
+		VersionCodename: vars["VERSION_CODENAME"],
+		PrettyName:      vars["PRETTY_NAME"],
+		Variant:         vars["VARIANT"],
+		BuildId:         vars["BUILD_ID"],
+	}
+}
+
+// ErrorInvalidAssignment describes a line skipped by ParseShellVars.
+type ErrorInvalidAssignment struct {
+	Line int   // Number of the line, starting at 1
+	Err  error // Reason the line is not a valid assignment
+}
+
+// Error pretty prints an ErrorInvalidAssignment instance.
+func (self ErrorInvalidAssignment) Error() string {
+	return fmt.Sprintf("Failed to parse line %d [%s]", self.Line, self.Err)
+}
+
+// ErrorInvalidAssignments lists all lines skipped by ParseShellVars.
+type ErrorInvalidAssignments []ErrorInvalidAssignment
+
+// Error pretty prints an ErrorInvalidAssignments instance.
+func (self ErrorInvalidAssignments) Error() string {
+	s := []string{}
+	for _, err := range self {
+		s = append(s, err.Error())
+	}
+
+	return fmt.Sprintf("%d lines skipped [%s]", len(self), strings.Join(s, "; "))
+}
+
+// ParseShellVars parses the variable assignments read from reader, in the
+// format of os-release and lsb-release: one assignment VAR=value per line,
+// with value quoted according to the rules of the shell. Empty lines and
+// comments are skipped, variable expansion is not supported. Lines that are
+// not valid assignments are skipped, too, the assignments of all other lines
+// are returned in any case.
+//
+// Returns ErrorInvalidAssignments listing the skipped lines if any line is not
+// a valid assignment, or an error if reading from reader fails.
+func ParseShellVars(reader io.Reader) (map[string]string, error) {
+	vars := map[string]string{}
+	invalid := ErrorInvalidAssignments{}
+	scanner := bufio.NewScanner(reader)
+
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 || len(kv[0]) == 0 || strings.ContainsAny(kv[0], " \t") {
+			invalid = append(invalid, ErrorInvalidAssignment{n, errors.New("Expected an assignment VAR=value")})
+			continue
+		}
+
+		value, err := unquoteShell(kv[1])
+		if err != nil {
+			invalid = append(invalid, ErrorInvalidAssignment{n, err})
+			continue
+		}
+
+		vars[kv[0]] = value
+	}
+
+	if err := scanner.Err(); err != nil {
+		return vars, err
+	}
+
+	if len(invalid) > 0 {
+		return vars, invalid
+	}
+
+	return vars, nil
+}
+
+// unquoteShell removes the quoting from the shell word s: characters enclosed in
+// single quotes are taken literally, backslashes escape $, `, ", \ and newlines
+// within double quotes and any character outside of quotes. Unquoted whitespace
+// terminates the word and may only be followed by a comment.
+func unquoteShell(s string) (string, error) {
+	const (
+		unquoted = iota
+		single
+		double
+	)
+
+	state := unquoted
+	word := []rune{}
+	runes := []rune(s)
+
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+
+		switch state {
+		case single:
+			if r == '\'' {
+				state = unquoted
+			} else {
+				word = append(word, r)
+			}
+		case double:
+			switch {
+			case r == '"':
+				state = unquoted
+			case r == '\\' && i+1 < len(runes) && strings.ContainsRune("$`\"\\\n", runes[i+1]):
+				i++
+				word = append(word, runes[i])
+			default:
+				word = append(word, r)
+			}
+		default:
+			switch {
+			case r == '\'':
+				state = single
+			case r == '"':
+				state = double
+			case r == '\\':
+				if i+1 == len(runes) {
+					return "", errors.New("Trailing backslash")
+				}
+				i++
+				word = append(word, runes[i])
+			case r == ' ' || r == '\t':
+				if rest := strings.TrimSpace(string(runes[i:])); len(rest) > 0 && !strings.HasPrefix(rest, "#") {
+					return "", errors.New(fmt.Sprintf("Unquoted whitespace in %s", s))
+				}
+				return string(word), nil
+			default:
+				word = append(word, r)
+			}
+		}
+	}
+
+	if state != unquoted {
+		return "", errors.New(fmt.Sprintf("Unterminated quote in %s", s))
+	}
+
+	return string(word), nil
+}
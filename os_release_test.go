@@ -0,0 +1,84 @@
+package csi
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseShellVarsHandlesQuoting(t *testing.T) {
+	input := `# comment
+NAME="Fedora Linux"
+ID=fedora
+ID_LIKE='rhel centos'
+
+VERSION="39 (Server \"Edition\")"
+VARIANT=Server\ Edition  # trailing comment
+BUILD_ID="a\$b\\c\d"
+EMPTY=
+`
+
+	vars, err := ParseShellVars(strings.NewReader(input))
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{
+		"NAME":     "Fedora Linux",
+		"ID":       "fedora",
+		"ID_LIKE":  "rhel centos",
+		"VERSION":  `39 (Server "Edition")`,
+		"VARIANT":  "Server Edition",
+		"BUILD_ID": `a$b\c\d`,
+		"EMPTY":    "",
+	}, vars)
+
+	for _, line := range []string{"NAME", "NAME=\"unterminated", "NAME='unterminated", "NAME=a b", "NAME=trailing\\"} {
+		_, err := ParseShellVars(strings.NewReader(line))
+		assert.NotNil(t, err, line)
+	}
+}
+
+func TestParseShellVarsSkipsInvalidLines(t *testing.T) {
+	input := "ID=debian\nnot an assignment\nNAME=\"unterminated\nVERSION_ID=\"12\"\n"
+
+	vars, err := ParseShellVars(strings.NewReader(input))
+	assert.Equal(t, map[string]string{"ID": "debian", "VERSION_ID": "12"}, vars)
+
+	invalid, ok := err.(ErrorInvalidAssignments)
+	assert.True(t, ok)
+	assert.Equal(t, 2, len(invalid))
+	assert.Equal(t, 2, invalid[0].Line)
+	assert.Equal(t, 3, invalid[1].Line)
+}
+
+func TestOSInspectorPrefersOSReleaseOverLSBRelease(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "csi-os-release-test")
+	defer os.RemoveAll(dir)
+
+	etc, usr, lsb := filepath.Join(dir, "etc-os-release"), filepath.Join(dir, "usr-os-release"), filepath.Join(dir, "lsb-release")
+	assert.Nil(t, ioutil.WriteFile(usr, []byte("NAME=\"Debian GNU/Linux\"\nID=debian\nVERSION_ID=\"12\"\nVERSION_CODENAME=bookworm\nHOME_URL=https://www.debian.org/ (broken)\n"), 0644))
+	assert.Nil(t, ioutil.WriteFile(lsb, []byte("DISTRIB_ID=Ubuntu\nDISTRIB_RELEASE=14.04\nDISTRIB_CODENAME=trusty\nDISTRIB_DESCRIPTION=\"Ubuntu 14.04 LTS\"\n"), 0644))
+
+	oi := OSInspector{OSReleaseFiles: []string{etc, usr}, ReleaseFile: lsb}
+
+	osi, err := oi.release()
+	assert.Nil(t, err)
+	assert.Equal(t, "Debian GNU/Linux", osi.Name)
+	assert.Equal(t, "12", osi.Release)
+	assert.Equal(t, OSRelease{Id: "debian", IdLike: []string{}, VersionId: "12", VersionCodename: "bookworm", PrettyName: "Linux"}, osi.OSRelease)
+
+	assert.Nil(t, os.Remove(usr))
+
+	osi, err = oi.release()
+	assert.Nil(t, err)
+	assert.Equal(t, "Ubuntu", osi.Name)
+	assert.Equal(t, "14.04", osi.Release)
+	assert.Equal(t, OSRelease{Id: "ubuntu", VersionId: "14.04", VersionCodename: "trusty", PrettyName: "Ubuntu 14.04 LTS"}, osi.OSRelease)
+
+	assert.Nil(t, os.Remove(lsb))
+
+	_, err = oi.release()
+	assert.NotNil(t, err)
+}
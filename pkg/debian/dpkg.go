@@ -35,6 +35,11 @@ func NewDpkg() *Dpkg {
 	return &Dpkg{"/var/lib/dpkg"}
 }
 
+// NewDpkgInRoot returns a new Dpkg instance, pointing to the dpkg runtime dir of the installation below root
+func NewDpkgInRoot(root string) *Dpkg {
+	return &Dpkg{filepath.Join(root, "/var/lib/dpkg")}
+}
+
 func (self Dpkg) Architecture() (string, error) {
 	archFn := filepath.Join(self.runtimeDir, "arch")
 
@@ -12,6 +12,16 @@ func NewSystem() *System {
 	return &System{NewDpkg()}
 }
 
+// NewSystemInRoot returns a new System instance inspecting the installation below root.
+func NewSystemInRoot(root string) *System {
+	return &System{NewDpkgInRoot(root)}
+}
+
+// InRoot returns a System inspecting the installation below root, implementing pkg.RootedSystem.
+func (self System) InRoot(root string) pkg.System {
+	return NewSystemInRoot(root)
+}
+
 // Resolve returns all packages containing a file matching pattern.
 //
 // Returns an error if querying the underlying package index fails.
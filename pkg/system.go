@@ -5,3 +5,11 @@ type System interface {
 	Resolver             // System provides means to resolve bundles given a search pattern
 	Arch() (Arch, error) // Arch returns the machine architecture that the current system was built for
 }
+
+// RootedSystem models a packaging system that is able to inspect
+// installations below another root directory, e.g., a container's rootfs.
+type RootedSystem interface {
+	System
+	// InRoot returns a System inspecting the installation below root.
+	InRoot(root string) System
+}
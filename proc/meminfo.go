@@ -0,0 +1,197 @@
+package proc
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// MemInfo describes the usage of memory and swap across the system, as
+// reported in /proc/meminfo. Sizes are given in bytes, the HugePages counts
+// in pages. Fields not reported by the running kernel are left at their zero
+// value, entries unknown to csi are kept in Other.
+type MemInfo struct {
+	MemTotal          uint64            // Total usable RAM
+	MemFree           uint64            // RAM left entirely unused
+	MemAvailable      uint64            // Estimate of the memory available for starting new applications without swapping
+	Buffers           uint64            // Memory in buffer cache for raw disk blocks
+	Cached            uint64            // Memory in the page cache, excluding SwapCached
+	SwapCached        uint64            // Memory swapped out and back in, still present in the swap file
+	Active            uint64            // Memory used recently, usually not reclaimed
+	Inactive          uint64            // Memory not used recently, eligible for reclaim
+	ActiveAnon        uint64            // Anonymous memory used recently
+	InactiveAnon      uint64            // Anonymous memory eligible for reclaim
+	ActiveFile        uint64            // File-backed memory used recently
+	InactiveFile      uint64            // File-backed memory eligible for reclaim
+	Unevictable       uint64            // Memory that cannot be reclaimed, e.g., mlocked pages
+	Mlocked           uint64            // Memory locked with mlock
+	SwapTotal         uint64            // Total amount of swap space available
+	SwapFree          uint64            // Amount of swap space currently unused
+	Dirty             uint64            // Memory waiting to be written back to disk
+	Writeback         uint64            // Memory actively being written back to disk
+	AnonPages         uint64            // Anonymous memory mapped into user space page tables
+	Mapped            uint64            // Files mapped into memory, e.g., libraries
+	Shmem             uint64            // Shared memory and tmpfs
+	KReclaimable      uint64            // Kernel allocations the kernel attempts to reclaim under memory pressure
+	Slab              uint64            // In-kernel data structures cache
+	SReclaimable      uint64            // Part of Slab that might be reclaimed
+	SUnreclaim        uint64            // Part of Slab that cannot be reclaimed
+	KernelStack       uint64            // Memory used by kernel stacks
+	PageTables        uint64            // Memory used by page tables
+	NFSUnstable       uint64            // NFS pages sent to the server but not yet committed
+	Bounce            uint64            // Memory used for block device bounce buffers
+	WritebackTmp      uint64            // Memory used by FUSE for temporary writeback buffers
+	CommitLimit       uint64            // Total amount of memory that can be allocated under strict overcommit
+	CommittedAS       uint64            // Amount of memory presently allocated, even if not yet used
+	VmallocTotal      uint64            // Total size of the vmalloc area
+	VmallocUsed       uint64            // Used part of the vmalloc area
+	VmallocChunk      uint64            // Largest contiguous free block of the vmalloc area
+	Percpu            uint64            // Memory used by per-cpu allocations
+	HardwareCorrupted uint64            // Memory the kernel identified as corrupted
+	AnonHugePages     uint64            // Anonymous memory backed by transparent huge pages
+	ShmemHugePages    uint64            // Shared memory backed by huge pages
+	ShmemPmdMapped    uint64            // Shared memory mapped into user space with huge pages
+	FileHugePages     uint64            // File-backed memory backed by huge pages
+	FilePmdMapped     uint64            // File-backed memory mapped into user space with huge pages
+	HugePagesTotal    uint64            // Size of the pool of huge pages, in pages
+	HugePagesFree     uint64            // Number of huge pages in the pool not yet allocated
+	HugePagesRsvd     uint64            // Number of huge pages reserved but not yet allocated
+	HugePagesSurp     uint64            // Number of huge pages in the pool above HugePagesTotal
+	Hugepagesize      uint64            // Default size of huge pages
+	Hugetlb           uint64            // Memory consumed by huge pages of all sizes
+	DirectMap4k       uint64            // Memory mapped by the kernel with 4k pages
+	DirectMap2M       uint64            // Memory mapped by the kernel with 2M pages
+	DirectMap1G       uint64            // Memory mapped by the kernel with 1G pages
+	Other             map[string]uint64 `yaml:",omitempty" json:",omitempty"` // Entries not known to csi, by name
+}
+
+// NewMemInfo reads the memory usage of the system from /proc/meminfo.
+//
+// Returns an error if opening /proc/meminfo or parsing an individual value fails.
+func NewMemInfo() (*MemInfo, error) {
+	return FS(Dir).NewMemInfo()
+}
+
+// NewMemInfo is like the package-level NewMemInfo but reads from the proc fs self.
+func (self FS) NewMemInfo() (*MemInfo, error) {
+	fn := self.Path("meminfo")
+
+	f, err := os.Open(fn)
+
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to read %s [%s]", fn, err))
+	}
+
+	defer f.Close()
+
+	return NewMemInfoFromReader(f)
+}
+
+// NewMemInfoFromReader parses the memory usage of the system, in the format of /proc/meminfo, from reader.
+//
+// Returns an error if parsing an individual value fails.
+func NewMemInfoFromReader(reader io.Reader) (*MemInfo, error) {
+	mi := MemInfo{}
+	fields := mi.fields()
+
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		kv := strings.SplitN(scanner.Text(), ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+
+		v, err := parseMemInfoValue(kv[1])
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Failed to parse %s [%s]", kv[0], err))
+		}
+
+		if field, present := fields[kv[0]]; present {
+			*field = v
+		} else {
+			if mi.Other == nil {
+				mi.Other = map[string]uint64{}
+			}
+			mi.Other[kv[0]] = v
+		}
+	}
+
+	return &mi, scanner.Err()
+}
+
+// parseMemInfoValue parses a value of /proc/meminfo, either a size in kB,
+// returned in bytes, or a plain count.
+func parseMemInfoValue(s string) (uint64, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 || len(fields) > 2 || (len(fields) == 2 && fields[1] != "kB") {
+		return 0, errors.New(fmt.Sprintf("Unexpected value '%s'", strings.TrimSpace(s)))
+	}
+
+	v, err := strconv.ParseUint(fields[0], 10, 64)
+	if len(fields) == 2 {
+		v *= 1024
+	}
+
+	return v, err
+}
+
+// fields returns pointers to all values in self, keyed by their name in /proc/meminfo.
+func (self *MemInfo) fields() map[string]*uint64 {
+	return map[string]*uint64{
+		"MemTotal":          &self.MemTotal,
+		"MemFree":           &self.MemFree,
+		"MemAvailable":      &self.MemAvailable,
+		"Buffers":           &self.Buffers,
+		"Cached":            &self.Cached,
+		"SwapCached":        &self.SwapCached,
+		"Active":            &self.Active,
+		"Inactive":          &self.Inactive,
+		"Active(anon)":      &self.ActiveAnon,
+		"Inactive(anon)":    &self.InactiveAnon,
+		"Active(file)":      &self.ActiveFile,
+		"Inactive(file)":    &self.InactiveFile,
+		"Unevictable":       &self.Unevictable,
+		"Mlocked":           &self.Mlocked,
+		"SwapTotal":         &self.SwapTotal,
+		"SwapFree":          &self.SwapFree,
+		"Dirty":             &self.Dirty,
+		"Writeback":         &self.Writeback,
+		"AnonPages":         &self.AnonPages,
+		"Mapped":            &self.Mapped,
+		"Shmem":             &self.Shmem,
+		"KReclaimable":      &self.KReclaimable,
+		"Slab":              &self.Slab,
+		"SReclaimable":      &self.SReclaimable,
+		"SUnreclaim":        &self.SUnreclaim,
+		"KernelStack":       &self.KernelStack,
+		"PageTables":        &self.PageTables,
+		"NFS_Unstable":      &self.NFSUnstable,
+		"Bounce":            &self.Bounce,
+		"WritebackTmp":      &self.WritebackTmp,
+		"CommitLimit":       &self.CommitLimit,
+		"Committed_AS":      &self.CommittedAS,
+		"VmallocTotal":      &self.VmallocTotal,
+		"VmallocUsed":       &self.VmallocUsed,
+		"VmallocChunk":      &self.VmallocChunk,
+		"Percpu":            &self.Percpu,
+		"HardwareCorrupted": &self.HardwareCorrupted,
+		"AnonHugePages":     &self.AnonHugePages,
+		"ShmemHugePages":    &self.ShmemHugePages,
+		"ShmemPmdMapped":    &self.ShmemPmdMapped,
+		"FileHugePages":     &self.FileHugePages,
+		"FilePmdMapped":     &self.FilePmdMapped,
+		"HugePages_Total":   &self.HugePagesTotal,
+		"HugePages_Free":    &self.HugePagesFree,
+		"HugePages_Rsvd":    &self.HugePagesRsvd,
+		"HugePages_Surp":    &self.HugePagesSurp,
+		"Hugepagesize":      &self.Hugepagesize,
+		"Hugetlb":           &self.Hugetlb,
+		"DirectMap4k":       &self.DirectMap4k,
+		"DirectMap2M":       &self.DirectMap2M,
+		"DirectMap1G":       &self.DirectMap1G,
+	}
+}
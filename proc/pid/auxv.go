@@ -9,9 +9,8 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"os"
+	"io/ioutil"
 	"path/filepath"
-	"syscall"
 	"unsafe"
 )
 
@@ -67,40 +66,32 @@ func determineEndianess() binary.ByteOrder {
 }
 
 // Describes the contents of the ELF interpreter information passed to the process at exec time.
-type Auxv map[uint32]uint32
+type Auxv map[uint64]uint64
 
 // NewAuxv reads the /proc/pid/auxv entry and returns the correspoding Auxv instance if
 // reading the file was successful or an error otherwise.
 func NewAuxv(pid int) (Auxv, error) {
-	fn := filepath.Join(Dir(pid), "auxv")
-
-	f, err := os.Open(fn)
-
-	if err != nil {
-		return nil, errors.New(fmt.Sprintf("Failed to read %s [%s]", fn, err))
-	}
-
-	defer f.Close()
-
-	stat, err := f.Stat()
+	return DefaultFS.NewAuxv(pid)
+}
 
-	if err != nil {
-		return nil, errors.New(fmt.Sprintf("Failed to stat %s [%s]", fn, err))
-	}
+// NewAuxv is like the package-level NewAuxv but reads from the proc fs self.
+func (self FS) NewAuxv(pid int) (Auxv, error) {
+	fn := filepath.Join(self.Dir(pid), "auxv")
 
-	b, err := syscall.Mmap(int(f.Fd()), 0, int(stat.Size()), syscall.PROT_READ, syscall.MAP_PRIVATE)
+	// procfs reports a size of 0 for auxv, we thus cannot mmap the file but have to read it.
+	b, err := ioutil.ReadFile(fn)
 
 	if err != nil {
-		return nil, errors.New(fmt.Sprintf("Failed to mmap %s [%s]", fn, err))
+		return nil, errors.New(fmt.Sprintf("Failed to read %s [%s]", fn, err))
 	}
 
-	defer syscall.Munmap(b)
-
 	return NewAuxvFromReader(bytes.NewReader(b)), nil
 }
 
 // NewAuxvFromReader reads the contents from reader returning
 // a corresponding Auxv instance or nil in case of issues.
+//
+// Entries are expected to be pairs of words of the native size and byte order.
 func NewAuxvFromReader(reader io.Reader) Auxv {
 	endianess := determineEndianess()
 
@@ -108,16 +99,23 @@ func NewAuxvFromReader(reader io.Reader) Auxv {
 		return nil
 	}
 
-	auxv := Auxv(make(map[uint32]uint32))
+	auxv := Auxv(make(map[uint64]uint64))
 
-	pair := []uint32{0, 0}
+	b := make([]byte, 2*unsafe.Sizeof(uintptr(0)))
+	word := func(b []byte) uint64 {
+		if len(b) == 8 {
+			return endianess.Uint64(b)
+		}
+		return uint64(endianess.Uint32(b))
+	}
 
-	for err := binary.Read(reader, endianess, &pair); err == nil; err = binary.Read(reader, endianess, &pair) {
-		if pair[0] == AT_NULL {
+	for _, err := io.ReadFull(reader, b); err == nil; _, err = io.ReadFull(reader, b) {
+		k, v := word(b[:len(b)/2]), word(b[len(b)/2:])
+		if k == AT_NULL {
 			break
 		}
 
-		auxv[pair[0]] = pair[1]
+		auxv[k] = v
 	}
 
 	return auxv
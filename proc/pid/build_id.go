@@ -0,0 +1,67 @@
+package pid
+
+import (
+	"debug/elf"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// BuildIdFile is the name of the file recording the build id of the executable
+// in snapshots of a proc fs, which do not contain the executable itself.
+const BuildIdFile = "build-id"
+
+// BuildId is the hex-encoded GNU build id of an ELF file.
+type BuildId string
+
+// NewBuildIdFromELF returns the build id of f, or an empty BuildId if f does not carry one.
+func NewBuildIdFromELF(f *elf.File) BuildId {
+	s := f.Section(".note.gnu.build-id")
+	if s == nil {
+		return ""
+	}
+
+	b, err := s.Data()
+	if err != nil || len(b) < 16 {
+		return ""
+	}
+
+	namesz := int(f.ByteOrder.Uint32(b[0:]))
+	descsz := int(f.ByteOrder.Uint32(b[4:]))
+	desc := 12 + (namesz+3)&^3
+	if desc+descsz > len(b) {
+		return ""
+	}
+
+	return BuildId(hex.EncodeToString(b[desc : desc+descsz]))
+}
+
+// NewBuildId determines the build id of the executable of the process identified by pid.
+//
+// Returns an error if the executable cannot be read or is not an ELF file.
+func NewBuildId(pid int) (BuildId, error) {
+	return DefaultFS.NewBuildId(pid)
+}
+
+// NewBuildId is like the package-level NewBuildId but reads from the proc fs self,
+// preferring the build id recorded in BuildIdFile.
+func (self FS) NewBuildId(pid int) (BuildId, error) {
+	if b, err := ioutil.ReadFile(filepath.Join(self.Dir(pid), BuildIdFile)); err == nil {
+		return BuildId(strings.TrimSpace(string(b))), nil
+	}
+
+	fn := filepath.Join(self.Dir(pid), "exe")
+
+	f, err := elf.Open(fn)
+
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("Failed to read %s [%s]", fn, err))
+	}
+
+	defer f.Close()
+
+	return NewBuildIdFromELF(f), nil
+}
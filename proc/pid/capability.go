@@ -0,0 +1,182 @@
+package pid
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Capability enumerates the distinct privileges of a thread.
+type Capability uint
+
+// Taken from ${KERNELSRC}/include/uapi/linux/capability.h
+const (
+	CAP_CHOWN              Capability = 0
+	CAP_DAC_OVERRIDE       Capability = 1
+	CAP_DAC_READ_SEARCH    Capability = 2
+	CAP_FOWNER             Capability = 3
+	CAP_FSETID             Capability = 4
+	CAP_KILL               Capability = 5
+	CAP_SETGID             Capability = 6
+	CAP_SETUID             Capability = 7
+	CAP_SETPCAP            Capability = 8
+	CAP_LINUX_IMMUTABLE    Capability = 9
+	CAP_NET_BIND_SERVICE   Capability = 10
+	CAP_NET_BROADCAST      Capability = 11
+	CAP_NET_ADMIN          Capability = 12
+	CAP_NET_RAW            Capability = 13
+	CAP_IPC_LOCK           Capability = 14
+	CAP_IPC_OWNER          Capability = 15
+	CAP_SYS_MODULE         Capability = 16
+	CAP_SYS_RAWIO          Capability = 17
+	CAP_SYS_CHROOT         Capability = 18
+	CAP_SYS_PTRACE         Capability = 19
+	CAP_SYS_PACCT          Capability = 20
+	CAP_SYS_ADMIN          Capability = 21
+	CAP_SYS_BOOT           Capability = 22
+	CAP_SYS_NICE           Capability = 23
+	CAP_SYS_RESOURCE       Capability = 24
+	CAP_SYS_TIME           Capability = 25
+	CAP_SYS_TTY_CONFIG     Capability = 26
+	CAP_MKNOD              Capability = 27
+	CAP_LEASE              Capability = 28
+	CAP_AUDIT_WRITE        Capability = 29
+	CAP_AUDIT_CONTROL      Capability = 30
+	CAP_SETFCAP            Capability = 31
+	CAP_MAC_OVERRIDE       Capability = 32
+	CAP_MAC_ADMIN          Capability = 33
+	CAP_SYSLOG             Capability = 34
+	CAP_WAKE_ALARM         Capability = 35
+	CAP_BLOCK_SUSPEND      Capability = 36
+	CAP_AUDIT_READ         Capability = 37
+	CAP_PERFMON            Capability = 38
+	CAP_BPF                Capability = 39
+	CAP_CHECKPOINT_RESTORE Capability = 40
+)
+
+var capabilityNames = []string{
+	"chown", "dac_override", "dac_read_search", "fowner", "fsetid", "kill", "setgid", "setuid",
+	"setpcap", "linux_immutable", "net_bind_service", "net_broadcast", "net_admin", "net_raw",
+	"ipc_lock", "ipc_owner", "sys_module", "sys_rawio", "sys_chroot", "sys_ptrace", "sys_pacct",
+	"sys_admin", "sys_boot", "sys_nice", "sys_resource", "sys_time", "sys_tty_config", "mknod",
+	"lease", "audit_write", "audit_control", "setfcap", "mac_override", "mac_admin", "syslog",
+	"wake_alarm", "block_suspend", "audit_read", "perfmon", "bpf", "checkpoint_restore",
+}
+
+// String pretty prints a Capability instance, using the names of capabilities(7).
+func (self Capability) String() string {
+	if int(self) < len(capabilityNames) {
+		return "cap_" + capabilityNames[self]
+	}
+
+	return fmt.Sprintf("cap_%d", uint(self))
+}
+
+// ParseCapabilityName returns the capability named name, the inverse of Capability.String.
+//
+// Returns an error if name does not refer to a capability.
+func ParseCapabilityName(name string) (Capability, error) {
+	for c := Capability(0); c < 64; c++ {
+		if c.String() == name {
+			return c, nil
+		}
+	}
+
+	return 0, errors.New(fmt.Sprintf("Unknown capability %s", name))
+}
+
+// CapabilitySet is a bitmask of capabilities, where bit n corresponds to Capability n.
+// CapabilitySets are marshaled as lists of capability names.
+type CapabilitySet uint64
+
+// NewCapabilitySetFromHex parses a capability set rendered in hexadecimal, as found in /proc/%{pid}/status.
+//
+// Returns an error if s is not a valid hexadecimal number.
+func NewCapabilitySetFromHex(s string) (CapabilitySet, error) {
+	v, err := strconv.ParseUint(strings.TrimSpace(s), 16, 64)
+	return CapabilitySet(v), err
+}
+
+// Has returns true if c is contained in the set.
+func (self CapabilitySet) Has(c Capability) bool {
+	return c < 64 && self&(1<<c) != 0
+}
+
+// Capabilities returns all capabilities contained in the set, in ascending order.
+func (self CapabilitySet) Capabilities() []Capability {
+	caps := []Capability{}
+	for c := Capability(0); c < 64; c++ {
+		if self.Has(c) {
+			caps = append(caps, c)
+		}
+	}
+
+	return caps
+}
+
+// String pretty prints the set as hexadecimal mask, as found in /proc/%{pid}/status.
+func (self CapabilitySet) String() string {
+	return fmt.Sprintf("%016x", uint64(self))
+}
+
+// Names returns the names of all capabilities contained in the set, in ascending order.
+func (self CapabilitySet) Names() []string {
+	names := []string{}
+	for _, c := range self.Capabilities() {
+		names = append(names, c.String())
+	}
+
+	return names
+}
+
+// NewCapabilitySetFromNames returns the set containing the capabilities listed in names.
+//
+// Returns an error if a name does not refer to a capability.
+func NewCapabilitySetFromNames(names []string) (CapabilitySet, error) {
+	set := CapabilitySet(0)
+	for _, name := range names {
+		c, err := ParseCapabilityName(name)
+		if err != nil {
+			return 0, err
+		}
+		set |= 1 << c
+	}
+
+	return set, nil
+}
+
+// MarshalYAML encodes the set as list of capability names.
+func (self CapabilitySet) MarshalYAML() (interface{}, error) {
+	return self.Names(), nil
+}
+
+// UnmarshalYAML decodes the set from a list of capability names.
+func (self *CapabilitySet) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	names := []string{}
+	if err := unmarshal(&names); err != nil {
+		return err
+	}
+
+	set, err := NewCapabilitySetFromNames(names)
+	*self = set
+	return err
+}
+
+// MarshalJSON encodes the set as list of capability names.
+func (self CapabilitySet) MarshalJSON() ([]byte, error) {
+	return json.Marshal(self.Names())
+}
+
+// UnmarshalJSON decodes the set from a list of capability names.
+func (self *CapabilitySet) UnmarshalJSON(b []byte) error {
+	names := []string{}
+	if err := json.Unmarshal(b, &names); err != nil {
+		return err
+	}
+
+	set, err := NewCapabilitySetFromNames(names)
+	*self = set
+	return err
+}
@@ -6,10 +6,10 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"os"
+	"io/ioutil"
 	"path/filepath"
+	"strconv"
 	"strings"
-	"syscall"
 )
 
 type Hierarchy struct {
@@ -18,15 +18,27 @@ type Hierarchy struct {
 	ControlGroup string   // Control group in the hierarchy to which the process belongs
 }
 
+// NewHierarchyFromLine parses a single line of /proc/%{pid}/cgroup, "<id>:<subsystems>:<control group>".
+// The subsystems are empty for the unified cgroup v2 hierarchy.
 func NewHierarchyFromLine(line string) (Hierarchy, error) {
 	h := Hierarchy{}
-	s := ""
 
-	if _, err := fmt.Sscanf(line, "%d:%s:%s", &h.ID, &s, &h.ControlGroup); err != nil {
+	// Control groups might contain colons, the line thus has exactly three fields.
+	fields := strings.SplitN(strings.TrimRight(line, "\n"), ":", 3)
+	if len(fields) != 3 {
+		return h, errors.New(fmt.Sprintf("Failed to parse line '%s'", line))
+	}
+
+	id, err := strconv.Atoi(fields[0])
+	if err != nil {
 		return h, errors.New(fmt.Sprintf("Failed to parse line '%s' [%s]", line, err))
 	}
 
-	h.Subsystems = strings.Split(s, ",")
+	h.ID, h.ControlGroup = id, fields[2]
+	if len(fields[1]) > 0 {
+		h.Subsystems = strings.Split(fields[1], ",")
+	}
+
 	return h, nil
 }
 
@@ -35,31 +47,24 @@ type Cgroup struct {
 	Hierarchies []Hierarchy
 }
 
+// NewCGroup reads the control groups of the process identified by pid from /proc/%{pid}/cgroup.
+//
+// Returns an error if reading /proc/%{pid}/cgroup fails.
 func NewCGroup(pid int) (*Cgroup, error) {
-	fn := filepath.Join(Dir(pid), "cgroup")
-
-	f, err := os.Open(fn)
-
-	if err != nil {
-		return nil, errors.New(fmt.Sprintf("Failed to read %s [%s]", fn, err))
-	}
-
-	defer f.Close()
-
-	stat, err := f.Stat()
+	return DefaultFS.NewCGroup(pid)
+}
 
-	if err != nil {
-		return nil, errors.New(fmt.Sprintf("Failed to stat %s [%s]", fn, err))
-	}
+// NewCGroup is like the package-level NewCGroup but reads from the proc fs self.
+func (self FS) NewCGroup(pid int) (*Cgroup, error) {
+	fn := filepath.Join(self.Dir(pid), "cgroup")
 
-	b, err := syscall.Mmap(int(f.Fd()), 0, int(stat.Size()), syscall.PROT_READ, syscall.MAP_PRIVATE)
+	// procfs reports a size of 0 for cgroup, we thus cannot mmap the file but have to read it.
+	b, err := ioutil.ReadFile(fn)
 
 	if err != nil {
-		return nil, errors.New(fmt.Sprintf("Failed to mmap %s [%s]", fn, err))
+		return nil, errors.New(fmt.Sprintf("Failed to read %s [%s]", fn, err))
 	}
 
-	defer syscall.Munmap(b)
-
 	return NewCgroupFromReader(bytes.NewReader(b)), nil
 }
 
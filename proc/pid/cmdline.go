@@ -16,7 +16,12 @@ type Cmdline []string
 // NewCmdline reads the complete command line of the process identified by pid and returns
 // the original command line or an error in case of issues.
 func NewCmdline(pid int) (Cmdline, error) {
-	fn := filepath.Join(Dir(pid), "cmdline")
+	return DefaultFS.NewCmdline(pid)
+}
+
+// NewCmdline is like the package-level NewCmdline but reads from the proc fs self.
+func (self FS) NewCmdline(pid int) (Cmdline, error) {
+	fn := filepath.Join(self.Dir(pid), "cmdline")
 
 	f, err := os.Open(fn)
 
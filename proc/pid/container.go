@@ -0,0 +1,55 @@
+package pid
+
+import (
+	"regexp"
+)
+
+// ContainerRuntime enumerates the container runtimes recognized from control groups.
+type ContainerRuntime string
+
+const (
+	Docker        ContainerRuntime = "docker"
+	Containerd    ContainerRuntime = "containerd"
+	Podman        ContainerRuntime = "podman"
+	Lxc           ContainerRuntime = "lxc"
+	SystemdNspawn ContainerRuntime = "systemd-nspawn"
+)
+
+// Container describes the container a process executes in.
+type Container struct {
+	Runtime ContainerRuntime // The runtime managing the container
+	Id      string           // Id or name of the container, as given in the control group path
+}
+
+// containerPatterns recognize the control groups created by container runtimes,
+// with the id of the container as first submatch. Patterns are checked in order.
+var containerPatterns = []struct {
+	Runtime ContainerRuntime
+	Pattern *regexp.Regexp
+}{
+	{Podman, regexp.MustCompile(`libpod-(?:conmon-)?([[:xdigit:]]{12,})(?:\.scope)?`)},
+	{Containerd, regexp.MustCompile(`cri-containerd[-:]([[:xdigit:]]{12,})`)},
+	{Containerd, regexp.MustCompile(`/kubepods[^:]*/(?:pod[^/]+/)?([[:xdigit:]]{64})`)},
+	{Docker, regexp.MustCompile(`docker-([[:xdigit:]]{12,})\.scope`)},
+	{Docker, regexp.MustCompile(`/docker/([[:xdigit:]]{12,})`)},
+	{SystemdNspawn, regexp.MustCompile(`systemd-nspawn@([^/]+)\.service`)},
+	{SystemdNspawn, regexp.MustCompile(`/machine\.slice/machine-([^/]+)\.scope`)},
+	{Lxc, regexp.MustCompile(`/lxc\.payload[./]([^/]+)`)},
+	{Lxc, regexp.MustCompile(`/lxc/([^/]+)`)},
+}
+
+// NewContainerFromCgroup detects the container a process executes in from
+// the paths of its control groups.
+//
+// Returns nil if the control groups do not indicate a known container runtime.
+func NewContainerFromCgroup(cg *Cgroup) *Container {
+	for _, cp := range containerPatterns {
+		for _, h := range cg.Hierarchies {
+			if m := cp.Pattern.FindStringSubmatch(h.ControlGroup); len(m) > 1 {
+				return &Container{cp.Runtime, m[1]}
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,55 @@
+package pid
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewHierarchyFromLineHandlesV1AndV2(t *testing.T) {
+	h, err := NewHierarchyFromLine("4:cpu,cpuacct:/user.slice\n")
+	assert.Nil(t, err)
+	assert.Equal(t, Hierarchy{4, []string{"cpu", "cpuacct"}, "/user.slice"}, h)
+
+	h, err = NewHierarchyFromLine("0::/system.slice/foo:bar.service\n")
+	assert.Nil(t, err)
+	assert.Equal(t, Hierarchy{0, nil, "/system.slice/foo:bar.service"}, h)
+
+	_, err = NewHierarchyFromLine("garbage")
+	assert.NotNil(t, err)
+}
+
+func TestNewContainerFromCgroupDetectsRuntimes(t *testing.T) {
+	id := "3f4e7c9a1b2d3e4f5a6b7c8d9e0f1a2b3c4d5e6f7a8b9c0d1e2f3a4b5c6d7e8f"
+
+	cases := map[string]*Container{
+		"12:pids:/docker/" + id:                    &Container{Docker, id},
+		"0::/system.slice/docker-" + id + ".scope": &Container{Docker, id},
+		"0::/system.slice/containerd.service/kubepods-burstable-pod1.slice:cri-containerd:" + id: &Container{Containerd, id},
+		"0::/kubepods.slice/kubepods-besteffort.slice/cri-containerd-" + id + ".scope":           &Container{Containerd, id},
+		"11:memory:/kubepods/besteffort/pod0f1e2d3c/" + id:                                       &Container{Containerd, id},
+		"0::/machine.slice/libpod-" + id + ".scope/container":                                    &Container{Podman, id},
+		"0::/lxc.payload.web01/init.scope":                                                       &Container{Lxc, "web01"},
+		"5:cpuset:/lxc/web01":                                                                    &Container{Lxc, "web01"},
+		"0::/machine.slice/systemd-nspawn@debian.service/payload":                                &Container{SystemdNspawn, "debian"},
+		"0::/machine.slice/machine-debian.scope":                                                 &Container{SystemdNspawn, "debian"},
+		"0::/user.slice/user-1000.slice/session-2.scope":                                         nil,
+	}
+
+	for line, expected := range cases {
+		cg := NewCgroupFromReader(strings.NewReader(line + "\n"))
+		assert.Equal(t, expected, NewContainerFromCgroup(cg), line)
+	}
+}
+
+func TestNamespacesReportDifferingTypes(t *testing.T) {
+	own, err := NewNamespaces(os.Getpid())
+	assert.Nil(t, err)
+	assert.Contains(t, own, NamespaceMount)
+	assert.Empty(t, own.Differing(own))
+
+	other := Namespaces{NamespaceMount: own[NamespaceMount] + 1, NamespaceNet: own[NamespaceNet], "unknown": 42}
+	assert.Equal(t, []string{NamespaceMount}, other.Differing(own))
+}
@@ -13,7 +13,12 @@ type Cwd string
 // NewCwd determines the current working directory of the process identified by pid,
 // returning an error if following the link to the cwd fails.
 func NewCwd(pid int) (Cwd, error) {
-	fn := filepath.Join(Dir(pid), "cwd")
+	return DefaultFS.NewCwd(pid)
+}
+
+// NewCwd is like the package-level NewCwd but reads from the proc fs self.
+func (self FS) NewCwd(pid int) (Cwd, error) {
+	fn := filepath.Join(self.Dir(pid), "cwd")
 
 	lr, err := os.Readlink(fn)
 	if err != nil {
@@ -15,7 +15,12 @@ type Environ map[string]string
 
 // NewEnviron loads the environment for the process with the given pid.
 func NewEnviron(pid int) (Environ, error) {
-	fn := filepath.Join(Dir(pid), "environ")
+	return DefaultFS.NewEnviron(pid)
+}
+
+// NewEnviron is like the package-level NewEnviron but reads from the proc fs self.
+func (self FS) NewEnviron(pid int) (Environ, error) {
+	fn := filepath.Join(self.Dir(pid), "environ")
 
 	f, err := os.Open(fn)
 
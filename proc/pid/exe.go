@@ -13,7 +13,12 @@ type Exe string
 // NewExe determines the path of the executed command from /proc/pid/exe.
 // Returns an error if following the symbolic link fails.
 func NewExe(pid int) (Exe, error) {
-	fn := filepath.Join(Dir(pid), "exe")
+	return DefaultFS.NewExe(pid)
+}
+
+// NewExe is like the package-level NewExe but reads from the proc fs self.
+func (self FS) NewExe(pid int) (Exe, error) {
+	fn := filepath.Join(self.Dir(pid), "exe")
 
 	lr, err := os.Readlink(fn)
 	if err != nil {
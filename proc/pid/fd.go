@@ -1,36 +1,191 @@
 package pid
 
 import (
+	"bufio"
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"syscall"
 )
 
-// File describes an fd referring to an actual file
-type File string
+// FdKind describes what an fd refers to.
+type FdKind string
 
-// SocketOrPipe describes an fd refering to a socket or pipe
-type SocketOrPipe struct {
-	Type  string // The type, either socket or pipe
-	Inode uint   // The INode
+const (
+	FdFile        FdKind = "file"       // A file in the filesystem
+	FdDeletedFile FdKind = "deleted"    // A file that has been removed from the filesystem
+	FdDevice      FdKind = "device"     // A character or block device
+	FdSocket      FdKind = "socket"     // A socket
+	FdPipe        FdKind = "pipe"       // A pipe or FIFO without a name
+	FdAnon        FdKind = "anon_inode" // An fd without an inode, e.g., an eventfd or epoll instance
+	FdMemfd       FdKind = "memfd"      // An anonymous file created by memfd_create
+	FdUnknown     FdKind = "unknown"    // An fd that could not be resolved
+)
+
+// FdStatFile is the name of the file recording the metadata of the files referred
+// to by fds in snapshots of a proc fs, where fd links no longer lead to the files.
+const FdStatFile = "fd-stat"
+
+// deletedSuffix is appended by the kernel to the paths of files removed from the filesystem.
+const deletedSuffix = " (deleted)"
+
+// memfdPrefix is prepended by the kernel to the names of files created by memfd_create.
+const memfdPrefix = "/memfd:"
+
+// inodeLinkRegExp matches link destinations of fds without a path, e.g., socket:[1234] or anon_inode:[eventfd].
+var inodeLinkRegExp = regexp.MustCompile(`^([^/:]+):\[?([^\]]*)\]?$`)
+
+// FdEntry describes an individual fd being in use by a process. Fields that do
+// not apply to the kind of the fd or could not be determined are left empty.
+type FdEntry struct {
+	Fd     int    // Number of the fd
+	Kind   FdKind // What the fd refers to
+	Target string `yaml:",omitempty" json:",omitempty"` // Path of files and devices, type of anonymous fds, name of memfds
+	Mode   string `yaml:",omitempty" json:",omitempty"` // Access mode, one of r, w or rw
+	Size   int64  `yaml:",omitempty" json:",omitempty"` // Size of files in bytes
+	Inode  uint64 `yaml:",omitempty" json:",omitempty"` // Inode of the file, socket or pipe
+	Device uint64 `yaml:",omitempty" json:",omitempty"` // Device containing the file, or the device itself for devices
+
+	Socket *Socket   `yaml:",omitempty" json:",omitempty"` // Endpoint of a socket
+	Peers  []PipeEnd `yaml:",omitempty" json:",omitempty"` // Fds of other processes referring to the opposite end of a pipe
+	Error  string    `yaml:",omitempty" json:",omitempty"` // Reason the fd could not be resolved
 }
 
-// Anon describes an anonymous fd without an inode
-type Anon string
+// FdStat describes the file an fd refers to, as reported by stat(2).
+type FdStat struct {
+	Mode uint32 // File type and permissions, see st_mode
+	Ino  uint64 // Inode of the file
+	Dev  uint64 // Device containing the file
+	Rdev uint64 // Device represented by the file, for device files
+	Size int64  // Size of the file in bytes
+}
+
+// FdStats maps fd numbers to the metadata of the files they refer to.
+type FdStats map[int]FdStat
 
-// Fd is a slice of elements each representing an fd being in use by a process.
+// NewFdStats stats the files referred to by all open fds of the process identified by pid.
 //
-// Depending on the type of an individual fd, the element is either a File, a SocketOrPipe or
-// an Anon instance.
-type Fd []interface{}
+// Returns an error if opening /proc/%{pid}/fd or a subsequent os.File.Readdir failed.
+func NewFdStats(pid int) (FdStats, error) {
+	return DefaultFS.NewFdStats(pid)
+}
+
+// NewFdStats is like the package-level NewFdStats but reads from the proc fs self,
+// preferring the metadata recorded in FdStatFile. Fds that cannot be stat'ed are
+// left out. The fd links are stat'ed directly instead of their destinations, which
+// might be relative to or not visible in the namespaces of the inspector.
+func (self FS) NewFdStats(pid int) (FdStats, error) {
+	if f, err := os.Open(filepath.Join(self.Dir(pid), FdStatFile)); err == nil {
+		defer f.Close()
+		return NewFdStatsFromReader(f)
+	}
+
+	fn := filepath.Join(self.Dir(pid), "fd")
+
+	f, err := os.Open(fn)
+
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to open %s [%s]", fn, err))
+	}
+
+	defer f.Close()
 
-// NewFd returns all open fds for the process identified by pid.
+	names, err := f.Readdirnames(0)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to read %s [%s]", fn, err))
+	}
+
+	stats := FdStats{}
+	for _, name := range names {
+		n, err := strconv.Atoi(name)
+		if err != nil {
+			continue
+		}
+
+		fi, err := os.Stat(filepath.Join(fn, name))
+		if err != nil {
+			continue
+		}
+
+		if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+			stats[n] = FdStat{uint32(st.Mode), st.Ino, uint64(st.Dev), uint64(st.Rdev), st.Size}
+		}
+	}
+
+	return stats, nil
+}
+
+// NewFdStatsFromReader parses fd metadata, in the format of FdStatFile, from reader.
+//
+// Returns an error if parsing a line fails.
+func NewFdStatsFromReader(reader io.Reader) (FdStats, error) {
+	stats := FdStats{}
+
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+
+		var n int
+		st := FdStat{}
+		if _, err := fmt.Sscanf(scanner.Text(), "%d %o %d %d %d %d", &n, &st.Mode, &st.Ino, &st.Dev, &st.Rdev, &st.Size); err != nil {
+			return nil, errors.New(fmt.Sprintf("Failed to parse '%s' [%s]", scanner.Text(), err))
+		}
+
+		stats[n] = st
+	}
+
+	return stats, scanner.Err()
+}
+
+// String renders self in the format of FdStatFile, one fd per line, ordered by fd number.
+func (self FdStats) String() string {
+	fds := []int{}
+	for n := range self {
+		fds = append(fds, n)
+	}
+
+	sort.Ints(fds)
+
+	s := ""
+	for _, n := range fds {
+		st := self[n]
+		s += fmt.Sprintf("%d %o %d %d %d %d\n", n, st.Mode, st.Ino, st.Dev, st.Rdev, st.Size)
+	}
+
+	return s
+}
+
+// Fd lists all fds being in use by a process, ordered by fd number.
+type Fd []FdEntry
+
+// NewFd returns all open fds for the process identified by pid. Sockets are
+// resolved to their endpoints and pipes are paired with the fds of other
+// processes referring to the opposite end.
 //
 // Returns an error if opening /proc/%{pid}/fd or a subsequent os.File.Readdir failed
 func NewFd(pid int) (Fd, error) {
-	fn := filepath.Join(Dir(pid), "fd")
+	return DefaultFS.NewFd(pid)
+}
+
+// NewFd is like the package-level NewFd but reads from the proc fs self.
+func (self FS) NewFd(pid int) (Fd, error) {
+	return self.NewFdContext(context.Background(), pid)
+}
+
+// NewFdContext is like NewFd but stops pairing pipes, which requires scanning
+// the fds of all processes, once ctx is done. The fds are returned together
+// with ctx.Err() in that case, with pipes lacking their peers.
+func (self FS) NewFdContext(ctx context.Context, pid int) (Fd, error) {
+	fn := filepath.Join(self.Dir(pid), "fd")
 
 	f, err := os.Open(fn)
 
@@ -40,36 +195,148 @@ func NewFd(pid int) (Fd, error) {
 
 	defer f.Close()
 
-	if entries, err := f.Readdir(0); err != nil {
+	names, err := f.Readdirnames(0)
+	if err != nil {
 		return nil, errors.New(fmt.Sprintf("Failed to read %s [%s]", fn, err))
-	} else {
-		fd := Fd{}
-
-		for _, fi := range entries {
-			fni := filepath.Join(fn, fi.Name())
-			dest, _ := os.Readlink(fni)
-			// We could not stat the destination and assume that the fd is not
-			// an actual file but either a socket/pipe or an fd without an inode.
-			if _, err := os.Stat(dest); err != nil {
-				kv := strings.Split(dest, ":")
-
-				if len(kv) != 2 {
-					continue
-				}
-
-				// We got an fd without an inode, parsing the file type now.
-				if kv[0] == "anon_inode" {
-					fd = append(fd, Anon(strings.Trim(kv[1], "[]")))
-				} else {
-					inode := uint(0)
-					fmt.Sscanf(kv[1], "[%d]", &inode)
-					fd = append(fd, SocketOrPipe{kv[0], inode})
-				}
-			} else {
-				fd = append(fd, File(dest))
+	}
+
+	stats, _ := self.NewFdStats(pid)
+
+	fd := Fd{}
+	for _, name := range names {
+		n, err := strconv.Atoi(name)
+		if err != nil {
+			continue
+		}
+
+		var st *FdStat
+		if s, present := stats[n]; present {
+			st = &s
+		}
+
+		entry := newFdEntry(filepath.Join(fn, name), st)
+		entry.Fd = n
+
+		if info, err := self.NewFdInfo(pid, n); err == nil {
+			entry.Mode = info.Mode()
+			if entry.Inode == 0 {
+				entry.Inode = info.Ino
 			}
 		}
 
-		return fd, nil
+		fd = append(fd, entry)
+	}
+
+	sort.Sort(fd)
+
+	self.resolveSockets(pid, fd)
+
+	return fd, self.resolvePipes(ctx, pid, fd)
+}
+
+// newFdEntry resolves the fd link fn, taking metadata of files from st, if not nil.
+func newFdEntry(fn string, st *FdStat) FdEntry {
+	entry := FdEntry{}
+
+	dest, err := os.Readlink(fn)
+	if err != nil {
+		entry.Kind, entry.Error = FdUnknown, err.Error()
+		return entry
+	}
+
+	switch m := inodeLinkRegExp.FindStringSubmatch(dest); {
+	case m != nil:
+		entry.Kind = FdKind(m[1])
+		if inode, err := strconv.ParseUint(m[2], 10, 64); err == nil {
+			entry.Inode = inode
+		} else {
+			entry.Target = m[2]
+		}
+		return entry
+	case strings.HasPrefix(dest, memfdPrefix):
+		entry.Kind, entry.Target = FdMemfd, strings.TrimSuffix(strings.TrimPrefix(dest, memfdPrefix), deletedSuffix)
+	case strings.HasSuffix(dest, deletedSuffix):
+		entry.Kind, entry.Target = FdDeletedFile, strings.TrimSuffix(dest, deletedSuffix)
+	default:
+		entry.Kind, entry.Target = FdFile, dest
+	}
+
+	if st != nil {
+		entry.Inode, entry.Device = st.Ino, st.Dev
+
+		switch st.Mode & syscall.S_IFMT {
+		case syscall.S_IFCHR, syscall.S_IFBLK:
+			entry.Kind, entry.Device = FdDevice, st.Rdev
+		case syscall.S_IFREG:
+			entry.Size = st.Size
+		}
 	}
+
+	return entry
+}
+
+func (self Fd) Len() int           { return len(self) }
+func (self Fd) Less(i, j int) bool { return self[i].Fd < self[j].Fd }
+func (self Fd) Swap(i, j int)      { self[i], self[j] = self[j], self[i] }
+
+// resolveSockets resolves the endpoints of all sockets in fd, as seen in the network namespace of pid.
+func (self FS) resolveSockets(pid int, fd Fd) {
+	var sockets Sockets
+
+	for i := range fd {
+		if fd[i].Kind != FdSocket {
+			continue
+		}
+
+		if sockets == nil {
+			if sockets, _ = self.NewSockets(pid); sockets == nil {
+				return
+			}
+		}
+
+		if s, present := sockets[uint(fd[i].Inode)]; present {
+			fd[i].Socket = &s
+		}
+	}
+}
+
+// resolvePipes pairs the pipes in fd with the opposite ends held by other processes,
+// until ctx is done.
+//
+// Returns ctx.Err() if ctx is done before all pipes are paired.
+func (self FS) resolvePipes(ctx context.Context, pid int, fd Fd) error {
+	inodes := []uint{}
+	for _, entry := range fd {
+		if entry.Kind == FdPipe {
+			inodes = append(inodes, uint(entry.Inode))
+		}
+	}
+
+	if len(inodes) == 0 {
+		return nil
+	}
+
+	ends, err := self.NewPipeEndsContext(ctx, inodes)
+	if err != nil {
+		// Pairing is best-effort, we only report giving up early.
+		return ctx.Err()
+	}
+
+	for i := range fd {
+		if fd[i].Kind != FdPipe {
+			continue
+		}
+
+		var writable *bool
+		if len(fd[i].Mode) > 0 {
+			w := strings.Contains(fd[i].Mode, "w")
+			writable = &w
+		}
+
+		if peers := ends.Peers(uint(fd[i].Inode), pid, writable); len(peers) > 0 {
+			fd[i].Peers = peers
+		}
+	}
+
+	return nil
 }
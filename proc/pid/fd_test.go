@@ -0,0 +1,150 @@
+package pid
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+)
+
+func TestNewFdEntryClassifiesLinkDestinations(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fd")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	entries := map[string]FdEntry{
+		"socket:[123]":                  {Kind: FdSocket, Inode: 123},
+		"pipe:[456]":                    {Kind: FdPipe, Inode: 456},
+		"anon_inode:[eventfd]":          {Kind: FdAnon, Target: "eventfd"},
+		"anon_inode:inotify":            {Kind: FdAnon, Target: "inotify"},
+		"anon_inode:[io_uring:sq]":      {Kind: FdAnon, Target: "io_uring:sq"},
+		"net:[4026531840]":              {Kind: FdKind("net"), Inode: 4026531840},
+		"/memfd:jit-cache:1 (deleted)":  {Kind: FdMemfd, Target: "jit-cache:1"},
+		"/var/tmp/gone:1.log (deleted)": {Kind: FdDeletedFile, Target: "/var/tmp/gone:1.log"},
+		"/nonexistent/file:with:colons": {Kind: FdFile, Target: "/nonexistent/file:with:colons"},
+	}
+
+	i := 0
+	for dest, expected := range entries {
+		fn := filepath.Join(dir, fmt.Sprint(i))
+		i++
+
+		assert.Nil(t, os.Symlink(dest, fn))
+		assert.Equal(t, expected, newFdEntry(fn, nil), dest)
+	}
+
+	assert.Nil(t, os.Symlink("/dev/null", filepath.Join(dir, "device")))
+	assert.Equal(t, FdEntry{Kind: FdDevice, Target: "/dev/null", Inode: 5, Device: 259},
+		newFdEntry(filepath.Join(dir, "device"), &FdStat{syscall.S_IFCHR | 0666, 5, 6, 259, 0}))
+
+	entry := newFdEntry(filepath.Join(dir, "missing"), nil)
+	assert.Equal(t, FdUnknown, entry.Kind)
+	assert.NotEmpty(t, entry.Error)
+}
+
+func TestNewFdResolvesFilesOfRunningProcess(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fd")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	fn := filepath.Join(dir, "data")
+	assert.Nil(t, ioutil.WriteFile(fn, []byte("42"), 0644))
+
+	f, err := os.Open(fn)
+	assert.Nil(t, err)
+	defer f.Close()
+
+	deleted, err := os.Create(filepath.Join(dir, "deleted"))
+	assert.Nil(t, err)
+	defer deleted.Close()
+	assert.Nil(t, os.Remove(deleted.Name()))
+
+	fd, err := NewFd(os.Getpid())
+	assert.Nil(t, err)
+
+	entries := map[int]FdEntry{}
+	for _, entry := range fd {
+		entries[entry.Fd] = entry
+	}
+
+	fi, err := f.Stat()
+	assert.Nil(t, err)
+
+	file := entries[int(f.Fd())]
+	assert.Equal(t, FdFile, file.Kind)
+	assert.Equal(t, fn, file.Target)
+	assert.Equal(t, "r", file.Mode)
+	assert.Equal(t, int64(2), file.Size)
+	assert.Equal(t, fi.Sys().(*syscall.Stat_t).Ino, file.Inode)
+
+	gone := entries[int(deleted.Fd())]
+	assert.Equal(t, FdDeletedFile, gone.Kind)
+	assert.Equal(t, deleted.Name(), gone.Target)
+	assert.Equal(t, "rw", gone.Mode)
+	assert.NotZero(t, gone.Inode)
+}
+
+func TestNewFdStatsPrefersRecordedMetadata(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fd")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	fs := FS(dir)
+	assert.Nil(t, os.MkdirAll(filepath.Join(fs.Dir(7), "fd"), 0755))
+
+	// Relative destinations are resolved against the directory of the link, not the cwd.
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "data"), []byte("42"), 0644))
+	assert.Nil(t, os.Symlink("../../data", filepath.Join(fs.Dir(7), "fd", "3")))
+
+	stats, err := fs.NewFdStats(7)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), stats[3].Size)
+	assert.Equal(t, uint32(syscall.S_IFREG), stats[3].Mode&syscall.S_IFMT)
+
+	recorded, err := NewFdStatsFromReader(strings.NewReader(stats.String()))
+	assert.Nil(t, err)
+	assert.Equal(t, stats, recorded)
+
+	// Once recorded, fds no longer need to lead to the files they refer to.
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(fs.Dir(7), FdStatFile), []byte(stats.String()), 0644))
+	assert.Nil(t, os.Remove(filepath.Join(dir, "data")))
+
+	fd, err := fs.NewFd(7)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(fd))
+	assert.Equal(t, int64(2), fd[0].Size)
+	assert.Equal(t, stats[3].Ino, fd[0].Inode)
+
+	_, err = NewFdStatsFromReader(strings.NewReader("3 garbage\n"))
+	assert.NotNil(t, err)
+}
+
+func TestFdEntriesMarshalWithoutEmptyFields(t *testing.T) {
+	fd := Fd{
+		{Fd: 0, Kind: FdDevice, Target: "/dev/null", Mode: "rw", Inode: 5, Device: 259},
+		{Fd: 1, Kind: FdPipe, Mode: "w", Inode: 20481, Peers: []PipeEnd{{1100, 6, false}}},
+	}
+
+	b, err := yaml.Marshal(fd)
+	assert.Nil(t, err)
+	assert.Equal(t, "- fd: 0\n  kind: device\n  target: /dev/null\n  mode: rw\n  inode: 5\n  device: 259\n- fd: 1\n  kind: pipe\n  mode: w\n  inode: 20481\n  peers:\n  - pid: 1100\n    fd: 6\n    writable: false\n", string(b))
+
+	w := Fd{}
+	assert.Nil(t, yaml.Unmarshal(b, &w))
+	assert.Equal(t, fd, w)
+
+	b, err = json.Marshal(fd)
+	assert.Nil(t, err)
+	assert.Equal(t, `[{"Fd":0,"Kind":"device","Target":"/dev/null","Mode":"rw","Inode":5,"Device":259},{"Fd":1,"Kind":"pipe","Mode":"w","Inode":20481,"Peers":[{"Pid":1100,"Fd":6,"Writable":false}]}]`, string(b))
+
+	w = Fd{}
+	assert.Nil(t, json.Unmarshal(b, &w))
+	assert.Equal(t, fd, w)
+}
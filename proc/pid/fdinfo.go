@@ -0,0 +1,270 @@
+package pid
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// EpollTarget describes an fd monitored by an epoll instance.
+type EpollTarget struct {
+	Fd     int    // The monitored fd in the process owning the epoll instance
+	Events uint32 // Events the fd is monitored for, see man epoll_ctl
+	Data   uint64 // User data associated with the fd
+}
+
+// InotifyWatch describes a watch of an inotify instance.
+type InotifyWatch struct {
+	Wd   int    // Watch descriptor
+	Ino  uint64 // Inode of the watched file
+	Sdev uint64 // Device the watched file resides on
+	Mask uint32 // Events the file is watched for, see man inotify
+}
+
+// TimerFd describes the settings of a timerfd.
+type TimerFd struct {
+	ClockId      int           // Clock the timer is based on, see man timerfd_create
+	Ticks        uint64        // Number of expirations that have occurred
+	SettimeFlags int           // Flags the timer was armed with, see man timerfd_settime
+	Value        time.Duration // Time until the next expiration
+	Interval     time.Duration // Interval of the timer, 0 for single-shot timers
+}
+
+// FdInfo describes the state of an open fd, as reported in /proc/%{pid}/fdinfo/%{fd}.
+// Details specific to the type of the fd are only set for fds of that type.
+type FdInfo struct {
+	Pos   int64  // Current file offset
+	Flags int    // Access mode and file status flags the fd was opened with, see man open
+	MntId int    // Id of the mount the file resides on, see /proc/%{pid}/mountinfo
+	Ino   uint64 // Inode of the file, since Linux 5.14
+
+	EventCount *uint64        `yaml:",omitempty"` // Counter of an eventfd
+	Epoll      []EpollTarget  `yaml:",omitempty"` // Fds monitored by an epoll instance
+	Inotify    []InotifyWatch `yaml:",omitempty"` // Watches of an inotify instance
+	TimerFd    *TimerFd       `yaml:",omitempty"` // Settings of a timerfd
+}
+
+// Readable returns true if the fd was opened for reading.
+func (self FdInfo) Readable() bool {
+	return self.Flags&syscall.O_ACCMODE != syscall.O_WRONLY
+}
+
+// Writable returns true if the fd was opened for writing.
+func (self FdInfo) Writable() bool {
+	return self.Flags&syscall.O_ACCMODE != syscall.O_RDONLY
+}
+
+// Mode returns the access mode of the fd, one of r, w or rw.
+func (self FdInfo) Mode() string {
+	switch {
+	case self.Readable() && self.Writable():
+		return "rw"
+	case self.Writable():
+		return "w"
+	}
+
+	return "r"
+}
+
+// FdInfos maps fd numbers to information about the fds.
+type FdInfos map[int]FdInfo
+
+// NewFdInfo reads information about fd of the process identified by pid from /proc/%{pid}/fdinfo/%{fd}.
+//
+// Returns an error if reading /proc/%{pid}/fdinfo/%{fd} or parsing an individual value fails.
+func NewFdInfo(pid int, fd int) (*FdInfo, error) {
+	return DefaultFS.NewFdInfo(pid, fd)
+}
+
+// NewFdInfo is like the package-level NewFdInfo but reads from the proc fs self.
+func (self FS) NewFdInfo(pid int, fd int) (*FdInfo, error) {
+	fn := filepath.Join(self.Dir(pid), "fdinfo", fmt.Sprint(fd))
+
+	f, err := os.Open(fn)
+
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to read %s [%s]", fn, err))
+	}
+
+	defer f.Close()
+
+	return NewFdInfoFromReader(f)
+}
+
+// NewFdInfos reads information about all open fds of the process identified by pid.
+// Fds closed while reading are omitted.
+//
+// Returns an error if reading /proc/%{pid}/fdinfo fails.
+func NewFdInfos(pid int) (FdInfos, error) {
+	return DefaultFS.NewFdInfos(pid)
+}
+
+// NewFdInfos is like the package-level NewFdInfos but reads from the proc fs self.
+func (self FS) NewFdInfos(pid int) (FdInfos, error) {
+	fn := filepath.Join(self.Dir(pid), "fdinfo")
+
+	f, err := os.Open(fn)
+
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to open %s [%s]", fn, err))
+	}
+
+	defer f.Close()
+
+	names, err := f.Readdirnames(0)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to read %s [%s]", fn, err))
+	}
+
+	infos := FdInfos{}
+	for _, name := range names {
+		fd, err := strconv.Atoi(name)
+		if err != nil {
+			continue
+		}
+
+		if info, err := self.NewFdInfo(pid, fd); err == nil {
+			infos[fd] = *info
+		}
+	}
+
+	return infos, nil
+}
+
+// parseKeyValues parses a line of whitespace-separated "key: value" or "key:value" pairs.
+func parseKeyValues(line string) map[string]string {
+	kv := map[string]string{}
+	key := ""
+
+	for _, field := range strings.Fields(line) {
+		if i := strings.Index(field, ":"); i >= 0 {
+			key = field[:i]
+			if len(field) > i+1 {
+				kv[key], key = field[i+1:], ""
+			}
+		} else if len(key) > 0 {
+			kv[key], key = field, ""
+		}
+	}
+
+	return kv
+}
+
+// parseTimespec parses a time in the format "(%llu, %llu)", seconds and nanoseconds.
+func parseTimespec(s string) (time.Duration, error) {
+	var secs, nsecs int64
+	if _, err := fmt.Sscanf(strings.Replace(s, " ", "", -1), "(%d,%d)", &secs, &nsecs); err != nil {
+		return 0, err
+	}
+
+	return time.Duration(secs)*time.Second + time.Duration(nsecs), nil
+}
+
+// NewFdInfoFromReader parses an FdInfo instance from reader.
+//
+// Returns an error if parsing an individual value fails.
+func NewFdInfoFromReader(reader io.Reader) (*FdInfo, error) {
+	info := FdInfo{}
+	scanner := bufio.NewScanner(reader)
+
+	parseUint := func(key string, s string, base int, bits int) (uint64, error) {
+		v, err := strconv.ParseUint(s, base, bits)
+		if err != nil {
+			return 0, errors.New(fmt.Sprintf("Failed to parse field %s [%s]", key, err))
+		}
+		return v, nil
+	}
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		kv := strings.SplitN(line, ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+
+		key, value := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+
+		var err error
+		var v uint64
+
+		switch {
+		case key == "pos":
+			info.Pos, err = strconv.ParseInt(value, 10, 64)
+		case key == "flags":
+			v, err = parseUint(key, value, 8, 32)
+			info.Flags = int(v)
+		case key == "mnt_id":
+			info.MntId, err = strconv.Atoi(value)
+		case key == "ino":
+			info.Ino, err = parseUint(key, value, 10, 64)
+		case key == "eventfd-count":
+			if v, err = parseUint(key, value, 16, 64); err == nil {
+				info.EventCount = &v
+			}
+		case key == "tfd":
+			fields := parseKeyValues(line)
+			target := EpollTarget{}
+			if target.Fd, err = strconv.Atoi(fields["tfd"]); err != nil {
+				break
+			}
+			if v, err = parseUint("events", fields["events"], 16, 32); err != nil {
+				break
+			}
+			target.Events = uint32(v)
+			if target.Data, err = parseUint("data", fields["data"], 16, 64); err != nil {
+				break
+			}
+			info.Epoll = append(info.Epoll, target)
+		case strings.HasPrefix(line, "inotify "):
+			fields := parseKeyValues(strings.TrimPrefix(line, "inotify "))
+			watch := InotifyWatch{}
+			if watch.Wd, err = strconv.Atoi(fields["wd"]); err != nil {
+				break
+			}
+			if watch.Ino, err = parseUint("ino", fields["ino"], 16, 64); err != nil {
+				break
+			}
+			if watch.Sdev, err = parseUint("sdev", fields["sdev"], 16, 64); err != nil {
+				break
+			}
+			if v, err = parseUint("mask", fields["mask"], 16, 32); err != nil {
+				break
+			}
+			watch.Mask = uint32(v)
+			info.Inotify = append(info.Inotify, watch)
+		case key == "clockid":
+			info.timerFd().ClockId, err = strconv.Atoi(value)
+		case key == "ticks":
+			info.timerFd().Ticks, err = parseUint(key, value, 10, 64)
+		case key == "settime flags":
+			v, err = parseUint(key, value, 8, 32)
+			info.timerFd().SettimeFlags = int(v)
+		case key == "it_value":
+			info.timerFd().Value, err = parseTimespec(value)
+		case key == "it_interval":
+			info.timerFd().Interval, err = parseTimespec(value)
+		}
+
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Failed to parse line '%s' [%s]", line, err))
+		}
+	}
+
+	return &info, scanner.Err()
+}
+
+// timerFd returns the TimerFd details of self, creating them if necessary.
+func (self *FdInfo) timerFd() *TimerFd {
+	if self.TimerFd == nil {
+		self.TimerFd = &TimerFd{}
+	}
+
+	return self.TimerFd
+}
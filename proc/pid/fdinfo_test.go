@@ -0,0 +1,34 @@
+package pid
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewFdInfosDecodesTypeSpecificDetails(t *testing.T) {
+	infos, err := testFS.NewFdInfos(1042)
+	assert.Nil(t, err)
+	assert.Equal(t, 7, len(infos))
+
+	assert.True(t, infos[0].Readable() && infos[0].Writable())
+	assert.Equal(t, 25, infos[0].MntId)
+	assert.True(t, !infos[1].Readable() && infos[1].Writable())
+	assert.Equal(t, uint64(20481), infos[1].Ino)
+
+	assert.Equal(t, uint64(42), *infos[3].EventCount)
+	assert.Equal(t, []EpollTarget{{3, 0x19, 3}, {2, 1, 0x100000002}}, infos[4].Epoll)
+	assert.Equal(t, []InotifyWatch{{1, 0x9e7e, 0x800013, 0x800afce}}, infos[5].Inotify)
+	assert.Equal(t, &TimerFd{1, 3, 1, 499925763 * time.Nanosecond, time.Second}, infos[6].TimerFd)
+	assert.Nil(t, infos[6].EventCount)
+}
+
+func TestNewFdInfoFromReaderRejectsMalformedValues(t *testing.T) {
+	_, err := NewFdInfoFromReader(strings.NewReader("pos:\t0\nflags:\t09\n"))
+	assert.NotNil(t, err)
+
+	_, err = NewFdInfoFromReader(strings.NewReader("tfd: x events: 1 data: 0\n"))
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,160 @@
+package pid
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testFS is a snapshot of a proc fs, containing a python process with id 1042 and two threads.
+const testFS = FS("../test_data")
+
+func TestFSResolvesDirectories(t *testing.T) {
+	assert.Equal(t, "/proc/42", Dir(42))
+	assert.Equal(t, "/proc/42", FS("").Dir(42))
+	assert.Equal(t, "../test_data/1042/task/1043", testFS.TaskDir(1042, 1043))
+	assert.Equal(t, "../test_data/1042/root", testFS.RootDir(1042))
+}
+
+func TestFSReadsProcessFromSnapshot(t *testing.T) {
+	auxv, err := testFS.NewAuxv(1042)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(4096), auxv[AT_PAGESZ])
+	assert.Equal(t, uint64(1000), auxv[AT_UID])
+
+	cmdline, err := testFS.NewCmdline(1042)
+	assert.Nil(t, err)
+	assert.Equal(t, Cmdline{"python3.4", "-m", "http.server"}, cmdline)
+
+	env, err := testFS.NewEnviron(1042)
+	assert.Nil(t, err)
+	assert.Equal(t, "C.UTF-8", env["LANG"])
+
+	cwd, err := testFS.NewCwd(1042)
+	assert.Nil(t, err)
+	assert.Equal(t, Cwd("/home/user"), cwd)
+
+	exe, err := testFS.NewExe(1042)
+	assert.Nil(t, err)
+	assert.Equal(t, Exe("/usr/bin/python3.4"), exe)
+
+	root, err := testFS.NewRoot(1042)
+	assert.Nil(t, err)
+	assert.Equal(t, Root("/"), root)
+
+	io, err := testFS.NewIO(1042)
+	assert.Nil(t, err)
+	assert.Equal(t, 4853198, io.RChar)
+	assert.Equal(t, 4096, io.WriteBytes)
+
+	limits, err := testFS.NewLimits(1042)
+	assert.Nil(t, err)
+	assert.Equal(t, 1024, *limits[OpenFiles].Soft)
+	assert.Equal(t, 4096, *limits[OpenFiles].Hard)
+	assert.Nil(t, limits[CpuTime].Soft)
+
+	oomAdj, err := testFS.NewOomAdj(1042)
+	assert.Nil(t, err)
+	assert.Equal(t, OomAdj(0), oomAdj)
+
+	oomScore, err := testFS.NewOomScore(1042)
+	assert.Nil(t, err)
+	assert.Equal(t, OomScore(668), oomScore)
+
+	oomScoreAdj, err := testFS.NewOomScoreAdj(1042)
+	assert.Nil(t, err)
+	assert.Equal(t, OomScoreAdj(0), oomScoreAdj)
+
+	statm, err := testFS.NewStatm(1042)
+	assert.Nil(t, err)
+	assert.Equal(t, Statm{59045, 4960, 3046, 852, 0, 2013, 0}, *statm)
+}
+
+func TestFSReadsStatusAndStatFromSnapshot(t *testing.T) {
+	stat, err := testFS.NewStat(1042)
+	assert.Nil(t, err)
+	assert.Equal(t, "python3.4", stat.Comm)
+	assert.Equal(t, 1, stat.Ppid)
+
+	status, err := testFS.NewStatus(1042)
+	assert.Nil(t, err)
+	assert.Equal(t, "python3.4", status.Name)
+	assert.Equal(t, 2, status.Threads)
+}
+
+func TestFSReadsMemoryFromSnapshot(t *testing.T) {
+	maps, err := testFS.NewMaps(1042)
+	assert.Nil(t, err)
+	assert.Equal(t, 5, len(maps))
+	assert.Equal(t, "/usr/bin/python3.4", maps[0].Path)
+	assert.Equal(t, MemoryUsage{}, maps[0].Usage)
+	assert.Equal(t, uint64(6944*1024), maps.Size())
+
+	smaps, err := testFS.NewSmaps(1042)
+	assert.Nil(t, err)
+	assert.Equal(t, 5, len(smaps))
+	assert.Equal(t, uint64(1024*1024), smaps[0].Usage.Pss)
+
+	rollup, err := testFS.NewSmapsRollup(1042)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(5112*1024), rollup.Rss)
+	assert.Equal(t, uint64(64*1024), rollup.Swap)
+}
+
+func TestFSReadsFdsNamespacesAndCgroupsFromSnapshot(t *testing.T) {
+	fd, err := testFS.NewFd(1042)
+	assert.Nil(t, err)
+	assert.Equal(t, 7, len(fd))
+
+	assert.Equal(t, 0, fd[0].Fd)
+	assert.Equal(t, FdDevice, fd[0].Kind)
+	assert.Equal(t, "/dev/null", fd[0].Target)
+	assert.Equal(t, "rw", fd[0].Mode)
+
+	socket := Socket{ProtocolTcp, "", 20482, "127.0.0.1:8080", "127.0.0.1:50000", "ESTABLISHED", 0, 42}
+	assert.Equal(t, FdEntry{Fd: 1, Kind: FdPipe, Mode: "w", Inode: 20481, Peers: []PipeEnd{{1100, 6, false}}}, fd[1])
+	assert.Equal(t, FdEntry{Fd: 2, Kind: FdSocket, Mode: "rw", Inode: 20482, Socket: &socket}, fd[2])
+	assert.Equal(t, FdEntry{Fd: 3, Kind: FdAnon, Target: "eventfd", Mode: "rw", Inode: 1057}, fd[3])
+	assert.Equal(t, FdEntry{Fd: 4, Kind: FdAnon, Target: "eventpoll", Mode: "rw", Inode: 1057}, fd[4])
+	assert.Equal(t, FdEntry{Fd: 5, Kind: FdAnon, Target: "inotify", Mode: "r", Inode: 1057}, fd[5])
+	assert.Equal(t, FdEntry{Fd: 6, Kind: FdAnon, Target: "timerfd", Mode: "rw", Inode: 1057}, fd[6])
+
+	ns, err := testFS.NewNamespaces(1042)
+	assert.Nil(t, err)
+	assert.Equal(t, 7, len(ns))
+	assert.Equal(t, uint64(4026532521), ns[NamespaceMount])
+
+	cg, err := testFS.NewCGroup(1042)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(cg.Hierarchies))
+	assert.Equal(t, Docker, NewContainerFromCgroup(cg).Runtime)
+}
+
+func TestFSReadsTasksFromSnapshot(t *testing.T) {
+	tasks, err := testFS.NewTasks(1042)
+	assert.Nil(t, err)
+	assert.Equal(t, Tasks{1042, 1043}, tasks)
+
+	main, err := testFS.NewTask(1042, 1042)
+	assert.Nil(t, err)
+	assert.Equal(t, "python3.4", main.Comm)
+	assert.Equal(t, "do_epoll_wait", main.Wchan)
+	assert.Equal(t, KernelStack{"ep_poll+0x2a4/0x3c0", "do_epoll_wait+0xb4/0xd0", "entry_SYSCALL_64_after_hwframe+0x44/0xa9"}, main.Stack)
+	assert.Equal(t, 232, main.Syscall.Number)
+
+	worker, err := testFS.NewTask(1042, 1043)
+	assert.Nil(t, err)
+	assert.Equal(t, "worker", worker.Comm)
+	assert.Equal(t, 1043, worker.Status.Pid)
+	assert.Empty(t, worker.Wchan)
+	assert.Nil(t, worker.Stack)
+	assert.Nil(t, worker.Syscall)
+}
+
+func TestFSFailsForMissingProcess(t *testing.T) {
+	_, err := testFS.NewStat(1)
+	assert.NotNil(t, err)
+
+	_, err = testFS.NewTask(1042, 1)
+	assert.NotNil(t, err)
+}
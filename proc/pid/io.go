@@ -27,7 +27,12 @@ type IO struct {
 
 // NewIO determines the io statistics for the process identified by pid.
 func NewIO(pid int) (*IO, error) {
-	fn := filepath.Join(Dir(pid), "io")
+	return DefaultFS.NewIO(pid)
+}
+
+// NewIO is like the package-level NewIO but reads from the proc fs self.
+func (self FS) NewIO(pid int) (*IO, error) {
+	fn := filepath.Join(self.Dir(pid), "io")
 
 	f, err := os.Open(fn)
 
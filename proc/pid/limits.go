@@ -131,7 +131,12 @@ type Limits map[ResourceLimit]*Limit
 //
 // Returns a Limits instance or an error if /proc/%{pid}/file could not be opened for reading
 func NewLimits(pid int) (Limits, error) {
-	fn := filepath.Join(Dir(pid), "limits")
+	return DefaultFS.NewLimits(pid)
+}
+
+// NewLimits is like the package-level NewLimits but reads from the proc fs self.
+func (self FS) NewLimits(pid int) (Limits, error) {
+	fn := filepath.Join(self.Dir(pid), "limits")
 
 	f, err := os.Open(fn)
 
@@ -30,7 +30,7 @@ const (
 // mapsRegExp parses an individual line from /proc/%{pid}/maps. Please see
 // https://regex101.com/r/cD2tN2/1 for a more readable overview together with
 // an example. Index constants are easily verifiable over there, too.
-var mapsRegExp = regexp.MustCompile(`(([[:xdigit:]]+)\-([[:xdigit:]]+))\s+((\-|r)(\-|w)(\-|x)(\-|p))\s+([[:xdigit:]]+)\s+(([[:digit:]]+)\:([[:digit:]]+))\s+([[:digit:]]+)\s+(.+)`)
+var mapsRegExp = regexp.MustCompile(`(([[:xdigit:]]+)\-([[:xdigit:]]+))\s+((\-|r)(\-|w)(\-|x)(s|p))\s+([[:xdigit:]]+)\s+(([[:xdigit:]]+)\:([[:xdigit:]]+))\s+([[:digit:]]+)\s*(.*)`)
 
 // MemoryRegion describes a mapped memory region and its access permissions
 type MemoryRegion struct {
@@ -50,17 +50,60 @@ type MemoryRegion struct {
 		Major int // Major identifier
 		Minor int // Minor identifier
 	}
-	Inode int    // Inode on the device backing the memory region
-	Path  string // Usually the file backing the memory mapping
+	Inode   int         // Inode on the device backing the memory region
+	Path    string      // Usually the file backing the memory mapping
+	Usage   MemoryUsage `yaml:",omitempty"` // Memory accounted to the region, only available if read from /proc/%{pid}/smaps
+	VmFlags []string    `yaml:",omitempty"` // Kernel flags of the region, only available if read from /proc/%{pid}/smaps
+}
+
+// String formats the memory region in the format of /proc/%{pid}/maps.
+func (self MemoryRegion) String() string {
+	perms := []byte("----")
+	if self.Permissions.Read {
+		perms[0] = 'r'
+	}
+	if self.Permissions.Write {
+		perms[1] = 'w'
+	}
+	if self.Permissions.Exec {
+		perms[2] = 'x'
+	}
+	if self.Permissions.Private {
+		perms[3] = 'p'
+	} else {
+		perms[3] = 's'
+	}
+
+	s := fmt.Sprintf("%08x-%08x %s %08x %02x:%02x %d", uint64(self.Address.Begin), uint64(self.Address.End), perms, self.Offset, self.Device.Major, self.Device.Minor, self.Inode)
+	if len(self.Path) > 0 {
+		s = fmt.Sprintf("%-72s %s", s, self.Path)
+	}
+
+	return s
 }
 
 // Maps is the set of all mapped memory regions of a process
 type Maps []MemoryRegion
 
+// Size returns the size of all regions summed up, in bytes.
+func (self Maps) Size() uint64 {
+	size := uint64(0)
+	for _, mr := range self {
+		size += uint64(mr.Address.End - mr.Address.Begin)
+	}
+
+	return size
+}
+
 // NewMaps reads the memory mappings from /proc/pid/maps, returning a Maps instance
 // and an error in case of issues.
 func NewMaps(pid int) (Maps, error) {
-	fn := filepath.Join(Dir(pid), "maps")
+	return DefaultFS.NewMaps(pid)
+}
+
+// NewMaps is like the package-level NewMaps but reads from the proc fs self.
+func (self FS) NewMaps(pid int) (Maps, error) {
+	fn := filepath.Join(self.Dir(pid), "maps")
 
 	f, err := os.Open(fn)
 
@@ -73,36 +116,51 @@ func NewMaps(pid int) (Maps, error) {
 	return NewMapsFromReader(f)
 }
 
-// NewMapsFromReader parses memory mappings from reader.
+// parseMemoryRegion parses a single line in the format of /proc/%{pid}/maps.
 //
-// Returns all parsed memory mappings and an error. If the error
-// is nil, all memory mappings were successfully parsed.
-func NewMapsFromReader(reader io.Reader) (Maps, error) {
-	maps := Maps{}
-	br := bufio.NewReader(reader)
+// Returns false if line does not describe a memory region.
+func parseMemoryRegion(line string) (MemoryRegion, bool) {
+	mr := MemoryRegion{}
+	tokens := mapsRegExp.FindStringSubmatch(strings.TrimRight(line, "\n"))
 
-	for line, err := br.ReadString('\n'); err == nil; line, err = br.ReadString('\n') {
-		tokens := mapsRegExp.FindStringSubmatch(strings.TrimRight(line, "\n"))
+	if len(tokens) < mapsSubmatchCount {
+		return mr, false
+	}
 
-		if len(tokens) >= mapsSubmatchCount {
-			mr := MemoryRegion{}
+	mr.Address.Begin, _ = strconv.ParseInt(tokens[mapsAddressBegin], 16, 64)
+	mr.Address.End, _ = strconv.ParseInt(tokens[mapsAddressEnd], 16, 64)
 
-			mr.Address.Begin, _ = strconv.ParseInt(tokens[mapsAddressBegin], 16, 64)
-			mr.Address.End, _ = strconv.ParseInt(tokens[mapsAddressEnd], 16, 64)
+	mr.Permissions.Read = tokens[mapsReadPerm] == "r"
+	mr.Permissions.Write = tokens[mapsWritePerm] == "w"
+	mr.Permissions.Exec = tokens[mapsExecPerm] == "x"
+	mr.Permissions.Private = tokens[mapsPrivatePerm] == "p"
 
-			mr.Permissions.Read = tokens[mapsReadPerm] == "r"
-			mr.Permissions.Write = tokens[mapsWritePerm] == "w"
-			mr.Permissions.Exec = tokens[mapsExecPerm] == "x"
-			mr.Permissions.Private = tokens[mapsPrivatePerm] == "p"
+	mr.Offset, _ = strconv.ParseInt(tokens[mapsOffset], 16, 64)
+
+	if major, err := strconv.ParseInt(tokens[mapsDevMajor], 16, 0); err == nil {
+		mr.Device.Major = int(major)
+	}
+
+	if minor, err := strconv.ParseInt(tokens[mapsDevMinor], 16, 0); err == nil {
+		mr.Device.Minor = int(minor)
+	}
 
-			mr.Offset, _ = strconv.ParseInt(tokens[mapsOffset], 16, 64)
+	mr.Inode, _ = strconv.Atoi(tokens[mapsInode])
+	mr.Path = tokens[mapsPath]
 
-			mr.Device.Major, _ = strconv.Atoi(tokens[mapsDevMajor])
-			mr.Device.Minor, _ = strconv.Atoi(tokens[mapsDevMinor])
+	return mr, true
+}
 
-			mr.Inode, _ = strconv.Atoi(tokens[mapsInode])
-			mr.Path = tokens[mapsPath]
+// NewMapsFromReader parses memory mappings from reader.
+//
+// Returns all parsed memory mappings and an error. If the error
+// is nil, all memory mappings were successfully parsed.
+func NewMapsFromReader(reader io.Reader) (Maps, error) {
+	maps := Maps{}
+	br := bufio.NewReader(reader)
 
+	for line, err := br.ReadString('\n'); err == nil; line, err = br.ReadString('\n') {
+		if mr, ok := parseMemoryRegion(line); ok {
 			maps = append(maps, mr)
 		}
 	}
@@ -0,0 +1,335 @@
+package pid
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Socket protocols, named after the tables in /proc/%{pid}/net.
+const (
+	ProtocolTcp     = "tcp"
+	ProtocolTcp6    = "tcp6"
+	ProtocolUdp     = "udp"
+	ProtocolUdp6    = "udp6"
+	ProtocolUnix    = "unix"
+	ProtocolNetlink = "netlink"
+)
+
+// Protocols lists all protocols resolved by NewSockets.
+var Protocols = []string{ProtocolTcp, ProtocolTcp6, ProtocolUdp, ProtocolUdp6, ProtocolUnix, ProtocolNetlink}
+
+// inetStates maps the states reported for tcp and udp sockets to their names,
+// taken from ${KERNELSRC}/include/net/tcp_states.h
+var inetStates = map[uint64]string{
+	0x01: "ESTABLISHED",
+	0x02: "SYN_SENT",
+	0x03: "SYN_RECV",
+	0x04: "FIN_WAIT1",
+	0x05: "FIN_WAIT2",
+	0x06: "TIME_WAIT",
+	0x07: "CLOSE",
+	0x08: "CLOSE_WAIT",
+	0x09: "LAST_ACK",
+	0x0a: "LISTEN",
+	0x0b: "CLOSING",
+	0x0c: "NEW_SYN_RECV",
+}
+
+// unixStates maps the states reported for unix sockets to their names,
+// taken from ${KERNELSRC}/include/uapi/linux/net.h
+var unixStates = map[uint64]string{
+	0x01: "UNCONNECTED",
+	0x02: "CONNECTING",
+	0x03: "CONNECTED",
+	0x04: "DISCONNECTING",
+}
+
+// unixTypes maps the types reported for unix sockets to their names.
+var unixTypes = map[uint64]string{
+	0x01: "stream",
+	0x02: "dgram",
+	0x05: "seqpacket",
+}
+
+// unixAcceptCon flags listening unix sockets, named __SO_ACCEPTCON in the kernel.
+const unixAcceptCon = 0x10000
+
+// Socket describes an endpoint of a network connection, resolved from the tables in /proc/%{pid}/net.
+type Socket struct {
+	Protocol      string // One of the Protocol* constants
+	Type          string // Type of the socket, e.g., stream or dgram for unix sockets and the netlink family for netlink sockets
+	Inode         uint   // Inode of the socket
+	LocalAddress  string // Local address, host:port for tcp and udp, the path for unix and the port id for netlink sockets
+	RemoteAddress string // Remote address, host:port for tcp and udp sockets, empty otherwise
+	State         string // State of the socket, e.g., ESTABLISHED or LISTEN
+	TxQueue       uint64 // Bytes queued for sending, or the send buffer in use for netlink sockets
+	RxQueue       uint64 // Bytes queued for receiving, or the receive buffer in use for netlink sockets
+}
+
+// Sockets maps socket inodes to the sockets they identify.
+type Sockets map[uint]Socket
+
+// NewSockets resolves the sockets in the network namespace of the process identified
+// by pid from the tables listed in Protocols. Missing tables are skipped.
+//
+// Returns an error if reading or parsing an individual table fails.
+func NewSockets(pid int) (Sockets, error) {
+	return DefaultFS.NewSockets(pid)
+}
+
+// NewSockets is like the package-level NewSockets but reads from the proc fs self.
+func (self FS) NewSockets(pid int) (Sockets, error) {
+	sockets := Sockets{}
+
+	for _, protocol := range Protocols {
+		fn := filepath.Join(self.Dir(pid), "net", protocol)
+
+		f, err := os.Open(fn)
+
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, errors.New(fmt.Sprintf("Failed to read %s [%s]", fn, err))
+		}
+
+		s, err := NewSocketsFromReader(protocol, f)
+		f.Close()
+
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Failed to parse %s [%s]", fn, err))
+		}
+
+		for inode, socket := range s {
+			sockets[inode] = socket
+		}
+	}
+
+	return sockets, nil
+}
+
+// NewSocketsFromReader parses the table of sockets of protocol from reader, in the format of /proc/%{pid}/net/%{protocol}.
+//
+// Returns an error if protocol is not known or if parsing an individual line fails.
+func NewSocketsFromReader(protocol string, reader io.Reader) (Sockets, error) {
+	var parse func(fields []string, header map[string]int) (Socket, error)
+
+	switch protocol {
+	case ProtocolTcp, ProtocolTcp6, ProtocolUdp, ProtocolUdp6:
+		parse = parseInetSocket
+	case ProtocolUnix:
+		parse = parseUnixSocket
+	case ProtocolNetlink:
+		parse = parseNetlinkSocket
+	default:
+		return nil, errors.New(fmt.Sprintf("Unknown protocol %s", protocol))
+	}
+
+	sockets := Sockets{}
+	scanner := bufio.NewScanner(reader)
+
+	// The first line names the columns.
+	header := map[string]int{}
+	if scanner.Scan() {
+		for i, name := range strings.Fields(scanner.Text()) {
+			header[name] = i
+		}
+	}
+
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		s, err := parse(fields, header)
+		if err != nil {
+			return nil, err
+		}
+
+		s.Protocol = protocol
+		sockets[s.Inode] = s
+	}
+
+	return sockets, scanner.Err()
+}
+
+// parseInetAddress decodes an address in the format "%08X:%04X" or "%032X:%04X",
+// with the address in network byte order printed as words of the host byte order.
+func parseInetAddress(s string) (string, error) {
+	hp := strings.Split(s, ":")
+	if len(hp) != 2 {
+		return "", errors.New(fmt.Sprintf("Failed to parse address %s", s))
+	}
+
+	b, err := hex.DecodeString(hp[0])
+	if err != nil || (len(b) != net.IPv4len && len(b) != net.IPv6len) {
+		return "", errors.New(fmt.Sprintf("Failed to parse address %s", s))
+	}
+
+	port, err := strconv.ParseUint(hp[1], 16, 16)
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("Failed to parse port %s [%s]", hp[1], err))
+	}
+
+	ip := make(net.IP, len(b))
+	for i := 0; i < len(b); i += 4 {
+		determineEndianess().PutUint32(ip[i:], binary.BigEndian.Uint32(b[i:]))
+	}
+
+	return net.JoinHostPort(ip.String(), fmt.Sprint(port)), nil
+}
+
+// parseInetSocket parses a line of /proc/%{pid}/net/{tcp,tcp6,udp,udp6}:
+// "sl local_address rem_address st tx_queue:rx_queue tr:tm->when retrnsmt uid timeout inode ...".
+func parseInetSocket(fields []string, header map[string]int) (Socket, error) {
+	s := Socket{}
+	if len(fields) < 10 {
+		return s, errors.New(fmt.Sprintf("Failed to parse line '%s'", strings.Join(fields, " ")))
+	}
+
+	var err error
+	if s.LocalAddress, err = parseInetAddress(fields[1]); err != nil {
+		return s, err
+	}
+
+	if s.RemoteAddress, err = parseInetAddress(fields[2]); err != nil {
+		return s, err
+	}
+
+	st, err := strconv.ParseUint(fields[3], 16, 8)
+	if err != nil {
+		return s, errors.New(fmt.Sprintf("Failed to parse state %s [%s]", fields[3], err))
+	}
+	s.State = inetStates[st]
+
+	if _, err := fmt.Sscanf(fields[4], "%x:%x", &s.TxQueue, &s.RxQueue); err != nil {
+		return s, errors.New(fmt.Sprintf("Failed to parse queues %s [%s]", fields[4], err))
+	}
+
+	inode, err := strconv.ParseUint(fields[9], 10, 64)
+	if err != nil {
+		return s, errors.New(fmt.Sprintf("Failed to parse inode %s [%s]", fields[9], err))
+	}
+	s.Inode = uint(inode)
+
+	return s, nil
+}
+
+// parseUnixSocket parses a line of /proc/%{pid}/net/unix:
+// "Num RefCount Protocol Flags Type St Inode Path".
+func parseUnixSocket(fields []string, header map[string]int) (Socket, error) {
+	s := Socket{}
+	if len(fields) < 7 {
+		return s, errors.New(fmt.Sprintf("Failed to parse line '%s'", strings.Join(fields, " ")))
+	}
+
+	values := []uint64{}
+	for _, field := range fields[3:6] {
+		v, err := strconv.ParseUint(field, 16, 64)
+		if err != nil {
+			return s, errors.New(fmt.Sprintf("Failed to parse line '%s' [%s]", strings.Join(fields, " "), err))
+		}
+		values = append(values, v)
+	}
+
+	flags, t, st := values[0], values[1], values[2]
+
+	s.Type = unixTypes[t]
+	s.State = unixStates[st]
+	if flags&unixAcceptCon != 0 {
+		s.State = "LISTEN"
+	}
+
+	inode, err := strconv.ParseUint(fields[6], 10, 64)
+	if err != nil {
+		return s, errors.New(fmt.Sprintf("Failed to parse inode %s [%s]", fields[6], err))
+	}
+	s.Inode = uint(inode)
+
+	// Abstract sockets are reported with a leading @, unnamed ones without a path.
+	if len(fields) > 7 {
+		s.LocalAddress = strings.Join(fields[7:], " ")
+	}
+
+	return s, nil
+}
+
+// netlinkFamilies maps netlink protocol numbers to their names, taken from ${KERNELSRC}/include/uapi/linux/netlink.h
+var netlinkFamilies = map[int]string{
+	0:  "route",
+	2:  "usersock",
+	4:  "sock_diag",
+	6:  "xfrm",
+	7:  "selinux",
+	9:  "audit",
+	10: "fib_lookup",
+	11: "connector",
+	12: "netfilter",
+	15: "kobject_uevent",
+	16: "generic",
+	18: "scsitransport",
+	19: "ecryptfs",
+	20: "rdma",
+	21: "crypto",
+}
+
+// parseNetlinkSocket parses a line of /proc/%{pid}/net/netlink, relying on header
+// for locating the columns: "sk Eth Pid Groups Rmem Wmem Dump Locks Drops Inode".
+func parseNetlinkSocket(fields []string, header map[string]int) (Socket, error) {
+	s := Socket{}
+
+	column := func(name string) (uint64, error) {
+		i, present := header[name]
+		if !present || i >= len(fields) {
+			return 0, errors.New(fmt.Sprintf("Failed to find column %s in line '%s'", name, strings.Join(fields, " ")))
+		}
+
+		v, err := strconv.ParseUint(fields[i], 10, 64)
+		if err != nil {
+			return 0, errors.New(fmt.Sprintf("Failed to parse column %s [%s]", name, err))
+		}
+
+		return v, nil
+	}
+
+	eth, err := column("Eth")
+	if err != nil {
+		return s, err
+	}
+
+	s.Type = netlinkFamilies[int(eth)]
+	if len(s.Type) == 0 {
+		s.Type = fmt.Sprint(eth)
+	}
+
+	port, err := column("Pid")
+	if err != nil {
+		return s, err
+	}
+	s.LocalAddress = fmt.Sprint(port)
+
+	if s.RxQueue, err = column("Rmem"); err != nil {
+		return s, err
+	}
+
+	if s.TxQueue, err = column("Wmem"); err != nil {
+		return s, err
+	}
+
+	inode, err := column("Inode")
+	if err != nil {
+		return s, err
+	}
+	s.Inode = uint(inode)
+
+	return s, nil
+}
@@ -0,0 +1,54 @@
+package pid
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewSocketsResolvesAllProtocols(t *testing.T) {
+	sockets, err := testFS.NewSockets(1042)
+	assert.Nil(t, err)
+	assert.Equal(t, 9, len(sockets))
+
+	assert.Equal(t, Socket{ProtocolTcp, "", 20470, "127.0.0.1:8080", "0.0.0.0:0", "LISTEN", 0, 0}, sockets[20470])
+	assert.Equal(t, Socket{ProtocolTcp6, "", 20471, "[::1]:8081", "[::]:0", "LISTEN", 0, 0}, sockets[20471])
+	assert.Equal(t, Socket{ProtocolUdp, "", 20483, "0.0.0.0:5353", "0.0.0.0:0", "CLOSE", 0, 0}, sockets[20483])
+	assert.Equal(t, Socket{ProtocolUnix, "stream", 20484, "/run/user/1000/python.sock", "", "LISTEN", 0, 0}, sockets[20484])
+	assert.Equal(t, Socket{ProtocolUnix, "stream", 20485, "", "", "CONNECTED", 0, 0}, sockets[20485])
+	assert.Equal(t, Socket{ProtocolUnix, "dgram", 20486, "@/tmp/.X11-unix/X0", "", "UNCONNECTED", 0, 0}, sockets[20486])
+	assert.Equal(t, Socket{ProtocolNetlink, "route", 20487, "1042", "", "", 0, 0}, sockets[20487])
+	assert.Equal(t, Socket{ProtocolNetlink, "kobject_uevent", 20488, "0", "", "", 0, 2304}, sockets[20488])
+}
+
+func TestNewSocketsFromReaderRejectsMalformedTables(t *testing.T) {
+	_, err := NewSocketsFromReader("sctp", strings.NewReader(""))
+	assert.NotNil(t, err)
+
+	_, err = NewSocketsFromReader(ProtocolTcp, strings.NewReader("header\n 0: 0100007F 00000000:0000 0A 00000000:00000000 00:00000000 00000000 0 0 1\n"))
+	assert.NotNil(t, err)
+
+	_, err = NewSocketsFromReader(ProtocolNetlink, strings.NewReader("sk Eth Pid\n0 0 1\n"))
+	assert.NotNil(t, err)
+}
+
+func TestNewPipeEndsPairsOppositeEnds(t *testing.T) {
+	ends, err := testFS.NewPipeEnds([]uint{20481})
+	assert.Nil(t, err)
+	assert.Equal(t, []PipeEnd{{1042, 1, true}, {1100, 5, true}, {1100, 6, false}}, ends[20481])
+
+	writable := true
+	assert.Equal(t, []PipeEnd{{1100, 6, false}}, ends.Peers(20481, 1042, &writable))
+	assert.Equal(t, []PipeEnd{{1100, 5, true}, {1100, 6, false}}, ends.Peers(20481, 1042, nil))
+}
+
+func TestNewPipeEndsContextStopsScanningOnceContextIsDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	ends, err := testFS.NewPipeEndsContext(ctx, []uint{20481})
+	assert.Equal(t, context.Canceled, err)
+	assert.Empty(t, ends[20481])
+}
@@ -0,0 +1,92 @@
+package pid
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Namespace types, as listed in /proc/%{pid}/ns.
+const (
+	NamespaceCgroup = "cgroup" // Cgroup root directory
+	NamespaceIpc    = "ipc"    // System V IPC and POSIX message queues
+	NamespaceMount  = "mnt"    // Mount points
+	NamespaceNet    = "net"    // Network devices, stacks and ports
+	NamespacePid    = "pid"    // Process ids
+	NamespaceTime   = "time"   // Boot and monotonic clocks
+	NamespaceUser   = "user"   // User and group ids
+	NamespaceUts    = "uts"    // Hostname and NIS domain name
+)
+
+// Namespaces maps the namespace types of a process to the inode numbers
+// identifying the namespaces. Processes sharing a namespace of a type
+// report the same inode for that type.
+type Namespaces map[string]uint64
+
+// NewNamespaces reads the namespaces of the process identified by pid from /proc/%{pid}/ns.
+// Namespaces that cannot be resolved, e.g., due to missing privileges, are omitted.
+//
+// Returns an error if reading /proc/%{pid}/ns fails.
+func NewNamespaces(pid int) (Namespaces, error) {
+	return DefaultFS.NewNamespaces(pid)
+}
+
+// NewNamespaces is like the package-level NewNamespaces but reads from the proc fs self.
+func (self FS) NewNamespaces(pid int) (Namespaces, error) {
+	return newNamespacesFromDir(filepath.Join(self.Dir(pid), "ns"))
+}
+
+// NewSelfNamespaces reads the namespaces of the calling process from the proc fs self.
+// Snapshots of a proc fs record the namespaces of the process taking the snapshot instead.
+//
+// Returns an error if reading self/ns fails.
+func (self FS) NewSelfNamespaces() (Namespaces, error) {
+	return newNamespacesFromDir(filepath.Join(self.SelfDir(), "ns"))
+}
+
+// newNamespacesFromDir reads namespaces from the links in fn.
+func newNamespacesFromDir(fn string) (Namespaces, error) {
+	f, err := os.Open(fn)
+
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to open %s [%s]", fn, err))
+	}
+
+	defer f.Close()
+
+	names, err := f.Readdirnames(0)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to read %s [%s]", fn, err))
+	}
+
+	ns := Namespaces{}
+	for _, name := range names {
+		dest, err := os.Readlink(filepath.Join(fn, name))
+		if err != nil {
+			continue
+		}
+
+		var inode uint64
+		if _, err := fmt.Sscanf(dest, name+":[%d]", &inode); err == nil {
+			ns[name] = inode
+		}
+	}
+
+	return ns, nil
+}
+
+// Differing returns the types of all namespaces that differ between self and other,
+// in alphabetical order. Types missing in either instance are ignored.
+func (self Namespaces) Differing(other Namespaces) []string {
+	types := []string{}
+	for t, inode := range self {
+		if o, present := other[t]; present && o != inode {
+			types = append(types, t)
+		}
+	}
+
+	sort.Strings(types)
+	return types
+}
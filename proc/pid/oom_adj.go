@@ -24,7 +24,12 @@ type OomAdj int
 // Returns an error if /proc/%{pid}/oom_adj could not be opened for reading
 // or if the value read from the value exceeds the documented bounds.
 func NewOomAdj(pid int) (OomAdj, error) {
-	fn := filepath.Join(Dir(pid), "oom_adj")
+	return DefaultFS.NewOomAdj(pid)
+}
+
+// NewOomAdj is like the package-level NewOomAdj but reads from the proc fs self.
+func (self FS) NewOomAdj(pid int) (OomAdj, error) {
+	fn := filepath.Join(self.Dir(pid), "oom_adj")
 
 	f, err := os.Open(fn)
 
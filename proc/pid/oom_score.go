@@ -16,7 +16,12 @@ type OomScore int
 //
 // Returns an error if /proc/%{pid}/oom_score could not be opened for reading
 func NewOomScore(pid int) (OomScore, error) {
-	fn := filepath.Join(Dir(pid), "oom_score")
+	return DefaultFS.NewOomScore(pid)
+}
+
+// NewOomScore is like the package-level NewOomScore but reads from the proc fs self.
+func (self FS) NewOomScore(pid int) (OomScore, error) {
+	fn := filepath.Join(self.Dir(pid), "oom_score")
 
 	f, err := os.Open(fn)
 
@@ -22,7 +22,12 @@ const (
 // Returns an error if /proc/%{pid}/oom_score_adj could not be opened for reading
 // or if the value read from the value exceeds the documented bounds.
 func NewOomScoreAdj(pid int) (OomScoreAdj, error) {
-	fn := filepath.Join(Dir(pid), "oom_score_adj")
+	return DefaultFS.NewOomScoreAdj(pid)
+}
+
+// NewOomScoreAdj is like the package-level NewOomScoreAdj but reads from the proc fs self.
+func (self FS) NewOomScoreAdj(pid int) (OomScoreAdj, error) {
+	fn := filepath.Join(self.Dir(pid), "oom_score_adj")
 
 	f, err := os.Open(fn)
 
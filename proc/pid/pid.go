@@ -1,13 +1,85 @@
 package pid
 
 import (
+	"errors"
 	"fmt"
 	"github.com/vosst/csi/proc"
+	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 )
 
+// FS describes the root of a proc fs to read information about processes from.
+// The zero value refers to the proc fs mounted at proc.Dir.
+type FS proc.FS
+
+// DefaultFS is the proc fs mounted at proc.Dir, used by all package-level functions.
+const DefaultFS = FS(proc.Dir)
+
 // Dir returns the subdirectory containing information about the process with id pid.
 func Dir(id int) string {
+	return DefaultFS.Dir(id)
+}
+
+// Dir returns the subdirectory of the proc fs self containing information about the process with id pid.
+func (self FS) Dir(id int) string {
 	// TODO(tvoss): How to handle negative pid values?
-	return filepath.Join(proc.Dir, fmt.Sprint(id))
+	return proc.FS(self).Path(fmt.Sprint(id))
+}
+
+// SelfDir returns the subdirectory of the proc fs self containing information about the calling process.
+func (self FS) SelfDir() string {
+	return proc.FS(self).Path("self")
+}
+
+// RootDir returns the directory providing access to the filesystem as seen by the process with id pid,
+// e.g., the root filesystem of a container.
+func RootDir(id int) string {
+	return DefaultFS.RootDir(id)
+}
+
+// RootDir is like the package-level RootDir but resolves the process in the proc fs self.
+func (self FS) RootDir(id int) string {
+	return filepath.Join(self.Dir(id), "root")
+}
+
+// InRoot resolves path, as seen by the process with id pid, through RootDir.
+func InRoot(id int, path string) string {
+	return DefaultFS.InRoot(id, path)
+}
+
+// InRoot is like the package-level InRoot but resolves the process in the proc fs self.
+func (self FS) InRoot(id int, path string) string {
+	return filepath.Join(self.RootDir(id), path)
+}
+
+// Pids lists the ids of all processes in the proc fs self, in ascending order.
+//
+// Returns an error if reading the root of the proc fs fails.
+func (self FS) Pids() ([]int, error) {
+	fn := proc.FS(self).Path()
+
+	f, err := os.Open(fn)
+
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to open %s [%s]", fn, err))
+	}
+
+	defer f.Close()
+
+	names, err := f.Readdirnames(0)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to read %s [%s]", fn, err))
+	}
+
+	pids := []int{}
+	for _, name := range names {
+		if id, err := strconv.Atoi(name); err == nil {
+			pids = append(pids, id)
+		}
+	}
+
+	sort.Ints(pids)
+	return pids, nil
 }
@@ -0,0 +1,97 @@
+package pid
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// PipeEnd describes an fd of a process referring to a pipe.
+type PipeEnd struct {
+	Pid      int  // Id of the process holding the fd
+	Fd       int  // Number of the fd in the process
+	Writable bool // True if the fd refers to the writing end of the pipe
+}
+
+// PipeEnds maps pipe inodes to all fds referring to the pipe.
+type PipeEnds map[uint][]PipeEnd
+
+// NewPipeEnds scans the fds of all processes for the pipes identified by inodes.
+// Processes and fds that cannot be inspected, e.g., due to missing privileges, are skipped.
+//
+// Returns an error if enumerating the processes fails.
+func NewPipeEnds(inodes []uint) (PipeEnds, error) {
+	return DefaultFS.NewPipeEnds(inodes)
+}
+
+// NewPipeEnds is like the package-level NewPipeEnds but reads from the proc fs self.
+func (self FS) NewPipeEnds(inodes []uint) (PipeEnds, error) {
+	return self.NewPipeEndsContext(context.Background(), inodes)
+}
+
+// NewPipeEndsContext is like NewPipeEnds but stops scanning once ctx is done,
+// returning the ends found so far together with ctx.Err().
+func (self FS) NewPipeEndsContext(ctx context.Context, inodes []uint) (PipeEnds, error) {
+	wanted := map[string]uint{}
+	for _, inode := range inodes {
+		wanted[fmt.Sprintf("pipe:[%d]", inode)] = inode
+	}
+
+	pids, err := self.Pids()
+	if err != nil {
+		return nil, err
+	}
+
+	ends := PipeEnds{}
+	for _, pid := range pids {
+		if err := ctx.Err(); err != nil {
+			return ends, err
+		}
+
+		fn := filepath.Join(self.Dir(pid), "fd")
+
+		f, err := os.Open(fn)
+		if err != nil {
+			continue
+		}
+
+		names, _ := f.Readdirnames(0)
+		f.Close()
+
+		for _, name := range names {
+			dest, err := os.Readlink(filepath.Join(fn, name))
+			if err != nil {
+				continue
+			}
+
+			inode, present := wanted[dest]
+			if !present {
+				continue
+			}
+
+			end := PipeEnd{Pid: pid}
+			fmt.Sscan(name, &end.Fd)
+			if info, err := self.NewFdInfo(pid, end.Fd); err == nil {
+				end.Writable = info.Writable()
+			}
+
+			ends[inode] = append(ends[inode], end)
+		}
+	}
+
+	return ends, nil
+}
+
+// Peers returns the ends of the pipe inode held by processes other than pid,
+// restricted to the opposite end if writable is known.
+func (self PipeEnds) Peers(inode uint, pid int, writable *bool) []PipeEnd {
+	peers := []PipeEnd{}
+	for _, end := range self[inode] {
+		if end.Pid != pid && (writable == nil || end.Writable != *writable) {
+			peers = append(peers, end)
+		}
+	}
+
+	return peers
+}
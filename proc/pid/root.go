@@ -15,7 +15,12 @@ type Root string
 // Returns an error if resolving the symbolic link fails, usually caused by
 // the process's main thread having exited already.
 func NewRoot(pid int) (Root, error) {
-	fn := filepath.Join(Dir(pid), "root")
+	return DefaultFS.NewRoot(pid)
+}
+
+// NewRoot is like the package-level NewRoot but reads from the proc fs self.
+func (self FS) NewRoot(pid int) (Root, error) {
+	fn := filepath.Join(self.Dir(pid), "root")
 
 	if r, err := os.Readlink(fn); err != nil {
 		return "", errors.New(fmt.Sprintf("Failed to resolve symbolic link [%s]", err))
@@ -0,0 +1,174 @@
+package pid
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// sigRtMin is the first real-time signal as seen by the kernel. Note that
+// glibc reserves the first real-time signals for internal purposes.
+const sigRtMin = 32
+
+// signalNames maps the standard signals to their names, taken from ${KERNELSRC}/include/uapi/asm-generic/signal.h
+var signalNames = map[syscall.Signal]string{
+	1:  "SIGHUP",
+	2:  "SIGINT",
+	3:  "SIGQUIT",
+	4:  "SIGILL",
+	5:  "SIGTRAP",
+	6:  "SIGABRT",
+	7:  "SIGBUS",
+	8:  "SIGFPE",
+	9:  "SIGKILL",
+	10: "SIGUSR1",
+	11: "SIGSEGV",
+	12: "SIGUSR2",
+	13: "SIGPIPE",
+	14: "SIGALRM",
+	15: "SIGTERM",
+	16: "SIGSTKFLT",
+	17: "SIGCHLD",
+	18: "SIGCONT",
+	19: "SIGSTOP",
+	20: "SIGTSTP",
+	21: "SIGTTIN",
+	22: "SIGTTOU",
+	23: "SIGURG",
+	24: "SIGXCPU",
+	25: "SIGXFSZ",
+	26: "SIGVTALRM",
+	27: "SIGPROF",
+	28: "SIGWINCH",
+	29: "SIGIO",
+	30: "SIGPWR",
+	31: "SIGSYS",
+}
+
+// SignalName returns the name of sig, e.g., SIGSEGV. Real-time signals are
+// named relative to the kernel's SIGRTMIN, e.g., SIGRTMIN+2.
+func SignalName(sig syscall.Signal) string {
+	if name, present := signalNames[sig]; present {
+		return name
+	}
+
+	if sig == sigRtMin {
+		return "SIGRTMIN"
+	}
+
+	if sig > sigRtMin && sig <= 64 {
+		return fmt.Sprintf("SIGRTMIN+%d", sig-sigRtMin)
+	}
+
+	return fmt.Sprintf("SIG%d", int(sig))
+}
+
+// ParseSignalName returns the signal named name, the inverse of SignalName.
+//
+// Returns an error if name does not refer to a known signal.
+func ParseSignalName(name string) (syscall.Signal, error) {
+	for sig := syscall.Signal(1); sig <= 64; sig++ {
+		if SignalName(sig) == name {
+			return sig, nil
+		}
+	}
+
+	return 0, errors.New(fmt.Sprintf("Unknown signal %s", name))
+}
+
+// SignalSet is a bitmask of signals, where bit n-1 corresponds to signal n.
+// SignalSets are marshaled as lists of signal names.
+type SignalSet uint64
+
+// NewSignalSetFromHex parses a signal mask rendered in hexadecimal, as found in /proc/%{pid}/status.
+//
+// Returns an error if s is not a valid hexadecimal number.
+func NewSignalSetFromHex(s string) (SignalSet, error) {
+	v, err := strconv.ParseUint(strings.TrimSpace(s), 16, 64)
+	return SignalSet(v), err
+}
+
+// Has returns true if sig is contained in the set.
+func (self SignalSet) Has(sig syscall.Signal) bool {
+	return sig > 0 && sig <= 64 && self&(1<<uint(sig-1)) != 0
+}
+
+// Signals returns all signals contained in the set, in ascending order.
+func (self SignalSet) Signals() []syscall.Signal {
+	signals := []syscall.Signal{}
+	for sig := syscall.Signal(1); sig <= 64; sig++ {
+		if self.Has(sig) {
+			signals = append(signals, sig)
+		}
+	}
+
+	return signals
+}
+
+// String pretty prints the set as hexadecimal mask, as found in /proc/%{pid}/status.
+func (self SignalSet) String() string {
+	return fmt.Sprintf("%016x", uint64(self))
+}
+
+// Names returns the names of all signals contained in the set, in ascending order.
+func (self SignalSet) Names() []string {
+	names := []string{}
+	for _, sig := range self.Signals() {
+		names = append(names, SignalName(sig))
+	}
+
+	return names
+}
+
+// NewSignalSetFromNames returns the set containing the signals listed in names.
+//
+// Returns an error if a name does not refer to a known signal.
+func NewSignalSetFromNames(names []string) (SignalSet, error) {
+	set := SignalSet(0)
+	for _, name := range names {
+		sig, err := ParseSignalName(name)
+		if err != nil {
+			return 0, err
+		}
+		set |= 1 << uint(sig-1)
+	}
+
+	return set, nil
+}
+
+// MarshalYAML encodes the set as list of signal names.
+func (self SignalSet) MarshalYAML() (interface{}, error) {
+	return self.Names(), nil
+}
+
+// UnmarshalYAML decodes the set from a list of signal names.
+func (self *SignalSet) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	names := []string{}
+	if err := unmarshal(&names); err != nil {
+		return err
+	}
+
+	set, err := NewSignalSetFromNames(names)
+	*self = set
+	return err
+}
+
+// MarshalJSON encodes the set as list of signal names.
+func (self SignalSet) MarshalJSON() ([]byte, error) {
+	return json.Marshal(self.Names())
+}
+
+// UnmarshalJSON decodes the set from a list of signal names.
+func (self *SignalSet) UnmarshalJSON(b []byte) error {
+	names := []string{}
+	if err := json.Unmarshal(b, &names); err != nil {
+		return err
+	}
+
+	set, err := NewSignalSetFromNames(names)
+	*self = set
+	return err
+}
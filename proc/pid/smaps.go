@@ -0,0 +1,249 @@
+package pid
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Backings of memory regions not backed by a file.
+const (
+	BackingAnonymous = "[anon]"  // Anonymous memory, e.g., allocated with mmap
+	BackingHeap      = "[heap]"  // The heap of the process
+	BackingStack     = "[stack]" // The stack of the main thread
+)
+
+// MemoryUsage accounts for the memory of one or more memory regions, in bytes.
+type MemoryUsage struct {
+	Size          uint64 // Size of the mapped regions
+	Rss           uint64 // Resident set size
+	Pss           uint64 // Proportional set size, i.e., resident memory divided by the number of processes sharing it
+	SharedClean   uint64 // Clean resident pages shared with other processes
+	SharedDirty   uint64 // Dirty resident pages shared with other processes
+	PrivateClean  uint64 // Clean resident pages private to the process
+	PrivateDirty  uint64 // Dirty resident pages private to the process
+	Referenced    uint64 // Memory currently marked as referenced or accessed
+	Anonymous     uint64 // Memory not belonging to any file
+	Swap          uint64 // Anonymous memory swapped out
+	SwapPss       uint64 // Proportional swap size
+	AnonHugePages uint64 // Anonymous memory backed by transparent huge pages
+	Locked        uint64 // Memory locked into RAM
+}
+
+// Add accounts the memory of other to self.
+func (self *MemoryUsage) Add(other MemoryUsage) {
+	self.Size += other.Size
+	self.Rss += other.Rss
+	self.Pss += other.Pss
+	self.SharedClean += other.SharedClean
+	self.SharedDirty += other.SharedDirty
+	self.PrivateClean += other.PrivateClean
+	self.PrivateDirty += other.PrivateDirty
+	self.Referenced += other.Referenced
+	self.Anonymous += other.Anonymous
+	self.Swap += other.Swap
+	self.SwapPss += other.SwapPss
+	self.AnonHugePages += other.AnonHugePages
+	self.Locked += other.Locked
+}
+
+// fields returns pointers to all sizes in usage, keyed by their names in /proc/%{pid}/smaps.
+func (self *MemoryUsage) fields() map[string]*uint64 {
+	return map[string]*uint64{
+		"Size":          &self.Size,
+		"Rss":           &self.Rss,
+		"Pss":           &self.Pss,
+		"Shared_Clean":  &self.SharedClean,
+		"Shared_Dirty":  &self.SharedDirty,
+		"Private_Clean": &self.PrivateClean,
+		"Private_Dirty": &self.PrivateDirty,
+		"Referenced":    &self.Referenced,
+		"Anonymous":     &self.Anonymous,
+		"Swap":          &self.Swap,
+		"SwapPss":       &self.SwapPss,
+		"AnonHugePages": &self.AnonHugePages,
+		"Locked":        &self.Locked,
+	}
+}
+
+// NewSmaps reads the memory mappings together with their memory usage from /proc/%{pid}/smaps.
+//
+// Returns an error if opening /proc/%{pid}/smaps or parsing an individual value fails.
+func NewSmaps(pid int) (Maps, error) {
+	return DefaultFS.NewSmaps(pid)
+}
+
+// NewSmaps is like the package-level NewSmaps but reads from the proc fs self.
+func (self FS) NewSmaps(pid int) (Maps, error) {
+	fn := filepath.Join(self.Dir(pid), "smaps")
+
+	f, err := os.Open(fn)
+
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to read %s [%s]", fn, err))
+	}
+
+	defer f.Close()
+
+	return NewSmapsFromReader(f)
+}
+
+// NewSmapsFromReader parses memory mappings together with their memory usage from reader.
+//
+// Returns an error if parsing an individual value fails.
+func NewSmapsFromReader(reader io.Reader) (Maps, error) {
+	maps := Maps{}
+	scanner := bufio.NewScanner(reader)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		// Lines describing a region start with its address range, all other lines are "key: value" pairs.
+		kv := strings.SplitN(line, ":", 2)
+		if len(kv) != 2 || strings.ContainsAny(kv[0], " -") {
+			if mr, ok := parseMemoryRegion(line); ok {
+				maps = append(maps, mr)
+			}
+			continue
+		}
+
+		if len(maps) == 0 {
+			continue
+		}
+
+		mr := &maps[len(maps)-1]
+		key, value := kv[0], strings.TrimSpace(kv[1])
+
+		if key == "VmFlags" {
+			mr.VmFlags = strings.Fields(value)
+		} else if size, present := mr.Usage.fields()[key]; present {
+			v, err := parseSize(value)
+			if err != nil {
+				return nil, errors.New(fmt.Sprintf("Failed to parse field %s [%v]", key, err))
+			}
+			*size = v
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return maps, nil
+}
+
+// NewSmapsRollup reads the memory usage summed up over all memory mappings
+// from /proc/%{pid}/smaps_rollup, which is considerably cheaper than reading
+// /proc/%{pid}/smaps. Available since Linux 4.14.
+//
+// Returns an error if opening /proc/%{pid}/smaps_rollup or parsing an individual value fails.
+func NewSmapsRollup(pid int) (*MemoryUsage, error) {
+	return DefaultFS.NewSmapsRollup(pid)
+}
+
+// NewSmapsRollup is like the package-level NewSmapsRollup but reads from the proc fs self.
+func (self FS) NewSmapsRollup(pid int) (*MemoryUsage, error) {
+	fn := filepath.Join(self.Dir(pid), "smaps_rollup")
+
+	f, err := os.Open(fn)
+
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to read %s [%s]", fn, err))
+	}
+
+	defer f.Close()
+
+	return NewSmapsRollupFromReader(f)
+}
+
+// NewSmapsRollupFromReader parses a memory usage summary from reader.
+//
+// Returns an error if parsing an individual value fails or if reader does not contain a summary.
+func NewSmapsRollupFromReader(reader io.Reader) (*MemoryUsage, error) {
+	maps, err := NewSmapsFromReader(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(maps) != 1 {
+		return nil, errors.New("Failed to find memory usage summary")
+	}
+
+	return &maps[0].Usage, nil
+}
+
+// Backing returns the file backing the region, or one of BackingAnonymous,
+// BackingHeap, BackingStack or the kernel's name for other special regions.
+func (self MemoryRegion) Backing() string {
+	switch {
+	case len(self.Path) == 0:
+		return BackingAnonymous
+	case strings.HasPrefix(self.Path, "[stack"):
+		return BackingStack
+	}
+
+	return self.Path
+}
+
+// Usage returns the memory usage summed up over all regions.
+func (self Maps) Usage() MemoryUsage {
+	total := MemoryUsage{}
+	for _, mr := range self {
+		total.Add(mr.Usage)
+	}
+
+	return total
+}
+
+// UsageByBacking returns the memory usage of all regions, summed up by their backing.
+func (self Maps) UsageByBacking() map[string]MemoryUsage {
+	usage := map[string]MemoryUsage{}
+	for _, mr := range self {
+		u := usage[mr.Backing()]
+		u.Add(mr.Usage)
+		usage[mr.Backing()] = u
+	}
+
+	return usage
+}
+
+// BackingUsage describes the memory usage of all regions sharing a backing.
+type BackingUsage struct {
+	Backing string      // The file backing the regions or a special backing like BackingHeap
+	Usage   MemoryUsage // Memory usage summed up over all regions
+}
+
+// byUsage orders BackingUsage instances by their proportional set size and swap usage, largest first.
+type byUsage []BackingUsage
+
+func (self byUsage) Len() int      { return len(self) }
+func (self byUsage) Swap(i, j int) { self[i], self[j] = self[j], self[i] }
+func (self byUsage) Less(i, j int) bool {
+	si, sj := self[i].Usage.Pss+self[i].Usage.SwapPss, self[j].Usage.Pss+self[j].Usage.SwapPss
+	if si != sj {
+		return si > sj
+	}
+	return self[i].Backing < self[j].Backing
+}
+
+// TopUsage returns the n backings accounting for the most memory, ordered by
+// their proportional set size and swap usage, largest first.
+func (self Maps) TopUsage(n int) []BackingUsage {
+	top := byUsage{}
+	for backing, usage := range self.UsageByBacking() {
+		top = append(top, BackingUsage{backing, usage})
+	}
+
+	sort.Sort(top)
+
+	if len(top) > n {
+		top = top[:n]
+	}
+
+	return top
+}
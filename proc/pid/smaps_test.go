@@ -0,0 +1,92 @@
+package pid
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testSmaps = `00400000-00754000 r-xp 00000000 08:02 404368                             /usr/bin/python3.4
+Size:               3408 kB
+Rss:                2048 kB
+Pss:                1024 kB
+Shared_Clean:       2048 kB
+Shared_Dirty:          0 kB
+Private_Clean:         0 kB
+Private_Dirty:         0 kB
+Referenced:         2048 kB
+Anonymous:             0 kB
+AnonHugePages:         0 kB
+Swap:                  0 kB
+SwapPss:               0 kB
+Locked:                0 kB
+THPeligible:    0
+VmFlags: rd ex mr mw me dw
+011c0000-01492000 rw-p 00000000 00:00 0                                  [heap]
+Size:               2888 kB
+Rss:                2800 kB
+Pss:                2800 kB
+Private_Dirty:      2800 kB
+Anonymous:          2800 kB
+Swap:                 64 kB
+SwapPss:              64 kB
+VmFlags: rd wr mr mw me ac
+7f8ac75f3000-7f8ac7673000 rw-p 00000000 00:00 0
+Size:                512 kB
+Rss:                 128 kB
+Pss:                 128 kB
+Anonymous:           128 kB
+VmFlags: rd wr mr mw me ac
+7f8ac7673000-7f8ac7694000 r-xp 00000000 fd:01 661266                     /lib/x86_64-linux-gnu/liblzma.so.5.0.0
+Size:                132 kB
+Rss:                 132 kB
+Pss:                  12 kB
+VmFlags: rd ex mr mw me
+7f8ac7894000-7f8ac7895000 rw-p 00021000 fd:01 661266                     /lib/x86_64-linux-gnu/liblzma.so.5.0.0
+Size:                  4 kB
+Rss:                   4 kB
+Pss:                   4 kB
+Private_Dirty:         4 kB
+VmFlags: rd wr mr mw me ac
+`
+
+func TestNewSmapsFromReaderParsesRegionsAndUsage(t *testing.T) {
+	maps, err := NewSmapsFromReader(strings.NewReader(testSmaps))
+	assert.Nil(t, err)
+	assert.Equal(t, 5, len(maps))
+
+	assert.Equal(t, "/usr/bin/python3.4", maps[0].Path)
+	assert.Equal(t, uint64(1024*1024), maps[0].Usage.Pss)
+	assert.Equal(t, uint64(2048*1024), maps[0].Usage.SharedClean)
+	assert.Equal(t, []string{"rd", "ex", "mr", "mw", "me", "dw"}, maps[0].VmFlags)
+	assert.Equal(t, uint64(64*1024), maps[1].Usage.Swap)
+}
+
+func TestMapsAggregateUsageByBacking(t *testing.T) {
+	maps, _ := NewSmapsFromReader(strings.NewReader(testSmaps))
+
+	assert.Equal(t, uint64((2048+2800+128+132+4)*1024), maps.Usage().Rss)
+
+	usage := maps.UsageByBacking()
+	assert.Equal(t, 4, len(usage))
+	assert.Equal(t, uint64(16*1024), usage["/lib/x86_64-linux-gnu/liblzma.so.5.0.0"].Pss)
+	assert.Equal(t, uint64(128*1024), usage[BackingAnonymous].Rss)
+
+	top := maps.TopUsage(2)
+	assert.Equal(t, 2, len(top))
+	assert.Equal(t, BackingHeap, top[0].Backing)
+	assert.Equal(t, "/usr/bin/python3.4", top[1].Backing)
+}
+
+func TestNewSmapsRollupFromReaderReturnsSummary(t *testing.T) {
+	rollup := "00400000-7ffc5a5fe000 ---p 00000000 00:00 0                          [rollup]\nRss:                5112 kB\nPss:                3968 kB\n"
+
+	usage, err := NewSmapsRollupFromReader(strings.NewReader(rollup))
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(5112*1024), usage.Rss)
+	assert.Equal(t, uint64(3968*1024), usage.Pss)
+
+	_, err = NewSmapsRollupFromReader(strings.NewReader(testSmaps))
+	assert.NotNil(t, err)
+}
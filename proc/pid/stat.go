@@ -1,15 +1,36 @@
 package pid
 
+// #include <unistd.h>
+import "C"
+
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"reflect"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// ClockTicks is the number of clock ticks per second, the unit of times reported in /proc/%{pid}/stat.
+var ClockTicks = int64(C.sysconf(C._SC_CLK_TCK))
+
+// ticksToDuration converts ticks, measured in clock ticks, to a duration.
+func ticksToDuration(ticks time.Duration) time.Duration {
+	if ClockTicks <= 0 {
+		return ticks
+	}
+
+	return ticks * (time.Second / time.Duration(ClockTicks))
+}
+
 // Flags is a bitfield holding process flags.
+// Flags are marshaled as lists of flag names.
 type Flags uint
 
 // Taken from ${KERNELSRC}/include/linux/sched.h
@@ -43,6 +64,209 @@ const (
 	PF_SUSPEND_TASK   = 0x80000000 // this thread called freeze_processes and should not be frozen
 )
 
+// flagNames maps the known flags to their names, in ascending order.
+var flagNames = []struct {
+	Flag Flags
+	Name string
+}{
+	{PF_EXITING, "PF_EXITING"},
+	{PF_EXITPIDONE, "PF_EXITPIDONE"},
+	{PF_VCPU, "PF_VCPU"},
+	{PF_WQ_WORKER, "PF_WQ_WORKER"},
+	{PF_FORKNOEXEC, "PF_FORKNOEXEC"},
+	{PF_MCE_PROCESS, "PF_MCE_PROCESS"},
+	{PF_SUPERPRIV, "PF_SUPERPRIV"},
+	{PF_DUMPCORE, "PF_DUMPCORE"},
+	{PF_SIGNALED, "PF_SIGNALED"},
+	{PF_MEMALLOC, "PF_MEMALLOC"},
+	{PF_NPROC_EXCEEDED, "PF_NPROC_EXCEEDED"},
+	{PF_USED_MATH, "PF_USED_MATH"},
+	{PF_USED_ASYNC, "PF_USED_ASYNC"},
+	{PF_NOFREEZE, "PF_NOFREEZE"},
+	{PF_FROZEN, "PF_FROZEN"},
+	{PF_FSTRANS, "PF_FSTRANS"},
+	{PF_KSWAPD, "PF_KSWAPD"},
+	{PF_MEMALLOC_NOIO, "PF_MEMALLOC_NOIO"},
+	{PF_LESS_THROTTLE, "PF_LESS_THROTTLE"},
+	{PF_KTHREAD, "PF_KTHREAD"},
+	{PF_RANDOMIZE, "PF_RANDOMIZE"},
+	{PF_SWAPWRITE, "PF_SWAPWRITE"},
+	{PF_NO_SETAFFINITY, "PF_NO_SETAFFINITY"},
+	{PF_MCE_EARLY, "PF_MCE_EARLY"},
+	{PF_MUTEX_TESTER, "PF_MUTEX_TESTER"},
+	{PF_FREEZER_SKIP, "PF_FREEZER_SKIP"},
+	{PF_SUSPEND_TASK, "PF_SUSPEND_TASK"},
+}
+
+// Names returns the names of all flags set in self. Unknown flags are rendered in hexadecimal.
+func (self Flags) Names() []string {
+	names := []string{}
+	rest := self
+
+	for _, fn := range flagNames {
+		if self&fn.Flag != 0 {
+			names = append(names, fn.Name)
+			rest &^= fn.Flag
+		}
+	}
+
+	for bit := Flags(1); rest != 0; bit <<= 1 {
+		if rest&bit != 0 {
+			names = append(names, fmt.Sprintf("0x%08x", uint(bit)))
+			rest &^= bit
+		}
+	}
+
+	return names
+}
+
+// NewFlagsFromNames returns the flags listed in names, the inverse of Flags.Names.
+//
+// Returns an error if a name does not refer to a known flag.
+func NewFlagsFromNames(names []string) (Flags, error) {
+	flags := Flags(0)
+
+next:
+	for _, name := range names {
+		for _, fn := range flagNames {
+			if fn.Name == name {
+				flags |= fn.Flag
+				continue next
+			}
+		}
+
+		v, err := strconv.ParseUint(name, 0, 32)
+		if err != nil {
+			return 0, errors.New(fmt.Sprintf("Unknown flag %s", name))
+		}
+		flags |= Flags(v)
+	}
+
+	return flags, nil
+}
+
+// String pretty prints a Flags instance.
+func (self Flags) String() string {
+	return "[" + strings.Join(self.Names(), " ") + "]"
+}
+
+// MarshalYAML encodes the flags as list of flag names.
+func (self Flags) MarshalYAML() (interface{}, error) {
+	return self.Names(), nil
+}
+
+// UnmarshalYAML decodes the flags from a list of flag names.
+func (self *Flags) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	names := []string{}
+	if err := unmarshal(&names); err != nil {
+		return err
+	}
+
+	flags, err := NewFlagsFromNames(names)
+	*self = flags
+	return err
+}
+
+// MarshalJSON encodes the flags as list of flag names.
+func (self Flags) MarshalJSON() ([]byte, error) {
+	return json.Marshal(self.Names())
+}
+
+// UnmarshalJSON decodes the flags from a list of flag names.
+func (self *Flags) UnmarshalJSON(b []byte) error {
+	names := []string{}
+	if err := json.Unmarshal(b, &names); err != nil {
+		return err
+	}
+
+	flags, err := NewFlagsFromNames(names)
+	*self = flags
+	return err
+}
+
+// SchedPolicy describes the scheduling policy of a process.
+// Policies are marshaled by name.
+type SchedPolicy uint
+
+// Taken from ${KERNELSRC}/include/uapi/linux/sched.h
+const (
+	SCHED_OTHER    SchedPolicy = 0
+	SCHED_FIFO     SchedPolicy = 1
+	SCHED_RR       SchedPolicy = 2
+	SCHED_BATCH    SchedPolicy = 3
+	SCHED_IDLE     SchedPolicy = 5
+	SCHED_DEADLINE SchedPolicy = 6
+)
+
+var schedPolicyNames = map[SchedPolicy]string{
+	SCHED_OTHER:    "SCHED_OTHER",
+	SCHED_FIFO:     "SCHED_FIFO",
+	SCHED_RR:       "SCHED_RR",
+	SCHED_BATCH:    "SCHED_BATCH",
+	SCHED_IDLE:     "SCHED_IDLE",
+	SCHED_DEADLINE: "SCHED_DEADLINE",
+}
+
+// String pretty prints a SchedPolicy instance.
+func (self SchedPolicy) String() string {
+	if name, present := schedPolicyNames[self]; present {
+		return name
+	}
+
+	return fmt.Sprintf("SCHED_%d", uint(self))
+}
+
+// NewSchedPolicyFromName returns the policy named name, the inverse of SchedPolicy.String.
+//
+// Returns an error if name does not refer to a known policy.
+func NewSchedPolicyFromName(name string) (SchedPolicy, error) {
+	for policy, n := range schedPolicyNames {
+		if n == name {
+			return policy, nil
+		}
+	}
+
+	if v, err := strconv.ParseUint(strings.TrimPrefix(name, "SCHED_"), 10, 32); err == nil {
+		return SchedPolicy(v), nil
+	}
+
+	return 0, errors.New(fmt.Sprintf("Unknown scheduling policy %s", name))
+}
+
+// MarshalYAML encodes the policy by name.
+func (self SchedPolicy) MarshalYAML() (interface{}, error) {
+	return self.String(), nil
+}
+
+// UnmarshalYAML decodes the policy from its name.
+func (self *SchedPolicy) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	name := ""
+	if err := unmarshal(&name); err != nil {
+		return err
+	}
+
+	policy, err := NewSchedPolicyFromName(name)
+	*self = policy
+	return err
+}
+
+// MarshalJSON encodes the policy by name.
+func (self SchedPolicy) MarshalJSON() ([]byte, error) {
+	return json.Marshal(self.String())
+}
+
+// UnmarshalJSON decodes the policy from its name.
+func (self *SchedPolicy) UnmarshalJSON(b []byte) error {
+	name := ""
+	if err := json.Unmarshal(b, &name); err != nil {
+		return err
+	}
+
+	policy, err := NewSchedPolicyFromName(name)
+	*self = policy
+	return err
+}
+
 // State describes the state of a process
 //
 // Known values are presented in constants, taken from ${KERNELSRC}/fs/proc/array.c
@@ -82,57 +306,82 @@ const (
 
 // Stat provides status information about the process as used by ps(1)
 type Stat struct {
-	Pid                 int    // The process id
-	Comm                string // Filename of the executable in parentheses
-	State               State  // State of the process
-	Ppid                int    // The PID of the parent process
-	Pgrp                int    // The process group ID of the process
-	Session             int    // The session ID of the process
-	TtyNr               int    // Controlling terminal of the process
-	Tpgid               int    // ID of the foreground process of the controlling tmerinal of the process
-	Flags               Flags  // Kernel flags word of the process
-	Minflt              uint   // Number of minor faults the process has made which have not required loading a memory page from disk
-	Cminflt             uint   // Number of minor faults that the process's waited-for children have made
-	Majflt              uint   // Number of major faults that the process's waited-for children have made
-	Cmajflt             uint   // Number of major faults that process's waited-for children have made
-	Utime               uint   // Amount of time that this process has been scheduled in user mode, in clock ticks
-	Stime               uint   // Amount of time that this process has been scheduled in kernel mode, in clock ticks
-	Cutime              int    // Amount of time that this process's waited-for children have been scheduled in kernel mode, in clock ticks
-	Cstime              int    // Amount of time that this process's waited-for children have been scheduled in kernel mode, in clock ticks
-	Priority            int    // Raw nice value as represented in the kernel or negated scheduling priority, minus one, for processes running a real-time scheduling policy
-	Nice                int    // The nice value, in the range 19 (low priority) to -20 (high priority)
-	NumThreads          int    // Number of threads in this process
-	Itrealvalue         uint   // Time in jiffies before the next SIGALRM is sent to the process due to an interval timer
-	StartTime           uint   // Time the process started after system boot.
-	Vsize               uint   // Virtual memory size in bytes
-	Rss                 uint   // Resident set size, number of pages the process has in real memory
-	RssLim              uint   // Current soft limit in bytes on the rss of the process
-	StartCode           uint   // Address above which program text can run
-	EndCode             uint   // Address below which program text can run
-	StartStack          uint   // Address of the start (i.e. bottom) of the stack
-	Kstkesp             uint   // Current value of ESP (stack pointer), as found in the kernel stack page for the process
-	Kstkeip             uint   // The current EIP (instruction pointer)
-	Signal              uint   // The bitmap of pending signals, displayed as a decimal number.
-	Blocked             uint   // The bitmap of blocked signals, displayed as a decimal number.
-	SigIgnore           uint   // The bitmap of ignored signals, displayed as a decimal number.
-	SigCatch            uint   // The bitmap of caught signals, displayed as a decimal number.
-	Wchan               uint   // The channel in which the process is waiting, where channel is the address of a system call.
-	Nswap               uint   // Number of pages swapped.
-	Cnswap              uint   // Cumulative nswap for child processes
-	ExitSignal          int    // Signal to be sent to parent when we die
-	Processor           int    // CPU number last executed on
-	RtPriority          uint   // Real-time scheduling priority, in the range 1-99 for processes scheduled under a real-time policy, or 0, for non-real-time processes
-	Policy              uint   // Scheduling policy
-	DelayacctBlkioTicks uint   // Aggregated block I/O delays, measured in ticks
-	GuestTime           uint   // Guest time of the process (time spent running a virtual CPU for a gust OS), in clock ticks
-	CguestTime          int    // Guest time of the process's children, measured in clock ticks
+	Pid                 int           // The process id
+	Comm                string        // Filename of the executable, without the surrounding parentheses
+	State               State         // State of the process
+	Ppid                int           // The PID of the parent process
+	Pgrp                int           // The process group ID of the process
+	Session             int           // The session ID of the process
+	TtyNr               int           // Controlling terminal of the process
+	Tpgid               int           // ID of the foreground process of the controlling tmerinal of the process
+	Flags               Flags         // Kernel flags word of the process
+	Minflt              uint          // Number of minor faults the process has made which have not required loading a memory page from disk
+	Cminflt             uint          // Number of minor faults that the process's waited-for children have made
+	Majflt              uint          // Number of major faults that the process's waited-for children have made
+	Cmajflt             uint          // Number of major faults that process's waited-for children have made
+	Utime               time.Duration // Amount of time that this process has been scheduled in user mode
+	Stime               time.Duration // Amount of time that this process has been scheduled in kernel mode
+	Cutime              time.Duration // Amount of time that this process's waited-for children have been scheduled in user mode
+	Cstime              time.Duration // Amount of time that this process's waited-for children have been scheduled in kernel mode
+	Priority            int           // Raw nice value as represented in the kernel or negated scheduling priority, minus one, for processes running a real-time scheduling policy
+	Nice                int           // The nice value, in the range 19 (low priority) to -20 (high priority)
+	NumThreads          int           // Number of threads in this process
+	Itrealvalue         uint          // Time in jiffies before the next SIGALRM is sent to the process due to an interval timer
+	StartTime           time.Duration // Time the process started after system boot, see Started for the wall-clock time
+	Vsize               uint          // Virtual memory size in bytes
+	Rss                 uint          // Resident set size, number of pages the process has in real memory
+	RssLim              uint          // Current soft limit in bytes on the rss of the process
+	StartCode           uint          // Address above which program text can run
+	EndCode             uint          // Address below which program text can run
+	StartStack          uint          // Address of the start (i.e. bottom) of the stack
+	Kstkesp             uint          // Current value of ESP (stack pointer), as found in the kernel stack page for the process
+	Kstkeip             uint          // The current EIP (instruction pointer)
+	Signal              SignalSet     // Pending signals
+	Blocked             SignalSet     // Blocked signals
+	SigIgnore           SignalSet     // Ignored signals
+	SigCatch            SignalSet     // Caught signals
+	Wchan               uint          // The channel in which the process is waiting, where channel is the address of a system call.
+	Nswap               uint          // Number of pages swapped.
+	Cnswap              uint          // Cumulative nswap for child processes
+	ExitSignal          int           // Signal to be sent to parent when we die
+	Processor           int           // CPU number last executed on
+	RtPriority          uint          // Real-time scheduling priority, in the range 1-99 for processes scheduled under a real-time policy, or 0, for non-real-time processes
+	Policy              SchedPolicy   // Scheduling policy
+	DelayacctBlkioTicks time.Duration // Aggregated block I/O delays
+	GuestTime           time.Duration // Guest time of the process (time spent running a virtual CPU for a gust OS)
+	CguestTime          time.Duration // Guest time of the process's children
+	StartData           uint          // Address above which program initialized and uninitialized data are placed, since Linux 3.3
+	EndData             uint          // Address below which program initialized and uninitialized data are placed, since Linux 3.3
+	StartBrk            uint          // Address above which program heap can be expanded with brk, since Linux 3.3
+	ArgStart            uint          // Address above which program command-line arguments are placed, since Linux 3.5
+	ArgEnd              uint          // Address below which program command-line arguments are placed, since Linux 3.5
+	EnvStart            uint          // Address above which the program environment is placed, since Linux 3.5
+	EnvEnd              uint          // Address below which the program environment is placed, since Linux 3.5
+	ExitCode            int           // The thread's exit status as reported by waitpid, since Linux 3.5
+
+	Extra []string `yaml:",omitempty"` // Trailing fields reported by newer kernels but not known to Stat, kept verbatim
+}
+
+// statRequiredFields is the number of leading fields of /proc/%{pid}/stat
+// reported by all supported kernels, up to and including Policy. All later
+// fields have been added over time and are left at their zero value if missing.
+const statRequiredFields = 41
+
+// Started returns the wall-clock time the process started at, given the boot time of the system.
+func (self Stat) Started(boot time.Time) time.Time {
+	return boot.Add(self.StartTime)
 }
 
 // NewStat reads /proc/%{pid}/stat into a Stat instance.
 //
 // Returns an error if opening /proc/%{pid}/stat or parsing an individual value fails.
 func NewStat(pid int) (*Stat, error) {
-	fn := filepath.Join(Dir(pid), "stat")
+	return DefaultFS.NewStat(pid)
+}
+
+// NewStat is like the package-level NewStat but reads from the proc fs self.
+func (self FS) NewStat(pid int) (*Stat, error) {
+	fn := filepath.Join(self.Dir(pid), "stat")
 
 	f, err := os.Open(fn)
 
@@ -145,31 +394,83 @@ func NewStat(pid int) (*Stat, error) {
 	return NewStatFromReader(f)
 }
 
+// setStatField decodes value into field, relying on the kind of field.
+func setStatField(field reflect.Value, value string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetUint(u)
+	default:
+		return errors.New(fmt.Sprintf("Unsupported kind %s", field.Kind()))
+	}
+
+	return nil
+}
+
 // NewStatFromReader parses a Stat instance from the given reader.
 //
-// Returns an error if parsing an individual value fails.
+// comm is delimited by the first '(' and the last ')', such that names
+// containing spaces or parentheses are handled correctly. All other fields
+// are mapped by their position. Fields missing on older kernels are left at
+// their zero value, fields not known to Stat are kept in Extra.
+//
+// Returns an error if required fields are missing or if parsing an individual value fails.
 func NewStatFromReader(reader io.Reader) (*Stat, error) {
+	b, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	line := strings.TrimSpace(string(b))
+	begin, end := strings.Index(line, "("), strings.LastIndex(line, ")")
+	if begin < 0 || end < begin {
+		return nil, errors.New("Failed to parse field Comm [missing parentheses]")
+	}
+
+	values := append([]string{strings.TrimSpace(line[:begin]), line[begin+1 : end]}, strings.Fields(line[end+1:])...)
+
 	stat := Stat{}
 
 	// We rely on reflection to step through the individual elements
-	// of Stat and scan them from reader one by one. Fortunately, Fscan is
-	// clever enough to do the right thing for numerical integer values.
+	// of Stat, mapping them to the values by position.
 	v := reflect.ValueOf(&stat).Elem()
 
 	// We need the type later on to provide a rich error message in case
-	// scanning an individual value fails.
+	// parsing an individual value fails.
 	t := reflect.TypeOf(stat)
 
-	// TODO(tvoss): Right now, we iterate over all fields in the struct, failing if any of those fails to be scanned
-	// We might want to consider member annotations in the future to handle
-	// optional values.
-	for i := 0; i < v.NumField(); i++ {
-		// We need a pointer to the field for passing it to Fscan.
-		field := v.Field(i).Addr()
-		if _, err := fmt.Fscan(reader, field.Interface()); err != nil {
+	// Extra is the last field and not reported by the kernel.
+	known := v.NumField() - 1
+
+	if len(values) < statRequiredFields {
+		return nil, errors.New(fmt.Sprintf("Failed to parse field %s [missing]", t.Field(len(values)).Name))
+	}
+
+	for i := 0; i < known && i < len(values); i++ {
+		if err := setStatField(v.Field(i), values[i]); err != nil {
 			return nil, errors.New(fmt.Sprintf("Failed to parse field %s [%v]", t.Field(i).Name, err))
 		}
 	}
 
+	if len(values) > known {
+		stat.Extra = values[known:]
+	}
+
+	// Times are reported in clock ticks.
+	for _, d := range []*time.Duration{&stat.Utime, &stat.Stime, &stat.Cutime, &stat.Cstime, &stat.StartTime, &stat.DelayacctBlkioTicks, &stat.GuestTime, &stat.CguestTime} {
+		*d = ticksToDuration(*d)
+	}
+
 	return &stat, nil
 }
@@ -0,0 +1,133 @@
+package pid
+
+import (
+	"encoding/json"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+)
+
+const testStat = "1042 (python3.4) S 1 1042 1042 0 -1 4194368 2338 0 0 0 150 25 0 0 20 0 2 0 4200 241848320 4960 18446744073709551615 4194304 7681608 140728129287696 0 0 0 0 16781312 16386 0 0 0 17 3 0 0 0 0 0"
+
+func TestNewStatFromReaderConvertsTimes(t *testing.T) {
+	stat, err := NewStatFromReader(strings.NewReader(testStat))
+	assert.Nil(t, err)
+
+	tick := time.Second / time.Duration(ClockTicks)
+	assert.Equal(t, 150*tick, stat.Utime)
+	assert.Equal(t, 25*tick, stat.Stime)
+	assert.Equal(t, 4200*tick, stat.StartTime)
+
+	boot := time.Date(2015, time.September, 4, 7, 0, 0, 0, time.UTC)
+	assert.Equal(t, boot.Add(4200*tick), stat.Started(boot))
+}
+
+func TestNewStatFromReaderDecodesSignalsFlagsAndPolicy(t *testing.T) {
+	stat, err := NewStatFromReader(strings.NewReader(testStat))
+	assert.Nil(t, err)
+
+	assert.Equal(t, []syscall.Signal{syscall.SIGINT, syscall.SIGTERM}, stat.SigCatch.Signals())
+	assert.Equal(t, []string{"SIGPIPE", "SIGXFSZ"}, stat.SigIgnore.Names())
+	assert.Equal(t, []string{"PF_FORKNOEXEC", "PF_RANDOMIZE"}, stat.Flags.Names())
+	assert.Equal(t, SCHED_OTHER, stat.Policy)
+}
+
+func TestStatTypesMarshalByName(t *testing.T) {
+	v := struct {
+		Flags  Flags
+		Set    SignalSet
+		Policy SchedPolicy
+	}{PF_DUMPCORE | PF_SIGNALED | 0x02, SignalSet(1<<1 | 1<<14 | 1<<33), SCHED_FIFO}
+
+	b, err := yaml.Marshal(v)
+	assert.Nil(t, err)
+	assert.Equal(t, "flags:\n- PF_DUMPCORE\n- PF_SIGNALED\n- \"0x00000002\"\nset:\n- SIGINT\n- SIGTERM\n- SIGRTMIN+2\npolicy: SCHED_FIFO\n", string(b))
+
+	w := v
+	w.Flags, w.Set, w.Policy = 0, 0, 0
+	assert.Nil(t, yaml.Unmarshal(b, &w))
+	assert.Equal(t, v, w)
+
+	b, err = json.Marshal(v)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"Flags":["PF_DUMPCORE","PF_SIGNALED","0x00000002"],"Set":["SIGINT","SIGTERM","SIGRTMIN+2"],"Policy":"SCHED_FIFO"}`, string(b))
+
+	w.Flags, w.Set, w.Policy = 0, 0, 0
+	assert.Nil(t, json.Unmarshal(b, &w))
+	assert.Equal(t, v, w)
+}
+
+func TestNewStatFromReaderHandlesKernelVersionsAndOddNames(t *testing.T) {
+	tick := time.Second / time.Duration(ClockTicks)
+
+	cases := []struct {
+		Kernel   string
+		Line     string
+		Comm     string
+		Delay    time.Duration
+		ArgStart uint
+		ExitCode int
+		Extra    []string
+	}{
+		{
+			"2.6.16, no delay accounting",
+			"1 (init) S 0 1 1 0 -1 4194560 3286 1062797 17 1138 3 183 22187 6813 16 0 1 0 1 1626112 141 4294967295 134512640 134544360 3219377616 3219376316 4294960144 0 0 1475401980 671819267 0 0 0 0 0 0 0",
+			"init", 0, 0, 0, nil,
+		},
+		{
+			"2.6.32, no data and argument addresses",
+			"1 (init) S 0 1 1 0 -1 4202752 3286 1062797 17 1138 3 183 22187 6813 20 0 1 0 1 24371200 423 18446744073709551615 1 1 0 0 0 0 0 4096 536962595 18446744073709551615 0 0 17 0 0 0 12 0 0",
+			"init", 12 * tick, 0, 0, nil,
+		},
+		{
+			"3.13, all fields",
+			"2337 (gnome-shell) S 2206 2206 2206 0 -1 4202496 1088203 4567 12 0 102830 14102 0 0 20 0 13 0 2896 1673592832 55498 18446744073709551615 4194304 4210852 140734506163136 140734506162656 139829347690013 0 0 16781312 82431 0 0 0 17 1 0 0 184 0 0 6311440 6312960 37199872 140734506164997 140734506165019 140734506165019 140734506168278 0",
+			"gnome-shell", 184 * tick, 140734506164997, 0, nil,
+		},
+		{
+			"5.15, comm containing spaces",
+			"31337 (Web Content) S 2650 2520 2520 0 -1 4194560 412711 0 18 0 53214 7413 0 0 20 0 29 0 1289411 3043581952 90723 18446744073709551615 94806151565312 94806152179648 140724946372288 0 0 0 0 69634 1082133752 0 0 0 17 6 0 0 0 0 0 94806152257488 94806152257824 94806168006656 140724946378451 140724946378655 140724946378655 140724946378718 0",
+			"Web Content", 0, 140724946378451, 0, nil,
+		},
+		{
+			"5.15, comm containing parentheses",
+			"4242 (a) (b)) Z 1 4242 4242 0 -1 4227084 87 0 0 0 0 0 0 0 20 0 1 0 98211 0 0 18446744073709551615 0 0 0 0 0 0 0 0 0 0 0 0 17 2 0 0 0 0 0 0 0 0 0 0 0 0 139",
+			"a) (b)", 0, 0, 139, nil,
+		},
+		{
+			"future kernel with additional fields",
+			"1 (systemd) S 0 1 1 0 -1 4194560 58362 6287195 107 2211 197 389 43541 6721 20 0 1 0 4 175681536 3200 18446744073709551615 1 1 0 0 0 0 671173123 4096 1260 0 0 0 17 0 0 0 51 0 0 0 0 0 0 0 0 0 0 42 abc",
+			"systemd", 51 * tick, 0, 0, []string{"42", "abc"},
+		},
+	}
+
+	for _, c := range cases {
+		stat, err := NewStatFromReader(strings.NewReader(c.Line + "\n"))
+		if !assert.Nil(t, err, c.Kernel) {
+			continue
+		}
+
+		assert.Equal(t, c.Comm, stat.Comm, c.Kernel)
+		assert.Equal(t, c.Delay, stat.DelayacctBlkioTicks, c.Kernel)
+		assert.Equal(t, c.ArgStart, stat.ArgStart, c.Kernel)
+		assert.Equal(t, c.ExitCode, stat.ExitCode, c.Kernel)
+		assert.Equal(t, c.Extra, stat.Extra, c.Kernel)
+		assert.Equal(t, SCHED_OTHER, stat.Policy, c.Kernel)
+	}
+}
+
+func TestNewStatFromReaderRejectsMalformedLines(t *testing.T) {
+	for _, line := range []string{
+		"",
+		"1 init S 0 1",
+		"1 (init) S 0 1 1 0 -1 4194560",
+		"1 (init) S zero 1 1 0 -1 4194560 3286 1062797 17 1138 3 183 22187 6813 16 0 1 0 1 1626112 141 4294967295 134512640 134544360 3219377616 3219376316 4294960144 0 0 1475401980 671819267 0 0 0 0 0 0 0",
+	} {
+		_, err := NewStatFromReader(strings.NewReader(line))
+		assert.NotNil(t, err, line)
+	}
+}
@@ -24,7 +24,12 @@ type Statm struct {
 //
 // Returns an error if opening /proc/%{pid}/statm or parsing an individual value fails.
 func NewStatm(pid int) (*Statm, error) {
-	fn := filepath.Join(Dir(pid), "statm")
+	return DefaultFS.NewStatm(pid)
+}
+
+// NewStatm is like the package-level NewStatm but reads from the proc fs self.
+func (self FS) NewStatm(pid int) (*Statm, error) {
+	fn := filepath.Join(self.Dir(pid), "statm")
 
 	f, err := os.Open(fn)
 
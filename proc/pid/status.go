@@ -0,0 +1,425 @@
+package pid
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Ids bundles the user or group ids of a process.
+type Ids struct {
+	Real       int // Real id
+	Effective  int // Effective id, used for permission checks
+	Saved      int // Saved set id
+	Filesystem int // Id used for filesystem access checks
+}
+
+// SigQ describes the queued signals of the real user id of a process.
+type SigQ struct {
+	Queued int // Number of currently queued signals
+	Limit  int // Resource limit on the number of queued signals
+}
+
+// SeccompMode describes the secure computing mode of a process.
+type SeccompMode int
+
+// Taken from ${KERNELSRC}/include/uapi/linux/seccomp.h
+const (
+	SeccompDisabled SeccompMode = 0 // Seccomp is not enabled
+	SeccompStrict   SeccompMode = 1 // Only read, write, _exit and sigreturn are permitted
+	SeccompFilter   SeccompMode = 2 // System calls are filtered with a BPF program
+)
+
+// String pretty prints a SeccompMode instance.
+func (self SeccompMode) String() string {
+	switch self {
+	case SeccompDisabled:
+		return "Disabled"
+	case SeccompStrict:
+		return "Strict"
+	case SeccompFilter:
+		return "Filter"
+	}
+
+	return fmt.Sprintf("Unknown [%d]", int(self))
+}
+
+// stateDescriptions maps states to the descriptions used in /proc/%{pid}/status.
+var stateDescriptions = map[State]string{
+	Running:     "running",
+	Sleeping:    "sleeping",
+	DiskSleep:   "disk sleep",
+	Zombie:      "zombie",
+	Stopped:     "stopped",
+	TracingStop: "tracing stop",
+	Dead:        "dead",
+}
+
+// Status provides status information about a process in a human-readable
+// form, as reported in /proc/%{pid}/status. Memory sizes are given in bytes.
+// Fields not reported by the running kernel are left at their zero value.
+type Status struct {
+	Name                     string        // Command run by the process
+	Umask                    os.FileMode   // File mode creation mask of the process
+	State                    State         // State of the process
+	Tgid                     int           // Thread group id, i.e., the process id
+	Ngid                     int           // NUMA group id, 0 if none
+	Pid                      int           // Thread id
+	PPid                     int           // The PID of the parent process
+	TracerPid                int           // The PID of the process tracing this process, 0 if none
+	Uid                      Ids           // User ids of the process
+	Gid                      Ids           // Group ids of the process
+	FDSize                   int           // Number of file descriptor slots currently allocated
+	Groups                   []int         // Supplementary groups of the process
+	NStgid                   []int         // Thread group id in each of the nested PID namespaces
+	NSpid                    []int         // Thread id in each of the nested PID namespaces
+	VmPeak                   uint64        // Peak virtual memory size
+	VmSize                   uint64        // Virtual memory size
+	VmLck                    uint64        // Locked memory size
+	VmPin                    uint64        // Pinned memory size
+	VmHWM                    uint64        // Peak resident set size, "high water mark"
+	VmRSS                    uint64        // Resident set size
+	RssAnon                  uint64        // Size of resident anonymous memory
+	RssFile                  uint64        // Size of resident file mappings
+	RssShmem                 uint64        // Size of resident shared memory
+	VmData                   uint64        // Size of the data segment
+	VmStk                    uint64        // Size of the stack segment
+	VmExe                    uint64        // Size of the text segment
+	VmLib                    uint64        // Size of shared library code
+	VmPTE                    uint64        // Size of page table entries
+	VmSwap                   uint64        // Swapped-out virtual memory size
+	HugetlbPages             uint64        // Size of hugetlb memory
+	Threads                  int           // Number of threads in the process
+	SigQ                     SigQ          // Queued signals
+	SigPnd                   SignalSet     // Signals pending for the thread
+	ShdPnd                   SignalSet     // Signals pending for the process as a whole
+	SigBlk                   SignalSet     // Blocked signals
+	SigIgn                   SignalSet     // Ignored signals
+	SigCgt                   SignalSet     // Caught signals
+	CapInh                   CapabilitySet // Inheritable capabilities
+	CapPrm                   CapabilitySet // Permitted capabilities
+	CapEff                   CapabilitySet // Effective capabilities
+	CapBnd                   CapabilitySet // Capability bounding set
+	CapAmb                   CapabilitySet // Ambient capabilities
+	NoNewPrivs               bool          // True if the process cannot gain privileges
+	Seccomp                  SeccompMode   // Secure computing mode of the process
+	CpusAllowed              []int         // CPUs the process may run on
+	MemsAllowed              []int         // Memory nodes the process may allocate memory on
+	VoluntaryCtxtSwitches    uint64        // Number of voluntary context switches
+	NonvoluntaryCtxtSwitches uint64        // Number of involuntary context switches
+}
+
+// NewStatus reads /proc/%{pid}/status into a Status instance.
+//
+// Returns an error if opening /proc/%{pid}/status or parsing an individual value fails.
+func NewStatus(pid int) (*Status, error) {
+	return DefaultFS.NewStatus(pid)
+}
+
+// NewStatus is like the package-level NewStatus but reads from the proc fs self.
+func (self FS) NewStatus(pid int) (*Status, error) {
+	fn := filepath.Join(self.Dir(pid), "status")
+
+	f, err := os.Open(fn)
+
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to read %s [%s]", fn, err))
+	}
+
+	defer f.Close()
+
+	return NewStatusFromReader(f)
+}
+
+// parseInts parses a whitespace-separated list of integers.
+func parseInts(s string) ([]int, error) {
+	ints := []int{}
+	for _, field := range strings.Fields(s) {
+		i, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, err
+		}
+		ints = append(ints, i)
+	}
+
+	return ints, nil
+}
+
+// formatInts renders ints as a whitespace-separated list.
+func formatInts(ints []int) string {
+	fields := make([]string, len(ints))
+	for i, v := range ints {
+		fields[i] = strconv.Itoa(v)
+	}
+
+	return strings.Join(fields, " ")
+}
+
+// parseIds parses the real, effective, saved and filesystem ids of a process.
+func parseIds(s string) (Ids, error) {
+	ids := Ids{}
+	_, err := fmt.Sscan(s, &ids.Real, &ids.Effective, &ids.Saved, &ids.Filesystem)
+	return ids, err
+}
+
+// parseSize parses a memory size given in kB, returning the size in bytes.
+func parseSize(s string) (uint64, error) {
+	fields := strings.Fields(s)
+	if len(fields) != 2 || fields[1] != "kB" {
+		return 0, errors.New(fmt.Sprintf("Unexpected size '%s'", s))
+	}
+
+	kb, err := strconv.ParseUint(fields[0], 10, 64)
+	return kb * 1024, err
+}
+
+// parseList parses a list of ranges in the format "0-3,8,10-11", as used for CPU and memory node lists.
+func parseList(s string) ([]int, error) {
+	list := []int{}
+	s = strings.TrimSpace(s)
+
+	if len(s) == 0 {
+		return list, nil
+	}
+
+	for _, r := range strings.Split(s, ",") {
+		bounds := strings.SplitN(r, "-", 2)
+
+		first, err := strconv.Atoi(bounds[0])
+		if err != nil {
+			return nil, err
+		}
+
+		last := first
+		if len(bounds) == 2 {
+			if last, err = strconv.Atoi(bounds[1]); err != nil {
+				return nil, err
+			}
+		}
+
+		for i := first; i <= last; i++ {
+			list = append(list, i)
+		}
+	}
+
+	return list, nil
+}
+
+// formatList renders list as ranges in the format "0-3,8,10-11". list has to be sorted.
+func formatList(list []int) string {
+	ranges := []string{}
+
+	for i := 0; i < len(list); {
+		j := i
+		for j+1 < len(list) && list[j+1] == list[j]+1 {
+			j++
+		}
+
+		if i == j {
+			ranges = append(ranges, strconv.Itoa(list[i]))
+		} else {
+			ranges = append(ranges, fmt.Sprintf("%d-%d", list[i], list[j]))
+		}
+
+		i = j + 1
+	}
+
+	return strings.Join(ranges, ",")
+}
+
+// sizes returns pointers to all memory sizes in status, keyed by name.
+func (self *Status) sizes() map[string]*uint64 {
+	return map[string]*uint64{
+		"VmPeak":       &self.VmPeak,
+		"VmSize":       &self.VmSize,
+		"VmLck":        &self.VmLck,
+		"VmPin":        &self.VmPin,
+		"VmHWM":        &self.VmHWM,
+		"VmRSS":        &self.VmRSS,
+		"RssAnon":      &self.RssAnon,
+		"RssFile":      &self.RssFile,
+		"RssShmem":     &self.RssShmem,
+		"VmData":       &self.VmData,
+		"VmStk":        &self.VmStk,
+		"VmExe":        &self.VmExe,
+		"VmLib":        &self.VmLib,
+		"VmPTE":        &self.VmPTE,
+		"VmSwap":       &self.VmSwap,
+		"HugetlbPages": &self.HugetlbPages,
+	}
+}
+
+// parseField decodes value into the field of status identified by key. Unknown keys are ignored.
+func (self *Status) parseField(key, value string) error {
+	if size, present := self.sizes()[key]; present {
+		v, err := parseSize(value)
+		*size = v
+		return err
+	}
+
+	signals := map[string]*SignalSet{"SigPnd": &self.SigPnd, "ShdPnd": &self.ShdPnd, "SigBlk": &self.SigBlk, "SigIgn": &self.SigIgn, "SigCgt": &self.SigCgt}
+	if set, present := signals[key]; present {
+		v, err := NewSignalSetFromHex(value)
+		*set = v
+		return err
+	}
+
+	caps := map[string]*CapabilitySet{"CapInh": &self.CapInh, "CapPrm": &self.CapPrm, "CapEff": &self.CapEff, "CapBnd": &self.CapBnd, "CapAmb": &self.CapAmb}
+	if set, present := caps[key]; present {
+		v, err := NewCapabilitySetFromHex(value)
+		*set = v
+		return err
+	}
+
+	ints := map[string]*int{"Tgid": &self.Tgid, "Ngid": &self.Ngid, "Pid": &self.Pid, "PPid": &self.PPid, "TracerPid": &self.TracerPid, "FDSize": &self.FDSize, "Threads": &self.Threads}
+	if i, present := ints[key]; present {
+		v, err := strconv.Atoi(value)
+		*i = v
+		return err
+	}
+
+	var err error
+
+	switch key {
+	case "Name":
+		self.Name = value
+	case "Umask":
+		var v uint64
+		v, err = strconv.ParseUint(value, 8, 32)
+		self.Umask = os.FileMode(v)
+	case "State":
+		if fields := strings.Fields(value); len(fields) > 0 {
+			self.State = State(fields[0])
+		}
+	case "Uid":
+		self.Uid, err = parseIds(value)
+	case "Gid":
+		self.Gid, err = parseIds(value)
+	case "Groups":
+		self.Groups, err = parseInts(value)
+	case "NStgid":
+		self.NStgid, err = parseInts(value)
+	case "NSpid":
+		self.NSpid, err = parseInts(value)
+	case "SigQ":
+		_, err = fmt.Sscanf(value, "%d/%d", &self.SigQ.Queued, &self.SigQ.Limit)
+	case "NoNewPrivs":
+		self.NoNewPrivs = value == "1"
+	case "Seccomp":
+		var v int
+		v, err = strconv.Atoi(value)
+		self.Seccomp = SeccompMode(v)
+	case "Cpus_allowed_list":
+		self.CpusAllowed, err = parseList(value)
+	case "Mems_allowed_list":
+		self.MemsAllowed, err = parseList(value)
+	case "voluntary_ctxt_switches":
+		self.VoluntaryCtxtSwitches, err = strconv.ParseUint(value, 10, 64)
+	case "nonvoluntary_ctxt_switches":
+		self.NonvoluntaryCtxtSwitches, err = strconv.ParseUint(value, 10, 64)
+	}
+
+	return err
+}
+
+// NewStatusFromReader parses a Status instance from the given reader.
+//
+// Returns an error if parsing an individual value fails.
+func NewStatusFromReader(reader io.Reader) (*Status, error) {
+	status := Status{}
+	scanner := bufio.NewScanner(reader)
+
+	for scanner.Scan() {
+		kv := strings.SplitN(scanner.Text(), ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+
+		key, value := kv[0], strings.TrimSpace(kv[1])
+		if err := status.parseField(key, value); err != nil {
+			return nil, errors.New(fmt.Sprintf("Failed to parse field %s [%v]", key, err))
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return &status, nil
+}
+
+// String renders the status in the format of /proc/%{pid}/status.
+func (self Status) String() string {
+	var buf bytes.Buffer
+	line := func(key string, value interface{}) {
+		fmt.Fprintf(&buf, "%s:\t%v\n", key, value)
+	}
+	size := func(key string, value uint64) {
+		fmt.Fprintf(&buf, "%s:\t%8d kB\n", key, value/1024)
+	}
+	ids := func(key string, ids Ids) {
+		fmt.Fprintf(&buf, "%s:\t%d\t%d\t%d\t%d\n", key, ids.Real, ids.Effective, ids.Saved, ids.Filesystem)
+	}
+
+	line("Name", self.Name)
+	line("Umask", fmt.Sprintf("%04o", uint32(self.Umask)))
+	line("State", fmt.Sprintf("%s (%s)", string(self.State), stateDescriptions[self.State]))
+	line("Tgid", self.Tgid)
+	line("Ngid", self.Ngid)
+	line("Pid", self.Pid)
+	line("PPid", self.PPid)
+	line("TracerPid", self.TracerPid)
+	ids("Uid", self.Uid)
+	ids("Gid", self.Gid)
+	line("FDSize", self.FDSize)
+	line("Groups", formatInts(self.Groups))
+	line("NStgid", formatInts(self.NStgid))
+	line("NSpid", formatInts(self.NSpid))
+	size("VmPeak", self.VmPeak)
+	size("VmSize", self.VmSize)
+	size("VmLck", self.VmLck)
+	size("VmPin", self.VmPin)
+	size("VmHWM", self.VmHWM)
+	size("VmRSS", self.VmRSS)
+	size("RssAnon", self.RssAnon)
+	size("RssFile", self.RssFile)
+	size("RssShmem", self.RssShmem)
+	size("VmData", self.VmData)
+	size("VmStk", self.VmStk)
+	size("VmExe", self.VmExe)
+	size("VmLib", self.VmLib)
+	size("VmPTE", self.VmPTE)
+	size("VmSwap", self.VmSwap)
+	size("HugetlbPages", self.HugetlbPages)
+	line("Threads", self.Threads)
+	line("SigQ", fmt.Sprintf("%d/%d", self.SigQ.Queued, self.SigQ.Limit))
+	line("SigPnd", self.SigPnd)
+	line("ShdPnd", self.ShdPnd)
+	line("SigBlk", self.SigBlk)
+	line("SigIgn", self.SigIgn)
+	line("SigCgt", self.SigCgt)
+	line("CapInh", self.CapInh)
+	line("CapPrm", self.CapPrm)
+	line("CapEff", self.CapEff)
+	line("CapBnd", self.CapBnd)
+	line("CapAmb", self.CapAmb)
+
+	noNewPrivs := 0
+	if self.NoNewPrivs {
+		noNewPrivs = 1
+	}
+	line("NoNewPrivs", noNewPrivs)
+	line("Seccomp", int(self.Seccomp))
+	line("Cpus_allowed_list", formatList(self.CpusAllowed))
+	line("Mems_allowed_list", formatList(self.MemsAllowed))
+	line("voluntary_ctxt_switches", self.VoluntaryCtxtSwitches)
+	line("nonvoluntary_ctxt_switches", self.NonvoluntaryCtxtSwitches)
+
+	return strings.TrimSuffix(buf.String(), "\n")
+}
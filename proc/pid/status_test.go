@@ -0,0 +1,126 @@
+package pid
+
+import (
+	"encoding/json"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+)
+
+const testStatus = `Name:	python3.4
+Umask:	0022
+State:	S (sleeping)
+Tgid:	1042
+Ngid:	0
+Pid:	1042
+PPid:	1
+TracerPid:	0
+Uid:	1000	1000	1000	1000
+Gid:	1000	1000	1000	1000
+FDSize:	64
+Groups:	4 24 27 1000
+NStgid:	1042
+NSpid:	1042
+VmPeak:	  236184 kB
+VmSize:	  236180 kB
+VmLck:	       0 kB
+VmPin:	       0 kB
+VmHWM:	   19844 kB
+VmRSS:	   19840 kB
+RssAnon:	    7656 kB
+RssFile:	   12184 kB
+RssShmem:	       0 kB
+VmData:	    8052 kB
+VmStk:	     132 kB
+VmExe:	    3408 kB
+VmLib:	    9984 kB
+VmPTE:	     200 kB
+VmSwap:	      16 kB
+HugetlbPages:	       0 kB
+Threads:	2
+SigQ:	0/31271
+SigPnd:	0000000000000000
+ShdPnd:	0000000000000000
+SigBlk:	0000000000000000
+SigIgn:	0000000001001000
+SigCgt:	0000000180000002
+CapInh:	0000000000000000
+CapPrm:	0000000000000000
+CapEff:	0000000000000000
+CapBnd:	000001ffffffffff
+CapAmb:	0000000000000000
+NoNewPrivs:	1
+Seccomp:	2
+Cpus_allowed_list:	0-3,6
+Mems_allowed_list:	0
+voluntary_ctxt_switches:	150
+nonvoluntary_ctxt_switches:	3`
+
+func TestNewStatusFromReaderDecodesFields(t *testing.T) {
+	status, err := NewStatusFromReader(strings.NewReader(testStatus))
+	assert.Nil(t, err)
+
+	assert.Equal(t, "python3.4", status.Name)
+	assert.Equal(t, State(Sleeping), status.State)
+	assert.Equal(t, 1042, status.Pid)
+	assert.Equal(t, Ids{1000, 1000, 1000, 1000}, status.Uid)
+	assert.Equal(t, []int{4, 24, 27, 1000}, status.Groups)
+	assert.Equal(t, uint64(236184*1024), status.VmPeak)
+	assert.Equal(t, uint64(16*1024), status.VmSwap)
+	assert.Equal(t, 2, status.Threads)
+	assert.Equal(t, SigQ{0, 31271}, status.SigQ)
+	assert.Equal(t, []syscall.Signal{syscall.SIGINT, 32, 33}, status.SigCgt.Signals())
+	assert.True(t, status.SigIgn.Has(syscall.SIGPIPE))
+	assert.True(t, status.CapBnd.Has(CAP_SYS_ADMIN))
+	assert.Equal(t, 41, len(status.CapBnd.Capabilities()))
+	assert.Empty(t, status.CapEff.Capabilities())
+	assert.True(t, status.NoNewPrivs)
+	assert.Equal(t, SeccompFilter, status.Seccomp)
+	assert.Equal(t, []int{0, 1, 2, 3, 6}, status.CpusAllowed)
+	assert.Equal(t, uint64(3), status.NonvoluntaryCtxtSwitches)
+}
+
+func TestStatusRendersInProcFormat(t *testing.T) {
+	status, err := NewStatusFromReader(strings.NewReader(testStatus))
+	assert.Nil(t, err)
+	assert.Equal(t, testStatus, status.String())
+}
+
+func TestNewStatusFromReaderReportsMalformedFields(t *testing.T) {
+	_, err := NewStatusFromReader(strings.NewReader("VmRSS:\tlots\n"))
+	assert.NotNil(t, err)
+}
+
+func TestCapabilityNames(t *testing.T) {
+	assert.Equal(t, "cap_sys_admin", CAP_SYS_ADMIN.String())
+	assert.Equal(t, "cap_checkpoint_restore", CAP_CHECKPOINT_RESTORE.String())
+	assert.Equal(t, "cap_63", Capability(63).String())
+}
+
+func TestCapabilitySetsMarshalByName(t *testing.T) {
+	v := struct {
+		Set CapabilitySet
+	}{CapabilitySet(1<<CAP_CHOWN | 1<<CAP_SYS_ADMIN | 1<<CAP_CHECKPOINT_RESTORE | 1<<63)}
+
+	b, err := yaml.Marshal(v)
+	assert.Nil(t, err)
+	assert.Equal(t, "set:\n- cap_chown\n- cap_sys_admin\n- cap_checkpoint_restore\n- cap_63\n", string(b))
+
+	w := v
+	w.Set = 0
+	assert.Nil(t, yaml.Unmarshal(b, &w))
+	assert.Equal(t, v, w)
+
+	b, err = json.Marshal(v)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"Set":["cap_chown","cap_sys_admin","cap_checkpoint_restore","cap_63"]}`, string(b))
+
+	w.Set = 0
+	assert.Nil(t, json.Unmarshal(b, &w))
+	assert.Equal(t, v, w)
+
+	assert.NotNil(t, json.Unmarshal([]byte(`{"Set":["cap_unknown"]}`), &w))
+}
@@ -0,0 +1,212 @@
+package pid
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// TaskDir returns the subdirectory containing information about the thread
+// with id tid of the process with id pid.
+func TaskDir(pid int, tid int) string {
+	return DefaultFS.TaskDir(pid, tid)
+}
+
+// TaskDir is like the package-level TaskDir but resolves the thread in the proc fs self.
+func (self FS) TaskDir(pid int, tid int) string {
+	return filepath.Join(self.Dir(pid), "task", fmt.Sprint(tid))
+}
+
+// Tasks lists the ids of all threads of a process, in ascending order.
+type Tasks []int
+
+// NewTasks enumerates the threads of the process identified by pid.
+//
+// Returns an error if reading /proc/%{pid}/task fails.
+func NewTasks(pid int) (Tasks, error) {
+	return DefaultFS.NewTasks(pid)
+}
+
+// NewTasks is like the package-level NewTasks but reads from the proc fs self.
+func (self FS) NewTasks(pid int) (Tasks, error) {
+	fn := filepath.Join(self.Dir(pid), "task")
+
+	f, err := os.Open(fn)
+
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to open %s [%s]", fn, err))
+	}
+
+	defer f.Close()
+
+	names, err := f.Readdirnames(0)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to read %s [%s]", fn, err))
+	}
+
+	tasks := Tasks{}
+	for _, name := range names {
+		if tid, err := strconv.Atoi(name); err == nil {
+			tasks = append(tasks, tid)
+		}
+	}
+
+	sort.Ints(tasks)
+	return tasks, nil
+}
+
+// Syscall describes the system call a thread is blocked in.
+type Syscall struct {
+	Running bool     // True if the thread is running, all other fields are invalid
+	Number  int      // Number of the system call, -1 if the thread is blocked outside of a system call
+	Args    []uint64 // Arguments of the system call
+	SP      uint64   // Stack pointer of the thread
+	PC      uint64   // Program counter of the thread
+}
+
+// NewSyscallFromReader parses a Syscall instance from reader, as found in /proc/%{pid}/task/%{tid}/syscall.
+//
+// Returns an error if parsing an individual value fails.
+func NewSyscallFromReader(reader io.Reader) (*Syscall, error) {
+	b, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := strings.Fields(string(b))
+	if len(fields) == 1 && fields[0] == "running" {
+		return &Syscall{Running: true}, nil
+	}
+
+	if len(fields) < 3 {
+		return nil, errors.New(fmt.Sprintf("Failed to parse syscall '%s'", strings.TrimSpace(string(b))))
+	}
+
+	sc := Syscall{}
+	if sc.Number, err = strconv.Atoi(fields[0]); err != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to parse syscall number [%s]", err))
+	}
+
+	values := []uint64{}
+	for _, field := range fields[1:] {
+		v, err := strconv.ParseUint(field, 0, 64)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Failed to parse syscall argument [%s]", err))
+		}
+		values = append(values, v)
+	}
+
+	n := len(values)
+	sc.Args, sc.SP, sc.PC = values[:n-2], values[n-2], values[n-1]
+	return &sc, nil
+}
+
+// KernelStack lists the functions on the kernel stack of a thread, innermost first.
+type KernelStack []string
+
+// NewKernelStackFromReader parses a KernelStack from reader, as found in /proc/%{pid}/task/%{tid}/stack.
+// Addresses are dropped as they are hidden from unprivileged readers anyway.
+func NewKernelStackFromReader(reader io.Reader) KernelStack {
+	stack := KernelStack{}
+	scanner := bufio.NewScanner(reader)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if i := strings.Index(line, "] "); strings.HasPrefix(line, "[<") && i >= 0 {
+			line = line[i+2:]
+		}
+
+		if len(line) > 0 {
+			stack = append(stack, line)
+		}
+	}
+
+	return stack
+}
+
+// Task bundles information about an individual thread of a process.
+type Task struct {
+	Tid     int         // Id of the thread
+	Comm    string      // Name of the thread
+	Wchan   string      // Kernel function the thread is waiting in, empty if not waiting
+	Stat    Stat        // Statistics about the thread
+	Status  Status      // Human-readable status of the thread
+	Stack   KernelStack // Kernel stack of the thread, nil if not readable
+	Syscall *Syscall    // System call the thread is blocked in, nil if not readable
+}
+
+// NewTask gathers information about the thread tid of the process identified by pid.
+// The kernel stack and the system call are only readable with elevated privileges
+// and are left empty if reading them fails.
+//
+// Returns an error if reading the thread's stat or status fails.
+func NewTask(pid int, tid int) (*Task, error) {
+	return DefaultFS.NewTask(pid, tid)
+}
+
+// NewTask is like the package-level NewTask but reads from the proc fs self.
+func (self FS) NewTask(pid int, tid int) (*Task, error) {
+	dir := self.TaskDir(pid, tid)
+	task := Task{Tid: tid}
+
+	open := func(name string) (*os.File, error) {
+		fn := filepath.Join(dir, name)
+		f, err := os.Open(fn)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Failed to read %s [%s]", fn, err))
+		}
+		return f, nil
+	}
+
+	f, err := open("stat")
+	if err != nil {
+		return nil, err
+	}
+
+	stat, err := NewStatFromReader(f)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+	task.Stat = *stat
+
+	if f, err = open("status"); err != nil {
+		return nil, err
+	}
+
+	status, err := NewStatusFromReader(f)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+	task.Status = *status
+
+	if b, err := ioutil.ReadFile(filepath.Join(dir, "comm")); err == nil {
+		task.Comm = strings.TrimSpace(string(b))
+	}
+
+	if b, err := ioutil.ReadFile(filepath.Join(dir, "wchan")); err == nil {
+		if wchan := strings.TrimSpace(string(b)); wchan != "0" {
+			task.Wchan = wchan
+		}
+	}
+
+	if f, err := open("stack"); err == nil {
+		task.Stack = NewKernelStackFromReader(f)
+		f.Close()
+	}
+
+	if f, err := open("syscall"); err == nil {
+		task.Syscall, _ = NewSyscallFromReader(f)
+		f.Close()
+	}
+
+	return &task, nil
+}
@@ -0,0 +1,44 @@
+package pid
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewSyscallFromReaderHandlesAllStates(t *testing.T) {
+	sc, err := NewSyscallFromReader(strings.NewReader("running\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, Syscall{Running: true}, *sc)
+
+	sc, err = NewSyscallFromReader(strings.NewReader("-1 0x7ffd5a3c1b28 0x7f8ac7675000\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, Syscall{false, -1, []uint64{}, 0x7ffd5a3c1b28, 0x7f8ac7675000}, *sc)
+
+	sc, err = NewSyscallFromReader(strings.NewReader("202 0x7f8ac6b2d9d0 0x80 0x0 0x0 0x0 0x0 0x7f8ac6b2d8f0 0x7f8ac7a1d3f8\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, 202, sc.Number)
+	assert.Equal(t, []uint64{0x7f8ac6b2d9d0, 0x80, 0, 0, 0, 0}, sc.Args)
+	assert.Equal(t, uint64(0x7f8ac7a1d3f8), sc.PC)
+
+	_, err = NewSyscallFromReader(strings.NewReader("garbage"))
+	assert.NotNil(t, err)
+}
+
+func TestNewKernelStackFromReaderStripsAddresses(t *testing.T) {
+	stack := NewKernelStackFromReader(strings.NewReader("[<0>] futex_wait_queue_me+0xc4/0x120\n[<ffffffff810f1c2d>] do_futex+0x2a1/0x5c0\n"))
+	assert.Equal(t, KernelStack{"futex_wait_queue_me+0xc4/0x120", "do_futex+0x2a1/0x5c0"}, stack)
+}
+
+func TestNewTasksListsThreadsOfProcess(t *testing.T) {
+	tasks, err := NewTasks(os.Getpid())
+	assert.Nil(t, err)
+	assert.Contains(t, tasks, os.Getpid())
+
+	task, err := NewTask(os.Getpid(), os.Getpid())
+	assert.Nil(t, err)
+	assert.Equal(t, os.Getpid(), task.Status.Pid)
+	assert.NotEmpty(t, task.Comm)
+}
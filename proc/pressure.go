@@ -0,0 +1,92 @@
+package proc
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Resources tracked by pressure stall information (PSI), see NewPressure.
+const (
+	PressureCPU    = "cpu"
+	PressureMemory = "memory"
+	PressureIO     = "io"
+)
+
+// PressureStall describes the share of wall time tasks stalled waiting for a resource.
+type PressureStall struct {
+	Avg10  float64       // Percentage of time stalled over the last 10 seconds
+	Avg60  float64       // Percentage of time stalled over the last 60 seconds
+	Avg300 float64       // Percentage of time stalled over the last 300 seconds
+	Total  time.Duration // Total time stalled since boot
+}
+
+// Pressure describes the pressure stall information of a resource, as
+// reported in /proc/pressure/%{resource}. Please see
+// ${KERNELSRC}/Documentation/accounting/psi.rst for further details.
+type Pressure struct {
+	Some PressureStall // Time at least some tasks stalled on the resource
+	Full PressureStall // Time all non-idle tasks stalled on the resource simultaneously
+}
+
+// NewPressure reads the pressure stall information of resource, one of
+// PressureCPU, PressureMemory or PressureIO, from /proc/pressure/%{resource}.
+//
+// Returns an error if opening the file or parsing its contents fails, e.g.,
+// if the running kernel does not support PSI.
+func NewPressure(resource string) (*Pressure, error) {
+	return FS(Dir).NewPressure(resource)
+}
+
+// NewPressure is like the package-level NewPressure but reads from the proc fs self.
+func (self FS) NewPressure(resource string) (*Pressure, error) {
+	fn := self.Path("pressure", resource)
+
+	f, err := os.Open(fn)
+
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to read %s [%s]", fn, err))
+	}
+
+	defer f.Close()
+
+	return NewPressureFromReader(f)
+}
+
+// NewPressureFromReader parses pressure stall information, in the format of /proc/pressure/%{resource}, from reader.
+//
+// Returns an error if parsing a line fails.
+func NewPressureFromReader(reader io.Reader) (*Pressure, error) {
+	p := Pressure{}
+
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if len(strings.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		ps := PressureStall{}
+		var kind string
+		var total uint64
+
+		if _, err := fmt.Sscanf(line, "%s avg10=%f avg60=%f avg300=%f total=%d", &kind, &ps.Avg10, &ps.Avg60, &ps.Avg300, &total); err != nil {
+			return nil, errors.New(fmt.Sprintf("Failed to parse '%s' [%s]", line, err))
+		}
+
+		ps.Total = time.Duration(total) * time.Microsecond
+
+		switch kind {
+		case "some":
+			p.Some = ps
+		case "full":
+			p.Full = ps
+		}
+	}
+
+	return &p, scanner.Err()
+}
@@ -1,4 +1,22 @@
 package proc
 
+import (
+	"path/filepath"
+)
+
 // Dir describes the default mount point of the proc fs.
 const Dir = "/proc"
+
+// FS describes the root of a proc fs, either its mount point or a copy of
+// it, e.g., extracted from a captured tarball. The zero value refers to Dir.
+type FS string
+
+// Path returns the path of the entry elem in the proc fs.
+func (self FS) Path(elem ...string) string {
+	root := string(self)
+	if len(root) == 0 {
+		root = Dir
+	}
+
+	return filepath.Join(append([]string{root}, elem...)...)
+}
@@ -0,0 +1,62 @@
+package proc
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFSResolvesPaths(t *testing.T) {
+	assert.Equal(t, "/proc/stat", FS("").Path("stat"))
+	assert.Equal(t, "test_data/1042/status", FS("test_data").Path("1042", "status"))
+}
+
+func TestBootTimeReadsBtime(t *testing.T) {
+	boot, err := FS("test_data").BootTime()
+	assert.Nil(t, err)
+	assert.Equal(t, time.Unix(1441350000, 0), boot)
+
+	_, err = FS("does_not_exist").BootTime()
+	assert.NotNil(t, err)
+}
+
+func TestMemInfoReportsSizesInBytes(t *testing.T) {
+	mi, err := FS("test_data").NewMemInfo()
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(8052408*1024), mi.MemTotal)
+	assert.Equal(t, uint64(412772*1024), mi.MemAvailable)
+	assert.Equal(t, uint64(5980420*1024), mi.ActiveAnon)
+	assert.Equal(t, uint64(14680064*1024), mi.CommittedAS)
+	assert.Equal(t, uint64(12288*1024), mi.SwapFree)
+	assert.Equal(t, uint64(16), mi.HugePagesTotal)
+	assert.Equal(t, uint64(2048*1024), mi.Hugepagesize)
+	assert.Equal(t, map[string]uint64{"CmaTotal": 0, "CmaFree": 0}, mi.Other)
+
+	_, err = NewMemInfoFromReader(strings.NewReader("MemTotal: 42 MB\n"))
+	assert.NotNil(t, err)
+}
+
+func TestVmStatSumsAllocStallsOverZones(t *testing.T) {
+	vs, err := FS("test_data").NewVmStat()
+	assert.Nil(t, err)
+	assert.Equal(t, VmStat{OomKill: 3, PgMajFault: 183742, AllocStall: 3500}, *vs)
+
+	vs, err = NewVmStatFromReader(strings.NewReader("allocstall 7\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(7), vs.AllocStall)
+}
+
+func TestPressureReadsAverages(t *testing.T) {
+	p, err := FS("test_data").NewPressure(PressureMemory)
+	assert.Nil(t, err)
+	assert.Equal(t, PressureStall{62.37, 41.08, 12.55, 493207145 * time.Microsecond}, p.Some)
+	assert.Equal(t, PressureStall{48.91, 30.12, 8.94, 371650022 * time.Microsecond}, p.Full)
+
+	_, err = NewPressureFromReader(strings.NewReader("some avg10=x\n"))
+	assert.NotNil(t, err)
+
+	_, err = FS("does_not_exist").NewPressure(PressureIO)
+	assert.NotNil(t, err)
+}
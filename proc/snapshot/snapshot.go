@@ -0,0 +1,424 @@
+// Package snapshot captures the proc fs entries describing a process into a
+// portable tar archive. Extracted archives are proc fs roots themselves and can
+// be inspected on another machine by means of pid.FS.
+package snapshot
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/vosst/csi/proc"
+	"github.com/vosst/csi/proc/pid"
+)
+
+// SystemFiles lists the system-wide entries of the proc fs included in snapshots.
+var SystemFiles = []string{
+	"cpuinfo",
+	"loadavg",
+	"meminfo",
+	"pressure/cpu",
+	"pressure/io",
+	"pressure/memory",
+	"stat",
+	"uptime",
+	"version",
+	"vmstat",
+}
+
+// skipped lists entries of process directories that are never copied: mem and
+// pagemap cover the whole address space, clear_refs is write-only and map_files
+// requires CAP_SYS_ADMIN for resolving any of its links.
+var skipped = map[string]bool{
+	"clear_refs": true,
+	"map_files":  true,
+	"mem":        true,
+	"pagemap":    true,
+}
+
+// taskSkipped lists entries of thread directories that are never copied, as
+// they describe the process as a whole and are archived once for the process.
+var taskSkipped = map[string]bool{
+	"auxv":         true,
+	"cmdline":      true,
+	"environ":      true,
+	"fd":           true,
+	"fdinfo":       true,
+	"maps":         true,
+	"mountinfo":    true,
+	"mounts":       true,
+	"mountstats":   true,
+	"net":          true,
+	"numa_maps":    true,
+	"smaps":        true,
+	"smaps_rollup": true,
+}
+
+// ErrorUnsupportedFormat is returned for archive names with an unknown suffix.
+type ErrorUnsupportedFormat struct {
+	Name string // Name of the archive
+}
+
+// Error pretty prints an ErrorUnsupportedFormat instance.
+func (self ErrorUnsupportedFormat) Error() string {
+	return fmt.Sprintf("Unsupported archive format %s, use one of .tar, .tar.gz, .tgz, .tar.zst or .tar.sz", self.Name)
+}
+
+// Format describes the compression applied to a tar archive.
+type Format string
+
+const (
+	Tar       Format = "tar"    // Uncompressed
+	TarGzip   Format = "gzip"   // Compressed with gzip
+	TarZstd   Format = "zstd"   // Compressed with zstd
+	TarSnappy Format = "snappy" // Compressed with snappy
+)
+
+// NewFormatFromName determines the format of an archive from the suffix of name.
+//
+// Returns an error if the suffix is not known.
+func NewFormatFromName(name string) (Format, error) {
+	switch {
+	case strings.HasSuffix(name, ".tar"):
+		return Tar, nil
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return TarGzip, nil
+	case strings.HasSuffix(name, ".tar.zst"):
+		return TarZstd, nil
+	case strings.HasSuffix(name, ".tar.sz"):
+		return TarSnappy, nil
+	}
+
+	return "", ErrorUnsupportedFormat{name}
+}
+
+// archive collects entries into a tar archive.
+type archive struct {
+	tw   *tar.Writer
+	when time.Time
+	dirs map[string]bool
+}
+
+// dir adds name and all of its parents to the archive, unless already present.
+func (self *archive) dir(name string) error {
+	if name == "." || self.dirs[name] {
+		return nil
+	}
+
+	if err := self.dir(filepath.Dir(name)); err != nil {
+		return err
+	}
+
+	self.dirs[name] = true
+	return self.tw.WriteHeader(&tar.Header{Name: name + "/", Typeflag: tar.TypeDir, Mode: 0755, ModTime: self.when})
+}
+
+// file adds a regular file called name with contents b to the archive.
+func (self *archive) file(name string, b []byte) error {
+	if err := self.dir(filepath.Dir(name)); err != nil {
+		return err
+	}
+
+	if err := self.tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(b)), ModTime: self.when}); err != nil {
+		return err
+	}
+
+	_, err := self.tw.Write(b)
+	return err
+}
+
+// link adds a symbolic link called name pointing to dest to the archive.
+func (self *archive) link(name string, dest string) error {
+	if err := self.dir(filepath.Dir(name)); err != nil {
+		return err
+	}
+
+	return self.tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeSymlink, Linkname: dest, Mode: 0777, ModTime: self.when})
+}
+
+// copy adds the proc fs entry fn to the archive as name, descending into directories.
+// Entries that cannot be read, e.g., due to missing privileges, are skipped. procfs
+// reports a size of 0 for most files, we thus read them completely before archiving.
+func (self *archive) copy(fn string, name string) error {
+	fi, err := os.Lstat(fn)
+	if err != nil {
+		return nil
+	}
+
+	switch {
+	case fi.Mode()&os.ModeSymlink != 0:
+		if dest, err := os.Readlink(fn); err == nil {
+			return self.link(name, dest)
+		}
+	case fi.IsDir():
+		names, err := readDirNames(fn)
+		if err != nil {
+			return nil
+		}
+
+		inTask := filepath.Base(filepath.Dir(name)) == "task"
+		for _, n := range names {
+			if skipped[n] || (inTask && taskSkipped[n]) {
+				continue
+			}
+
+			if err := self.copy(filepath.Join(fn, n), filepath.Join(name, n)); err != nil {
+				return err
+			}
+		}
+	case fi.Mode().IsRegular():
+		if b, err := ioutil.ReadFile(fn); err == nil {
+			return self.file(name, b)
+		}
+	}
+
+	return nil
+}
+
+// readDirNames returns the names of all entries in the directory fn.
+func readDirNames(fn string) ([]string, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	return f.Readdirnames(0)
+}
+
+// Write archives all readable entries describing the process identified by id
+// in the proc fs fs to writer, together with SystemFiles, the namespaces of the
+// calling process, the build id of the process's executable, the metadata of the
+// files referred to by the process's fds and the fds of other processes referring
+// to the opposite ends of the process's pipes. extra lists further files only
+// available on the inspecting host, by name relative to the root of the archive.
+//
+// Returns an error if the process does not exist or if writing to writer fails.
+func Write(writer io.Writer, fs pid.FS, id int, extra map[string][]byte) error {
+	dir := fs.Dir(id)
+	if _, err := os.Stat(dir); err != nil {
+		return errors.New(fmt.Sprintf("Failed to access %s [%s]", dir, err))
+	}
+
+	w := newArchive(writer)
+
+	for _, name := range SystemFiles {
+		if err := w.copy(proc.FS(fs).Path(name), name); err != nil {
+			return errors.New(fmt.Sprintf("Failed to archive %s [%s]", name, err))
+		}
+	}
+
+	if err := w.copy(filepath.Join(fs.SelfDir(), "ns"), filepath.Join("self", "ns")); err != nil {
+		return errors.New(fmt.Sprintf("Failed to archive own namespaces [%s]", err))
+	}
+
+	if err := w.copy(dir, fmt.Sprint(id)); err != nil {
+		return errors.New(fmt.Sprintf("Failed to archive %s [%s]", dir, err))
+	}
+
+	// Pipes are paired with the fds of other processes, we archive those fds, too.
+	if fd, err := fs.NewFd(id); err == nil {
+		for _, f := range fd {
+			for _, peer := range f.Peers {
+				for _, dir := range []string{"fd", "fdinfo"} {
+					name := filepath.Join(fmt.Sprint(peer.Pid), dir, fmt.Sprint(peer.Fd))
+					if err := w.copy(filepath.Join(fs.Dir(peer.Pid), dir, fmt.Sprint(peer.Fd)), name); err != nil {
+						return errors.New(fmt.Sprintf("Failed to archive pipe peer %s [%s]", name, err))
+					}
+				}
+			}
+		}
+	}
+
+	if buildId, err := fs.NewBuildId(id); err == nil && len(buildId) > 0 {
+		if err := w.file(filepath.Join(fmt.Sprint(id), pid.BuildIdFile), []byte(buildId+"\n")); err != nil {
+			return errors.New(fmt.Sprintf("Failed to archive build id [%s]", err))
+		}
+	}
+
+	// Fd links are archived as is and no longer lead to the files once extracted.
+	if stats, err := fs.NewFdStats(id); err == nil {
+		if err := w.file(filepath.Join(fmt.Sprint(id), pid.FdStatFile), []byte(stats.String())); err != nil {
+			return errors.New(fmt.Sprintf("Failed to archive fd metadata [%s]", err))
+		}
+	}
+
+	names := []string{}
+	for name := range extra {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err := w.file(name, extra[name]); err != nil {
+			return errors.New(fmt.Sprintf("Failed to archive %s [%s]", name, err))
+		}
+	}
+
+	return w.tw.Close()
+}
+
+// newArchive returns an archive written to w.
+func newArchive(w io.Writer) *archive {
+	return &archive{tar.NewWriter(w), time.Now(), map[string]bool{}}
+}
+
+// Create archives the process identified by id in the proc fs fs, together with
+// extra, to the file fn, compressed according to the suffix of fn. See Write.
+//
+// Returns an error if the suffix of fn is not known or if writing the archive fails.
+func Create(fn string, fs pid.FS, id int, extra map[string][]byte) error {
+	format, err := NewFormatFromName(fn)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(fn)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Failed to create %s [%s]", fn, err))
+	}
+
+	defer f.Close()
+
+	var wc io.WriteCloser
+	switch format {
+	case TarGzip:
+		wc = gzip.NewWriter(f)
+	case TarZstd:
+		if wc, err = zstd.NewWriter(f); err != nil {
+			return errors.New(fmt.Sprintf("Failed to compress %s [%s]", fn, err))
+		}
+	case TarSnappy:
+		wc = snappy.NewBufferedWriter(f)
+	default:
+		wc = f
+	}
+
+	if err := Write(wc, fs, id, extra); err != nil {
+		return err
+	}
+
+	if err := wc.Close(); err != nil {
+		return errors.New(fmt.Sprintf("Failed to write %s [%s]", fn, err))
+	}
+
+	return nil
+}
+
+// Read extracts the archive read from reader into dir, which then serves as
+// root of a proc fs.
+//
+// Returns an error if reading the archive fails or if it contains entries
+// that would be extracted outside of dir.
+func Read(reader io.Reader, dir string) error {
+	tr := tar.NewReader(reader)
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return errors.New(fmt.Sprintf("Failed to read archive [%s]", err))
+		}
+
+		name := filepath.Clean(hdr.Name)
+		if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return errors.New(fmt.Sprintf("Refusing to extract %s outside of %s", hdr.Name, dir))
+		}
+
+		// Links extracted before must not redirect later entries outside of dir.
+		if throughLink(dir, name) {
+			return errors.New(fmt.Sprintf("Refusing to extract %s through a symbolic link", hdr.Name))
+		}
+
+		fn := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(fn), 0755); err != nil {
+			return err
+		}
+
+		// Replace instead of following links to earlier entries of the same name.
+		if hdr.Typeflag != tar.TypeDir {
+			os.Remove(fn)
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(fn, 0755)
+		case tar.TypeSymlink:
+			err = os.Symlink(hdr.Linkname, fn)
+		case tar.TypeReg:
+			var f *os.File
+			if f, err = os.OpenFile(fn, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644); err == nil {
+				_, err = io.Copy(f, tr)
+				f.Close()
+			}
+		}
+
+		if err != nil {
+			return errors.New(fmt.Sprintf("Failed to extract %s [%s]", hdr.Name, err))
+		}
+	}
+}
+
+// throughLink returns true if any parent of name below dir is a symbolic link.
+func throughLink(dir string, name string) bool {
+	for parent := filepath.Dir(name); parent != "."; parent = filepath.Dir(parent) {
+		if fi, err := os.Lstat(filepath.Join(dir, parent)); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Open extracts the archive fn, decompressed according to its suffix, into dir,
+// returning the proc fs rooted at dir.
+//
+// Returns an error if the suffix of fn is not known or if extracting the archive fails.
+func Open(fn string, dir string) (pid.FS, error) {
+	format, err := NewFormatFromName(fn)
+	if err != nil {
+		return "", err
+	}
+
+	f, err := os.Open(fn)
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("Failed to open %s [%s]", fn, err))
+	}
+
+	defer f.Close()
+
+	var reader io.Reader = f
+	switch format {
+	case TarGzip:
+		gr, err := gzip.NewReader(f)
+		if err != nil {
+			return "", errors.New(fmt.Sprintf("Failed to decompress %s [%s]", fn, err))
+		}
+		defer gr.Close()
+		reader = gr
+	case TarZstd:
+		zr, err := zstd.NewReader(f)
+		if err != nil {
+			return "", errors.New(fmt.Sprintf("Failed to decompress %s [%s]", fn, err))
+		}
+		defer zr.Close()
+		reader = zr
+	case TarSnappy:
+		reader = snappy.NewReader(f)
+	}
+
+	return pid.FS(dir), Read(reader, dir)
+}
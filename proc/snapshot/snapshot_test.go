@@ -0,0 +1,144 @@
+package snapshot
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vosst/csi/proc/pid"
+)
+
+// testFS is a snapshot of a proc fs, containing a python process with id 1042 and two threads.
+const testFS = pid.FS("../test_data")
+
+func TestNewFormatFromNameHonoursSuffix(t *testing.T) {
+	for name, format := range map[string]Format{"a.tar": Tar, "a.tar.gz": TarGzip, "a.tgz": TarGzip, "a.tar.zst": TarZstd, "a.tar.sz": TarSnappy} {
+		f, err := NewFormatFromName(name)
+		assert.Nil(t, err)
+		assert.Equal(t, format, f, name)
+	}
+
+	_, err := NewFormatFromName("a.tar.xz")
+	assert.Equal(t, ErrorUnsupportedFormat{"a.tar.xz"}, err)
+}
+
+func TestWriteAndReadRoundTripProcess(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "csi-snapshot-test")
+	defer os.RemoveAll(dir)
+
+	buf := bytes.Buffer{}
+	assert.Nil(t, Write(&buf, testFS, 1042, map[string][]byte{"1042/extra": []byte("recorded\n")}))
+	assert.Nil(t, Read(&buf, dir))
+
+	fs := pid.FS(dir)
+
+	extra, err := ioutil.ReadFile(filepath.Join(dir, "1042", "extra"))
+	assert.Nil(t, err)
+	assert.Equal(t, "recorded\n", string(extra))
+
+	for _, name := range []string{"stat", "1042/status", "1042/smaps", "1042/task/1042/stack", "1042/task/1043/status"} {
+		expected, _ := ioutil.ReadFile(filepath.Join("../test_data", name))
+		actual, err := ioutil.ReadFile(filepath.Join(dir, name))
+		assert.Nil(t, err, name)
+		assert.Equal(t, expected, actual, name)
+	}
+
+	exe, err := fs.NewExe(1042)
+	assert.Nil(t, err)
+	assert.Equal(t, pid.Exe("/usr/bin/python3.4"), exe)
+
+	ns, err := fs.NewNamespaces(1042)
+	assert.Nil(t, err)
+	assert.Equal(t, 7, len(ns))
+
+	tasks, err := fs.NewTasks(1042)
+	assert.Nil(t, err)
+	assert.Equal(t, pid.Tasks{1042, 1043}, tasks)
+}
+
+func TestCreateAndOpenSnapshotOfLiveProcess(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "csi-snapshot-test")
+	defer os.RemoveAll(dir)
+
+	data := filepath.Join(dir, "data")
+	assert.Nil(t, ioutil.WriteFile(data, []byte("42"), 0644))
+
+	f, err := os.Open(data)
+	assert.Nil(t, err)
+	defer f.Close()
+
+	fi, err := f.Stat()
+	assert.Nil(t, err)
+
+	for _, name := range []string{"live.tar", "live.tar.gz", "live.tar.zst", "live.tar.sz"} {
+		fn := filepath.Join(dir, name)
+		assert.Nil(t, Create(fn, pid.DefaultFS, os.Getpid(), nil), name)
+
+		root := filepath.Join(dir, name+".d")
+		fs, err := Open(fn, root)
+		assert.Nil(t, err, name)
+
+		status, err := fs.NewStatus(os.Getpid())
+		assert.Nil(t, err, name)
+		assert.Equal(t, os.Getpid(), status.Pid, name)
+
+		_, err = fs.NewTask(os.Getpid(), os.Getpid())
+		assert.Nil(t, err, name)
+
+		own, _ := pid.NewNamespaces(os.Getpid())
+		self, err := fs.NewSelfNamespaces()
+		assert.Nil(t, err, name)
+		assert.Equal(t, own, self, name)
+
+		_, err = os.Lstat(filepath.Join(fs.Dir(os.Getpid()), "mem"))
+		assert.True(t, os.IsNotExist(err), name)
+
+		if buildId, _ := pid.NewBuildId(os.Getpid()); len(buildId) > 0 {
+			recorded, err := fs.NewBuildId(os.Getpid())
+			assert.Nil(t, err, name)
+			assert.Equal(t, buildId, recorded, name)
+		}
+
+		stats, err := fs.NewFdStats(os.Getpid())
+		assert.Nil(t, err, name)
+		assert.Equal(t, fi.Size(), stats[int(f.Fd())].Size, name)
+		assert.Equal(t, fi.Sys().(*syscall.Stat_t).Ino, stats[int(f.Fd())].Ino, name)
+	}
+
+	assert.NotNil(t, Create(filepath.Join(dir, "live.tar.xz"), pid.DefaultFS, os.Getpid(), nil))
+}
+
+func TestReadRefusesEntriesOutsideOfDir(t *testing.T) {
+	archive := func(headers ...*tar.Header) *bytes.Buffer {
+		buf := bytes.Buffer{}
+		tw := tar.NewWriter(&buf)
+		for _, hdr := range headers {
+			tw.WriteHeader(hdr)
+		}
+		tw.Close()
+		return &buf
+	}
+
+	dir, _ := ioutil.TempDir("", "csi-snapshot-test")
+	defer os.RemoveAll(dir)
+
+	assert.NotNil(t, Read(archive(&tar.Header{Name: "../escape", Typeflag: tar.TypeReg}), dir))
+	assert.NotNil(t, Read(archive(&tar.Header{Name: "/escape", Typeflag: tar.TypeReg}), dir))
+
+	outside, _ := ioutil.TempDir("", "csi-snapshot-test")
+	defer os.RemoveAll(outside)
+
+	err := Read(archive(
+		&tar.Header{Name: "1/link", Typeflag: tar.TypeSymlink, Linkname: outside},
+		&tar.Header{Name: "1/link/escape", Typeflag: tar.TypeReg},
+	), dir)
+	assert.NotNil(t, err)
+
+	_, err = os.Stat(filepath.Join(outside, "escape"))
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,45 @@
+package proc
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BootTime returns the time the system booted at, as reported in /proc/stat.
+//
+// Returns an error if reading /proc/stat fails or if it does not report the boot time.
+func BootTime() (time.Time, error) {
+	return FS(Dir).BootTime()
+}
+
+// BootTime is like the package-level BootTime but reads from the proc fs self.
+func (self FS) BootTime() (time.Time, error) {
+	fn := self.Path("stat")
+
+	f, err := os.Open(fn)
+
+	if err != nil {
+		return time.Time{}, errors.New(fmt.Sprintf("Failed to read %s [%s]", fn, err))
+	}
+
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if fields := strings.Fields(scanner.Text()); len(fields) == 2 && fields[0] == "btime" {
+			secs, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil {
+				return time.Time{}, errors.New(fmt.Sprintf("Failed to parse boot time [%s]", err))
+			}
+
+			return time.Unix(secs, 0), nil
+		}
+	}
+
+	return time.Time{}, errors.New(fmt.Sprintf("Failed to find boot time in %s", fn))
+}
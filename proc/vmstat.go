@@ -0,0 +1,80 @@
+package proc
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// VmStat bundles the virtual memory counters of /proc/vmstat hinting at
+// memory pressure. Counters accumulate since boot, counters not reported
+// by the running kernel are left at zero.
+type VmStat struct {
+	OomKill    uint64 // Number of processes killed by the OOM killer
+	PgMajFault uint64 // Number of page faults that required loading a page from disk
+	AllocStall uint64 // Number of allocations that stalled for direct reclaim, summed up over all zones
+}
+
+// NewVmStat reads the virtual memory counters of the system from /proc/vmstat.
+//
+// Returns an error if opening /proc/vmstat or parsing an individual counter fails.
+func NewVmStat() (*VmStat, error) {
+	return FS(Dir).NewVmStat()
+}
+
+// NewVmStat is like the package-level NewVmStat but reads from the proc fs self.
+func (self FS) NewVmStat() (*VmStat, error) {
+	fn := self.Path("vmstat")
+
+	f, err := os.Open(fn)
+
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to read %s [%s]", fn, err))
+	}
+
+	defer f.Close()
+
+	return NewVmStatFromReader(f)
+}
+
+// NewVmStatFromReader parses virtual memory counters, in the format of /proc/vmstat, from reader.
+//
+// Returns an error if parsing an individual counter fails.
+func NewVmStatFromReader(reader io.Reader) (*VmStat, error) {
+	vs := VmStat{}
+
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+
+		var counter *uint64
+
+		switch {
+		case fields[0] == "oom_kill":
+			counter = &vs.OomKill
+		case fields[0] == "pgmajfault":
+			counter = &vs.PgMajFault
+		// Linux 4.10 split allocstall into one counter per zone, e.g., allocstall_normal.
+		case fields[0] == "allocstall" || strings.HasPrefix(fields[0], "allocstall_"):
+			counter = &vs.AllocStall
+		default:
+			continue
+		}
+
+		v, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Failed to parse %s [%s]", fields[0], err))
+		}
+
+		*counter += v
+	}
+
+	return &vs, scanner.Err()
+}
@@ -1,123 +1,429 @@
 package csi
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/vosst/csi/pkg"
+	"github.com/vosst/csi/pkg/debian"
+	"github.com/vosst/csi/proc"
 	"github.com/vosst/csi/proc/pid"
+	"github.com/vosst/csi/proc/snapshot"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
 )
 
+// BundleFile is the name of the file recording the package/bundle of the executable
+// in snapshots of a proc fs, as resolved on the inspected host. An empty file records
+// that the executable does not belong to any package/bundle.
+const BundleFile = "bundle"
+
+// topMemoryBackings is the number of backings reported in ProcessReport.TopMemory.
+const topMemoryBackings = 10
+
 // ProcessReport bundles information about an individual process.
 type ProcessReport struct {
 	Bundle pkg.Bundle // The package/bundle the executable executed in the process belongs to
 
-	Cmdline     pid.Cmdline     // Command line
-	Cwd         pid.Cwd         // Current working directory
-	Env         pid.Environ     // Runtime environment
-	Exe         pid.Exe         // Path to executed command
-	Fd          pid.Fd          // All open fds
-	IO          pid.IO          // IO statistics
-	Limits      pid.Limits      // Resource limits
-	Maps        pid.Maps        // Mapped memory regions of the process
-	OomAdj      pid.OomAdj      // OomAdj factor for altering the kernel's badness heuristic
-	OomScore    pid.OomScore    // Badness score of the process for OOM selection
-	OomScoreAdj pid.OomScoreAdj // New style adjustment factor for altering the kernel's badness heuristic
-	Root        pid.Root        // Filesystem root of a process
-	Stat        pid.Stat        // Statistics about a process
-	Statm       pid.Statm       // Statistics about a process's memory usage
+	Auxv        pid.Auxv           // Auxiliary vector passed to the process at exec time
+	Cmdline     pid.Cmdline        // Command line
+	Cwd         pid.Cwd            // Current working directory
+	Env         pid.Environ        // Runtime environment
+	Exe         pid.Exe            // Path to executed command
+	BuildId     pid.BuildId        // Build id of the executed command, empty if unknown
+	Fd          pid.Fd             // All open fds
+	FdInfo      pid.FdInfos        // State of all open fds, by fd number
+	IO          pid.IO             // IO statistics
+	Limits      pid.Limits         // Resource limits
+	Maps        pid.Maps           // Mapped memory regions of the process
+	Memory      pid.MemoryUsage    // Memory usage summed up over all mapped regions
+	TopMemory   []pid.BackingUsage // Backings accounting for the most memory, largest first
+	OomAdj      pid.OomAdj         // OomAdj factor for altering the kernel's badness heuristic
+	OomScore    pid.OomScore       // Badness score of the process for OOM selection
+	OomScoreAdj pid.OomScoreAdj    // New style adjustment factor for altering the kernel's badness heuristic
+	Root        pid.Root           // Filesystem root of a process
+	Stat        pid.Stat           // Statistics about a process
+	Started     time.Time          // Wall-clock time the process started at
+	Status      pid.Status         // Human-readable status of a process
+	Statm       pid.Statm          // Statistics about a process's memory usage
+	Tasks       []pid.Task         // Individual threads of the process
+
+	Namespaces        pid.Namespaces // Namespaces of the process
+	ForeignNamespaces []string       // Types of namespaces the process does not share with the inspector
+	NsPid             int            // Id of the process in its innermost PID namespace
+	Container         *pid.Container // Container the process executes in, nil if none
+
+	Collectors map[string]CollectorStatus // Outcome of the individual collectors, by name
+	Results    map[string]interface{}     `yaml:",inline" json:"-"` // Results of collectors not built into csi, by name
 }
 
-// ProcessInspector inspects an individual process
-type ProcessInspector struct {
-	PackagingSystem pkg.System // Queries into the underlying packaging system
+// MarshalJSON encodes self to JSON, with Results inlined like in YAML.
+func (self ProcessReport) MarshalJSON() ([]byte, error) {
+	// plain has all fields of ProcessReport but none of its methods, avoiding recursion.
+	type plain ProcessReport
+	return marshalJSONWithResults(plain(self), self.Results)
 }
 
-// Inspect inspects an individual process, returning a report on sucess and nil in case of an error.
-//
-// Returns an error in case of assembling required information fails.
-func (self ProcessInspector) Inspect(id int) (*ProcessReport, error) {
-	pr := ProcessReport{}
+// UnmarshalYAML decodes a ProcessReport from YAML. Bundle is an interface and
+// cannot be decoded directly, we restore it as a debian.Package, the only
+// pkg.Bundle implementation we serialize.
+func (self *ProcessReport) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	raw := yaml.MapSlice{}
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
 
-	if cl, err := pid.NewCmdline(id); err != nil {
-		return nil, err
-	} else {
-		pr.Cmdline = cl
+	rest := yaml.MapSlice{}
+	var bundle debian.Package
+
+	for _, item := range raw {
+		if item.Key != "bundle" {
+			rest = append(rest, item)
+		} else if item.Value != nil {
+			b, err := yaml.Marshal(item.Value)
+			if err != nil {
+				return err
+			}
+
+			if err := yaml.Unmarshal(b, &bundle); err != nil {
+				return err
+			}
+		}
 	}
 
-	if cwd, err := pid.NewCwd(id); err != nil {
-		return nil, err
-	} else {
-		pr.Cwd = cwd
+	b, err := yaml.Marshal(rest)
+	if err != nil {
+		return err
 	}
 
-	if env, err := pid.NewEnviron(id); err != nil {
-		return nil, err
-	} else {
-		pr.Env = env
+	// plain has all fields of ProcessReport but none of its methods, avoiding recursion.
+	type plain ProcessReport
+	if err := yaml.Unmarshal(b, (*plain)(self)); err != nil {
+		return err
 	}
 
-	if exe, err := pid.NewExe(id); err != nil {
-		return nil, err
-	} else {
-		pr.Exe = exe
+	if bundle != nil {
+		self.Bundle = bundle
 	}
 
-	if fd, err := pid.NewFd(id); err != nil {
-		return nil, err
-	} else {
-		pr.Fd = fd
+	return nil
+}
+
+// ProcessInspector inspects an individual process
+type ProcessInspector struct {
+	PackagingSystem pkg.System // Queries into the underlying packaging system
+	Proc            pid.FS     // The proc fs to read information about processes from
+	Workers         int        // Maximum number of collectors running concurrently, DefaultWorkers if not positive
+	Collectors      *Registry  // Collectors to run, DefaultRegistry if nil
+}
+
+// InForeignNamespace returns true if the process does not share the namespace of type t with the inspector.
+func (self ProcessReport) InForeignNamespace(t string) bool {
+	for _, f := range self.ForeignNamespaces {
+		if f == t {
+			return true
+		}
 	}
 
-	if io, err := pid.NewIO(id); err == nil {
-		pr.IO = *io
+	return false
+}
+
+// processCollector is a built-in collector storing its result in a field of ProcessReport.
+type processCollector struct {
+	name    string                                                        // Name of the collector
+	entry   string                                                        // Entry of the process's proc fs directory probed for the cause of failures
+	collect func(ctx context.Context, target Target) (interface{}, error) // Gathers the information
+	apply   func(pr *ProcessReport, v interface{})                        // Stores the information in a report
+}
+
+func (self processCollector) Name() string {
+	return self.name
+}
+
+func (self processCollector) Scope() Scope {
+	return ScopeProcess
+}
+
+func (self processCollector) Collect(ctx context.Context, target Target) (interface{}, error) {
+	return self.collect(ctx, target)
+}
+
+// inspectNamespaces returns the namespaces of the process target.Pid and the
+// types of namespaces differing from the inspector's own.
+func inspectNamespaces(target Target) (pid.Namespaces, []string, error) {
+	ns, err := target.Proc.NewNamespaces(target.Pid)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	if limits, err := pid.NewLimits(id); err != nil {
-		fmt.Println(err)
-		return nil, err
-	} else {
-		pr.Limits = limits
+	own, err := target.Proc.NewSelfNamespaces()
+	if err != nil {
+		return ns, nil, nil
 	}
 
-	if maps, err := pid.NewMaps(id); err != nil {
-		return nil, err
-	} else {
-		pr.Maps = maps
+	return ns, ns.Differing(own), nil
+}
+
+// inspectBundle resolves the package/bundle the executable of the process
+// target.Pid belongs to, preferring the bundle recorded in BundleFile. Paths
+// reported for processes in another mount namespace refer to their root
+// filesystem, e.g., the rootfs of a container.
+func inspectBundle(target Target) (pkg.Bundle, error) {
+	if b, err := ioutil.ReadFile(filepath.Join(target.Proc.Dir(target.Pid), BundleFile)); err == nil {
+		if len(strings.TrimSpace(string(b))) == 0 {
+			return nil, nil
+		}
+
+		// debian.Package is the only pkg.Bundle implementation we serialize, see UnmarshalYAML.
+		var bundle debian.Package
+		if err := yaml.Unmarshal(b, &bundle); err != nil {
+			return nil, errors.New(fmt.Sprintf("Failed to parse %s [%s]", BundleFile, err))
+		}
+
+		return bundle, nil
 	}
 
-	if oomAdj, err := pid.NewOomAdj(id); err != nil {
+	exe, err := target.Proc.NewExe(target.Pid)
+	if err != nil {
 		return nil, err
-	} else {
-		pr.OomAdj = oomAdj
 	}
 
-	if oomScore, err := pid.NewOomScore(id); err != nil {
-		return nil, err
-	} else {
-		pr.OomScore = oomScore
+	system := target.PackagingSystem
+	if rs, ok := system.(pkg.RootedSystem); ok {
+		_, foreign, _ := inspectNamespaces(target)
+		for _, t := range foreign {
+			if t == pid.NamespaceMount {
+				system = rs.InRoot(target.Proc.RootDir(target.Pid))
+			}
+		}
 	}
 
-	if root, err := pid.NewRoot(id); err != nil {
+	bundles, err := system.Resolve(string(exe))
+	if err != nil || len(bundles) == 0 {
 		return nil, err
-	} else {
-		pr.Root = root
 	}
 
-	if stat, err := pid.NewStat(id); err != nil {
-		return nil, err
-	} else {
-		pr.Stat = *stat
+	return bundles[0], nil
+}
+
+// processCollectors lists the collectors built into csi contributing to ProcessReport.
+// Collectors are named after the key of the field they fill, as serialized to YAML.
+// Collectors filling several fields are named after the first of them:
+//
+//	maps       fills maps, memory and topmemory
+//	memory     fills memory, taking precedence over maps
+//	status     fills status and nspid
+//	namespaces fills namespaces and foreignnamespaces
+var processCollectors = []processCollector{
+	{"auxv", "auxv", func(ctx context.Context, t Target) (interface{}, error) {
+		return t.Proc.NewAuxv(t.Pid)
+	}, func(pr *ProcessReport, v interface{}) { pr.Auxv = v.(pid.Auxv) }},
+	{"cmdline", "cmdline", func(ctx context.Context, t Target) (interface{}, error) {
+		return t.Proc.NewCmdline(t.Pid)
+	}, func(pr *ProcessReport, v interface{}) { pr.Cmdline = v.(pid.Cmdline) }},
+	{"cwd", "cwd", func(ctx context.Context, t Target) (interface{}, error) {
+		return t.Proc.NewCwd(t.Pid)
+	}, func(pr *ProcessReport, v interface{}) { pr.Cwd = v.(pid.Cwd) }},
+	{"env", "environ", func(ctx context.Context, t Target) (interface{}, error) {
+		return t.Proc.NewEnviron(t.Pid)
+	}, func(pr *ProcessReport, v interface{}) { pr.Env = v.(pid.Environ) }},
+	{"exe", "exe", func(ctx context.Context, t Target) (interface{}, error) {
+		return t.Proc.NewExe(t.Pid)
+	}, func(pr *ProcessReport, v interface{}) { pr.Exe = v.(pid.Exe) }},
+	{"buildid", "exe", func(ctx context.Context, t Target) (interface{}, error) {
+		return t.Proc.NewBuildId(t.Pid)
+	}, func(pr *ProcessReport, v interface{}) { pr.BuildId = v.(pid.BuildId) }},
+	{"fd", "fd", func(ctx context.Context, t Target) (interface{}, error) {
+		return t.Proc.NewFdContext(ctx, t.Pid)
+	}, func(pr *ProcessReport, v interface{}) { pr.Fd = v.(pid.Fd) }},
+	{"fdinfo", "fdinfo", func(ctx context.Context, t Target) (interface{}, error) {
+		return t.Proc.NewFdInfos(t.Pid)
+	}, func(pr *ProcessReport, v interface{}) { pr.FdInfo = v.(pid.FdInfos) }},
+	{"io", "io", func(ctx context.Context, t Target) (interface{}, error) {
+		return t.Proc.NewIO(t.Pid)
+	}, func(pr *ProcessReport, v interface{}) { pr.IO = *v.(*pid.IO) }},
+	{"limits", "limits", func(ctx context.Context, t Target) (interface{}, error) {
+		return t.Proc.NewLimits(t.Pid)
+	}, func(pr *ProcessReport, v interface{}) { pr.Limits = v.(pid.Limits) }},
+	{"maps", "maps", func(ctx context.Context, t Target) (interface{}, error) {
+		return t.Proc.NewMaps(t.Pid)
+	}, func(pr *ProcessReport, v interface{}) { pr.Maps = v.(pid.Maps) }},
+	// smaps_rollup is considerably cheaper to read than smaps but lacks the
+	// size of the mapped regions, which we sum up from maps.
+	{"memory", "smaps_rollup", func(ctx context.Context, t Target) (interface{}, error) {
+		usage, err := t.Proc.NewSmapsRollup(t.Pid)
+		if err != nil {
+			maps, err := t.Proc.NewSmaps(t.Pid)
+			if err != nil {
+				return nil, err
+			}
+
+			total := maps.Usage()
+			return &total, nil
+		}
+
+		maps, err := t.Proc.NewMaps(t.Pid)
+		if err != nil {
+			return nil, err
+		}
+
+		usage.Size = maps.Size()
+		return usage, nil
+	}, func(pr *ProcessReport, v interface{}) { pr.Memory = *v.(*pid.MemoryUsage) }},
+	// smaps is only read for breaking down memory usage by backing.
+	{"topmemory", "smaps", func(ctx context.Context, t Target) (interface{}, error) {
+		maps, err := t.Proc.NewSmaps(t.Pid)
+		if err != nil {
+			return nil, err
+		}
+
+		return maps.TopUsage(topMemoryBackings), nil
+	}, func(pr *ProcessReport, v interface{}) { pr.TopMemory = v.([]pid.BackingUsage) }},
+	{"oomadj", "oom_adj", func(ctx context.Context, t Target) (interface{}, error) {
+		return t.Proc.NewOomAdj(t.Pid)
+	}, func(pr *ProcessReport, v interface{}) { pr.OomAdj = v.(pid.OomAdj) }},
+	{"oomscore", "oom_score", func(ctx context.Context, t Target) (interface{}, error) {
+		return t.Proc.NewOomScore(t.Pid)
+	}, func(pr *ProcessReport, v interface{}) { pr.OomScore = v.(pid.OomScore) }},
+	{"root", "root", func(ctx context.Context, t Target) (interface{}, error) {
+		return t.Proc.NewRoot(t.Pid)
+	}, func(pr *ProcessReport, v interface{}) { pr.Root = v.(pid.Root) }},
+	{"stat", "stat", func(ctx context.Context, t Target) (interface{}, error) {
+		return t.Proc.NewStat(t.Pid)
+	}, func(pr *ProcessReport, v interface{}) { pr.Stat = *v.(*pid.Stat) }},
+	{"started", "stat", func(ctx context.Context, t Target) (interface{}, error) {
+		stat, err := t.Proc.NewStat(t.Pid)
+		if err != nil {
+			return nil, err
+		}
+
+		boot, err := proc.FS(t.Proc).BootTime()
+		if err != nil {
+			return nil, err
+		}
+
+		return stat.Started(boot), nil
+	}, func(pr *ProcessReport, v interface{}) { pr.Started = v.(time.Time) }},
+	{"status", "status", func(ctx context.Context, t Target) (interface{}, error) {
+		return t.Proc.NewStatus(t.Pid)
+	}, func(pr *ProcessReport, v interface{}) {
+		pr.Status = *v.(*pid.Status)
+		if nspid := pr.Status.NSpid; len(nspid) > 0 {
+			pr.NsPid = nspid[len(nspid)-1]
+		}
+	}},
+	{"statm", "statm", func(ctx context.Context, t Target) (interface{}, error) {
+		return t.Proc.NewStatm(t.Pid)
+	}, func(pr *ProcessReport, v interface{}) { pr.Statm = *v.(*pid.Statm) }},
+	// Threads might exit while we are inspecting them, we
+	// thus only report the ones we were able to inspect.
+	{"tasks", "task", func(ctx context.Context, t Target) (interface{}, error) {
+		tids, err := t.Proc.NewTasks(t.Pid)
+		var tasks []pid.Task
+		for _, tid := range tids {
+			if ctx.Err() != nil {
+				break
+			}
+
+			if task, err := t.Proc.NewTask(t.Pid, tid); err == nil {
+				tasks = append(tasks, *task)
+			}
+		}
+		return tasks, err
+	}, func(pr *ProcessReport, v interface{}) { pr.Tasks = v.([]pid.Task) }},
+	{"namespaces", "ns", func(ctx context.Context, t Target) (interface{}, error) {
+		ns, foreign, err := inspectNamespaces(t)
+		return ProcessReport{Namespaces: ns, ForeignNamespaces: foreign}, err
+	}, func(pr *ProcessReport, v interface{}) {
+		pr.Namespaces, pr.ForeignNamespaces = v.(ProcessReport).Namespaces, v.(ProcessReport).ForeignNamespaces
+	}},
+	{"container", "cgroup", func(ctx context.Context, t Target) (interface{}, error) {
+		cg, err := t.Proc.NewCGroup(t.Pid)
+		if err != nil {
+			return nil, err
+		}
+		return pid.NewContainerFromCgroup(cg), nil
+	}, func(pr *ProcessReport, v interface{}) { pr.Container = v.(*pid.Container) }},
+	{"bundle", "exe", func(ctx context.Context, t Target) (interface{}, error) {
+		return inspectBundle(t)
+	}, func(pr *ProcessReport, v interface{}) { pr.Bundle, _ = v.(pkg.Bundle) }},
+}
+
+// Snapshot archives the process identified by id in self.Proc to the file fn, see
+// snapshot.Create. The package/bundle of the process's executable is recorded in
+// BundleFile, as the packaging system of the host analysing the snapshot does not
+// know about it. If resolving the bundle fails, nothing is recorded and the host
+// analysing the snapshot resolves the bundle on its own.
+//
+// Returns an error if writing the snapshot fails.
+func (self ProcessInspector) Snapshot(fn string, id int) error {
+	extra := map[string][]byte{}
+
+	if self.PackagingSystem != nil {
+		if bundle, err := inspectBundle(Target{id, self.Proc, self.PackagingSystem}); err == nil {
+			b := []byte{}
+			if bundle != nil {
+				if b, err = yaml.Marshal(bundle); err != nil {
+					return errors.New(fmt.Sprintf("Failed to record bundle [%s]", err))
+				}
+			}
+
+			extra[filepath.Join(fmt.Sprint(id), BundleFile)] = b
+		}
 	}
 
-	if statm, err := pid.NewStatm(id); err != nil {
-		return nil, err
-	} else {
-		pr.Statm = *statm
+	return snapshot.Create(fn, self.Proc, id, extra)
+}
+
+// Inspect inspects an individual process, see InspectContext.
+func (self ProcessInspector) Inspect(id int) (*ProcessReport, error) {
+	return self.InspectContext(context.Background(), id)
+}
+
+// InspectContext inspects an individual process, running the enabled process
+// collectors of self.Collectors, at most self.Workers of them concurrently,
+// until all of them finished or ctx is done. Inspecting is best-effort: a
+// report is returned in any case, containing whatever could be gathered,
+// with the outcome of every collector recorded in ProcessReport.Collectors.
+// Collectors not finished when ctx is done are marked as timed out.
+//
+// Returns ErrorCollectors listing the failed collectors if any collector fails.
+func (self ProcessInspector) InspectContext(ctx context.Context, id int) (*ProcessReport, error) {
+	pr := ProcessReport{NsPid: id, Collectors: map[string]CollectorStatus{}}
+
+	registry := self.Collectors
+	if registry == nil {
+		registry = DefaultRegistry
 	}
 
-	if bundles, err := self.PackagingSystem.Resolve(string(pr.Exe)); err != nil {
-		return nil, err
-	} else if len(bundles) > 0 {
-		pr.Bundle = bundles[0]
+	store := func(c Collector, v interface{}, err error) {
+		if pc, ok := c.(processCollector); ok {
+			if err == nil {
+				pc.apply(&pr, v)
+			}
+		} else if v != nil {
+			if pr.Results == nil {
+				pr.Results = map[string]interface{}{}
+			}
+			pr.Results[c.Name()] = v
+		}
+	}
+
+	failed := func(name string, err error) ErrorCollector {
+		fn := ""
+		if pc, ok := registry.Collector(name).(processCollector); ok {
+			fn = filepath.Join(self.Proc.Dir(id), pc.entry)
+		}
+
+		return newErrorCollector(name, err, self.Proc.Dir(id), fn)
+	}
+
+	target := Target{id, self.Proc, self.PackagingSystem}
+	if errs := runCollectors(ctx, self.Workers, registry.jobs(ScopeProcess, target, pr.Collectors, store, failed), pr.Collectors); len(errs) > 0 {
+		return &pr, errs
 	}
 
 	return &pr, nil
@@ -0,0 +1,164 @@
+package csi
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vosst/csi/pkg"
+	"github.com/vosst/csi/pkg/debian"
+	"github.com/vosst/csi/proc/pid"
+	"github.com/vosst/csi/proc/snapshot"
+)
+
+// fakeSystem resolves every path to the same package.
+type fakeSystem struct {
+	resolved []string
+}
+
+func (self *fakeSystem) Resolve(pattern string) ([]pkg.Bundle, error) {
+	self.resolved = append(self.resolved, pattern)
+	return []pkg.Bundle{debian.Package{"Package": []string{"python3.4"}}}, nil
+}
+
+func (self *fakeSystem) Arch() (pkg.Arch, error) {
+	return pkg.Arch("amd64"), nil
+}
+
+func TestProcessInspectorReadsFromSnapshot(t *testing.T) {
+	system := &fakeSystem{}
+	pi := ProcessInspector{system, pid.FS("proc/test_data"), 0, nil}
+
+	pr, err := pi.Inspect(1042)
+	assert.Nil(t, err)
+
+	assert.Equal(t, pid.Exe("/usr/bin/python3.4"), pr.Exe)
+	assert.Equal(t, []string{"/usr/bin/python3.4"}, system.resolved)
+	assert.Equal(t, "python3.4", pr.Bundle.Name())
+	assert.Equal(t, time.Unix(1441350000, 0).Add(pr.Stat.StartTime), pr.Started)
+	assert.Equal(t, uint64(5112*1024), pr.Memory.Rss)
+	assert.Equal(t, uint64(6944*1024), pr.Memory.Size)
+	assert.Equal(t, "[heap]", pr.TopMemory[0].Backing)
+	assert.Equal(t, 2, len(pr.Tasks))
+	assert.Equal(t, pid.Docker, pr.Container.Runtime)
+	assert.Equal(t, 1042, pr.NsPid)
+	assert.Equal(t, pid.BuildId("5e1d0c2f8a9b3e4d7c6f5a4b3c2d1e0f9a8b7c6d"), pr.BuildId)
+
+	for name, status := range pr.Collectors {
+		assert.Equal(t, CollectorStatus{State: CollectorOk}, status, name)
+	}
+}
+
+func TestProcessInspectorReturnsPartialReports(t *testing.T) {
+	pi := ProcessInspector{&fakeSystem{}, pid.FS("proc/test_data"), 0, nil}
+
+	pr, err := pi.Inspect(1100)
+	assert.NotNil(t, pr)
+	assert.Equal(t, pid.Cmdline{"logger", "-t", "http"}, pr.Cmdline)
+	assert.Equal(t, 3, len(pr.Fd))
+	assert.Equal(t, CollectorOk, pr.Collectors["fd"].State)
+
+	errs, ok := err.(ErrorCollectors)
+	assert.True(t, ok)
+	assert.Equal(t, len(pr.Collectors)-3, len(errs))
+
+	for _, ec := range errs {
+		assert.Equal(t, ec.Status(), pr.Collectors[ec.Collector])
+	}
+
+	assert.Equal(t, CollectorMissing, pr.Collectors["limits"].State)
+	assert.NotEmpty(t, pr.Collectors["limits"].Error)
+	assert.Equal(t, CollectorMissing, pr.Collectors["bundle"].State)
+
+	pr, err = pi.Inspect(1)
+	assert.NotNil(t, pr)
+	for _, ec := range err.(ErrorCollectors) {
+		assert.Equal(t, syscall.ESRCH, ec.Errno)
+		assert.Equal(t, CollectorExited, pr.Collectors[ec.Collector].State)
+	}
+}
+
+func TestProcessInspectorReportsIdenticallyFromSnapshot(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "csi-snapshot-test")
+	defer os.RemoveAll(dir)
+
+	pi := ProcessInspector{&fakeSystem{}, pid.FS("proc/test_data"), 0, nil}
+
+	fn := filepath.Join(dir, "1042.tar.gz")
+	assert.Nil(t, pi.Snapshot(fn, 1042))
+
+	fs, err := snapshot.Open(fn, filepath.Join(dir, "proc"))
+	assert.Nil(t, err)
+
+	expected, err := pi.Inspect(1042)
+	assert.Nil(t, err)
+
+	// The bundle is recorded in the snapshot, the analysing host's packaging system is not consulted.
+	analysis := &fakeSystem{}
+	actual, err := ProcessInspector{analysis, fs, 0, nil}.Inspect(1042)
+	assert.Nil(t, err)
+	assert.Empty(t, analysis.resolved)
+
+	assert.Equal(t, expected, actual)
+}
+
+func TestProcessInspectorReportsLiveProcessIdenticallyFromSnapshot(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "csi-snapshot-test")
+	defer os.RemoveAll(dir)
+
+	data := filepath.Join(dir, "data")
+	assert.Nil(t, ioutil.WriteFile(data, []byte("42"), 0644))
+
+	f, err := os.Open(data)
+	assert.Nil(t, err)
+	defer f.Close()
+
+	live := ProcessInspector{&fakeSystem{}, pid.DefaultFS, 0, nil}
+
+	fn := filepath.Join(dir, "live.tar.zst")
+	assert.Nil(t, live.Snapshot(fn, os.Getpid()))
+
+	expected, _ := live.Inspect(os.Getpid())
+
+	// Files referred to by fds are usually not around on the analysing host.
+	assert.Nil(t, os.Remove(data))
+
+	fs, err := snapshot.Open(fn, filepath.Join(dir, "proc"))
+	assert.Nil(t, err)
+
+	analysis := &fakeSystem{}
+	actual, _ := ProcessInspector{analysis, fs, 0, nil}.Inspect(os.Getpid())
+	assert.Empty(t, analysis.resolved)
+
+	// Counters and the fds used for inspecting change in between, we compare everything else.
+	assert.Equal(t, expected.Bundle, actual.Bundle)
+	assert.Equal(t, expected.Auxv, actual.Auxv)
+	assert.Equal(t, expected.Cmdline, actual.Cmdline)
+	assert.Equal(t, expected.Cwd, actual.Cwd)
+	assert.Equal(t, expected.Env, actual.Env)
+	assert.Equal(t, expected.Exe, actual.Exe)
+	assert.Equal(t, expected.BuildId, actual.BuildId)
+	assert.Equal(t, expected.Limits, actual.Limits)
+	assert.Equal(t, expected.Root, actual.Root)
+	assert.Equal(t, expected.Started, actual.Started)
+	assert.Equal(t, expected.Namespaces, actual.Namespaces)
+	assert.Equal(t, expected.ForeignNamespaces, actual.ForeignNamespaces)
+	assert.Equal(t, expected.NsPid, actual.NsPid)
+	assert.Equal(t, expected.Container, actual.Container)
+
+	entry := func(fd pid.Fd) pid.FdEntry {
+		for _, e := range fd {
+			if e.Fd == int(f.Fd()) {
+				return e
+			}
+		}
+		return pid.FdEntry{}
+	}
+
+	assert.Equal(t, int64(2), entry(expected.Fd).Size)
+	assert.Equal(t, entry(expected.Fd), entry(actual.Fd))
+}
@@ -0,0 +1,269 @@
+package csi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// DefaultCollectorConfigFile is the default location of the CollectorConfig.
+const DefaultCollectorConfigFile = "/etc/csi/collectors.yaml"
+
+// ErrorDuplicateCollector is returned when registering a collector under a name that is already taken.
+type ErrorDuplicateCollector struct {
+	Name string // Name of the collector
+}
+
+// Error pretty prints an ErrorDuplicateCollector instance.
+func (self ErrorDuplicateCollector) Error() string {
+	return fmt.Sprintf("A collector or report field named %s already exists", self.Name)
+}
+
+// ErrorUnknownCollector is returned when enabling or disabling a collector that is not registered.
+type ErrorUnknownCollector struct {
+	Name string // Name of the collector
+}
+
+// Error pretty prints an ErrorUnknownCollector instance.
+func (self ErrorUnknownCollector) Error() string {
+	return fmt.Sprintf("Unknown collector %s", self.Name)
+}
+
+// CollectorConfig enables and disables collectors and declares additional ones.
+type CollectorConfig struct {
+	Disabled []string              // Names of collectors not to run
+	Enabled  []string              // Names of collectors to run, even if listed in Disabled
+	Files    []FileCollectorConfig // Collectors gathering the contents of files, e.g., application-specific logs
+}
+
+// LoadCollectorConfig reads the CollectorConfig stored in path. A missing file yields an empty config.
+//
+// Returns an error if reading or decoding path fails.
+func LoadCollectorConfig(path string) (*CollectorConfig, error) {
+	config := CollectorConfig{}
+
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &config, nil
+	} else if err != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to read collector config %s [%s]", path, err))
+	}
+
+	if err := yaml.Unmarshal(b, &config); err != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to decode collector config %s [%s]", path, err))
+	}
+
+	return &config, nil
+}
+
+// Registry holds the collectors run by inspectors, in order of registration.
+// A Registry must not be modified while inspecting.
+type Registry struct {
+	collectors []Collector
+	disabled   map[string]bool
+}
+
+// DefaultRegistry is used by inspectors not specifying a Registry.
+var DefaultRegistry = NewDefaultRegistry()
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{nil, map[string]bool{}}
+}
+
+// NewDefaultRegistry returns a Registry holding all collectors built into csi.
+func NewDefaultRegistry() *Registry {
+	r := NewRegistry()
+	for _, c := range processCollectors {
+		r.collectors = append(r.collectors, c)
+	}
+
+	for _, c := range systemCollectors {
+		r.collectors = append(r.collectors, c)
+	}
+
+	return r
+}
+
+// reportKeys lists the keys of the fields of ProcessReport and SystemReport,
+// as serialized to YAML, in lower case. Results of collectors must not shadow
+// these fields, neither in YAML nor in JSON, which keeps the field names as is.
+var reportKeys = func() map[string]bool {
+	keys := map[string]bool{}
+	for _, t := range []reflect.Type{reflect.TypeOf(ProcessReport{}), reflect.TypeOf(SystemReport{})} {
+		for i := 0; i < t.NumField(); i++ {
+			keys[strings.ToLower(t.Field(i).Name)] = true
+		}
+	}
+
+	return keys
+}()
+
+// Register adds c to the collectors run by inspectors. c is enabled.
+//
+// Returns an error if a collector with the name of c is already registered,
+// or if the name is taken by a field of ProcessReport or SystemReport,
+// regardless of case.
+func (self *Registry) Register(c Collector) error {
+	if self.Collector(c.Name()) != nil || reportKeys[strings.ToLower(c.Name())] {
+		return ErrorDuplicateCollector{c.Name()}
+	}
+
+	self.collectors = append(self.collectors, c)
+	return nil
+}
+
+// Collector returns the collector registered under name, nil if there is none.
+func (self *Registry) Collector(name string) Collector {
+	for _, c := range self.collectors {
+		if c.Name() == name {
+			return c
+		}
+	}
+
+	return nil
+}
+
+// Collectors returns all collectors of scope, enabled or not, in order of registration.
+func (self *Registry) Collectors(scope Scope) []Collector {
+	collectors := []Collector{}
+	for _, c := range self.collectors {
+		if c.Scope() == scope {
+			collectors = append(collectors, c)
+		}
+	}
+
+	return collectors
+}
+
+// Enabled returns true if the collector called name is run by inspectors.
+func (self *Registry) Enabled(name string) bool {
+	return !self.disabled[name]
+}
+
+// Enable runs the collector called name.
+//
+// Returns an error if no collector called name is registered.
+func (self *Registry) Enable(name string) error {
+	if self.Collector(name) == nil {
+		return ErrorUnknownCollector{name}
+	}
+
+	delete(self.disabled, name)
+	return nil
+}
+
+// Disable stops running the collector called name.
+//
+// Returns an error if no collector called name is registered.
+func (self *Registry) Disable(name string) error {
+	if self.Collector(name) == nil {
+		return ErrorUnknownCollector{name}
+	}
+
+	self.disabled[name] = true
+	return nil
+}
+
+// Configure registers the file collectors declared in config, and enables
+// and disables collectors accordingly.
+//
+// Returns an error if registering a file collector fails or if config names an unknown collector.
+func (self *Registry) Configure(config CollectorConfig) error {
+	for _, fc := range config.Files {
+		if err := self.Register(NewFileCollector(fc)); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range config.Disabled {
+		if err := self.Disable(name); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range config.Enabled {
+		if err := self.Enable(name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Load configures self with the CollectorConfig stored in path, see LoadCollectorConfig and Configure.
+//
+// Returns an error if loading the config or configuring self fails.
+func (self *Registry) Load(path string) error {
+	config, err := LoadCollectorConfig(path)
+	if err != nil {
+		return err
+	}
+
+	return self.Configure(*config)
+}
+
+// jobs returns the jobs running the collectors of scope in self against target,
+// recording disabled collectors in statuses. store is invoked with the results of
+// finished collectors, and failed determines the cause of failures.
+func (self *Registry) jobs(scope Scope, target Target, statuses map[string]CollectorStatus, store func(c Collector, v interface{}, err error), failed func(name string, err error) ErrorCollector) []collectorJob {
+	jobs := []collectorJob{}
+
+	for _, c := range self.Collectors(scope) {
+		if !self.Enabled(c.Name()) {
+			statuses[c.Name()] = CollectorStatus{State: CollectorDisabled}
+			continue
+		}
+
+		c := c
+		jobs = append(jobs, collectorJob{c.Name(), func(ctx context.Context) (func(), error) {
+			v, err := c.Collect(ctx, target)
+			return func() { store(c, v, err) }, err
+		}, func(err error) ErrorCollector {
+			return failed(c.Name(), err)
+		}})
+	}
+
+	return jobs
+}
+
+// marshalJSONWithResults encodes v, a struct, to a JSON object and appends
+// results, the results of collectors not built into csi, ordered by name.
+func marshalJSONWithResults(v interface{}, results map[string]interface{}) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil || len(results) == 0 {
+		return b, err
+	}
+
+	names := []string{}
+	for name := range results {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	buf := bytes.NewBuffer(b[:len(b)-1])
+	for _, name := range names {
+		value, err := json.Marshal(results[name])
+		if err != nil {
+			return nil, err
+		}
+
+		key, _ := json.Marshal(name)
+		buf.WriteByte(',')
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,264 @@
+package csi
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vosst/csi/proc"
+	"github.com/vosst/csi/proc/pid"
+	"gopkg.in/yaml.v2"
+)
+
+// threadCount is a site-specific collector reporting the number of threads of a process.
+type threadCount struct{}
+
+func (self threadCount) Name() string {
+	return "thread-count"
+}
+
+func (self threadCount) Scope() Scope {
+	return ScopeProcess
+}
+
+func (self threadCount) Collect(ctx context.Context, target Target) (interface{}, error) {
+	tasks, err := target.Proc.NewTasks(target.Pid)
+	return len(tasks), err
+}
+
+func TestRegistryRejectsDuplicateAndReservedNames(t *testing.T) {
+	r := NewDefaultRegistry()
+
+	assert.Nil(t, r.Register(threadCount{}))
+	assert.Equal(t, ErrorDuplicateCollector{"thread-count"}, r.Register(threadCount{}))
+	assert.Equal(t, ErrorDuplicateCollector{"cmdline"}, r.Register(NewFileCollector(FileCollectorConfig{Name: "cmdline"})))
+	assert.Equal(t, ErrorDuplicateCollector{"hostname"}, r.Register(NewFileCollector(FileCollectorConfig{Name: "hostname"})))
+	assert.Equal(t, ErrorDuplicateCollector{"Exe"}, r.Register(NewFileCollector(FileCollectorConfig{Name: "Exe"})))
+	assert.Equal(t, ErrorDuplicateCollector{"HostName"}, r.Register(NewFileCollector(FileCollectorConfig{Name: "HostName"})))
+
+	assert.Equal(t, ErrorUnknownCollector{"unknown"}, r.Disable("unknown"))
+}
+
+func TestBuiltInCollectorsAreNamedAfterTheKeysTheyFill(t *testing.T) {
+	// keys returns the paths of all keys in the YAML serialization of v, joined by dots.
+	keys := func(v interface{}) map[string]bool {
+		b, err := yaml.Marshal(v)
+		assert.Nil(t, err)
+
+		m := map[interface{}]interface{}{}
+		assert.Nil(t, yaml.Unmarshal(b, &m))
+
+		paths := map[string]bool{}
+		var walk func(prefix string, m map[interface{}]interface{})
+		walk = func(prefix string, m map[interface{}]interface{}) {
+			for k, v := range m {
+				path := prefix + k.(string)
+				paths[path] = true
+				if sub, ok := v.(map[interface{}]interface{}); ok {
+					walk(path+".", sub)
+				}
+			}
+		}
+		walk("", m)
+
+		return paths
+	}
+
+	pk, sk := keys(ProcessReport{}), keys(SystemReport{})
+	for _, c := range DefaultRegistry.Collectors(ScopeProcess) {
+		assert.True(t, pk[c.Name()], c.Name())
+	}
+
+	for _, c := range DefaultRegistry.Collectors(ScopeSystem) {
+		assert.True(t, sk[c.Name()], c.Name())
+	}
+}
+
+func TestRegistryIsConfiguredFromFile(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "csi-registry-test")
+	defer os.RemoveAll(dir)
+
+	log := filepath.Join(dir, "app.log")
+	assert.Nil(t, ioutil.WriteFile(log, []byte("first line\nlast line\n"), 0644))
+
+	fn := filepath.Join(dir, "collectors.yaml")
+	config := "disabled: [env, os.logs.syslog, os.logs.dmesg]\nenabled: [os.logs.dmesg]\nfiles:\n- name: app-log\n  path: " + log + "\n  limit: 10\n"
+	assert.Nil(t, ioutil.WriteFile(fn, []byte(config), 0644))
+
+	r := NewDefaultRegistry()
+	assert.Nil(t, r.Load(fn))
+
+	assert.False(t, r.Enabled("env"))
+	assert.False(t, r.Enabled("os.logs.syslog"))
+	assert.True(t, r.Enabled("os.logs.dmesg"))
+	assert.Equal(t, ScopeSystem, r.Collector("app-log").Scope())
+
+	v, err := r.Collector("app-log").Collect(context.Background(), Target{})
+	assert.Nil(t, err)
+	assert.Equal(t, "last line\n", v)
+
+	// A missing config leaves the registry untouched.
+	assert.Nil(t, NewDefaultRegistry().Load(filepath.Join(dir, "missing.yaml")))
+}
+
+func TestProcessReportSerializesResultsByCollectorName(t *testing.T) {
+	r := NewDefaultRegistry()
+	assert.Nil(t, r.Register(threadCount{}))
+	assert.Nil(t, r.Disable("env"))
+
+	pi := ProcessInspector{&fakeSystem{}, pid.FS("proc/test_data"), 0, r}
+	pr, err := pi.Inspect(1042)
+	assert.Nil(t, err)
+
+	assert.Nil(t, pr.Env)
+	assert.Equal(t, CollectorDisabled, pr.Collectors["env"].State)
+	assert.Equal(t, CollectorOk, pr.Collectors["thread-count"].State)
+	assert.Equal(t, 2, pr.Results["thread-count"])
+
+	b, err := yaml.Marshal(pr)
+	assert.Nil(t, err)
+	assert.Contains(t, string(b), "\nthread-count: 2\n")
+
+	decoded := ProcessReport{}
+	assert.Nil(t, yaml.Unmarshal(b, &decoded))
+	assert.Equal(t, 2, decoded.Results["thread-count"])
+	assert.Equal(t, pr.Exe, decoded.Exe)
+
+	b, err = json.Marshal(pr)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasSuffix(string(b), `,"thread-count":2}`))
+}
+
+func TestFileCollectorResolvesProcessPathsInRoot(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "csi-file-collector-test")
+	defer os.RemoveAll(dir)
+
+	assert.Nil(t, os.MkdirAll(filepath.Join(dir, "42", "root", "var", "log"), 0755))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "42", "root", "var", "log", "app.log"), []byte("contents"), 0644))
+
+	c := NewFileCollector(FileCollectorConfig{"app-log", ScopeProcess, "/var/log/app.log", 0})
+	v, err := c.Collect(context.Background(), Target{Pid: 42, Proc: pid.FS(dir)})
+	assert.Nil(t, err)
+	assert.Equal(t, "contents", v)
+
+	_, err = c.Collect(context.Background(), Target{Pid: 43, Proc: pid.FS(dir)})
+	assert.NotNil(t, err)
+}
+
+func TestFileCollectorResolvesSymlinksInRoot(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "csi-file-collector-test")
+	defer os.RemoveAll(dir)
+
+	root := filepath.Join(dir, "42", "root")
+	assert.Nil(t, os.MkdirAll(filepath.Join(root, "var", "log"), 0755))
+	assert.Nil(t, os.MkdirAll(filepath.Join(root, "data"), 0755))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(root, "data", "app.log"), []byte("contents"), 0644))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "secret"), []byte("secret"), 0644))
+
+	// Absolute links and links leaving the root stay in the root.
+	assert.Nil(t, os.Symlink("/data/app.log", filepath.Join(root, "var", "log", "app.log")))
+	assert.Nil(t, os.Symlink("../../../../../secret", filepath.Join(root, "var", "log", "escape.log")))
+	assert.Nil(t, os.Symlink(filepath.Join(dir, "secret"), filepath.Join(root, "var", "log", "host.log")))
+
+	target := Target{Pid: 42, Proc: pid.FS(dir)}
+
+	c := NewFileCollector(FileCollectorConfig{"app-log", ScopeProcess, "/var/log/app.log", 0})
+	v, err := c.Collect(context.Background(), target)
+	assert.Nil(t, err)
+	assert.Equal(t, "contents", v)
+
+	for _, fn := range []string{"/var/log/escape.log", "/var/log/host.log", "/../secret"} {
+		c := NewFileCollector(FileCollectorConfig{"app-log", ScopeProcess, fn, 0})
+		_, err := c.Collect(context.Background(), target)
+		assert.NotNil(t, err, fn)
+	}
+}
+
+func TestFileCollectorRejectsFilesThatAreNotRegular(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "csi-file-collector-test")
+	defer os.RemoveAll(dir)
+
+	fifo := filepath.Join(dir, "fifo")
+	assert.Nil(t, syscall.Mkfifo(fifo, 0644))
+
+	for _, fn := range []string{fifo, "/dev/zero", dir} {
+		c := NewFileCollector(FileCollectorConfig{"file", ScopeSystem, fn, 0})
+		_, err := c.Collect(context.Background(), Target{})
+		assert.NotNil(t, err, fn)
+	}
+}
+
+func TestFileCollectorLimitsFilesByDefault(t *testing.T) {
+	f, _ := ioutil.TempFile("", "csi-file-collector-test")
+	defer os.Remove(f.Name())
+	f.Write(make([]byte, DefaultFileLimit))
+	f.Write([]byte("tail"))
+	f.Close()
+
+	c := NewFileCollector(FileCollectorConfig{"file", ScopeSystem, f.Name(), 0})
+	v, err := c.Collect(context.Background(), Target{})
+	assert.Nil(t, err)
+	assert.Equal(t, DefaultFileLimit, len(v.(string)))
+	assert.True(t, strings.HasSuffix(v.(string), "tail"))
+}
+
+func TestSystemReportExplainsMemoryAndIOPressure(t *testing.T) {
+	r := NewRegistry()
+	for _, name := range []string{"os.memory", "os.vmstat", "os.pressure"} {
+		assert.Nil(t, r.Register(DefaultRegistry.Collector(name)))
+	}
+
+	si := SystemInspector{&fakeSystem{}, proc.FS("proc/test_data"), 0, r}
+	sr, err := si.Inspect()
+	assert.Nil(t, err)
+
+	assert.Equal(t, uint64(412772*1024), sr.OS.Memory.MemAvailable)
+	assert.Equal(t, uint64(3), sr.OS.VmStat.OomKill)
+	assert.Equal(t, 62.37, sr.OS.Pressure.Memory.Some.Avg10)
+	assert.Equal(t, 27.03, sr.OS.Pressure.IO.Full.Avg10)
+	assert.Equal(t, 4.12, sr.OS.Pressure.CPU.Some.Avg10)
+
+	si.Proc = proc.FS("does_not_exist")
+	sr, err = si.Inspect()
+	assert.Equal(t, 3, len(err.(ErrorCollectors)))
+	for _, name := range []string{"os.memory", "os.vmstat", "os.pressure"} {
+		assert.Equal(t, CollectorMissing, sr.Collectors[name].State, name)
+	}
+}
+
+func TestPressureCollectorKeepsResourcesTheKernelReports(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "csi-pressure-test")
+	defer os.RemoveAll(dir)
+
+	assert.Nil(t, os.MkdirAll(filepath.Join(dir, "pressure"), 0755))
+	for _, resource := range []string{proc.PressureCPU, proc.PressureMemory} {
+		b, err := ioutil.ReadFile(filepath.Join("proc", "test_data", "pressure", resource))
+		assert.Nil(t, err)
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "pressure", resource), b, 0644))
+	}
+
+	r := NewRegistry()
+	assert.Nil(t, r.Register(DefaultRegistry.Collector("os.pressure")))
+
+	si := SystemInspector{&fakeSystem{}, proc.FS(dir), 0, r}
+	sr, err := si.Inspect()
+	assert.Nil(t, err)
+	assert.Equal(t, CollectorOk, sr.Collectors["os.pressure"].State)
+	assert.Equal(t, 4.12, sr.OS.Pressure.CPU.Some.Avg10)
+	assert.Equal(t, 62.37, sr.OS.Pressure.Memory.Some.Avg10)
+	assert.Equal(t, proc.Pressure{}, sr.OS.Pressure.IO)
+
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "pressure", proc.PressureIO), []byte("garbage\n"), 0644))
+
+	sr, err = si.Inspect()
+	assert.NotNil(t, err)
+	assert.Equal(t, CollectorFailed, sr.Collectors["os.pressure"].State)
+	assert.Equal(t, 4.12, sr.OS.Pressure.CPU.Some.Avg10)
+	assert.Equal(t, 62.37, sr.OS.Pressure.Memory.Some.Avg10)
+}
@@ -0,0 +1,603 @@
+package stacktrace
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Pointer encodings used in .eh_frame, taken from the LSB specification.
+const (
+	dwEhPeAbsptr  = 0x00
+	dwEhPeUleb128 = 0x01
+	dwEhPeUdata2  = 0x02
+	dwEhPeUdata4  = 0x03
+	dwEhPeUdata8  = 0x04
+	dwEhPeSleb128 = 0x09
+	dwEhPeSdata2  = 0x0a
+	dwEhPeSdata4  = 0x0b
+	dwEhPeSdata8  = 0x0c
+	dwEhPePcrel   = 0x10
+	dwEhPeOmit    = 0xff
+)
+
+// Call frame instructions, taken from the DWARF 4 specification, section 7.23.
+const (
+	dwCfaAdvanceLoc        = 0x40
+	dwCfaOffset            = 0x80
+	dwCfaRestore           = 0xc0
+	dwCfaNop               = 0x00
+	dwCfaSetLoc            = 0x01
+	dwCfaAdvanceLoc1       = 0x02
+	dwCfaAdvanceLoc2       = 0x03
+	dwCfaAdvanceLoc4       = 0x04
+	dwCfaOffsetExtended    = 0x05
+	dwCfaRestoreExtended   = 0x06
+	dwCfaUndefined         = 0x07
+	dwCfaSameValue         = 0x08
+	dwCfaRegister          = 0x09
+	dwCfaRememberState     = 0x0a
+	dwCfaRestoreState      = 0x0b
+	dwCfaDefCfa            = 0x0c
+	dwCfaDefCfaRegister    = 0x0d
+	dwCfaDefCfaOffset      = 0x0e
+	dwCfaDefCfaExpression  = 0x0f
+	dwCfaExpression        = 0x10
+	dwCfaOffsetExtendedSf  = 0x11
+	dwCfaDefCfaSf          = 0x12
+	dwCfaDefCfaOffsetSf    = 0x13
+	dwCfaValOffset         = 0x14
+	dwCfaValOffsetSf       = 0x15
+	dwCfaValExpression     = 0x16
+	dwCfaGnuArgsSize       = 0x2e
+	dwCfaGnuNegOffsetExtSf = 0x2f
+)
+
+// cfiReader decodes the primitive values found in .eh_frame and .debug_frame sections.
+type cfiReader struct {
+	b     []byte
+	off   int
+	order binary.ByteOrder
+	ws    int    // Size of an address in bytes
+	addr  uint64 // Virtual address of b[0], required for pc-relative pointers
+	err   error
+}
+
+func (self *cfiReader) need(n int) bool {
+	if self.err == nil && (n < 0 || self.off < 0 || self.off > len(self.b) || n > len(self.b)-self.off) {
+		self.err = errors.New("Failed to decode call frame information, unexpected end of data")
+	}
+
+	return self.err == nil
+}
+
+func (self *cfiReader) u8() uint8 {
+	if !self.need(1) {
+		return 0
+	}
+	self.off++
+	return self.b[self.off-1]
+}
+
+func (self *cfiReader) u16() uint16 {
+	if !self.need(2) {
+		return 0
+	}
+	self.off += 2
+	return self.order.Uint16(self.b[self.off-2:])
+}
+
+func (self *cfiReader) u32() uint32 {
+	if !self.need(4) {
+		return 0
+	}
+	self.off += 4
+	return self.order.Uint32(self.b[self.off-4:])
+}
+
+func (self *cfiReader) u64() uint64 {
+	if !self.need(8) {
+		return 0
+	}
+	self.off += 8
+	return self.order.Uint64(self.b[self.off-8:])
+}
+
+func (self *cfiReader) word() uint64 {
+	if self.ws == 8 {
+		return self.u64()
+	}
+
+	return uint64(self.u32())
+}
+
+func (self *cfiReader) uleb() uint64 {
+	var v uint64
+	for shift := uint(0); self.need(1); shift += 7 {
+		b := self.u8()
+		v |= uint64(b&0x7f) << shift
+		if b&0x80 == 0 {
+			break
+		}
+	}
+
+	return v
+}
+
+func (self *cfiReader) sleb() int64 {
+	var v int64
+	var b uint8
+	shift := uint(0)
+	for self.need(1) {
+		b = self.u8()
+		v |= int64(b&0x7f) << shift
+		shift += 7
+		if b&0x80 == 0 {
+			break
+		}
+	}
+
+	if shift < 64 && b&0x40 != 0 {
+		v |= -1 << shift
+	}
+
+	return v
+}
+
+func (self *cfiReader) cstring() string {
+	start := self.off
+	for self.need(1) && self.b[self.off] != 0 {
+		self.off++
+	}
+	s := string(self.b[start:self.off])
+	self.u8()
+	return s
+}
+
+func (self *cfiReader) block(n uint64) []byte {
+	// Clamp n such that huge lengths do not overflow int but fail need.
+	if n > uint64(len(self.b)) {
+		n = uint64(len(self.b)) + 1
+	}
+
+	if !self.need(int(n)) {
+		return nil
+	}
+	self.off += int(n)
+	return self.b[self.off-int(n) : self.off]
+}
+
+// entryLength decodes the initial length of a CIE or FDE, following the
+// escape 0xffffffff to a 64-bit length. Returns the length and the size of
+// the id following it, 8 for 64-bit DWARF and 4 otherwise.
+func (self *cfiReader) entryLength() (uint64, int) {
+	length := uint64(self.u32())
+	if length == 0xffffffff {
+		return self.u64(), 8
+	}
+
+	return length, 4
+}
+
+// id decodes the CIE id or CIE pointer of an entry, of size idSize.
+func (self *cfiReader) id(idSize int) uint64 {
+	if idSize == 8 {
+		return self.u64()
+	}
+
+	return uint64(self.u32())
+}
+
+// encoded decodes a pointer using encoding enc.
+func (self *cfiReader) encoded(enc uint8) uint64 {
+	if enc == dwEhPeOmit {
+		return 0
+	}
+
+	pos := self.addr + uint64(self.off)
+
+	var v uint64
+	switch enc & 0x0f {
+	case dwEhPeAbsptr:
+		v = self.word()
+	case dwEhPeUleb128:
+		v = self.uleb()
+	case dwEhPeUdata2:
+		v = uint64(self.u16())
+	case dwEhPeUdata4:
+		v = uint64(self.u32())
+	case dwEhPeUdata8:
+		v = self.u64()
+	case dwEhPeSleb128:
+		v = uint64(self.sleb())
+	case dwEhPeSdata2:
+		v = uint64(int16(self.u16()))
+	case dwEhPeSdata4:
+		v = uint64(int32(self.u32()))
+	case dwEhPeSdata8:
+		v = self.u64()
+	default:
+		if self.err == nil {
+			self.err = errors.New(fmt.Sprintf("Unsupported pointer encoding %#x", enc))
+		}
+	}
+
+	switch enc & 0x70 {
+	case 0:
+	case dwEhPePcrel:
+		v += pos
+	default:
+		if self.err == nil {
+			self.err = errors.New(fmt.Sprintf("Unsupported pointer application %#x", enc))
+		}
+	}
+
+	return v
+}
+
+// cie models a common information entry.
+type cie struct {
+	codeAlign   uint64
+	dataAlign   int64
+	raReg       uint64
+	fdeEncoding uint8
+	augmented   bool // True if FDEs carry augmentation data
+	initial     []byte
+	initialAddr uint64
+}
+
+// fde models a frame description entry, covering the address range [begin, end).
+type fde struct {
+	cie          *cie
+	begin, end   uint64
+	instructions []byte
+	instrAddr    uint64
+}
+
+// frameTable holds all FDEs of a .eh_frame or .debug_frame section, sorted by address.
+type frameTable []fde
+
+// parseFrameTable parses the .eh_frame (if eh is true) or .debug_frame section b,
+// located at virtual address addr.
+//
+// Returns an error if the section is malformed.
+func parseFrameTable(b []byte, addr uint64, order binary.ByteOrder, ws int, eh bool) (frameTable, error) {
+	cies := map[int]*cie{}
+	table := frameTable{}
+
+	for off := 0; off+4 <= len(b); {
+		r := cfiReader{b: b, off: off, order: order, ws: ws, addr: addr}
+
+		length, idSize := r.entryLength()
+		if r.err != nil {
+			return nil, errors.New("Failed to parse call frame information, entry exceeds section")
+		}
+
+		if length == 0 {
+			// A zero terminator ends .eh_frame.
+			if eh {
+				break
+			}
+			off = r.off
+			continue
+		}
+
+		start := r.off
+		if length > uint64(len(b)-start) {
+			return nil, errors.New("Failed to parse call frame information, entry exceeds section")
+		}
+		end := start + int(length)
+		r.b = b[:end]
+
+		id := r.id(idSize)
+
+		if isCieId(id, idSize, eh) {
+			c, err := parseCie(&r, eh)
+			if err != nil {
+				return nil, err
+			}
+			cies[off] = c
+		} else {
+			// In .eh_frame, the CIE pointer is relative to the pointer itself.
+			cieOff := int64(id)
+			if eh {
+				cieOff = int64(start) - int64(id)
+			}
+
+			c, present := cies[int(cieOff)]
+			if !present {
+				var err error
+				if c, err = resolveCie(b, cieOff, addr, order, ws, eh); err != nil {
+					return nil, err
+				}
+				cies[int(cieOff)] = c
+			}
+
+			enc := c.fdeEncoding
+			if !eh {
+				enc = dwEhPeAbsptr
+			}
+
+			begin := r.encoded(enc)
+			size := r.encoded(enc & 0x0f)
+			if c.augmented {
+				r.block(r.uleb())
+			}
+
+			if r.err != nil {
+				return nil, r.err
+			}
+
+			table = append(table, fde{c, begin, begin + size, b[r.off:end], addr + uint64(r.off)})
+		}
+
+		off = end
+	}
+
+	sort.Sort(table)
+	return table, nil
+}
+
+// isCieId returns true if id, of size idSize, marks a CIE rather than an FDE.
+func isCieId(id uint64, idSize int, eh bool) bool {
+	if eh {
+		return id == 0
+	}
+
+	return (idSize == 4 && id == 0xffffffff) || (idSize == 8 && id == 0xffffffffffffffff)
+}
+
+// resolveCie parses the CIE at offset off of the section b, referenced by an FDE.
+//
+// Returns an error if off does not refer to a well-formed CIE within b.
+func resolveCie(b []byte, off int64, addr uint64, order binary.ByteOrder, ws int, eh bool) (*cie, error) {
+	if off < 0 || off >= int64(len(b)) {
+		return nil, errors.New(fmt.Sprintf("Failed to resolve CIE at offset %d, exceeds section", off))
+	}
+
+	r := cfiReader{b: b, off: int(off), order: order, ws: ws, addr: addr}
+
+	length, idSize := r.entryLength()
+	if r.err != nil || length == 0 || length > uint64(len(b)-r.off) {
+		return nil, errors.New(fmt.Sprintf("Failed to resolve CIE at offset %d, entry exceeds section", off))
+	}
+	r.b = b[:r.off+int(length)]
+
+	if !isCieId(r.id(idSize), idSize, eh) || r.err != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to resolve CIE at offset %d, not a CIE", off))
+	}
+
+	return parseCie(&r, eh)
+}
+
+// parseCie parses a CIE, starting right after its id.
+func parseCie(r *cfiReader, eh bool) (*cie, error) {
+	c := cie{fdeEncoding: dwEhPeAbsptr}
+
+	version := r.u8()
+	augmentation := r.cstring()
+	if !eh && version >= 4 {
+		// address_size and segment_size
+		r.u8()
+		r.u8()
+	}
+
+	c.codeAlign = r.uleb()
+	c.dataAlign = r.sleb()
+	if version == 1 {
+		c.raReg = uint64(r.u8())
+	} else {
+		c.raReg = r.uleb()
+	}
+
+	if len(augmentation) > 0 && augmentation[0] == 'z' {
+		c.augmented = true
+		data := cfiReader{b: r.block(r.uleb()), order: r.order, ws: r.ws, addr: r.addr + uint64(r.off)}
+		data.addr -= uint64(len(data.b))
+
+		for _, a := range augmentation[1:] {
+			switch a {
+			case 'R':
+				c.fdeEncoding = data.u8()
+			case 'L':
+				data.u8()
+			case 'P':
+				data.encoded(data.u8())
+			case 'S':
+			default:
+				return nil, errors.New(fmt.Sprintf("Unsupported CIE augmentation %q", augmentation))
+			}
+		}
+	} else if len(augmentation) > 0 && augmentation != "eh" {
+		return nil, errors.New(fmt.Sprintf("Unsupported CIE augmentation %q", augmentation))
+	}
+
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	c.initial = r.b[r.off:]
+	c.initialAddr = r.addr + uint64(r.off)
+	return &c, nil
+}
+
+func (self frameTable) Len() int           { return len(self) }
+func (self frameTable) Less(i, j int) bool { return self[i].begin < self[j].begin }
+func (self frameTable) Swap(i, j int)      { self[i], self[j] = self[j], self[i] }
+
+// find returns the FDE covering pc, or nil if there is none.
+func (self frameTable) find(pc uint64) *fde {
+	i := sort.Search(len(self), func(i int) bool { return self[i].begin > pc }) - 1
+	if i >= 0 && pc < self[i].end {
+		return &self[i]
+	}
+
+	return nil
+}
+
+// ruleKind enumerates the ways a register of the calling frame can be recovered.
+type ruleKind int
+
+const (
+	ruleSameValue  ruleKind = iota // Register is unchanged
+	ruleUndefined                  // Register cannot be recovered
+	ruleOffset                     // Register is saved at CFA+value
+	ruleValOffset                  // Register equals CFA+value
+	ruleRegister                   // Register is saved in register value
+	ruleExpression                 // Register is described by a DWARF expression, not supported
+)
+
+type rule struct {
+	kind  ruleKind
+	value int64
+}
+
+// row describes how to compute the canonical frame address (CFA) and how to
+// recover registers of the calling frame at a given address.
+type row struct {
+	cfaReg    uint64
+	cfaOffset int64
+	cfaExpr   bool // True if the CFA is described by a DWARF expression, not supported
+	rules     map[uint64]rule
+}
+
+func (self row) clone() row {
+	rules := make(map[uint64]rule, len(self.rules))
+	for k, v := range self.rules {
+		rules[k] = v
+	}
+	self.rules = rules
+	return self
+}
+
+// row executes the call frame instructions of the FDE up to pc.
+//
+// Returns an error if the instructions are malformed.
+func (self *fde) row(pc uint64, order binary.ByteOrder, ws int) (row, error) {
+	r := row{rules: map[uint64]rule{}}
+
+	ir := cfiReader{b: self.cie.initial, order: order, ws: ws, addr: self.cie.initialAddr}
+	if err := self.execute(&ir, &r, nil, ^uint64(0)); err != nil {
+		return r, err
+	}
+
+	initial := r.clone()
+	fr := cfiReader{b: self.instructions, order: order, ws: ws, addr: self.instrAddr}
+	err := self.execute(&fr, &r, &initial, pc)
+	return r, err
+}
+
+// execute interprets the instructions available from r, updating row, until
+// the location exceeds pc.
+func (self *fde) execute(r *cfiReader, current *row, initial *row, pc uint64) error {
+	c := self.cie
+	loc := self.begin
+	stack := []row{}
+
+	restore := func(reg uint64) {
+		if initial == nil {
+			return
+		}
+		if rl, present := initial.rules[reg]; present {
+			current.rules[reg] = rl
+		} else {
+			delete(current.rules, reg)
+		}
+	}
+
+	for r.off < len(r.b) && r.err == nil {
+		op := r.u8()
+
+		switch op & 0xc0 {
+		case dwCfaAdvanceLoc:
+			loc += uint64(op&0x3f) * c.codeAlign
+			if loc > pc {
+				return nil
+			}
+			continue
+		case dwCfaOffset:
+			current.rules[uint64(op&0x3f)] = rule{ruleOffset, int64(r.uleb()) * c.dataAlign}
+			continue
+		case dwCfaRestore:
+			restore(uint64(op & 0x3f))
+			continue
+		}
+
+		switch op {
+		case dwCfaNop:
+		case dwCfaSetLoc:
+			loc = r.encoded(c.fdeEncoding)
+		case dwCfaAdvanceLoc1:
+			loc += uint64(r.u8()) * c.codeAlign
+		case dwCfaAdvanceLoc2:
+			loc += uint64(r.u16()) * c.codeAlign
+		case dwCfaAdvanceLoc4:
+			loc += uint64(r.u32()) * c.codeAlign
+		case dwCfaOffsetExtended:
+			reg := r.uleb()
+			current.rules[reg] = rule{ruleOffset, int64(r.uleb()) * c.dataAlign}
+		case dwCfaRestoreExtended:
+			restore(r.uleb())
+		case dwCfaUndefined:
+			current.rules[r.uleb()] = rule{ruleUndefined, 0}
+		case dwCfaSameValue:
+			current.rules[r.uleb()] = rule{ruleSameValue, 0}
+		case dwCfaRegister:
+			reg := r.uleb()
+			current.rules[reg] = rule{ruleRegister, int64(r.uleb())}
+		case dwCfaRememberState:
+			stack = append(stack, current.clone())
+		case dwCfaRestoreState:
+			if len(stack) == 0 {
+				return errors.New("Failed to execute call frame instructions, state stack is empty")
+			}
+			*current = stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+		case dwCfaDefCfa:
+			current.cfaReg = r.uleb()
+			current.cfaOffset = int64(r.uleb())
+			current.cfaExpr = false
+		case dwCfaDefCfaRegister:
+			current.cfaReg = r.uleb()
+			current.cfaExpr = false
+		case dwCfaDefCfaOffset:
+			current.cfaOffset = int64(r.uleb())
+		case dwCfaDefCfaExpression:
+			r.block(r.uleb())
+			current.cfaExpr = true
+		case dwCfaExpression, dwCfaValExpression:
+			reg := r.uleb()
+			r.block(r.uleb())
+			current.rules[reg] = rule{ruleExpression, 0}
+		case dwCfaOffsetExtendedSf:
+			reg := r.uleb()
+			current.rules[reg] = rule{ruleOffset, r.sleb() * c.dataAlign}
+		case dwCfaDefCfaSf:
+			current.cfaReg = r.uleb()
+			current.cfaOffset = r.sleb() * c.dataAlign
+			current.cfaExpr = false
+		case dwCfaDefCfaOffsetSf:
+			current.cfaOffset = r.sleb() * c.dataAlign
+		case dwCfaValOffset:
+			reg := r.uleb()
+			current.rules[reg] = rule{ruleValOffset, int64(r.uleb()) * c.dataAlign}
+		case dwCfaValOffsetSf:
+			reg := r.uleb()
+			current.rules[reg] = rule{ruleValOffset, r.sleb() * c.dataAlign}
+		case dwCfaGnuArgsSize:
+			r.uleb()
+		case dwCfaGnuNegOffsetExtSf:
+			reg := r.uleb()
+			current.rules[reg] = rule{ruleOffset, -int64(r.uleb()) * c.dataAlign}
+		default:
+			return errors.New(fmt.Sprintf("Unsupported call frame instruction %#x", op))
+		}
+
+		if loc > pc {
+			return nil
+		}
+	}
+
+	return r.err
+}
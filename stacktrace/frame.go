@@ -0,0 +1,71 @@
+// Package stacktrace unwinds and symbolizes the stack of a crashed thread
+// offline, relying on the call frame information, symbol tables and DWARF
+// information of the binaries mapped into the crashed process.
+package stacktrace
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// stacktraceTopFrames is the number of frames included in the StacktraceTop field of apport reports.
+const stacktraceTopFrames = 5
+
+// Frame describes an individual frame of a stack trace.
+type Frame struct {
+	PC       uint64 // Program counter, or the return address for all but the innermost frame
+	Function string // Name of the function containing PC, empty if unknown
+	Offset   uint64 // Offset of PC into Function
+	File     string // Source file containing PC, empty if unknown
+	Line     int    // Line in File
+	Module   string // Path of the binary containing PC, empty if unknown
+}
+
+// location pretty prints the frame in the format used by gdb.
+func (self Frame) location() string {
+	fn := "??"
+	if len(self.Function) > 0 {
+		fn = self.Function
+	}
+
+	switch {
+	case len(self.File) > 0:
+		return fmt.Sprintf("%s () at %s:%d", fn, self.File, self.Line)
+	case len(self.Module) > 0:
+		return fmt.Sprintf("%s () from %s", fn, self.Module)
+	}
+
+	return fmt.Sprintf("%s ()", fn)
+}
+
+// Stacktrace is a sequence of frames, starting with the innermost frame.
+type Stacktrace []Frame
+
+// String pretty prints the stack trace in the format of apport's Stacktrace field.
+func (self Stacktrace) String() string {
+	var buf bytes.Buffer
+	for i, frame := range self {
+		if i > 0 {
+			buf.WriteString("\n")
+		}
+		fmt.Fprintf(&buf, "#%d  0x%016x in %s", i, frame.PC, frame.location())
+	}
+
+	return buf.String()
+}
+
+// Top pretty prints the innermost frames in the format of apport's StacktraceTop field.
+func (self Stacktrace) Top() string {
+	var buf bytes.Buffer
+	for i, frame := range self {
+		if i == stacktraceTopFrames {
+			break
+		}
+		if i > 0 {
+			buf.WriteString("\n")
+		}
+		buf.WriteString(frame.location())
+	}
+
+	return buf.String()
+}
@@ -0,0 +1,33 @@
+package stacktrace
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testStacktrace = Stacktrace{
+	{PC: 0x7f0000001234, Function: "raise", Module: "/lib/x86_64-linux-gnu/libc.so.6"},
+	{PC: 0x400567, Function: "main", File: "main.c", Line: 42, Module: "/usr/bin/crashy"},
+	{PC: 0x1234},
+}
+
+func TestStacktracePrettyPrintsLikeGdb(t *testing.T) {
+	assert.Equal(t,
+		"#0  0x00007f0000001234 in raise () from /lib/x86_64-linux-gnu/libc.so.6\n"+
+			"#1  0x0000000000400567 in main () at main.c:42\n"+
+			"#2  0x0000000000001234 in ?? ()",
+		testStacktrace.String())
+}
+
+func TestStacktraceTopOmitsAddressesAndLimitsFrames(t *testing.T) {
+	assert.Equal(t,
+		"raise () from /lib/x86_64-linux-gnu/libc.so.6\nmain () at main.c:42\n?? ()",
+		testStacktrace.Top())
+
+	long := Stacktrace{}
+	for i := 0; i < 2*stacktraceTopFrames; i++ {
+		long = append(long, Frame{Function: "f"})
+	}
+	assert.Equal(t, "f ()\nf ()\nf ()\nf ()\nf ()", long.Top())
+}
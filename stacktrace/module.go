@@ -0,0 +1,279 @@
+package stacktrace
+
+import (
+	"debug/dwarf"
+	"debug/elf"
+	"encoding/binary"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/vosst/csi/proc/pid"
+)
+
+// DefaultDebugDir is the directory that distributions install separate debug files to.
+const DefaultDebugDir = "/usr/lib/debug"
+
+// Module describes an ELF file mapped into the address space of a process.
+//
+// Symbols, DWARF information and call frame information are loaded lazily
+// on first use.
+type Module struct {
+	Path     string // Path of the mapped file
+	Start    uint64 // Lowest address covered by a mapping of the file
+	End      uint64 // Highest address covered by a mapping of the file
+	Bias     uint64 // Difference between run-time and link-time addresses
+	DebugDir string // Directory searched for separate debug files
+	Root     string // Directory Path and DebugDir are resolved in, e.g., the root of a container, the host's root if empty
+
+	regions []pid.MemoryRegion
+	loaded  bool
+	symbols []elf.Symbol
+	dwarf   *dwarf.Data
+	frames  []frameTable
+	order   binary.ByteOrder
+	ws      int
+}
+
+// Modules is a collection of modules, sorted by address.
+type Modules []*Module
+
+// NewModules assembles the modules mapped into a process from maps, searching
+// for separate debug files in debugDir. Anonymous and pseudo mappings, e.g., [stack],
+// are ignored.
+func NewModules(maps pid.Maps, debugDir string) Modules {
+	return NewModulesInRoot(maps, debugDir, "")
+}
+
+// NewModulesInRoot is like NewModules but resolves the paths of mapped files
+// and debugDir in root, e.g., for processes executing in a different mount
+// namespace, seen through /proc/%{pid}/root.
+func NewModulesInRoot(maps pid.Maps, debugDir string, root string) Modules {
+	modules := Modules{}
+	byPath := map[string]*Module{}
+
+	for _, mr := range maps {
+		if !strings.HasPrefix(mr.Path, "/") || strings.HasSuffix(mr.Path, " (deleted)") {
+			continue
+		}
+
+		m, present := byPath[mr.Path]
+		if !present {
+			m = &Module{Path: mr.Path, Start: uint64(mr.Address.Begin), End: uint64(mr.Address.End), DebugDir: debugDir, Root: root}
+			byPath[mr.Path] = m
+			modules = append(modules, m)
+		}
+
+		if uint64(mr.Address.Begin) < m.Start {
+			m.Start = uint64(mr.Address.Begin)
+		}
+		if uint64(mr.Address.End) > m.End {
+			m.End = uint64(mr.Address.End)
+		}
+		m.regions = append(m.regions, mr)
+	}
+
+	sort.Sort(modules)
+	return modules
+}
+
+func (self Modules) Len() int           { return len(self) }
+func (self Modules) Less(i, j int) bool { return self[i].Start < self[j].Start }
+func (self Modules) Swap(i, j int)      { self[i], self[j] = self[j], self[i] }
+
+// Lookup returns the module covering addr, or nil if addr is not covered by any module.
+func (self Modules) Lookup(addr uint64) *Module {
+	i := sort.Search(len(self), func(i int) bool { return self[i].Start > addr }) - 1
+	if i >= 0 && addr < self[i].End {
+		return self[i]
+	}
+
+	return nil
+}
+
+// inRoot resolves path in self.Root.
+func (self *Module) inRoot(path string) string {
+	if len(self.Root) == 0 {
+		return path
+	}
+
+	return filepath.Join(self.Root, path)
+}
+
+// openDebugFile opens the separate debug file for f, as installed to
+// ${DebugDir}/.build-id/xx/yyyy.debug. Returns nil if there is none.
+func (self *Module) openDebugFile(f *elf.File) *elf.File {
+	id := string(pid.NewBuildIdFromELF(f))
+	if len(id) < 3 || len(self.DebugDir) == 0 {
+		return nil
+	}
+
+	df, err := elf.Open(self.inRoot(filepath.Join(self.DebugDir, ".build-id", id[:2], id[2:]+".debug")))
+	if err != nil {
+		return nil
+	}
+
+	return df
+}
+
+// sectionData returns the contents of the section called name, or nil if f
+// does not contain the section or if the section does not occupy space in f.
+func sectionData(f *elf.File, name string) (*elf.Section, []byte) {
+	s := f.Section(name)
+	if s == nil || s.Type == elf.SHT_NOBITS {
+		return nil, nil
+	}
+
+	b, err := s.Data()
+	if err != nil {
+		return nil, nil
+	}
+
+	return s, b
+}
+
+// load reads symbols, DWARF and call frame information from the mapped file
+// and its separate debug file. Failures leave the module without the
+// respective information.
+func (self *Module) load() {
+	if self.loaded {
+		return
+	}
+	self.loaded = true
+
+	f, err := elf.Open(self.inRoot(self.Path))
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	self.order = f.ByteOrder
+	self.ws = 4
+	if f.Class == elf.ELFCLASS64 {
+		self.ws = 8
+	}
+
+	// The mapping of the segment containing a region's file offset determines the load bias.
+bias:
+	for _, mr := range self.regions {
+		for _, prog := range f.Progs {
+			if prog.Type == elf.PT_LOAD && uint64(mr.Offset) <= prog.Off && prog.Off < uint64(mr.Offset)+uint64(mr.Address.End-mr.Address.Begin) {
+				self.Bias = uint64(mr.Address.Begin) - (prog.Vaddr - (prog.Off - uint64(mr.Offset)))
+				break bias
+			}
+		}
+	}
+
+	files := []*elf.File{f}
+	if df := self.openDebugFile(f); df != nil {
+		defer df.Close()
+		files = []*elf.File{df, f}
+	}
+
+	for _, file := range files {
+		if syms, err := file.Symbols(); err == nil {
+			self.symbols = append(self.symbols, syms...)
+		}
+		if syms, err := file.DynamicSymbols(); err == nil {
+			self.symbols = append(self.symbols, syms...)
+		}
+
+		if self.dwarf == nil {
+			if d, err := file.DWARF(); err == nil {
+				self.dwarf = d
+			}
+		}
+	}
+
+	funcs := self.symbols[:0]
+	for _, sym := range self.symbols {
+		if elf.ST_TYPE(sym.Info) == elf.STT_FUNC && sym.Value != 0 {
+			funcs = append(funcs, sym)
+		}
+	}
+	self.symbols = funcs
+	sort.Sort(bySymbolValue(self.symbols))
+
+	if s, b := sectionData(f, ".eh_frame"); s != nil {
+		if t, err := parseFrameTable(b, s.Addr, f.ByteOrder, self.ws, true); err == nil {
+			self.frames = append(self.frames, t)
+		}
+	}
+
+	for _, file := range files {
+		if s, b := sectionData(file, ".debug_frame"); s != nil {
+			if t, err := parseFrameTable(b, s.Addr, file.ByteOrder, self.ws, false); err == nil {
+				self.frames = append(self.frames, t)
+				break
+			}
+		}
+	}
+}
+
+type bySymbolValue []elf.Symbol
+
+func (self bySymbolValue) Len() int           { return len(self) }
+func (self bySymbolValue) Less(i, j int) bool { return self[i].Value < self[j].Value }
+func (self bySymbolValue) Swap(i, j int)      { self[i], self[j] = self[j], self[i] }
+
+// symbol returns the function symbol containing the link-time address addr, or nil.
+func (self *Module) symbol(addr uint64) *elf.Symbol {
+	i := sort.Search(len(self.symbols), func(i int) bool { return self.symbols[i].Value > addr }) - 1
+	if i < 0 {
+		return nil
+	}
+
+	sym := &self.symbols[i]
+	if sym.Size > 0 && addr >= sym.Value+sym.Size {
+		return nil
+	}
+
+	return sym
+}
+
+// fde returns the frame description entry covering the link-time address addr, or nil.
+func (self *Module) fde(addr uint64) *fde {
+	for _, t := range self.frames {
+		if f := t.find(addr); f != nil {
+			return f
+		}
+	}
+
+	return nil
+}
+
+// Symbolize resolves the run-time address pc to a function and, if DWARF
+// information is available, to a source location.
+func (self *Module) Symbolize(pc uint64) Frame {
+	self.load()
+
+	frame := Frame{PC: pc, Module: self.Path}
+	addr := pc - self.Bias
+
+	if sym := self.symbol(addr); sym != nil {
+		frame.Function = sym.Name
+		frame.Offset = addr - sym.Value
+	}
+
+	if self.dwarf == nil {
+		return frame
+	}
+
+	cu, err := self.dwarf.Reader().SeekPC(addr)
+	if err != nil {
+		return frame
+	}
+
+	lr, err := self.dwarf.LineReader(cu)
+	if err != nil || lr == nil {
+		return frame
+	}
+
+	var entry dwarf.LineEntry
+	if err := lr.SeekPC(addr, &entry); err == nil && entry.File != nil {
+		frame.File = entry.File.Name
+		frame.Line = entry.Line
+	}
+
+	return frame
+}
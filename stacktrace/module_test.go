@@ -0,0 +1,84 @@
+package stacktrace
+
+import (
+	"debug/elf"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vosst/csi/proc/pid"
+)
+
+func TestNewModulesGroupsMappingsByPath(t *testing.T) {
+	maps, err := pid.NewMapsFromReader(strings.NewReader(
+		"00400000-00401000 r-xp 00000000 08:02 1 /usr/bin/crashy\n" +
+			"00601000-00602000 rw-p 00001000 08:02 1 /usr/bin/crashy\n" +
+			"00602000-00623000 rw-p 00000000 00:00 0 [heap]\n" +
+			"7f0000000000-7f0000002000 r-xp 00000000 08:02 2 /lib/libc.so.6\n" +
+			"7f0000003000-7f0000004000 r-xp 00000000 08:02 3 /tmp/gone (deleted)\n"))
+	assert.Nil(t, err)
+
+	modules := NewModules(maps, DefaultDebugDir)
+	assert.Equal(t, 2, len(modules))
+
+	assert.Equal(t, "/usr/bin/crashy", modules[0].Path)
+	assert.Equal(t, uint64(0x400000), modules[0].Start)
+	assert.Equal(t, uint64(0x602000), modules[0].End)
+
+	assert.Equal(t, modules[0], modules.Lookup(0x600000))
+	assert.Equal(t, modules[1], modules.Lookup(0x7f0000001000))
+	assert.Nil(t, modules.Lookup(0x602000))
+}
+
+func TestModuleComputesLoadBiasOfRunningBinary(t *testing.T) {
+	maps, err := pid.NewMaps(os.Getpid())
+	assert.Nil(t, err)
+
+	pc := uint64(reflect.ValueOf(TestModuleComputesLoadBiasOfRunningBinary).Pointer())
+	m := NewModules(maps, DefaultDebugDir).Lookup(pc)
+	assert.NotNil(t, m)
+	m.load()
+
+	f, err := elf.Open(m.Path)
+	assert.Nil(t, err)
+	defer f.Close()
+
+	text := f.Section(".text")
+	assert.True(t, text.Addr <= pc-m.Bias && pc-m.Bias < text.Addr+text.Size)
+}
+
+func TestNewModulesInRootResolvesPathsInRoot(t *testing.T) {
+	maps, err := pid.NewMaps(os.Getpid())
+	assert.Nil(t, err)
+
+	pc := uint64(reflect.ValueOf(TestNewModulesInRootResolvesPathsInRoot).Pointer())
+	exe := NewModules(maps, DefaultDebugDir).Lookup(pc)
+	assert.NotNil(t, exe)
+
+	root, err := ioutil.TempDir("", "csi-module-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(root)
+
+	// The binary is known to the process as /bin/crashy.
+	assert.Nil(t, os.MkdirAll(filepath.Join(root, "bin"), 0755))
+	assert.Nil(t, os.Symlink(exe.Path, filepath.Join(root, "bin", "crashy")))
+	for i := range maps {
+		if maps[i].Path == exe.Path {
+			maps[i].Path = "/bin/crashy"
+		}
+	}
+
+	m := NewModulesInRoot(maps, DefaultDebugDir, root).Lookup(pc)
+	assert.NotNil(t, m)
+	assert.Equal(t, "/bin/crashy", m.Path)
+	m.load()
+	assert.NotEqual(t, 0, len(m.symbols))
+
+	m = NewModules(maps, DefaultDebugDir).Lookup(pc)
+	m.load()
+	assert.Equal(t, 0, len(m.symbols))
+}
@@ -0,0 +1,220 @@
+package stacktrace
+
+import (
+	"debug/elf"
+	"errors"
+	"fmt"
+
+	"github.com/vosst/csi/core"
+)
+
+// DefaultMaxFrames limits the number of frames unwound if Unwinder.MaxFrames is not set.
+const DefaultMaxFrames = 256
+
+// Memory provides access to the memory of a crashed process, e.g., *core.Core.
+type Memory interface {
+	// ReadWord reads a word of the process's native size at addr.
+	ReadWord(addr uint64) (uint64, error)
+}
+
+// arch describes the DWARF register numbering and the frame layout of a machine.
+type arch struct {
+	names         []string // Register names, indexed by DWARF register number
+	sp, fp, ra    uint64   // DWARF register numbers of stack pointer, frame pointer and return address
+	wordSize      uint64   // Size of a word in bytes
+	framePointers bool     // True if frames can be unwound by following frame pointers
+}
+
+var arches = map[elf.Machine]arch{
+	elf.EM_X86_64: {
+		names: []string{
+			"rax", "rdx", "rcx", "rbx", "rsi", "rdi", "rbp", "rsp", "r8", "r9",
+			"r10", "r11", "r12", "r13", "r14", "r15", "rip",
+		},
+		sp: 7, fp: 6, ra: 16, wordSize: 8, framePointers: true,
+	},
+	elf.EM_386: {
+		names: []string{"eax", "ecx", "edx", "ebx", "esp", "ebp", "esi", "edi", "eip"},
+		sp:    4, fp: 5, ra: 8, wordSize: 4, framePointers: true,
+	},
+	elf.EM_AARCH64: {
+		names: []string{
+			"x0", "x1", "x2", "x3", "x4", "x5", "x6", "x7", "x8", "x9", "x10",
+			"x11", "x12", "x13", "x14", "x15", "x16", "x17", "x18", "x19", "x20",
+			"x21", "x22", "x23", "x24", "x25", "x26", "x27", "x28", "x29", "x30",
+			"sp",
+		},
+		sp: 31, fp: 29, ra: 30, wordSize: 8, framePointers: true,
+	},
+	elf.EM_ARM: {
+		names: []string{
+			"r0", "r1", "r2", "r3", "r4", "r5", "r6", "r7", "r8", "r9", "r10",
+			"fp", "ip", "sp", "lr", "pc",
+		},
+		sp: 13, fp: 11, ra: 14, wordSize: 4,
+	},
+}
+
+// ErrorUnsupportedMachine indicates that unwinding is not supported for a machine.
+type ErrorUnsupportedMachine struct {
+	Machine elf.Machine // The offending machine
+}
+
+// Error pretty prints the given ErrorUnsupportedMachine instance.
+func (self ErrorUnsupportedMachine) Error() string {
+	return fmt.Sprintf("Unwinding is not supported on %s", self.Machine)
+}
+
+// Unwinder walks the stack of a crashed thread, using call frame information
+// from .eh_frame and .debug_frame and falling back to frame pointers.
+type Unwinder struct {
+	Machine   elf.Machine // The machine the crashed process executed on
+	Memory    Memory      // The memory of the crashed process
+	Modules   Modules     // The binaries mapped into the crashed process
+	MaxFrames int         // Maximum number of frames, DefaultMaxFrames if 0
+}
+
+// Unwind walks the stack starting from regs and symbolizes every frame.
+//
+// Returns an error if the machine is not supported or if regs lack the program counter.
+func (self Unwinder) Unwind(regs core.Registers) (Stacktrace, error) {
+	a, present := arches[self.Machine]
+	if !present {
+		return nil, ErrorUnsupportedMachine{self.Machine}
+	}
+
+	pc, present := regs.PC()
+	if !present {
+		return nil, errors.New("Failed to unwind, program counter is missing")
+	}
+
+	state := map[uint64]uint64{}
+	for i, name := range a.names {
+		if v, present := regs.Get(name); present {
+			state[uint64(i)] = v
+		}
+	}
+
+	max := self.MaxFrames
+	if max == 0 {
+		max = DefaultMaxFrames
+	}
+
+	trace := Stacktrace{}
+	for i := 0; i < max && pc != 0; i++ {
+		// Return addresses point right after the call instruction, which
+		// might already belong to the next function or line.
+		lookup := pc
+		if i > 0 {
+			lookup = pc - 1
+		}
+
+		m := self.Modules.Lookup(lookup)
+
+		frame := Frame{}
+		if m != nil {
+			frame = m.Symbolize(lookup)
+		}
+		frame.PC = pc
+		trace = append(trace, frame)
+
+		next, ra, err := self.stepCfi(a, m, lookup, state)
+		if err != nil && a.framePointers {
+			next, ra, err = self.stepFramePointer(a, state)
+		}
+
+		// The stack grows downwards, callers' frames reside at higher addresses.
+		if err != nil || next[a.sp] < state[a.sp] || (next[a.sp] == state[a.sp] && ra == pc) {
+			break
+		}
+
+		state, pc = next, ra
+	}
+
+	return trace, nil
+}
+
+// stepCfi recovers the registers of the calling frame from the call frame information of m.
+func (self Unwinder) stepCfi(a arch, m *Module, lookup uint64, state map[uint64]uint64) (map[uint64]uint64, uint64, error) {
+	if m == nil {
+		return nil, 0, errors.New("No module covers the program counter")
+	}
+
+	m.load()
+	f := m.fde(lookup - m.Bias)
+	if f == nil {
+		return nil, 0, errors.New(fmt.Sprintf("No call frame information for %#x", lookup))
+	}
+
+	r, err := f.row(lookup-m.Bias, m.order, m.ws)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	base, present := state[r.cfaReg]
+	if r.cfaExpr || !present {
+		return nil, 0, errors.New(fmt.Sprintf("Unable to compute CFA for %#x", lookup))
+	}
+	cfa := uint64(int64(base) + r.cfaOffset)
+
+	next := make(map[uint64]uint64, len(state))
+	for k, v := range state {
+		next[k] = v
+	}
+
+	undefined := false
+	for reg, rl := range r.rules {
+		switch rl.kind {
+		case ruleSameValue:
+		case ruleUndefined:
+			delete(next, reg)
+			undefined = undefined || reg == f.cie.raReg
+		case ruleOffset:
+			v, err := self.Memory.ReadWord(uint64(int64(cfa) + rl.value))
+			if err != nil {
+				return nil, 0, err
+			}
+			next[reg] = v
+		case ruleValOffset:
+			next[reg] = uint64(int64(cfa) + rl.value)
+		case ruleRegister:
+			v, present := state[uint64(rl.value)]
+			if !present {
+				return nil, 0, errors.New(fmt.Sprintf("Unable to recover register %d", reg))
+			}
+			next[reg] = v
+		case ruleExpression:
+			return nil, 0, errors.New(fmt.Sprintf("Unable to recover register %d from expression", reg))
+		}
+	}
+
+	next[a.sp] = cfa
+
+	// An undefined return address marks the outermost frame.
+	if undefined {
+		return next, 0, nil
+	}
+
+	return next, next[f.cie.raReg], nil
+}
+
+// stepFramePointer recovers the registers of the calling frame by following the frame pointer.
+func (self Unwinder) stepFramePointer(a arch, state map[uint64]uint64) (map[uint64]uint64, uint64, error) {
+	fp, present := state[a.fp]
+	if !present || fp == 0 {
+		return nil, 0, errors.New("Frame pointer is not available")
+	}
+
+	prev, err := self.Memory.ReadWord(fp)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	ra, err := self.Memory.ReadWord(fp + a.wordSize)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	next := map[uint64]uint64{a.fp: prev, a.sp: fp + 2*a.wordSize, a.ra: ra}
+	return next, ra, nil
+}
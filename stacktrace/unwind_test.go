@@ -0,0 +1,267 @@
+package stacktrace
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vosst/csi/core"
+)
+
+const (
+	testEhFrameAddr = 0x800
+	testFooBegin    = 0x1000
+	testFooSize     = 0x100
+	testBarBegin    = 0x2000
+)
+
+// testEhFrame assembles an .eh_frame section describing foo, a function
+// that pushes rbp and then establishes a frame pointer:
+//
+//	0x1000: push %rbp
+//	0x1001: mov %rsp,%rbp
+//	0x1004: ...
+func testEhFrame() []byte {
+	return testEhFrameWithAugmentation([]byte{0})
+}
+
+// testEhFrameWithAugmentation is like testEhFrame, but the FDE carries the
+// augmentation data aug, prefixed by its ULEB128-encoded length.
+func testEhFrameWithAugmentation(aug []byte) []byte {
+	var cieBody bytes.Buffer
+	cieBody.Write([]byte{0, 0, 0, 0})     // CIE id
+	cieBody.Write([]byte{1, 'z', 'R', 0}) // version and augmentation
+	cieBody.Write([]byte{1, 0x78, 16})    // code align 1, data align -8, return address in rip
+	cieBody.Write([]byte{1, dwEhPePcrel | dwEhPeSdata4})
+	cieBody.Write([]byte{dwCfaDefCfa, 7, 8, dwCfaOffset | 16, 1, dwCfaNop})
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, uint32(cieBody.Len()))
+	buf.Write(cieBody.Bytes())
+
+	fdeStart := buf.Len()
+	var fdeBody bytes.Buffer
+	binary.Write(&fdeBody, binary.LittleEndian, uint32(fdeStart+4))
+	pcBeginAddr := testEhFrameAddr + fdeStart + 8
+	binary.Write(&fdeBody, binary.LittleEndian, int32(testFooBegin-pcBeginAddr))
+	binary.Write(&fdeBody, binary.LittleEndian, uint32(testFooSize))
+	fdeBody.Write(aug)
+	fdeBody.Write([]byte{dwCfaAdvanceLoc | 1, dwCfaDefCfaOffset, 16, dwCfaOffset | 6, 2})
+	fdeBody.Write([]byte{dwCfaAdvanceLoc | 3, dwCfaDefCfaRegister, 6, dwCfaNop})
+
+	binary.Write(&buf, binary.LittleEndian, uint32(fdeBody.Len()))
+	buf.Write(fdeBody.Bytes())
+	buf.Write([]byte{0, 0, 0, 0})
+
+	return buf.Bytes()
+}
+
+func TestFrameTableResolvesRowsForAddresses(t *testing.T) {
+	table, err := parseFrameTable(testEhFrame(), testEhFrameAddr, binary.LittleEndian, 8, true)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(table))
+
+	f := table.find(testFooBegin + 0x10)
+	assert.NotNil(t, f)
+	assert.Equal(t, uint64(testFooBegin), f.begin)
+	assert.Equal(t, uint64(testFooBegin+testFooSize), f.end)
+	assert.Nil(t, table.find(testFooBegin+testFooSize))
+	assert.Nil(t, table.find(testFooBegin-1))
+
+	r, err := f.row(testFooBegin, binary.LittleEndian, 8)
+	assert.Nil(t, err)
+	assert.Equal(t, row{cfaReg: 7, cfaOffset: 8, rules: map[uint64]rule{16: {ruleOffset, -8}}}, r)
+
+	r, err = f.row(testFooBegin+1, binary.LittleEndian, 8)
+	assert.Nil(t, err)
+	assert.Equal(t, row{cfaReg: 7, cfaOffset: 16, rules: map[uint64]rule{16: {ruleOffset, -8}, 6: {ruleOffset, -16}}}, r)
+
+	r, err = f.row(testFooBegin+0x10, binary.LittleEndian, 8)
+	assert.Nil(t, err)
+	assert.Equal(t, row{cfaReg: 6, cfaOffset: 16, rules: map[uint64]rule{16: {ruleOffset, -8}, 6: {ruleOffset, -16}}}, r)
+}
+
+func TestParseFrameTableRejectsTruncatedSections(t *testing.T) {
+	b := testEhFrame()
+	_, err := parseFrameTable(b[:len(b)-12], testEhFrameAddr, binary.LittleEndian, 8, true)
+	assert.NotNil(t, err)
+}
+
+// testDebugFrame64 assembles a .debug_frame section in 64-bit DWARF format,
+// with an FDE for foo preceding the CIE it refers to.
+func testDebugFrame64() []byte {
+	var fdeBody bytes.Buffer
+	binary.Write(&fdeBody, binary.LittleEndian, []uint64{0, testFooBegin, testFooSize})
+	fdeBody.Write([]byte{dwCfaAdvanceLoc | 1, dwCfaDefCfaOffset, 16})
+
+	var cieBody bytes.Buffer
+	binary.Write(&cieBody, binary.LittleEndian, uint64(0xffffffffffffffff))
+	cieBody.Write([]byte{1, 0})        // version and augmentation
+	cieBody.Write([]byte{1, 0x78, 16}) // code align 1, data align -8, return address in rip
+	cieBody.Write([]byte{dwCfaDefCfa, 7, 8, dwCfaOffset | 16, 1})
+
+	var buf bytes.Buffer
+	entry := func(body []byte) {
+		binary.Write(&buf, binary.LittleEndian, uint32(0xffffffff))
+		binary.Write(&buf, binary.LittleEndian, uint64(len(body)))
+		buf.Write(body)
+	}
+
+	fde := fdeBody.Bytes()
+	binary.LittleEndian.PutUint64(fde, uint64(12+len(fde)))
+	entry(fde)
+	entry(cieBody.Bytes())
+
+	return buf.Bytes()
+}
+
+func TestParseFrameTableResolvesCiesInDwarf64(t *testing.T) {
+	table, err := parseFrameTable(testDebugFrame64(), 0, binary.LittleEndian, 8, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(table))
+
+	r, err := table.find(testFooBegin+1).row(testFooBegin+1, binary.LittleEndian, 8)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(7), r.cfaReg)
+	assert.Equal(t, int64(16), r.cfaOffset)
+}
+
+func TestParseFrameTableRejectsMalformedEntries(t *testing.T) {
+	// An FDE whose CIE pointer points before the section.
+	var fde bytes.Buffer
+	binary.Write(&fde, binary.LittleEndian, []uint32{12, 0x100, 0, 0})
+	_, err := parseFrameTable(fde.Bytes(), testEhFrameAddr, binary.LittleEndian, 8, true)
+	assert.NotNil(t, err)
+
+	// An FDE whose augmentation data claims a huge length.
+	_, err = parseFrameTable(testEhFrameWithAugmentation([]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01}), testEhFrameAddr, binary.LittleEndian, 8, true)
+	assert.NotNil(t, err)
+
+	// A 64-bit FDE referring to a CIE that exceeds the section.
+	b := testDebugFrame64()
+	_, err = parseFrameTable(b[:len(b)-4], 0, binary.LittleEndian, 8, false)
+	assert.NotNil(t, err)
+}
+
+// parseAndExecute parses the frame table b and executes the instructions of all FDEs, ignoring errors.
+func parseAndExecute(b []byte, eh bool) {
+	table, err := parseFrameTable(b, testEhFrameAddr, binary.LittleEndian, 8, eh)
+	if err != nil {
+		return
+	}
+
+	for i := range table {
+		table[i].row(table[i].end, binary.LittleEndian, 8)
+	}
+}
+
+func TestParseFrameTableSurvivesTruncatedAndGarbageInput(t *testing.T) {
+	for _, b := range [][]byte{testEhFrame(), testDebugFrame64()} {
+		for n := 0; n <= len(b); n++ {
+			parseAndExecute(b[:n], true)
+			parseAndExecute(b[:n], false)
+		}
+
+		for i := range b {
+			for _, v := range []byte{0x00, 0x7f, 0x80, 0xff} {
+				mutated := append([]byte{}, b...)
+				mutated[i] = v
+				parseAndExecute(mutated, true)
+				parseAndExecute(mutated, false)
+			}
+		}
+	}
+
+	rnd := rand.New(rand.NewSource(42))
+	for i := 0; i < 10000; i++ {
+		b := make([]byte, rnd.Intn(128))
+		rnd.Read(b)
+		parseAndExecute(b, i%2 == 0)
+	}
+}
+
+type testMemory map[uint64]uint64
+
+func (self testMemory) ReadWord(addr uint64) (uint64, error) {
+	if v, present := self[addr]; present {
+		return v, nil
+	}
+
+	return 0, errors.New(fmt.Sprintf("Address %#x is not mapped", addr))
+}
+
+func testModules(t *testing.T) Modules {
+	table, err := parseFrameTable(testEhFrame(), testEhFrameAddr, binary.LittleEndian, 8, true)
+	assert.Nil(t, err)
+
+	return Modules{&Module{
+		Path:   "/usr/bin/test",
+		Start:  testFooBegin,
+		End:    testBarBegin + 0x100,
+		loaded: true,
+		order:  binary.LittleEndian,
+		ws:     8,
+		frames: []frameTable{table},
+		symbols: []elf.Symbol{
+			{Name: "foo", Info: elf.ST_INFO(elf.STB_GLOBAL, elf.STT_FUNC), Value: testFooBegin, Size: testFooSize},
+			{Name: "bar", Info: elf.ST_INFO(elf.STB_GLOBAL, elf.STT_FUNC), Value: testBarBegin, Size: 0x100},
+		},
+	}}
+}
+
+func testRegisters(rip, rsp, rbp uint64) core.Registers {
+	regs := core.Registers{elf.EM_X86_64, make([]uint64, 27)}
+	regs.Values[4] = rbp
+	regs.Values[16] = rip
+	regs.Values[19] = rsp
+	return regs
+}
+
+func TestUnwinderFollowsCfiAndFramePointers(t *testing.T) {
+	// foo was called from bar, which has no call frame information and is
+	// unwound by following the frame pointer. A null frame pointer terminates the chain.
+	memory := testMemory{
+		0x7000: 0x7100, 0x7008: testBarBegin + 5,
+		0x7100: 0, 0x7108: 0,
+	}
+
+	u := Unwinder{Machine: elf.EM_X86_64, Memory: memory, Modules: testModules(t)}
+	trace, err := u.Unwind(testRegisters(testFooBegin+0x10, 0x6ff0, 0x7000))
+	assert.Nil(t, err)
+
+	assert.Equal(t, Stacktrace{
+		{PC: testFooBegin + 0x10, Function: "foo", Offset: 0x10, Module: "/usr/bin/test"},
+		{PC: testBarBegin + 5, Function: "bar", Offset: 4, Module: "/usr/bin/test"},
+	}, trace)
+}
+
+func TestUnwinderUsesCfiInPrologue(t *testing.T) {
+	// Crashed right at the entry of foo, rbp still belongs to the caller.
+	memory := testMemory{0x6ff8: testBarBegin + 5}
+
+	u := Unwinder{Machine: elf.EM_X86_64, Memory: memory, Modules: testModules(t)}
+	trace, err := u.Unwind(testRegisters(testFooBegin, 0x6ff8, 0))
+	assert.Nil(t, err)
+
+	assert.Equal(t, 2, len(trace))
+	assert.Equal(t, "bar", trace[1].Function)
+}
+
+func TestUnwinderKeepsUnknownFrames(t *testing.T) {
+	u := Unwinder{Machine: elf.EM_X86_64, Memory: testMemory{}, Modules: testModules(t)}
+	trace, err := u.Unwind(testRegisters(0xdead, 0x6ff8, 0))
+	assert.Nil(t, err)
+
+	assert.Equal(t, Stacktrace{{PC: 0xdead}}, trace)
+}
+
+func TestUnwinderRejectsUnsupportedMachines(t *testing.T) {
+	u := Unwinder{Machine: elf.EM_MIPS}
+	_, err := u.Unwind(core.Registers{elf.EM_MIPS, nil})
+	assert.Equal(t, ErrorUnsupportedMachine{elf.EM_MIPS}, err)
+}
@@ -2,15 +2,20 @@ package csi
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 	"strings"
 	"syscall"
+	"unsafe"
 
 	"github.com/vosst/csi/log"
 	"github.com/vosst/csi/pkg"
+	"github.com/vosst/csi/proc"
+	"github.com/vosst/csi/proc/pid"
 )
 
 // Poor man's version of StatFs, just exposing the values we are actually interested in
@@ -35,10 +40,10 @@ type Mount struct {
 
 // ParseMounts reads all mounted file systems from reader, expecting a line format
 // as specified in man fstab. For every mounted filesystem, ParseMounts tries to
-// query size information.
+// query size information, until ctx is done.
 // The function is quite robust and tries to keep on processing for as long as possible,
 // reporting partial results together with errors.
-func parseMounts(reader io.Reader) []Mount {
+func parseMounts(ctx context.Context, reader io.Reader) ([]Mount, error) {
 	mounts := []Mount{}
 
 	br := bufio.NewReader(reader)
@@ -48,113 +53,325 @@ func parseMounts(reader io.Reader) []Mount {
 			continue
 		}
 
-		statfs := syscall.Statfs_t{}
-		if err = syscall.Statfs(mnt.File, &statfs); err == nil {
-			fsStats := FSStats{statfs.Bsize, statfs.Blocks, statfs.Bfree, statfs.Bavail}
-			mnt.FSStats = &fsStats
+		if err := ctx.Err(); err != nil {
+			return mounts, err
 		}
+
+		mnt.FSStats = statFS(ctx, mnt.File)
 		mounts = append(mounts, mnt)
 	}
 
-	return mounts
+	return mounts, nil
+}
+
+// statFS queries size information about the filesystem mounted at file, nil if
+// unavailable. statfs(2) cannot be interrupted and blocks for as long as, e.g.,
+// an NFS server does not respond. Once ctx is done, we thus stop waiting and
+// abandon the call instead of cancelling it, leaving it to finish in the background.
+func statFS(ctx context.Context, file string) *FSStats {
+	stats := make(chan *FSStats, 1)
+
+	go func() {
+		statfs := syscall.Statfs_t{}
+		if err := syscall.Statfs(file, &statfs); err != nil {
+			stats <- nil
+		} else {
+			stats <- &FSStats{statfs.Bsize, statfs.Blocks, statfs.Bfree, statfs.Bavail}
+		}
+	}()
+
+	select {
+	case s := <-stats:
+		return s
+	case <-ctx.Done():
+		return nil
+	}
 }
 
 // OSReport summarizes information about the operating system
 type OSReport struct {
-	Name    string   // Name of the OS
-	Release string   // Relase of the OS
-	Logs    struct { // Central logs documenting the OS operations
+	Name      string    // Name of the OS
+	Release   string    // Relase of the OS
+	OSRelease OSRelease // Identification of the OS, as described in os-release
+	Logs      struct {  // Central logs documenting the OS operations
 		Dmesg  []byte // Contents of the kernel log buffer
 		Syslog []byte // Contents of syslog
 	}
-	Memory struct { // Information about total available/free memory
-		Total uint64 // Total usable RAM
-		Free  uint64 // Amound of memory currently unused
+	Memory   proc.MemInfo // Usage of memory and swap, as reported in /proc/meminfo
+	VmStat   proc.VmStat  // Virtual memory counters hinting at memory pressure
+	Pressure struct {     // Pressure stall information, left empty if the kernel does not support PSI
+		CPU    proc.Pressure // Pressure on the CPUs
+		Memory proc.Pressure // Pressure on memory
+		IO     proc.Pressure // Pressure on IO
 	}
-	Swap struct { // Information about total available/free swap
-		Total uint64 // Total amount of swap space available
-		Free  uint64 // Amount of swap space that is currently unused
+	Kernel struct { // Information about the running kernel, see man uname
+		Name    string // Name of the kernel, e.g., Linux
+		Release string // Release of the kernel
+		Version string // Version of the kernel
+		Machine string // Hardware identifier
 	}
 	Mounts []Mount // All mounted filesystems
 }
 
+// utsString converts a NUL-terminated field of syscall.Utsname to a string.
+// The element type of the fields differs across architectures, hence we
+// reinterpret the field as a byte array.
+func utsString(field unsafe.Pointer) string {
+	b := (*[65]byte)(field)
+	if n := bytes.IndexByte(b[:], 0); n >= 0 {
+		return string(b[:n])
+	}
+
+	return string(b[:])
+}
+
 // OSInspector provides means to gather information about the operating system
 type OSInspector struct {
 	DmesgCollector  log.Collector
 	SyslogCollector log.Collector
-	ReleaseFile     string
-	MemInfo         string
+	OSReleaseFiles  []string // Locations of os-release, in order of precedence
+	ReleaseFile     string   // Location of lsb-release, consulted if none of OSReleaseFiles exists
+	Proc            proc.FS  // The proc fs to read memory usage and pressure from
 	MTab            string
+	Workers         int // Maximum number of collectors running concurrently, DefaultWorkers if not positive
 }
 
-func (self OSInspector) Inspect() (OSReport, error) {
+// NewOSInspector returns an OSInspector reading from the default locations
+// and from the proc fs fs.
+func NewOSInspector(fs proc.FS) OSInspector {
+	return OSInspector{log.NewDmesgCollector(), log.NewSyslogCollector(), OSReleaseFiles, "/etc/lsb-release", fs, "/etc/mtab", 0}
+}
+
+// release identifies the OS from the first of self.OSReleaseFiles that
+// exists, falling back to the lsb-release file self.ReleaseFile.
+//
+// Returns an error if reading or parsing the identifying file fails.
+func (self OSInspector) release() (OSReport, error) {
 	osi := OSReport{}
-	{
-		f, err := os.Open(self.ReleaseFile)
-		if err != nil {
-			return osi, errors.New(fmt.Sprintf("Failed to open release file %s [%s]", self.ReleaseFile, err))
+
+	for _, fn := range self.OSReleaseFiles {
+		f, err := os.Open(fn)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return osi, errors.New(fmt.Sprintf("Failed to open os-release file %s [%s]", fn, err))
 		}
 
-		defer f.Close()
+		vars, err := ParseShellVars(f)
+		f.Close()
 
-		br := bufio.NewReader(f)
-		for s, err := br.ReadString('\n'); err == nil; s, err = br.ReadString('\n') {
-			tokens := strings.Split(s, "=")
+		// Invalid lines are skipped, identifying the OS from the remaining ones.
+		if _, skipped := err.(ErrorInvalidAssignments); err != nil && !skipped {
+			return osi, errors.New(fmt.Sprintf("Failed to parse os-release file %s [%s]", fn, err))
+		}
 
-			switch tokens[0] {
-			case "DISTRIB_ID":
-				osi.Name = strings.Trim(tokens[1], "\t \n")
-			case "DISTRIB_RELEASE":
-				osi.Release = strings.Trim(tokens[1], "\t \n")
+		// Defaults as given in man os-release.
+		for key, value := range map[string]string{"ID": "linux", "NAME": "Linux", "PRETTY_NAME": "Linux"} {
+			if len(vars[key]) == 0 {
+				vars[key] = value
 			}
 		}
+
+		osi.Name, osi.Release, osi.OSRelease = vars["NAME"], vars["VERSION_ID"], NewOSReleaseFromVars(vars)
+		return osi, nil
+	}
+
+	f, err := os.Open(self.ReleaseFile)
+	if err != nil {
+		return osi, errors.New(fmt.Sprintf("Failed to open release file %s, none of %s exists [%s]", self.ReleaseFile, strings.Join(self.OSReleaseFiles, ", "), err))
+	}
+
+	defer f.Close()
+
+	vars, err := ParseShellVars(f)
+	if _, skipped := err.(ErrorInvalidAssignments); err != nil && !skipped {
+		return osi, errors.New(fmt.Sprintf("Failed to parse release file %s [%s]", self.ReleaseFile, err))
+	}
+
+	osi.Name, osi.Release = vars["DISTRIB_ID"], vars["DISTRIB_RELEASE"]
+	osi.OSRelease = OSRelease{
+		Id:              strings.ToLower(vars["DISTRIB_ID"]),
+		VersionId:       vars["DISTRIB_RELEASE"],
+		VersionCodename: vars["DISTRIB_CODENAME"],
+		PrettyName:      vars["DISTRIB_DESCRIPTION"],
 	}
 
-	{
-		f, err := os.Open(self.MemInfo)
+	return osi, nil
+}
+
+// systemCollector is a built-in collector storing its result in a field of
+// SystemReport. Collectors contributing to OSReport gather information with
+// an OSInspector. Collectors return nil unless they gathered at least partial
+// results, which are stored even if the collector fails.
+type systemCollector struct {
+	name    string                                                                               // Name of the collector
+	entry   string                                                                               // Entry of the proc fs probed for the cause of failures, empty if none
+	os      bool                                                                                 // True if the collector contributes to OSReport
+	collect func(ctx context.Context, inspector OSInspector, target Target) (interface{}, error) // Gathers the information
+	apply   func(sr *SystemReport, v interface{})                                                // Stores the information in a report
+}
+
+func (self systemCollector) Name() string {
+	return self.name
+}
+
+func (self systemCollector) Scope() Scope {
+	return ScopeSystem
+}
+
+// failed wraps err, the failure of self gathering information from the proc fs fs,
+// determining its cause. The proc fs readers report failures with errors that have
+// lost their errno, we thus probe self.entry for the cause.
+func (self systemCollector) failed(fs proc.FS, err error) ErrorCollector {
+	ec := ErrorCollector{self.name, errnoOf(err), err}
+	if ec.Errno == 0 && len(self.entry) > 0 {
+		ec.Errno = errnoOf(probe(fs.Path(self.entry)))
+	}
+
+	return ec
+}
+
+// Collect gathers information with the OSInspector returned by NewOSInspector for target.Proc.
+func (self systemCollector) Collect(ctx context.Context, target Target) (interface{}, error) {
+	return self.collect(ctx, NewOSInspector(proc.FS(target.Proc)), target)
+}
+
+// systemCollectors lists the collectors built into csi contributing to SystemReport.
+// Collectors are named after the path of keys leading to the field they fill, as
+// serialized to YAML, e.g., os.memory. os.release fills os.name, os.release and
+// os.osrelease.
+var systemCollectors = []systemCollector{
+	{"hostname", "", false, func(ctx context.Context, inspector OSInspector, target Target) (interface{}, error) {
+		return os.Hostname()
+	}, func(sr *SystemReport, v interface{}) { sr.HostName = v.(string) }},
+	{"architecture", "", false, func(ctx context.Context, inspector OSInspector, target Target) (interface{}, error) {
+		return target.PackagingSystem.Arch()
+	}, func(sr *SystemReport, v interface{}) { sr.Architecture = v.(pkg.Arch) }},
+	{"os.release", "", true, func(ctx context.Context, inspector OSInspector, target Target) (interface{}, error) {
+		return inspector.release()
+	}, func(sr *SystemReport, v interface{}) {
+		osi := v.(OSReport)
+		sr.OS.Name, sr.OS.Release, sr.OS.OSRelease = osi.Name, osi.Release, osi.OSRelease
+	}},
+	{"os.memory", "meminfo", true, func(ctx context.Context, inspector OSInspector, target Target) (interface{}, error) {
+		mi, err := inspector.Proc.NewMemInfo()
+		if err != nil {
+			return nil, err
+		}
+		return mi, nil
+	}, func(sr *SystemReport, v interface{}) { sr.OS.Memory = *v.(*proc.MemInfo) }},
+	{"os.vmstat", "vmstat", true, func(ctx context.Context, inspector OSInspector, target Target) (interface{}, error) {
+		vs, err := inspector.Proc.NewVmStat()
 		if err != nil {
-			return osi, errors.New(fmt.Sprintf("Failed to open meminfo file %s [%s]", self.MemInfo, err))
+			return nil, err
 		}
+		return vs, nil
+	}, func(sr *SystemReport, v interface{}) { sr.OS.VmStat = *v.(*proc.VmStat) }},
+	// Kernels might not track the pressure on all resources, we leave missing
+	// resources empty and keep the ones we were able to read.
+	{"os.pressure", "pressure", true, func(ctx context.Context, inspector OSInspector, target Target) (interface{}, error) {
+		osi := OSReport{}
+		pressure := map[string]*proc.Pressure{proc.PressureCPU: &osi.Pressure.CPU, proc.PressureMemory: &osi.Pressure.Memory, proc.PressureIO: &osi.Pressure.IO}
+		found, errs := 0, []string{}
+
+		for _, resource := range []string{proc.PressureCPU, proc.PressureMemory, proc.PressureIO} {
+			if _, err := os.Stat(inspector.Proc.Path("pressure", resource)); os.IsNotExist(err) {
+				continue
+			}
 
-		defer f.Close()
+			found++
 
-		br := bufio.NewReader(f)
-		for s, err := br.ReadString('\n'); err == nil; s, err = br.ReadString('\n') {
-			tokens := strings.Split(s, ":")
-			switch tokens[0] {
-			case "MemTotal":
-				fmt.Sscanf(strings.Trim(tokens[1], "\t \n"), "%d kB", &(osi.Memory.Total))
-			case "MemFree":
-				fmt.Sscanf(strings.Trim(tokens[1], "\t \n"), "%d kB", &osi.Memory.Free)
-			case "SwapTotal":
-				fmt.Sscanf(strings.Trim(tokens[1], "\t \n"), "%d kB", &osi.Swap.Total)
-			case "SwapFree":
-				fmt.Sscanf(strings.Trim(tokens[1], "\t \n"), "%d kB", &osi.Swap.Free)
+			v, err := inspector.Proc.NewPressure(resource)
+			if err != nil {
+				errs = append(errs, err.Error())
+				continue
 			}
+
+			*pressure[resource] = *v
 		}
-	}
 
-	{
-		f, err := os.Open(self.MTab)
+		switch {
+		case found == 0:
+			return nil, errors.New(fmt.Sprintf("Failed to read %s, the kernel does not support PSI", inspector.Proc.Path("pressure")))
+		case len(errs) == found:
+			return nil, errors.New(strings.Join(errs, "; "))
+		case len(errs) > 0:
+			return osi, errors.New(strings.Join(errs, "; "))
+		}
+
+		return osi, nil
+	}, func(sr *SystemReport, v interface{}) { sr.OS.Pressure = v.(OSReport).Pressure }},
+	// Querying the size of network filesystems might block for long, we
+	// thus gather mounts concurrently to all other information.
+	{"os.mounts", "", true, func(ctx context.Context, inspector OSInspector, target Target) (interface{}, error) {
+		f, err := os.Open(inspector.MTab)
 		if err != nil {
-			return osi, errors.New(fmt.Sprintf("Failed to open mtab file %s [%s]", self.MTab, err))
+			return nil, errors.New(fmt.Sprintf("Failed to open mtab file %s [%s]", inspector.MTab, err))
 		}
 
 		defer f.Close()
 
-		osi.Mounts = parseMounts(f)
+		return parseMounts(ctx, f)
+	}, func(sr *SystemReport, v interface{}) { sr.OS.Mounts = v.([]Mount) }},
+	{"os.kernel", "", true, func(ctx context.Context, inspector OSInspector, target Target) (interface{}, error) {
+		uts := syscall.Utsname{}
+		if err := syscall.Uname(&uts); err != nil {
+			return nil, errors.New(fmt.Sprintf("Failed to query kernel information [%s]", err))
+		}
 
-	}
+		osi := OSReport{}
+		osi.Kernel.Name = utsString(unsafe.Pointer(&uts.Sysname))
+		osi.Kernel.Release = utsString(unsafe.Pointer(&uts.Release))
+		osi.Kernel.Version = utsString(unsafe.Pointer(&uts.Version))
+		osi.Kernel.Machine = utsString(unsafe.Pointer(&uts.Machine))
+
+		return osi, nil
+	}, func(sr *SystemReport, v interface{}) { sr.OS.Kernel = v.(OSReport).Kernel }},
+	{"os.logs.dmesg", "", true, func(ctx context.Context, inspector OSInspector, target Target) (interface{}, error) {
+		return inspector.DmesgCollector.Collect(ctx)
+	}, func(sr *SystemReport, v interface{}) { sr.OS.Logs.Dmesg = v.([]byte) }},
+	{"os.logs.syslog", "", true, func(ctx context.Context, inspector OSInspector, target Target) (interface{}, error) {
+		return inspector.SyslogCollector.Collect(ctx)
+	}, func(sr *SystemReport, v interface{}) { sr.OS.Logs.Syslog = v.([]byte) }},
+}
+
+// Inspect gathers information about the operating system, see InspectContext.
+func (self OSInspector) Inspect() (OSReport, error) {
+	return self.InspectContext(context.Background())
+}
 
-	if b, err := self.DmesgCollector.Collect(); err == nil {
-		osi.Logs.Dmesg = b
+// InspectContext gathers information about the operating system, running at
+// most self.Workers collectors concurrently until all of them finished or ctx
+// is done. Inspecting is best-effort: the report contains whatever could be
+// gathered.
+//
+// Returns ErrorCollectors listing the failed collectors if any collector fails.
+func (self OSInspector) InspectContext(ctx context.Context) (OSReport, error) {
+	sr := SystemReport{}
+
+	jobs := []collectorJob{}
+	for _, c := range systemCollectors {
+		if !c.os {
+			continue
+		}
+
+		c := c
+		jobs = append(jobs, collectorJob{c.name, func(ctx context.Context) (func(), error) {
+			v, err := c.collect(ctx, self, Target{})
+			if v == nil {
+				return nil, err
+			}
+			return func() { c.apply(&sr, v) }, err
+		}, func(err error) ErrorCollector {
+			return c.failed(self.Proc, err)
+		}})
 	}
 
-	if b, err := self.SyslogCollector.Collect(); err == nil {
-		osi.Logs.Syslog = b
+	if errs := runCollectors(ctx, self.Workers, jobs, map[string]CollectorStatus{}); len(errs) > 0 {
+		return sr.OS, errs
 	}
 
-	return osi, nil
+	return sr.OS, nil
 }
 
 // SystemReport bundles system-specific information relevant
@@ -163,31 +380,72 @@ type SystemReport struct {
 	HostName     string   // HostName of this machine.
 	Architecture pkg.Arch // Host architecture.
 	OS           OSReport // Information about the OS.
+
+	Collectors map[string]CollectorStatus // Outcome of the individual collectors, by name.
+	Results    map[string]interface{}     `yaml:",inline" json:"-"` // Results of collectors not built into csi, by name.
+}
+
+// MarshalJSON encodes self to JSON, with Results inlined like in YAML.
+func (self SystemReport) MarshalJSON() ([]byte, error) {
+	// plain has all fields of SystemReport but none of its methods, avoiding recursion.
+	type plain SystemReport
+	return marshalJSONWithResults(plain(self), self.Results)
 }
 
 // SystemInspector inspects core properties of the current system.
 type SystemInspector struct {
-	PkgSystem pkg.System // Retrievs information from the packaging system.
+	PkgSystem  pkg.System // Retrievs information from the packaging system.
+	Proc       proc.FS    // The proc fs to read information about the system from.
+	Workers    int        // Maximum number of collectors running concurrently, DefaultWorkers if not positive.
+	Collectors *Registry  // Collectors to run, DefaultRegistry if nil.
 }
 
-// Inspect gathers information about the current system and encodes
-// it to encoder.
-func (self SystemInspector) Inspect() (si SystemReport, err error) {
-	var hn string
-	if hn, err = os.Hostname(); err != nil {
-		return
+// Inspect gathers information about the current system, see InspectContext.
+func (self SystemInspector) Inspect() (SystemReport, error) {
+	return self.InspectContext(context.Background())
+}
+
+// InspectContext gathers information about the current system, running the
+// enabled system collectors of self.Collectors, at most self.Workers of them
+// concurrently, until all of them finished or ctx is done. Inspecting is
+// best-effort: the report contains whatever could be gathered, with the
+// outcome of every collector recorded in SystemReport.Collectors. Collectors
+// not finished when ctx is done are marked as timed out.
+//
+// Returns ErrorCollectors listing the failed collectors if any collector fails.
+func (self SystemInspector) InspectContext(ctx context.Context) (SystemReport, error) {
+	si := SystemReport{Collectors: map[string]CollectorStatus{}}
+
+	registry := self.Collectors
+	if registry == nil {
+		registry = DefaultRegistry
 	}
 
-	si.HostName = hn
-	si.Architecture, _ = self.PkgSystem.Arch()
+	store := func(c Collector, v interface{}, err error) {
+		if sc, ok := c.(systemCollector); ok {
+			if v != nil {
+				sc.apply(&si, v)
+			}
+		} else if v != nil {
+			if si.Results == nil {
+				si.Results = map[string]interface{}{}
+			}
+			si.Results[c.Name()] = v
+		}
+	}
 
-	os := OSInspector{log.NewDmesgCollector(), log.NewSyslogCollector(), "/etc/lsb-release", "/proc/meminfo", "/etc/mtab"}
-	si.OS, err = os.Inspect()
+	failed := func(name string, err error) ErrorCollector {
+		if sc, ok := registry.Collector(name).(systemCollector); ok {
+			return sc.failed(self.Proc, err)
+		}
 
-	if err != nil {
-		err = errors.New(fmt.Sprintf("Failed to inspect the OS [%s]", err))
-		return
+		return ErrorCollector{name, errnoOf(err), err}
+	}
+
+	target := Target{0, pid.FS(self.Proc), self.PkgSystem}
+	if errs := runCollectors(ctx, self.Workers, registry.jobs(ScopeSystem, target, si.Collectors, store, failed), si.Collectors); len(errs) > 0 {
+		return si, errs
 	}
 
-	return
+	return si, nil
 }
@@ -0,0 +1,166 @@
+package csi
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/vosst/csi/crash"
+)
+
+// DefaultMaxUploadAttempts is the number of failed attempts after which an upload is given up.
+const DefaultMaxUploadAttempts = 10
+
+// UploadState enumerates the states of a crash's upload.
+type UploadState string
+
+const (
+	UploadPending       UploadState = "pending"        // The report has not been accepted by the crash database, yet
+	UploadCoreRequested UploadState = "core-requested" // The report has been accepted, the crash database asks for the core dump
+	UploadUploaded      UploadState = "uploaded"       // The upload is complete
+	UploadFailed        UploadState = "failed"         // The upload failed permanently
+)
+
+// UploadStatus records the progress of a crash's upload. It is persisted next
+// to the crash, such that uploads resume where they left off, e.g., after a reboot.
+type UploadStatus struct {
+	State       UploadState // Current state of the upload
+	Attempts    int         // Number of failed attempts in the current state
+	NextAttempt time.Time   // Earliest time for the next attempt, zero if not deferred
+	LastError   string      // Error reported by the last failed attempt
+	OopsId      string      // Id assigned to the crash by the crash database
+}
+
+// ErrorUploadDeferred indicates that an upload has been postponed after a temporary failure.
+type ErrorUploadDeferred struct {
+	Until time.Time // Earliest time for the next attempt
+}
+
+// Error pretty prints the given ErrorUploadDeferred instance.
+func (self ErrorUploadDeferred) Error() string {
+	return fmt.Sprintf("Upload deferred until %s", self.Until.Format(time.RFC3339))
+}
+
+// UploadQueue uploads the crashes of a store, tracking the state of every
+// upload next to the crash. Temporary failures are retried with exponential
+// backoff, honouring delays requested by the crash database. Permanent
+// failures, i.e., client errors reported by the crash database, are not retried.
+type UploadQueue struct {
+	Store       CrashStore           // The store containing crashes
+	Uploader    crash.ReportUploader // Uploads reports and cores to the crash database
+	Backoff     crash.Backoff        // Delays between retries
+	MaxAttempts int                  // Failed attempts after which an upload is given up
+	Now         func() time.Time     // Source of the current time
+	Rand        *rand.Rand           // Source of randomness for jittering delays
+}
+
+// NewUploadQueue returns an UploadQueue for store, relying on uploader and default settings.
+func NewUploadQueue(store CrashStore, uploader crash.ReportUploader) *UploadQueue {
+	return &UploadQueue{
+		Store:       store,
+		Uploader:    uploader,
+		Backoff:     crash.DefaultBackoff,
+		MaxAttempts: DefaultMaxUploadAttempts,
+		Now:         time.Now,
+		Rand:        rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// fail records a failed attempt in status, either scheduling a retry or giving up.
+func (self *UploadQueue) fail(status *UploadStatus, err error) {
+	status.Attempts++
+	status.LastError = err.Error()
+
+	if !crash.IsTemporary(err) || status.Attempts >= self.MaxAttempts {
+		status.State = UploadFailed
+		status.NextAttempt = time.Time{}
+		return
+	}
+
+	delay := self.Backoff.Delay(status.Attempts, self.Rand)
+	if he, ok := err.(crash.ErrorHttpStatus); ok && he.RetryAfter > delay {
+		delay = he.RetryAfter
+	}
+
+	status.NextAttempt = self.Now().Add(delay)
+}
+
+// succeed moves status to state, resetting all information about failed attempts.
+func (self *UploadQueue) succeed(status *UploadStatus, state UploadState) {
+	status.State = state
+	status.Attempts = 0
+	status.NextAttempt = time.Time{}
+	status.LastError = ""
+}
+
+// uploadCore streams the core dump of the crash identified by name from the store to the crash database.
+func (self *UploadQueue) uploadCore(name string, report crash.Report, oopsId string) error {
+	core, err := self.Store.OpenCore(name)
+	if err != nil {
+		return err
+	}
+
+	defer core.Close()
+	return self.Uploader.UploadCore(report, core, oopsId)
+}
+
+// Upload advances the upload of the crash identified by name with contents
+// report as far as possible, persisting its status after every step.
+//
+// Returns the resulting status and the error of a failed attempt. Returns
+// ErrorUploadDeferred if the upload is postponed to a later time.
+func (self *UploadQueue) Upload(name string, report crash.Report) (UploadStatus, error) {
+	status, err := self.Store.LoadUploadStatus(name)
+	if err != nil {
+		return status, err
+	}
+
+	if status.State == UploadUploaded || status.State == UploadFailed {
+		return status, nil
+	}
+
+	if self.Now().Before(status.NextAttempt) {
+		return status, ErrorUploadDeferred{status.NextAttempt}
+	}
+
+	if len(status.State) == 0 {
+		status.State = UploadPending
+	}
+
+	var uerr error
+
+	if status.State == UploadPending {
+		if result, err := self.Uploader.Submit(report); err != nil {
+			self.fail(&status, err)
+			uerr = err
+		} else {
+			status.OopsId = result.OopsId
+			if result.CoreRequested {
+				self.succeed(&status, UploadCoreRequested)
+			} else {
+				self.succeed(&status, UploadUploaded)
+			}
+		}
+
+		// Record the progress before uploading the core, such that we do
+		// not submit the report again if the core upload is interrupted.
+		if err := self.Store.SaveUploadStatus(name, status); err != nil {
+			return status, err
+		}
+	}
+
+	if status.State == UploadCoreRequested && uerr == nil {
+		if err := self.uploadCore(name, report, status.OopsId); err != nil {
+			self.fail(&status, err)
+			uerr = err
+		} else {
+			self.succeed(&status, UploadUploaded)
+		}
+
+		if err := self.Store.SaveUploadStatus(name, status); err != nil {
+			return status, err
+		}
+	}
+
+	return status, uerr
+}
@@ -0,0 +1,185 @@
+package csi
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vosst/csi/crash"
+)
+
+// scriptedUploader replays prepared results for every stage of the upload protocol.
+type scriptedUploader struct {
+	submits []error
+	cores   []error
+	result  crash.SubmitResult
+
+	submitted int
+	uploaded  int
+	core      string
+}
+
+func (self *scriptedUploader) Submit(report crash.Report) (crash.SubmitResult, error) {
+	self.submitted++
+	if err := self.submits[0]; err != nil {
+		self.submits = self.submits[1:]
+		return crash.SubmitResult{}, err
+	}
+
+	return self.result, nil
+}
+
+func (self *scriptedUploader) UploadCore(report crash.Report, core io.Reader, oopsId string) error {
+	self.uploaded++
+	b, _ := ioutil.ReadAll(core)
+	self.core = string(b)
+	err := self.cores[0]
+	self.cores = self.cores[1:]
+	return err
+}
+
+var testNow = time.Date(2015, time.September, 4, 7, 59, 46, 0, time.UTC)
+
+func newTestQueue(store CrashStore, uploader crash.ReportUploader) *UploadQueue {
+	q := NewUploadQueue(store, uploader)
+	q.Backoff = crash.Backoff{time.Minute, time.Hour, 2, 0}
+	q.MaxAttempts = 3
+	q.Now = func() time.Time { return testNow }
+	return q
+}
+
+func TestUploadQueueRecordsOopsIdNextToReport(t *testing.T) {
+	store, name, cleanup := newTestStore(t)
+	defer cleanup()
+
+	u := &scriptedUploader{submits: []error{nil}, result: crash.SubmitResult{"1234-abcd", false}}
+	status, err := newTestQueue(store, u).Upload(name, crash.Report{})
+	assert.Nil(t, err)
+	assert.Equal(t, UploadStatus{State: UploadUploaded, OopsId: "1234-abcd"}, status)
+
+	_, err = os.Stat(filepath.Join(store.Dir, name, uploadStatusFile))
+	assert.Nil(t, err)
+
+	// Uploaded crashes are not submitted again.
+	status, err = newTestQueue(store, u).Upload(name, crash.Report{})
+	assert.Nil(t, err)
+	assert.Equal(t, UploadUploaded, status.State)
+	assert.Equal(t, 1, u.submitted)
+}
+
+func TestUploadQueueBacksOffAfterServerErrors(t *testing.T) {
+	store, _, cleanup := newTestStore(t)
+	defer cleanup()
+
+	u := &scriptedUploader{submits: []error{crash.ErrorHttpStatus{http.StatusServiceUnavailable, 0}, nil}}
+	q := newTestQueue(store, u)
+
+	status, err := q.Upload("test.crash", crash.Report{})
+	assert.NotNil(t, err)
+	assert.Equal(t, UploadPending, status.State)
+	assert.Equal(t, 1, status.Attempts)
+	assert.Equal(t, testNow.Add(time.Minute), status.NextAttempt)
+
+	_, err = os.Stat(filepath.Join(store.Dir, "test.upload.yaml"))
+	assert.Nil(t, err)
+
+	// Too early for another attempt.
+	_, err = q.Upload("test.crash", crash.Report{})
+	assert.Equal(t, ErrorUploadDeferred{testNow.Add(time.Minute)}, err)
+	assert.Equal(t, 1, u.submitted)
+
+	q.Now = func() time.Time { return testNow.Add(time.Minute) }
+	status, err = q.Upload("test.crash", crash.Report{})
+	assert.Nil(t, err)
+	assert.Equal(t, UploadUploaded, status.State)
+	assert.Equal(t, 0, status.Attempts)
+}
+
+func TestUploadQueueHonoursRetryAfter(t *testing.T) {
+	store, _, cleanup := newTestStore(t)
+	defer cleanup()
+
+	u := &scriptedUploader{submits: []error{crash.ErrorHttpStatus{http.StatusTooManyRequests, 2 * time.Hour}}}
+	status, _ := newTestQueue(store, u).Upload("test.crash", crash.Report{})
+	assert.Equal(t, testNow.Add(2*time.Hour), status.NextAttempt)
+}
+
+func TestUploadQueueGivesUpOnClientErrors(t *testing.T) {
+	store, _, cleanup := newTestStore(t)
+	defer cleanup()
+
+	u := &scriptedUploader{submits: []error{crash.ErrorHttpStatus{http.StatusBadRequest, 0}}}
+	q := newTestQueue(store, u)
+
+	status, err := q.Upload("test.crash", crash.Report{})
+	assert.NotNil(t, err)
+	assert.Equal(t, UploadFailed, status.State)
+
+	status, err = q.Upload("test.crash", crash.Report{})
+	assert.Nil(t, err)
+	assert.Equal(t, UploadFailed, status.State)
+	assert.Equal(t, 1, u.submitted)
+}
+
+func TestUploadQueueGivesUpAfterMaxAttempts(t *testing.T) {
+	store, _, cleanup := newTestStore(t)
+	defer cleanup()
+
+	unavailable := crash.ErrorHttpStatus{http.StatusInternalServerError, 0}
+	u := &scriptedUploader{submits: []error{unavailable, unavailable, unavailable}}
+	q := newTestQueue(store, u)
+
+	status := UploadStatus{}
+	for i := 0; i < 3; i++ {
+		status, _ = q.Upload("test.crash", crash.Report{})
+		now := status.NextAttempt
+		q.Now = func() time.Time { return now }
+	}
+
+	assert.Equal(t, UploadFailed, status.State)
+	assert.Equal(t, 3, status.Attempts)
+}
+
+func TestUploadQueueResumesCoreUploadWithoutResubmitting(t *testing.T) {
+	store, name, cleanup := newTestStore(t)
+	defer cleanup()
+
+	u := &scriptedUploader{
+		submits: []error{nil},
+		cores:   []error{crash.ErrorHttpStatus{http.StatusBadGateway, 0}, nil},
+		result:  crash.SubmitResult{"1234-abcd", true},
+	}
+	q := newTestQueue(store, u)
+
+	status, err := q.Upload(name, crash.Report{})
+	assert.NotNil(t, err)
+	assert.Equal(t, UploadCoreRequested, status.State)
+	assert.Equal(t, "1234-abcd", status.OopsId)
+
+	// A new queue picks up the persisted state, e.g., after a reboot.
+	q = newTestQueue(store, u)
+	q.Now = func() time.Time { return testNow.Add(time.Hour) }
+
+	status, err = q.Upload(name, crash.Report{})
+	assert.Nil(t, err)
+	assert.Equal(t, UploadStatus{State: UploadUploaded, OopsId: "1234-abcd"}, status)
+	assert.Equal(t, 1, u.submitted)
+	assert.Equal(t, 2, u.uploaded)
+	assert.Equal(t, "core dump contents", u.core)
+}
+
+func TestCrashStoreRemovesUploadStatus(t *testing.T) {
+	store, _, cleanup := newTestStore(t)
+	defer cleanup()
+
+	assert.Nil(t, store.SaveUploadStatus("test.crash", UploadStatus{State: UploadUploaded}))
+	assert.Nil(t, store.Remove("test.crash"))
+
+	_, err := os.Stat(filepath.Join(store.Dir, "test.upload.yaml"))
+	assert.True(t, os.IsNotExist(err))
+}